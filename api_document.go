@@ -0,0 +1,418 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/ncardozo92/gapef_swimming_metrics/audit"
+	"github.com/ncardozo92/gapef_swimming_metrics/constants"
+	"github.com/ncardozo92/gapef_swimming_metrics/custom_error"
+	"github.com/ncardozo92/gapef_swimming_metrics/health"
+	"github.com/ncardozo92/gapef_swimming_metrics/listing"
+	"github.com/ncardozo92/gapef_swimming_metrics/metrics"
+	"github.com/ncardozo92/gapef_swimming_metrics/openapi"
+	"github.com/ncardozo92/gapef_swimming_metrics/user"
+)
+
+// the security schemes of the document
+const (
+	SECURITY_BEARER  = "bearerAuth"
+	SECURITY_API_KEY = "apiKeyAuth"
+	SECURITY_METRICS = "metricsToken"
+)
+
+const (
+	TAG_AUTHENTICATION = "Authentication"
+	TAG_USERS          = "Users"
+	TAG_REGISTRATION   = "Registration"
+	TAG_ACCOUNT        = "Account"
+	TAG_SECURITY       = "Security"
+	TAG_AUDIT          = "Audit"
+	TAG_OPERATIONS     = "Operations"
+)
+
+// the operations that need a user token or an API key
+var authenticated = []map[string][]string{{SECURITY_BEARER: {}}, {SECURITY_API_KEY: {}}}
+
+// describes every route of the API, the schemas of the bodies are read from the DTOs so they do not get outdated
+func apiDocument() *openapi.Document {
+	document := openapi.New(openapi.Info{
+		Title:   "GAPEF Swimming Metrics API",
+		Version: health.Version,
+		Description: "The failed responses have a stable code, their texts are in the language of the " +
+			"Accept-Language header (es or en) unless the user chose one. They are sent as RFC 7807 problems to " +
+			"the clients that accept application/problem+json.",
+	})
+
+	document.Components.SecuritySchemes = map[string]openapi.SecurityScheme{
+		SECURITY_BEARER: {Type: "http", Scheme: "bearer", BearerFormat: "JWT",
+			Description: "Token returned by the login"},
+		SECURITY_API_KEY: {Type: "apiKey", In: openapi.IN_HEADER, Name: user.API_KEY_HEADER,
+			Description: "Key of a machine client, created by an admin"},
+		SECURITY_METRICS: {Type: "http", Scheme: "bearer",
+			Description: "Token of the Prometheus scraper, only required when it is configured"},
+	}
+
+	documentAuthentication(document)
+	documentUsers(document)
+	documentRegistration(document)
+	documentAccount(document)
+	documentSecurity(document)
+	documentOperations(document)
+
+	return document
+}
+
+func documentAuthentication(document *openapi.Document) {
+	loginResponses := responses(document, http.StatusOK, "Token of the user, or the challenge of the second factor",
+		document.JSON(user.LoginDTO{}))
+
+	document.Add(http.MethodPost, user.PATH_LOGIN, openapi.Operation{
+		Summary:     "Log in with the username and password",
+		Tags:        []string{TAG_AUTHENTICATION},
+		RequestBody: body(document, user.DTO{}),
+		Responses:   loginResponses,
+	})
+	document.Add(http.MethodPost, user.PATH_LOGIN_2FA, openapi.Operation{
+		Summary:     "Finish the login with a code of the second factor",
+		Tags:        []string{TAG_AUTHENTICATION},
+		RequestBody: body(document, user.TwoFactorLoginDTO{}),
+		Responses:   loginResponses,
+	})
+	document.Add(http.MethodGet, user.PATH_LOGIN_OIDC, openapi.Operation{
+		Summary:   "Start the login with the external identity provider",
+		Tags:      []string{TAG_AUTHENTICATION},
+		Responses: responses(document, http.StatusFound, "Redirection to the identity provider", nil),
+	})
+	document.Add(http.MethodGet, user.PATH_LOGIN_OIDC_CALLBACK, openapi.Operation{
+		Summary: "Finish the login with the external identity provider",
+		Tags:    []string{TAG_AUTHENTICATION},
+		Parameters: []openapi.Parameter{
+			query("code", "Authorization code of the provider"),
+			query("state", "State sent to the provider"),
+			query("error", "Error of the provider"),
+		},
+		Responses: loginResponses,
+	})
+	document.Add(http.MethodGet, user.PATH_JWKS, openapi.Operation{
+		Summary:   "Public keys that verify the tokens",
+		Tags:      []string{TAG_AUTHENTICATION},
+		Responses: responses(document, http.StatusOK, "Key set", document.JSON(user.JwksDTO{})),
+	})
+}
+
+func documentUsers(document *openapi.Document) {
+	document.Add(http.MethodGet, user.PATH_USERS, openapi.Operation{
+		Summary: "List the users",
+		Tags:    []string{TAG_USERS},
+		Parameters: append(listingParameters(user.USER_SORT_FIELDS),
+			enumQuery("role", "Role of the users", roles()...),
+			query("group", "Training group of the users"),
+			enumQuery("active", "Active or inactive users", "true", "false"),
+			query("q", "Text searched at the names, username and email"),
+		),
+		Responses: responses(document, http.StatusOK, "Page of users", document.JSON(listing.Page[user.DTO]{})),
+		Security:  authenticated,
+	})
+	document.Add(http.MethodPost, user.PATH_USERS, openapi.Operation{
+		Summary:     "Create a user",
+		Tags:        []string{TAG_USERS},
+		RequestBody: body(document, user.DTO{}),
+		Responses:   responses(document, http.StatusCreated, "The user was created", nil),
+		Security:    authenticated,
+	})
+	document.Add(http.MethodPost, user.PATH_USERS_IMPORT, openapi.Operation{
+		Summary:     "Create the users of a roster spreadsheet",
+		Description: "Nothing is created when a row is invalid or already exists, the errors of every row are returned",
+		Tags:        []string{TAG_USERS},
+		RequestBody: &openapi.RequestBody{Required: true, Content: map[string]openapi.MediaType{
+			openapi.MIME_MULTIPART: {Schema: &openapi.Schema{Type: "object", Properties: map[string]*openapi.Schema{
+				user.IMPORT_FILE_FIELD:               {Type: "string", Format: "binary"},
+				user.IMPORT_GENERATE_PASSWORDS_FIELD: {Type: "boolean"},
+			}}},
+		}},
+		Responses: responses(document, http.StatusCreated, "The created users", document.JSON(user.ImportResultDTO{})),
+		Security:  authenticated,
+	})
+	document.Add(http.MethodGet, user.PATH_USER, openapi.Operation{
+		Summary:   "Get a user",
+		Tags:      []string{TAG_USERS},
+		Responses: responses(document, http.StatusOK, "The user", document.JSON(user.DTO{})),
+		Security:  authenticated,
+	})
+	document.Add(http.MethodGet, user.PATH_USERS_SEARCH, openapi.Operation{
+		Summary: "Search users by their names, username or email",
+		Tags:    []string{TAG_USERS},
+		Parameters: []openapi.Parameter{
+			{Name: "q", In: openapi.IN_QUERY, Required: true, Schema: &openapi.Schema{Type: "string"},
+				Description: "Searched text, of at least 2 characters"},
+			enumQuery("role", "Role of the users", roles()...),
+			{Name: "limit", In: openapi.IN_QUERY, Schema: &openapi.Schema{Type: "integer"},
+				Description: "Amount of results, between 1 and 50"},
+		},
+		Responses: responses(document, http.StatusOK, "The best matches",
+			document.JSON([]user.SearchResultDTO{})),
+		Security: authenticated,
+	})
+	document.Add(http.MethodPost, user.PATH_USER_ATHLETES, openapi.Operation{
+		Summary:     "Link an athlete to a parent",
+		Tags:        []string{TAG_USERS},
+		RequestBody: body(document, user.LinkAthleteDTO{}),
+		Responses:   responses(document, http.StatusNoContent, "The athlete was linked", nil),
+		Security:    authenticated,
+	})
+}
+
+func documentRegistration(document *openapi.Document) {
+	document.Add(http.MethodPost, user.PATH_SIGNUP, openapi.Operation{
+		Summary:     "Register an athlete",
+		Description: "The athlete can log in after verifying the email and being approved by a coach",
+		Tags:        []string{TAG_REGISTRATION},
+		RequestBody: body(document, user.DTO{}),
+		Responses:   responses(document, http.StatusCreated, "The athlete was registered", nil),
+	})
+	document.Add(http.MethodGet, user.PATH_VERIFY_EMAIL, openapi.Operation{
+		Summary:    "Verify the email with the link sent to it",
+		Tags:       []string{TAG_REGISTRATION},
+		Parameters: []openapi.Parameter{query("token", "Token of the verification link")},
+		Responses: responses(document, http.StatusOK, "The email was verified", map[string]openapi.MediaType{
+			openapi.MIME_TEXT: {Schema: &openapi.Schema{Type: "string"}},
+		}),
+	})
+	document.Add(http.MethodPost, user.PATH_VERIFY_EMAIL_RESEND, openapi.Operation{
+		Summary:     "Send the verification link again",
+		Tags:        []string{TAG_REGISTRATION},
+		RequestBody: body(document, user.ResendVerificationDTO{}),
+		Responses:   responses(document, http.StatusAccepted, "The link is sent if the email has an account", nil),
+	})
+	document.Add(http.MethodGet, user.PATH_USERS_PENDING, openapi.Operation{
+		Summary:   "List the athletes waiting for approval",
+		Tags:      []string{TAG_REGISTRATION},
+		Responses: responses(document, http.StatusOK, "The pending athletes", document.JSON([]user.DTO{})),
+		Security:  authenticated,
+	})
+	document.Add(http.MethodPost, user.PATH_USER_APPROVE, openapi.Operation{
+		Summary:     "Approve a pending athlete into a training group",
+		Tags:        []string{TAG_REGISTRATION},
+		RequestBody: body(document, user.ApprovalDTO{}),
+		Responses:   responses(document, http.StatusNoContent, "The athlete was approved", nil),
+		Security:    authenticated,
+	})
+	document.Add(http.MethodPost, user.PATH_USER_REJECT, openapi.Operation{
+		Summary:     "Reject a pending athlete",
+		Tags:        []string{TAG_REGISTRATION},
+		RequestBody: body(document, user.RejectionDTO{}),
+		Responses:   responses(document, http.StatusNoContent, "The athlete was rejected", nil),
+		Security:    authenticated,
+	})
+}
+
+func documentAccount(document *openapi.Document) {
+	document.Add(http.MethodPut, user.PATH_PASSWORD, openapi.Operation{
+		Summary:     "Change the password of the authenticated user",
+		Tags:        []string{TAG_ACCOUNT},
+		RequestBody: body(document, user.PasswordUpdateDTO{}),
+		Responses:   responses(document, http.StatusNoContent, "The password was changed", nil),
+		Security:    authenticated,
+	})
+	document.Add(http.MethodPost, user.PATH_PASSWORD_RESET, openapi.Operation{
+		Summary:     "Send a link to reset the password",
+		Description: "The link opens the front-end page set at APP_PASSWORD_RESET_PAGE_URL, which confirms the reset",
+		Tags:        []string{TAG_ACCOUNT},
+		RequestBody: body(document, user.PasswordResetRequestDTO{}),
+		Responses:   responses(document, http.StatusAccepted, "The link is sent if the email has an account", nil),
+	})
+	document.Add(http.MethodPost, user.PATH_PASSWORD_RESET_CONFIRM, openapi.Operation{
+		Summary:     "Reset the password with the token of the link",
+		Tags:        []string{TAG_ACCOUNT},
+		RequestBody: body(document, user.PasswordResetDTO{}),
+		Responses:   responses(document, http.StatusNoContent, "The password was reset", nil),
+	})
+	document.Add(http.MethodPut, user.PATH_LANGUAGE, openapi.Operation{
+		Summary:     "Choose the language of the texts and emails of the authenticated user",
+		Description: "It replaces the Accept-Language header from the next login on",
+		Tags:        []string{TAG_ACCOUNT},
+		RequestBody: body(document, user.LanguageDTO{}),
+		Responses:   responses(document, http.StatusNoContent, "The language was stored", nil),
+		Security:    authenticated,
+	})
+	document.Add(http.MethodPost, user.PATH_2FA, openapi.Operation{
+		Summary:   "Start the enrolment of the second factor",
+		Tags:      []string{TAG_ACCOUNT},
+		Responses: responses(document, http.StatusOK, "Secret of the authenticator app", document.JSON(user.TwoFactorEnrollmentDTO{})),
+		Security:  authenticated,
+	})
+	document.Add(http.MethodPost, user.PATH_2FA_CONFIRM, openapi.Operation{
+		Summary:     "Enable the second factor with a code of the authenticator app",
+		Tags:        []string{TAG_ACCOUNT},
+		RequestBody: body(document, user.TwoFactorCodeDTO{}),
+		Responses:   responses(document, http.StatusOK, "The recovery codes", document.JSON(user.RecoveryCodesDTO{})),
+		Security:    authenticated,
+	})
+	document.Add(http.MethodDelete, user.PATH_2FA, openapi.Operation{
+		Summary:     "Disable the second factor",
+		Tags:        []string{TAG_ACCOUNT},
+		RequestBody: body(document, user.TwoFactorCodeDTO{}),
+		Responses:   responses(document, http.StatusNoContent, "The second factor was disabled", nil),
+		Security:    authenticated,
+	})
+}
+
+func documentSecurity(document *openapi.Document) {
+	document.Add(http.MethodGet, user.PATH_2FA_POLICY, openapi.Operation{
+		Summary:   "Get the roles that must use the second factor",
+		Tags:      []string{TAG_SECURITY},
+		Responses: responses(document, http.StatusOK, "The policy", document.JSON(user.TwoFactorPolicyDTO{})),
+		Security:  authenticated,
+	})
+	document.Add(http.MethodPut, user.PATH_2FA_POLICY, openapi.Operation{
+		Summary:     "Set the roles that must use the second factor",
+		Tags:        []string{TAG_SECURITY},
+		RequestBody: body(document, user.TwoFactorPolicyDTO{}),
+		Responses:   responses(document, http.StatusOK, "The policy", document.JSON(user.TwoFactorPolicyDTO{})),
+		Security:    authenticated,
+	})
+	document.Add(http.MethodGet, user.PATH_LOCKOUTS, openapi.Operation{
+		Summary:   "List the logins blocked by failed attempts",
+		Tags:      []string{TAG_SECURITY},
+		Responses: responses(document, http.StatusOK, "The lockouts", document.JSON([]user.LockoutDTO{})),
+		Security:  authenticated,
+	})
+	document.Add(http.MethodDelete, user.PATH_LOCKOUT, openapi.Operation{
+		Summary:   "Unblock a login",
+		Tags:      []string{TAG_SECURITY},
+		Responses: responses(document, http.StatusNoContent, "The lockout was removed", nil),
+		Security:  authenticated,
+	})
+	document.Add(http.MethodGet, user.PATH_API_KEYS, openapi.Operation{
+		Summary:   "List the API keys",
+		Tags:      []string{TAG_SECURITY},
+		Responses: responses(document, http.StatusOK, "The API keys", document.JSON([]user.ApiKeyDTO{})),
+		Security:  authenticated,
+	})
+	document.Add(http.MethodPost, user.PATH_API_KEYS, openapi.Operation{
+		Summary:     "Create an API key",
+		Description: "The key is only returned by this response",
+		Tags:        []string{TAG_SECURITY},
+		RequestBody: body(document, user.ApiKeyRequestDTO{}),
+		Responses:   responses(document, http.StatusCreated, "The API key", document.JSON(user.ApiKeyDTO{})),
+		Security:    authenticated,
+	})
+	document.Add(http.MethodDelete, user.PATH_API_KEY, openapi.Operation{
+		Summary:   "Revoke an API key",
+		Tags:      []string{TAG_SECURITY},
+		Responses: responses(document, http.StatusNoContent, "The API key was revoked", nil),
+		Security:  authenticated,
+	})
+
+	auditFilters := []openapi.Parameter{
+		query("actor", "Id of the user or API key that did the action"),
+		query("action", "Recorded action"),
+		query("target_type", "Type of the entity the action was done on"),
+		query("target_id", "Id of the entity the action was done on"),
+		{Name: "from", In: openapi.IN_QUERY, Schema: &openapi.Schema{Type: "string", Format: "date-time"}},
+		{Name: "to", In: openapi.IN_QUERY, Schema: &openapi.Schema{Type: "string", Format: "date-time"}},
+	}
+
+	document.Add(http.MethodGet, audit.PATH_AUDIT, openapi.Operation{
+		Summary:    "Query the audit log",
+		Tags:       []string{TAG_AUDIT},
+		Parameters: append(listingParameters([]string{"timestamp"}), auditFilters...),
+		Responses:  responses(document, http.StatusOK, "Page of entries", document.JSON(listing.Page[audit.Entry]{})),
+		Security:   authenticated,
+	})
+	document.Add(http.MethodGet, audit.PATH_AUDIT_EXPORT, openapi.Operation{
+		Summary:    "Export the audit log",
+		Tags:       []string{TAG_AUDIT},
+		Parameters: append(auditFilters, enumQuery("format", "Format of the file", audit.FORMAT_CSV, audit.FORMAT_JSON)),
+		Responses: responses(document, http.StatusOK, "File with the newest entries", map[string]openapi.MediaType{
+			openapi.MIME_CSV:  {Schema: &openapi.Schema{Type: "string"}},
+			openapi.MIME_JSON: {Schema: document.Schema([]audit.Entry{})},
+		}),
+		Security: authenticated,
+	})
+}
+
+func documentOperations(document *openapi.Document) {
+	probeResponses := responses(document, http.StatusOK, "The application is healthy", document.JSON(health.ReportDTO{}))
+	probeResponses[strconv.Itoa(http.StatusServiceUnavailable)] = openapi.Response{
+		Description: "The application or one of its dependencies is failing", Content: document.JSON(health.ReportDTO{})}
+
+	document.Add(http.MethodGet, health.PATH_HEALTH, openapi.Operation{
+		Summary:   "Liveness probe",
+		Tags:      []string{TAG_OPERATIONS},
+		Responses: probeResponses,
+	})
+	document.Add(http.MethodGet, health.PATH_READY, openapi.Operation{
+		Summary:   "Readiness probe",
+		Tags:      []string{TAG_OPERATIONS},
+		Responses: probeResponses,
+	})
+	document.Add(http.MethodGet, metrics.PATH_METRICS, openapi.Operation{
+		Summary: "Metrics in the Prometheus format",
+		Tags:    []string{TAG_OPERATIONS},
+		Responses: responses(document, http.StatusOK, "The metrics", map[string]openapi.MediaType{
+			openapi.MIME_TEXT: {Schema: &openapi.Schema{Type: "string"}},
+		}),
+		Security: []map[string][]string{{SECURITY_METRICS: {}}},
+	})
+	document.Add(http.MethodGet, openapi.PATH_OPENAPI, openapi.Operation{
+		Summary:   "This document",
+		Tags:      []string{TAG_OPERATIONS},
+		Responses: responses(document, http.StatusOK, "OpenAPI 3 document", document.JSON(map[string]any{})),
+	})
+	document.Add(http.MethodGet, openapi.PATH_DOCS, openapi.Operation{
+		Summary: "Page to browse and try the API",
+		Tags:    []string{TAG_OPERATIONS},
+		Responses: responses(document, http.StatusOK, "Swagger UI", map[string]openapi.MediaType{
+			"text/html": {Schema: &openapi.Schema{Type: "string"}},
+		}),
+	})
+}
+
+// the response of the success status and the errors, which share the body
+func responses(document *openapi.Document, status int, description string,
+	content map[string]openapi.MediaType) map[string]openapi.Response {
+
+	return map[string]openapi.Response{
+		strconv.Itoa(status): {Description: description, Content: content},
+		"default": {Description: "Error, the code tells which one", Content: map[string]openapi.MediaType{
+			openapi.MIME_JSON:              {Schema: document.Schema(custom_error.DTO{})},
+			custom_error.MIME_PROBLEM_JSON: {Schema: document.Schema(custom_error.ProblemDTO{})},
+		}},
+	}
+}
+
+func body(document *openapi.Document, value any) *openapi.RequestBody {
+	return &openapi.RequestBody{Required: true, Content: document.JSON(value)}
+}
+
+func query(name, description string) openapi.Parameter {
+	return openapi.Parameter{Name: name, In: openapi.IN_QUERY, Description: description, Schema: &openapi.Schema{Type: "string"}}
+}
+
+func enumQuery(name, description string, values ...string) openapi.Parameter {
+	parameter := query(name, description)
+	parameter.Schema.Enum = values
+
+	return parameter
+}
+
+// the params of the cursor pagination, the sort fields can be prefixed by "-" to sort in descending order
+func listingParameters(sortFields []string) []openapi.Parameter {
+	sortValues := []string{}
+	for _, field := range sortFields {
+		sortValues = append(sortValues, field, listing.DESCENDING_PREFIX+field)
+	}
+
+	return []openapi.Parameter{
+		query(listing.PARAM_CURSOR, "Cursor of the next page, returned by the previous one"),
+		{Name: listing.PARAM_SIZE, In: openapi.IN_QUERY, Schema: &openapi.Schema{Type: "integer"},
+			Description: "Amount of items of the page, up to " + strconv.Itoa(listing.MAX_SIZE)},
+		enumQuery(listing.PARAM_SORT, "Field to sort by", sortValues...),
+	}
+}
+
+func roles() []string {
+	return []string{constants.ROLE_ADMIN, constants.ROLE_ATLETHE, constants.ROLE_COACH, constants.ROLE_PARENT}
+}
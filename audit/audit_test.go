@@ -0,0 +1,219 @@
+package audit
+
+import (
+	"context"
+	"encoding/csv"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/ncardozo92/gapef_swimming_metrics/listing"
+	"github.com/stretchr/testify/assert"
+)
+
+type account struct {
+	Id       string   `bson:"_id,omitempty"`
+	Username string   `bson:"username"`
+	Password string   `bson:"password"`
+	Group    string   `bson:"group,omitempty"`
+	Grams    []string `bson:"search_grams,omitempty"`
+}
+
+// keeps the entries in memory, the tests do not need a database
+type memoryStore struct {
+	entries   []Entry
+	appendErr error
+}
+
+func (store *memoryStore) Append(ctx context.Context, entry Entry) error {
+	store.entries = append(store.entries, entry)
+
+	return store.appendErr
+}
+
+func (store *memoryStore) Find(ctx context.Context, filter Filter, request listing.Request) (Page, error) {
+	return listing.NewPage(store.entries, int64(len(store.entries)), request, func(entry Entry) (any, string) {
+		return entry.Timestamp, entry.Id
+	})
+}
+
+func (store *memoryStore) FindAll(ctx context.Context, filter Filter, limit int) ([]Entry, error) {
+	return store.entries, nil
+}
+
+func anonymous(c echo.Context) Actor {
+	return Actor{Type: ACTOR_ANONYMOUS}
+}
+
+func TestDiff(t *testing.T) {
+	before := account{Id: "1", Username: "nico", Password: "old hash", Grams: []string{" ni"}}
+	after := account{Id: "1", Username: "nico", Password: "new hash", Group: "A", Grams: []string{" ni", "nic"}}
+
+	changes := Diff(before, after)
+
+	assert.Equal(t, []Change{
+		{Field: "group", Before: nil, After: "A"},
+		{Field: "password", Before: REDACTED, After: REDACTED},
+	}, changes)
+}
+
+func TestDiffCreation(t *testing.T) {
+	changes := Diff(nil, account{Id: "1", Username: "nico", Password: "hash"})
+
+	assert.Equal(t, []Change{
+		{Field: "password", Before: nil, After: REDACTED},
+		{Field: "username", Before: nil, After: "nico"},
+	}, changes)
+}
+
+func TestMiddleware(t *testing.T) {
+	testCases := []struct {
+		name          string
+		method        string
+		handler       echo.HandlerFunc
+		expectedEntry bool
+		expectedActor Actor
+		expectedName  string
+	}{
+		{
+			name:   "records the requests that change data",
+			method: http.MethodPost,
+			handler: func(c echo.Context) error {
+				SetTarget(c, "user", "1")
+				return c.NoContent(http.StatusCreated)
+			},
+			expectedEntry: true,
+			expectedActor: Actor{Type: ACTOR_ANONYMOUS},
+			expectedName:  "POST /users",
+		},
+		{
+			name:   "skips the reads",
+			method: http.MethodGet,
+			handler: func(c echo.Context) error {
+				return c.NoContent(http.StatusOK)
+			},
+		},
+		{
+			name:   "records the reads whose action was set",
+			method: http.MethodGet,
+			handler: func(c echo.Context) error {
+				SetAction(c, "verify_email")
+				SetActor(c, ACTOR_USER, "1", "nico")
+				return c.NoContent(http.StatusOK)
+			},
+			expectedEntry: true,
+			expectedActor: Actor{Type: ACTOR_USER, Id: "1", Name: "nico"},
+			expectedName:  "verify_email",
+		},
+		{
+			name:   "records the failed requests",
+			method: http.MethodDelete,
+			handler: func(c echo.Context) error {
+				return echo.NewHTTPError(http.StatusUnauthorized)
+			},
+			expectedEntry: true,
+			expectedActor: Actor{Type: ACTOR_ANONYMOUS},
+			expectedName:  "DELETE /users",
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			store := &memoryStore{}
+			e := echo.New()
+			e.Any("/users", testCase.handler, Middleware(store, anonymous))
+
+			request := httptest.NewRequest(testCase.method, "/users", nil)
+			request.Header.Set(echo.HeaderXRealIP, "10.0.0.1")
+			recorder := httptest.NewRecorder()
+			e.ServeHTTP(recorder, request)
+
+			if !testCase.expectedEntry {
+				assert.Empty(t, store.entries)
+				return
+			}
+
+			assert.Len(t, store.entries, 1)
+			entry := store.entries[0]
+			assert.Equal(t, testCase.expectedName, entry.Action)
+			assert.Equal(t, testCase.expectedActor, entry.Actor)
+			assert.Equal(t, recorder.Code, entry.Status)
+			assert.Equal(t, "10.0.0.1", entry.Ip)
+			assert.False(t, entry.Timestamp.IsZero())
+		})
+	}
+}
+
+func TestMiddlewareStoreFailure(t *testing.T) {
+	store := &memoryStore{appendErr: errors.New("database down")}
+	e := echo.New()
+	e.POST("/users", func(c echo.Context) error {
+		return c.NoContent(http.StatusCreated)
+	}, Middleware(store, anonymous))
+
+	recorder := httptest.NewRecorder()
+	e.ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, "/users", nil))
+
+	// the request does not fail because the entry could not be recorded
+	assert.Equal(t, http.StatusCreated, recorder.Code)
+}
+
+func TestParseFilter(t *testing.T) {
+	filter, details := ParseFilter(url.Values{"action": {"login"}, "from": {"2024-01-01T00:00:00Z"}})
+
+	assert.Empty(t, details)
+	assert.Equal(t, "login", filter.Action)
+	assert.Equal(t, time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC), *filter.From)
+
+	_, details = ParseFilter(url.Values{"to": {"yesterday"}})
+	assert.Len(t, details, 1)
+}
+
+func TestExportCSV(t *testing.T) {
+	store := &memoryStore{entries: []Entry{
+		{
+			Timestamp: time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC),
+			Actor:     Actor{Type: ACTOR_USER, Id: "1", Name: "nico"},
+			Action:    "login",
+			Ip:        "10.0.0.1",
+			Status:    http.StatusOK,
+		},
+		{
+			Timestamp: time.Date(2024, 1, 1, 11, 0, 0, 0, time.UTC),
+			Actor:     Actor{Type: ACTOR_USER, Id: "1", Name: "nico"},
+			Action:    "POST /users",
+			Target:    Target{Type: "user", Id: "2"},
+			Changes:   []Change{{Field: "group", After: "A"}},
+			Status:    http.StatusCreated,
+		},
+	}}
+
+	e := echo.New()
+	recorder := httptest.NewRecorder()
+	context := e.NewContext(httptest.NewRequest(http.MethodGet, PATH_AUDIT_EXPORT, nil), recorder)
+
+	assert.NoError(t, NewHandler(store).Export(context))
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	assert.Contains(t, recorder.Header().Get(echo.HeaderContentDisposition), ".csv")
+
+	rows, readErr := csv.NewReader(strings.NewReader(recorder.Body.String())).ReadAll()
+
+	assert.NoError(t, readErr)
+	assert.Len(t, rows, 3)
+	assert.Equal(t, csvHeader, rows[0])
+	assert.Equal(t, "", rows[1][9])
+	assert.Equal(t, `[{"field":"group","before":null,"after":"A"}]`, rows[2][9])
+}
+
+func TestExportInvalidFormat(t *testing.T) {
+	e := echo.New()
+	recorder := httptest.NewRecorder()
+	context := e.NewContext(httptest.NewRequest(http.MethodGet, PATH_AUDIT_EXPORT+"?format=xml", nil), recorder)
+
+	assert.ErrorIs(t, NewHandler(&memoryStore{}).Export(context), ErrInvalidQuery)
+}
@@ -0,0 +1,88 @@
+package audit
+
+import (
+	"reflect"
+	"sort"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// value recorded instead of the secrets, so the log shows they changed without storing them
+const REDACTED = "[REDACTED]"
+
+// fields that are never stored at the log, named as they are stored at the database
+var secretFields = map[string]bool{
+	"password":       true,
+	"totp_secret":    true,
+	"recovery_codes": true,
+	"hash":           true,
+}
+
+// fields that are derived from others, their changes are not interesting
+var ignoredFields = map[string]bool{
+	"_id":          true,
+	"search_grams": true,
+}
+
+// Diff compares two versions of an entity field by field, using their database representation. Before is nil for a
+// creation and after is nil for a deletion
+func Diff(before, after any) []Change {
+	beforeFields := toFields(before)
+	afterFields := toFields(after)
+
+	fieldNames := map[string]bool{}
+	for field := range beforeFields {
+		fieldNames[field] = true
+	}
+	for field := range afterFields {
+		fieldNames[field] = true
+	}
+
+	changes := []Change{}
+
+	for field := range fieldNames {
+		beforeValue, afterValue := beforeFields[field], afterFields[field]
+
+		if ignoredFields[field] || reflect.DeepEqual(beforeValue, afterValue) {
+			continue
+		}
+
+		if secretFields[field] {
+			beforeValue, afterValue = redact(beforeValue), redact(afterValue)
+		}
+
+		changes = append(changes, Change{Field: field, Before: beforeValue, After: afterValue})
+	}
+
+	sort.Slice(changes, func(i, j int) bool {
+		return changes[i].Field < changes[j].Field
+	})
+
+	return changes
+}
+
+func toFields(entity any) bson.M {
+	fields := bson.M{}
+
+	if entity == nil {
+		return fields
+	}
+
+	document, marshalErr := bson.Marshal(entity)
+
+	if marshalErr != nil {
+		return fields
+	}
+
+	bson.Unmarshal(document, &fields)
+
+	return fields
+}
+
+func redact(value any) any {
+	if value == nil {
+		return nil
+	}
+
+	return REDACTED
+}
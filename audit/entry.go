@@ -0,0 +1,131 @@
+// Package audit records who did what on the application: the logins and every request that changes data
+package audit
+
+import (
+	"net/url"
+	"time"
+
+	"github.com/ncardozo92/gapef_swimming_metrics/i18n"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+const (
+	ACTOR_USER      = "user"
+	ACTOR_API_KEY   = "api_key"
+	ACTOR_ANONYMOUS = "anonymous"
+
+	DETAIL_INVALID_FROM = "La fecha from debe tener el formato RFC 3339"
+	DETAIL_INVALID_TO   = "La fecha to debe tener el formato RFC 3339"
+
+	CODE_INVALID_FROM = "invalid_from_date"
+	CODE_INVALID_TO   = "invalid_to_date"
+)
+
+// Entry is a recorded action, the entries are never modified once stored
+type Entry struct {
+	Id        string    `bson:"_id,omitempty" json:"id"`
+	Timestamp time.Time `bson:"timestamp" json:"timestamp"`
+	Actor     Actor     `bson:"actor" json:"actor"`
+	Action    string    `bson:"action" json:"action"`
+	Target    Target    `bson:"target,omitempty" json:"target,omitempty"`
+	Changes   []Change  `bson:"changes,omitempty" json:"changes,omitempty"`
+	Ip        string    `bson:"ip" json:"ip"`
+	// status of the response, tells if the action succeeded
+	Status int `bson:"status" json:"status"`
+}
+
+// Actor is who did the action
+type Actor struct {
+	Id   string `bson:"id,omitempty" json:"id,omitempty"`
+	Type string `bson:"type" json:"type"`
+	// username of the user or name of the API key
+	Name string `bson:"name,omitempty" json:"name,omitempty"`
+}
+
+// Target is the entity the action was done on
+type Target struct {
+	Type string `bson:"type,omitempty" json:"type,omitempty"`
+	Id   string `bson:"id,omitempty" json:"id,omitempty"`
+}
+
+// Change is the value of a field before and after the action
+type Change struct {
+	Field  string `bson:"field" json:"field"`
+	Before any    `bson:"before" json:"before"`
+	After  any    `bson:"after" json:"after"`
+}
+
+// Filter selects the entries of a query or export, the empty fields do not filter
+type Filter struct {
+	ActorId    string
+	Action     string
+	TargetType string
+	TargetId   string
+	From       *time.Time
+	To         *time.Time
+}
+
+// ParseFilter reads the filter from the actor, action, target_type, target_id, from and to query params
+func ParseFilter(query url.Values) (Filter, []i18n.Message) {
+	details := []i18n.Message{}
+	filter := Filter{
+		ActorId:    query.Get("actor"),
+		Action:     query.Get("action"),
+		TargetType: query.Get("target_type"),
+		TargetId:   query.Get("target_id"),
+	}
+
+	if from := query.Get("from"); from != "" {
+		if parsedFrom, parsingErr := time.Parse(time.RFC3339, from); parsingErr != nil {
+			details = append(details, i18n.NewMessage(CODE_INVALID_FROM))
+		} else {
+			filter.From = &parsedFrom
+		}
+	}
+
+	if to := query.Get("to"); to != "" {
+		if parsedTo, parsingErr := time.Parse(time.RFC3339, to); parsingErr != nil {
+			details = append(details, i18n.NewMessage(CODE_INVALID_TO))
+		} else {
+			filter.To = &parsedTo
+		}
+	}
+
+	return filter, details
+}
+
+func (filter Filter) query() bson.D {
+	query := bson.D{}
+
+	if filter.ActorId != "" {
+		query = append(query, bson.E{Key: "actor.id", Value: filter.ActorId})
+	}
+
+	if filter.Action != "" {
+		query = append(query, bson.E{Key: "action", Value: filter.Action})
+	}
+
+	if filter.TargetType != "" {
+		query = append(query, bson.E{Key: "target.type", Value: filter.TargetType})
+	}
+
+	if filter.TargetId != "" {
+		query = append(query, bson.E{Key: "target.id", Value: filter.TargetId})
+	}
+
+	if filter.From != nil || filter.To != nil {
+		period := bson.D{}
+
+		if filter.From != nil {
+			period = append(period, bson.E{Key: "$gte", Value: *filter.From})
+		}
+
+		if filter.To != nil {
+			period = append(period, bson.E{Key: "$lt", Value: *filter.To})
+		}
+
+		query = append(query, bson.E{Key: "timestamp", Value: period})
+	}
+
+	return query
+}
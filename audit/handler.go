@@ -0,0 +1,149 @@
+package audit
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/ncardozo92/gapef_swimming_metrics/custom_error"
+	"github.com/ncardozo92/gapef_swimming_metrics/i18n"
+	"github.com/ncardozo92/gapef_swimming_metrics/listing"
+	"github.com/ncardozo92/gapef_swimming_metrics/logging"
+	"github.com/ncardozo92/gapef_swimming_metrics/persistence"
+)
+
+const (
+	PATH_AUDIT        = "/audit"
+	PATH_AUDIT_EXPORT = "/audit/export"
+
+	FORMAT_CSV  = "csv"
+	FORMAT_JSON = "json"
+	// the export has the newest entries up to this amount, older ones are exported narrowing the dates
+	MAX_EXPORT_ENTRIES = 10000
+
+	MESSAGE_INVALID_QUERY         = "La consulta de auditoría posee datos inválidos"
+	MESSAGE_CANNOT_RETRIEVE_AUDIT = "No se pudo recuperar el registro de auditoría"
+	DETAIL_INVALID_FORMAT         = "El formato debe ser csv o json"
+
+	CODE_INVALID_QUERY         = "invalid_audit_query"
+	CODE_CANNOT_RETRIEVE_AUDIT = "cannot_retrieve_audit"
+	CODE_INVALID_FORMAT        = "invalid_export_format"
+)
+
+var (
+	ErrInvalidQuery        = custom_error.New(http.StatusBadRequest, CODE_INVALID_QUERY, MESSAGE_INVALID_QUERY)
+	ErrCannotRetrieveAudit = custom_error.New(http.StatusInternalServerError, CODE_CANNOT_RETRIEVE_AUDIT,
+		MESSAGE_CANNOT_RETRIEVE_AUDIT)
+)
+
+var csvHeader = []string{"timestamp", "actor_type", "actor_id", "actor_name", "action", "target_type", "target_id",
+	"ip", "status", "changes"}
+
+type Handler struct {
+	store Store
+}
+
+// Returns a new instance of Handler
+func NewHandler(store Store) *Handler {
+	return &Handler{store: store}
+}
+
+// GetEntries returns a page of the entries that match the filters, the newest first
+func (handler Handler) GetEntries(context echo.Context) error {
+	request, details := listing.ParseRequest(context.QueryParams(), []string{"timestamp"}, "-timestamp")
+	filter, filterDetails := ParseFilter(context.QueryParams())
+
+	if details = append(details, filterDetails...); len(details) > 0 {
+		logging.LogErrorContext(context.Request().Context(), "invalid audit query, %v", details)
+		return ErrInvalidQuery.WithDetails(details...)
+	}
+
+	page, findErr := handler.store.Find(context.Request().Context(), filter, request)
+
+	if findErr != nil {
+		logging.LogErrorContext(context.Request().Context(), "could not retrieve the audit entries, %v", findErr)
+		return storeError(findErr)
+	}
+
+	return context.JSON(http.StatusOK, page)
+}
+
+// Export downloads the entries that match the filters as a CSV or JSON file
+func (handler Handler) Export(context echo.Context) error {
+	filter, details := ParseFilter(context.QueryParams())
+	format := context.QueryParam("format")
+
+	if format == "" {
+		format = FORMAT_CSV
+	}
+
+	if format != FORMAT_CSV && format != FORMAT_JSON {
+		details = append(details, i18n.NewMessage(CODE_INVALID_FORMAT))
+	}
+
+	if len(details) > 0 {
+		logging.LogErrorContext(context.Request().Context(), "invalid audit export, %v", details)
+		return ErrInvalidQuery.WithDetails(details...)
+	}
+
+	entries, findErr := handler.store.FindAll(context.Request().Context(), filter, MAX_EXPORT_ENTRIES)
+
+	if findErr != nil {
+		logging.LogErrorContext(context.Request().Context(), "could not retrieve the audit entries, %v", findErr)
+		return storeError(findErr)
+	}
+
+	filename := "audit-" + time.Now().UTC().Format("20060102-150405") + "." + format
+	context.Response().Header().Set(echo.HeaderContentDisposition, "attachment; filename=\""+filename+"\"")
+
+	if format == FORMAT_JSON {
+		return context.JSON(http.StatusOK, entries)
+	}
+
+	context.Response().Header().Set(echo.HeaderContentType, "text/csv; charset=utf-8")
+	context.Response().WriteHeader(http.StatusOK)
+
+	writer := csv.NewWriter(context.Response())
+	writer.Write(csvHeader)
+
+	for _, entry := range entries {
+		changes := []byte{}
+		if len(entry.Changes) > 0 {
+			changes, _ = json.Marshal(entry.Changes)
+		}
+
+		writer.Write([]string{
+			entry.Timestamp.Format(time.RFC3339),
+			entry.Actor.Type,
+			entry.Actor.Id,
+			entry.Actor.Name,
+			entry.Action,
+			entry.Target.Type,
+			entry.Target.Id,
+			entry.Ip,
+			strconv.Itoa(entry.Status),
+			string(changes),
+		})
+	}
+
+	writer.Flush()
+
+	return writer.Error()
+}
+
+// the queries that timed out are answered with a 504 so the client knows it can retry, the ones canceled by the
+// client are not failures of the server
+func storeError(storeErr error) *custom_error.Error {
+	if persistence.IsCanceled(storeErr) {
+		return custom_error.ErrCanceled.Wrap(storeErr)
+	}
+
+	if persistence.IsTimeout(storeErr) {
+		return custom_error.ErrTimeout.Wrap(storeErr)
+	}
+
+	return ErrCannotRetrieveAudit.Wrap(storeErr)
+}
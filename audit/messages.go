@@ -0,0 +1,13 @@
+package audit
+
+import "github.com/ncardozo92/gapef_swimming_metrics/i18n"
+
+func init() {
+	i18n.Register(map[string]i18n.Translation{
+		CODE_INVALID_QUERY:         {Es: MESSAGE_INVALID_QUERY, En: "The audit query has invalid data"},
+		CODE_CANNOT_RETRIEVE_AUDIT: {Es: MESSAGE_CANNOT_RETRIEVE_AUDIT, En: "The audit log could not be retrieved"},
+		CODE_INVALID_FORMAT:        {Es: DETAIL_INVALID_FORMAT, En: "The format must be csv or json"},
+		CODE_INVALID_FROM:          {Es: DETAIL_INVALID_FROM, En: "The from date must have the RFC 3339 format"},
+		CODE_INVALID_TO:            {Es: DETAIL_INVALID_TO, En: "The to date must have the RFC 3339 format"},
+	})
+}
@@ -0,0 +1,97 @@
+package audit
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/ncardozo92/gapef_swimming_metrics/logging"
+)
+
+// key of the echo context where the middleware keeps the entry that the handlers complete
+const CONTEXT_ENTRY = "audit_entry"
+
+// ActorResolver returns who made the request, from the credentials the authentication middleware validated
+type ActorResolver func(c echo.Context) Actor
+
+// Middleware records an entry for every request that changes data and for the requests whose handler described
+// the action, like the logins. It must wrap the authentication middleware, so the rejected requests are recorded too
+func Middleware(store Store, resolveActor ActorResolver) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			entry := &Entry{}
+			c.Set(CONTEXT_ENTRY, entry)
+
+			err := next(c)
+
+			if err != nil {
+				c.Error(err)
+			}
+
+			if !isMutating(c.Request().Method) && entry.Action == "" {
+				return nil
+			}
+
+			entry.Timestamp = time.Now().UTC()
+			entry.Ip = c.RealIP()
+			entry.Status = c.Response().Status
+
+			if entry.Action == "" {
+				entry.Action = c.Request().Method + " " + c.Path()
+			}
+
+			// the handlers set the actor when the request has no credentials, like a login
+			if entry.Actor.Type == "" {
+				entry.Actor = resolveActor(c)
+			}
+
+			// the entry is recorded even when the client already disconnected
+			if appendErr := store.Append(context.WithoutCancel(c.Request().Context()), *entry); appendErr != nil {
+				logging.LogErrorContext(c.Request().Context(), "could not record the audit entry %s, %v", entry.Action, appendErr)
+			}
+
+			return nil
+		}
+	}
+}
+
+// SetAction names the action of the request, the requests that do not change data are only recorded when it is set
+func SetAction(c echo.Context, action string) {
+	if entry := getEntry(c); entry != nil {
+		entry.Action = action
+	}
+}
+
+// SetActor sets who made the request, for the actions that authenticate the user
+func SetActor(c echo.Context, actorType, id, name string) {
+	if entry := getEntry(c); entry != nil {
+		entry.Actor = Actor{Type: actorType, Id: id, Name: name}
+	}
+}
+
+// SetTarget sets the entity the action was done on
+func SetTarget(c echo.Context, targetType, id string) {
+	if entry := getEntry(c); entry != nil {
+		entry.Target = Target{Type: targetType, Id: id}
+	}
+}
+
+// SetChanges records the difference between the entity before and after the action
+func SetChanges(c echo.Context, before, after any) {
+	if entry := getEntry(c); entry != nil {
+		entry.Changes = Diff(before, after)
+	}
+}
+
+// the entry is missing when the request did not go through the middleware, like in the handler tests
+func getEntry(c echo.Context) *Entry {
+	entry, _ := c.Get(CONTEXT_ENTRY).(*Entry)
+
+	return entry
+}
+
+func isMutating(method string) bool {
+	return method == http.MethodPost || method == http.MethodPut || method == http.MethodPatch ||
+		method == http.MethodDelete
+}
@@ -0,0 +1,109 @@
+package audit
+
+import (
+	"context"
+
+	"github.com/ncardozo92/gapef_swimming_metrics/listing"
+	"github.com/ncardozo92/gapef_swimming_metrics/persistence"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	AUDIT_COLLECTION = "audit_log"
+	// name of the operations of the store at the metrics and traces
+	REPOSITORY_NAME = "audit"
+)
+
+// Page is a page of an entries query
+type Page = listing.Page[Entry]
+
+// Store keeps the entries. It is append only, there is no way to modify or remove an entry
+type Store interface {
+	Append(ctx context.Context, entry Entry) error
+	Find(ctx context.Context, filter Filter, request listing.Request) (Page, error)
+	// returns the newest entries that match the filter, at most limit of them
+	FindAll(ctx context.Context, filter Filter, limit int) ([]Entry, error)
+}
+
+type MongoStore struct {
+	Database *mongo.Database
+}
+
+// creates a MongoStore
+func NewMongoStore(database *mongo.Database) *MongoStore {
+	return &MongoStore{Database: database}
+}
+
+func (store MongoStore) Append(ctx context.Context, entry Entry) (err error) {
+	ctx, done := persistence.StartOperation(ctx, REPOSITORY_NAME, "Append")
+	defer func() { done(err) }()
+
+	_, insertErr := store.Database.Collection(AUDIT_COLLECTION).InsertOne(ctx, entry)
+
+	return insertErr
+}
+
+func (store MongoStore) Find(ctx context.Context, filter Filter, request listing.Request) (_ Page, err error) {
+	ctx, done := persistence.StartOperation(ctx, REPOSITORY_NAME, "Find")
+	defer func() { done(err) }()
+
+	collection := store.Database.Collection(AUDIT_COLLECTION)
+	query := filter.query()
+
+	total, countErr := collection.CountDocuments(ctx, query)
+
+	if countErr != nil {
+		return Page{}, countErr
+	}
+
+	entriesCursor, findErr := collection.Find(ctx, bson.D{{Key: "$and", Value: bson.A{query, request.Filter()}}},
+		request.FindOptions())
+
+	if findErr != nil {
+		return Page{}, findErr
+	}
+
+	entries := []Entry{}
+
+	if cursorErr := entriesCursor.All(ctx, &entries); cursorErr != nil {
+		return Page{}, cursorErr
+	}
+
+	return listing.NewPage(entries, total, request, func(entry Entry) (any, string) {
+		return entry.Timestamp, entry.Id
+	})
+}
+
+func (store MongoStore) FindAll(ctx context.Context, filter Filter, limit int) (_ []Entry, err error) {
+	ctx, done := persistence.StartOperation(ctx, REPOSITORY_NAME, "FindAll")
+	defer func() { done(err) }()
+
+	findOptions := options.Find().SetSort(bson.D{{Key: "timestamp", Value: -1}}).SetLimit(int64(limit))
+
+	entriesCursor, findErr := store.Database.Collection(AUDIT_COLLECTION).Find(ctx, filter.query(), findOptions)
+
+	if findErr != nil {
+		return nil, findErr
+	}
+
+	entries := []Entry{}
+
+	if cursorErr := entriesCursor.All(ctx, &entries); cursorErr != nil {
+		return nil, cursorErr
+	}
+
+	return entries, nil
+}
+
+// EnsureIndexes creates the indexes of the queries by date, actor and target
+func (store MongoStore) EnsureIndexes() error {
+	_, indexErr := store.Database.Collection(AUDIT_COLLECTION).Indexes().CreateMany(context.TODO(), []mongo.IndexModel{
+		{Keys: bson.D{{Key: "timestamp", Value: -1}, {Key: "_id", Value: -1}}},
+		{Keys: bson.D{{Key: "actor.id", Value: 1}, {Key: "timestamp", Value: -1}}},
+		{Keys: bson.D{{Key: "target.type", Value: 1}, {Key: "target.id", Value: 1}, {Key: "timestamp", Value: -1}}},
+	})
+
+	return indexErr
+}
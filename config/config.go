@@ -0,0 +1,484 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	ENV_DEVELOPMENT = "development"
+	ENV_PRODUCTION  = "production"
+	// the flag kept from the first versions, it is the same as APP_ENV=development
+	DEV_FLAG = "--dev"
+
+	LOG_LEVEL_INFO    = "info"
+	LOG_LEVEL_WARNING = "warning"
+	LOG_LEVEL_ERROR   = "error"
+
+	LOG_FORMAT_JSON = "json"
+	LOG_FORMAT_TEXT = "text"
+
+	TRACING_EXPORTER_NONE   = "none"
+	TRACING_EXPORTER_STDOUT = "stdout"
+	TRACING_EXPORTER_OTLP   = "otlp"
+)
+
+// Config has every setting of the application, loaded once at startup
+type Config struct {
+	Env       string
+	Server    Server
+	Mongo     Mongo
+	Jwt       Jwt
+	Mail      Mail
+	Oidc      Oidc
+	Password  Password
+	Metrics   Metrics
+	Log       Log
+	Tracing   Tracing
+	RateLimit RateLimit
+}
+
+type Server struct {
+	Port int
+	// the public address of the application, used to build the links sent by email
+	BaseUrl string
+	// page of the front-end that asks for the new password, the reset emails link to it with the token in the query
+	PasswordResetPageUrl string
+	// how long the requests in progress can take to finish when the application stops
+	ShutdownTimeout time.Duration
+	// how long the application keeps serving after it is asked to stop, answering that it is not ready, so the load
+	// balancer takes it out before it stops accepting requests
+	DrainDelay time.Duration
+	// the client address is read from X-Forwarded-For only when the request comes from one of these ranges, without
+	// them it is the address of the connection
+	TrustedProxies []*net.IPNet
+}
+
+type Mongo struct {
+	Host             string
+	Port             string
+	User             string
+	Password         string
+	Database         string
+	OperationTimeout time.Duration
+	// the operations that need another limit than OperationTimeout, by repository and operation like users.CreateMany
+	OperationTimeouts map[string]time.Duration
+	// the server is pinged at startup until it answers, waiting ConnectBackoff after the first failure and twice as
+	// long after each of the next ones
+	ConnectAttempts int
+	ConnectBackoff  time.Duration
+}
+
+type Jwt struct {
+	Algorithm string
+	// where the signing keys are stored. Without it the keys only live in memory, each replica has its own and
+	// cannot verify the tokens of the others, so the replicas must share this directory
+	KeysDir string
+	// how often the signing key is replaced and how long a replaced key still verifies tokens
+	KeyRotationInterval   time.Duration
+	KeyVerificationPeriod time.Duration
+	AccessTokenLifetime   time.Duration
+	// lifetime of the links sent by email
+	EmailVerificationLifetime time.Duration
+	PasswordResetLifetime     time.Duration
+}
+
+// the emails are logged instead of sent when there is no SMTP host
+type Mail struct {
+	SmtpHost string
+	SmtpPort string
+	SmtpUser string
+	SmtpPass string
+	From     string
+}
+
+// the login with an external provider is disabled when there is no issuer
+type Oidc struct {
+	Issuer       string
+	ClientId     string
+	ClientSecret string
+	RedirectUrl  string
+}
+
+type Password struct {
+	MinLength     int
+	RequireLower  bool
+	RequireUpper  bool
+	RequireDigit  bool
+	RequireSymbol bool
+	BreachedFile  string
+}
+
+// the metrics are public when there is no token
+type Metrics struct {
+	Token string
+}
+
+type Log struct {
+	// the lines below this level are not written
+	Level string
+	// json or text, text is easier to read in development
+	Format string
+}
+
+// the spans are exported to an OTLP collector, printed for local runs or not recorded
+type Tracing struct {
+	Exporter     string
+	OtlpEndpoint string
+	ServiceName  string
+}
+
+// the requests of each client are limited by the policy of the route, the authentication routes and the listings
+// have their own ones
+type RateLimit struct {
+	Enabled bool
+	Default Rate
+	Auth    Rate
+	Listing Rate
+	// the limit of every ip, checked before the authentication so the rejected credentials count too
+	Ip Rate
+}
+
+// Rate allows a burst of Requests that is refilled during Period, it is written like 10/1m
+type Rate struct {
+	Requests int
+	Period   time.Duration
+}
+
+// IsDev checks if the application runs in a development environment
+func (config Config) IsDev() bool {
+	return config.Env == ENV_DEVELOPMENT
+}
+
+// Address is the address the server listens to
+func (server Server) Address() string {
+	return ":" + strconv.Itoa(server.Port)
+}
+
+// Report lists the settings that are missing or cannot be parsed, so all of them can be fixed at once
+type Report struct {
+	Missing []string
+	Invalid []string
+}
+
+func (report Report) Error() string {
+	lines := []string{"the configuration is not valid"}
+
+	if len(report.Missing) > 0 {
+		lines = append(lines, "missing settings: "+strings.Join(report.Missing, ", "))
+	}
+
+	for _, invalid := range report.Invalid {
+		lines = append(lines, "invalid setting "+invalid)
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+func (report Report) isEmpty() bool {
+	return len(report.Missing) == 0 && len(report.Invalid) == 0
+}
+
+// a setting read from the sources by its key, the fallback is used when no source has it
+type setting struct {
+	key      string
+	required bool
+	fallback string
+	bind     func(value string) error
+}
+
+// Load reads the configuration of the process. The sources, from the highest precedence to the lowest, are the
+// environment variables, the .env file, only read with --dev, and the YAML file set by --config=<path> or
+// CONFIG_FILE. Empty values are treated as not set
+func Load(args []string) (Config, error) {
+	return load(args, os.Environ(), DOTENV_FILE)
+}
+
+func load(args, environ []string, dotenvPath string) (Config, error) {
+	values, sourcesErr := readSources(args, environ, dotenvPath)
+
+	if sourcesErr != nil {
+		return Config{}, sourcesErr
+	}
+
+	config := Config{}
+	report := Report{}
+
+	for _, setting := range config.settings() {
+		value := values[setting.key]
+
+		if value == "" && setting.required {
+			report.Missing = append(report.Missing, setting.key)
+			continue
+		}
+
+		if value == "" {
+			value = setting.fallback
+		}
+
+		if value == "" {
+			continue
+		}
+
+		if bindErr := setting.bind(value); bindErr != nil {
+			report.Invalid = append(report.Invalid, fmt.Sprintf("%s=%q, %v", setting.key, value, bindErr))
+		}
+	}
+
+	if hasFlag(args, DEV_FLAG) {
+		config.Env = ENV_DEVELOPMENT
+	}
+
+	// the text lines are easier to read in development, the JSON ones are easier to search in production
+	if config.Log.Format == "" && config.IsDev() {
+		config.Log.Format = LOG_FORMAT_TEXT
+	} else if config.Log.Format == "" {
+		config.Log.Format = LOG_FORMAT_JSON
+	}
+
+	config.validate(&report)
+
+	if !report.isEmpty() {
+		return config, report
+	}
+
+	return config, nil
+}
+
+// the settings of every field, the key is the name of the environment variable
+func (config *Config) settings() []setting {
+	return []setting{
+		{key: "APP_ENV", fallback: ENV_PRODUCTION, bind: stringSetting(&config.Env)},
+		{key: "APP_PORT", fallback: "8080", bind: intSetting(&config.Server.Port)},
+		{key: "APP_BASE_URL", required: true, bind: urlSetting(&config.Server.BaseUrl)},
+		{key: "APP_PASSWORD_RESET_PAGE_URL", required: true, bind: urlSetting(&config.Server.PasswordResetPageUrl)},
+		{key: "APP_SHUTDOWN_TIMEOUT", fallback: "15s", bind: durationSetting(&config.Server.ShutdownTimeout)},
+		{key: "APP_SHUTDOWN_DRAIN_DELAY", fallback: "5s", bind: durationSetting(&config.Server.DrainDelay)},
+		{key: "APP_TRUSTED_PROXIES", bind: ipRangesSetting(&config.Server.TrustedProxies)},
+
+		{key: "MONGODB_HOST", required: true, bind: stringSetting(&config.Mongo.Host)},
+		{key: "MONGODB_PORT", fallback: "27017", bind: stringSetting(&config.Mongo.Port)},
+		{key: "MONGODB_USER", required: true, bind: stringSetting(&config.Mongo.User)},
+		{key: "MONGODB_PASS", required: true, bind: stringSetting(&config.Mongo.Password)},
+		{key: "MONGODB_DATABASE_NAME", fallback: "gapef_swimming_metrics", bind: stringSetting(&config.Mongo.Database)},
+		{key: "MONGODB_OPERATION_TIMEOUT", fallback: "5s", bind: durationSetting(&config.Mongo.OperationTimeout)},
+		{key: "MONGODB_OPERATION_TIMEOUTS", bind: durationsSetting(&config.Mongo.OperationTimeouts)},
+		{key: "MONGODB_CONNECT_ATTEMPTS", fallback: "5", bind: intSetting(&config.Mongo.ConnectAttempts)},
+		{key: "MONGODB_CONNECT_BACKOFF", fallback: "1s", bind: durationSetting(&config.Mongo.ConnectBackoff)},
+
+		{key: "JWT_ALGORITHM", fallback: "EdDSA", bind: stringSetting(&config.Jwt.Algorithm)},
+		{key: "JWT_KEYS_DIR", bind: stringSetting(&config.Jwt.KeysDir)},
+		{key: "JWT_KEY_ROTATION_INTERVAL", fallback: "168h", bind: durationSetting(&config.Jwt.KeyRotationInterval)},
+		{key: "JWT_KEY_VERIFICATION_PERIOD", fallback: "48h", bind: durationSetting(&config.Jwt.KeyVerificationPeriod)},
+		{key: "JWT_ACCESS_TOKEN_LIFETIME", fallback: "3m", bind: durationSetting(&config.Jwt.AccessTokenLifetime)},
+		{key: "EMAIL_VERIFICATION_LINK_LIFETIME", fallback: "24h", bind: durationSetting(&config.Jwt.EmailVerificationLifetime)},
+		{key: "PASSWORD_RESET_LINK_LIFETIME", fallback: "30m", bind: durationSetting(&config.Jwt.PasswordResetLifetime)},
+
+		{key: "MAIL_SMTP_HOST", bind: stringSetting(&config.Mail.SmtpHost)},
+		{key: "MAIL_SMTP_PORT", fallback: "587", bind: stringSetting(&config.Mail.SmtpPort)},
+		{key: "MAIL_SMTP_USER", bind: stringSetting(&config.Mail.SmtpUser)},
+		{key: "MAIL_SMTP_PASS", bind: stringSetting(&config.Mail.SmtpPass)},
+		{key: "MAIL_FROM", bind: stringSetting(&config.Mail.From)},
+
+		{key: "OIDC_ISSUER", bind: stringSetting(&config.Oidc.Issuer)},
+		{key: "OIDC_CLIENT_ID", bind: stringSetting(&config.Oidc.ClientId)},
+		{key: "OIDC_CLIENT_SECRET", bind: stringSetting(&config.Oidc.ClientSecret)},
+		{key: "OIDC_REDIRECT_URL", bind: stringSetting(&config.Oidc.RedirectUrl)},
+
+		{key: "PASSWORD_MIN_LENGTH", fallback: "10", bind: intSetting(&config.Password.MinLength)},
+		{key: "PASSWORD_REQUIRE_LOWER", fallback: "true", bind: boolSetting(&config.Password.RequireLower)},
+		{key: "PASSWORD_REQUIRE_UPPER", fallback: "true", bind: boolSetting(&config.Password.RequireUpper)},
+		{key: "PASSWORD_REQUIRE_DIGIT", fallback: "true", bind: boolSetting(&config.Password.RequireDigit)},
+		{key: "PASSWORD_REQUIRE_SYMBOL", fallback: "false", bind: boolSetting(&config.Password.RequireSymbol)},
+		{key: "PASSWORD_BREACHED_FILE", bind: stringSetting(&config.Password.BreachedFile)},
+
+		{key: "METRICS_TOKEN", bind: stringSetting(&config.Metrics.Token)},
+
+		{key: "LOG_LEVEL", fallback: LOG_LEVEL_INFO, bind: stringSetting(&config.Log.Level)},
+		{key: "LOG_FORMAT", bind: stringSetting(&config.Log.Format)},
+
+		{key: "TRACING_EXPORTER", fallback: TRACING_EXPORTER_NONE, bind: stringSetting(&config.Tracing.Exporter)},
+		{key: "TRACING_OTLP_ENDPOINT", bind: stringSetting(&config.Tracing.OtlpEndpoint)},
+		{key: "TRACING_SERVICE_NAME", fallback: "gapef_swimming_metrics", bind: stringSetting(&config.Tracing.ServiceName)},
+
+		{key: "RATE_LIMIT_ENABLED", fallback: "true", bind: boolSetting(&config.RateLimit.Enabled)},
+		{key: "RATE_LIMIT_DEFAULT", fallback: "300/1m", bind: rateSetting(&config.RateLimit.Default)},
+		{key: "RATE_LIMIT_AUTH", fallback: "10/1m", bind: rateSetting(&config.RateLimit.Auth)},
+		{key: "RATE_LIMIT_LISTING", fallback: "60/1m", bind: rateSetting(&config.RateLimit.Listing)},
+		{key: "RATE_LIMIT_IP", fallback: "600/1m", bind: rateSetting(&config.RateLimit.Ip)},
+	}
+}
+
+// checks the rules that involve more than one setting
+func (config Config) validate(report *Report) {
+	if config.Env != ENV_DEVELOPMENT && config.Env != ENV_PRODUCTION {
+		report.Invalid = append(report.Invalid, fmt.Sprintf("APP_ENV=%q, it must be %s or %s", config.Env,
+			ENV_DEVELOPMENT, ENV_PRODUCTION))
+	}
+
+	if config.Log.Level != LOG_LEVEL_INFO && config.Log.Level != LOG_LEVEL_WARNING && config.Log.Level != LOG_LEVEL_ERROR {
+		report.Invalid = append(report.Invalid, fmt.Sprintf("LOG_LEVEL=%q, it must be %s, %s or %s", config.Log.Level,
+			LOG_LEVEL_INFO, LOG_LEVEL_WARNING, LOG_LEVEL_ERROR))
+	}
+
+	if config.Log.Format != LOG_FORMAT_JSON && config.Log.Format != LOG_FORMAT_TEXT {
+		report.Invalid = append(report.Invalid, fmt.Sprintf("LOG_FORMAT=%q, it must be %s or %s", config.Log.Format,
+			LOG_FORMAT_JSON, LOG_FORMAT_TEXT))
+	}
+
+	switch config.Tracing.Exporter {
+	case TRACING_EXPORTER_NONE, TRACING_EXPORTER_STDOUT:
+	case TRACING_EXPORTER_OTLP:
+		report.Missing = appendMissing(report.Missing, map[string]string{"TRACING_OTLP_ENDPOINT": config.Tracing.OtlpEndpoint})
+	default:
+		report.Invalid = append(report.Invalid, fmt.Sprintf("TRACING_EXPORTER=%q, it must be %s, %s or %s",
+			config.Tracing.Exporter, TRACING_EXPORTER_NONE, TRACING_EXPORTER_STDOUT, TRACING_EXPORTER_OTLP))
+	}
+
+	// the verification links must be signed by a key that is still verified when they are followed
+	if config.Jwt.KeyVerificationPeriod < config.Jwt.EmailVerificationLifetime {
+		report.Invalid = append(report.Invalid, "JWT_KEY_VERIFICATION_PERIOD, it must be at least the "+
+			"EMAIL_VERIFICATION_LINK_LIFETIME")
+	}
+
+	if config.Oidc.Issuer != "" {
+		report.Missing = appendMissing(report.Missing, map[string]string{
+			"OIDC_CLIENT_ID":    config.Oidc.ClientId,
+			"OIDC_REDIRECT_URL": config.Oidc.RedirectUrl,
+		})
+	}
+
+	if config.Mail.SmtpHost != "" {
+		report.Missing = appendMissing(report.Missing, map[string]string{"MAIL_FROM": config.Mail.From})
+	}
+}
+
+func appendMissing(missing []string, values map[string]string) []string {
+	for _, key := range sortedKeys(values) {
+		if values[key] == "" {
+			missing = append(missing, key)
+		}
+	}
+
+	return missing
+}
+
+func stringSetting(target *string) func(string) error {
+	return func(value string) error {
+		*target = value
+		return nil
+	}
+}
+
+func intSetting(target *int) func(string) error {
+	return func(value string) error {
+		parsedValue, parsingErr := strconv.Atoi(value)
+
+		if parsingErr != nil || parsedValue < 1 {
+			return errors.New("it must be a positive number")
+		}
+
+		*target = parsedValue
+		return nil
+	}
+}
+
+func boolSetting(target *bool) func(string) error {
+	return func(value string) error {
+		parsedValue, parsingErr := strconv.ParseBool(value)
+
+		if parsingErr != nil {
+			return errors.New("it must be true or false")
+		}
+
+		*target = parsedValue
+		return nil
+	}
+}
+
+func rateSetting(target *Rate) func(string) error {
+	return func(value string) error {
+		requests, period, found := strings.Cut(value, "/")
+		parsedRequests, requestsErr := strconv.Atoi(requests)
+		parsedPeriod, periodErr := time.ParseDuration(period)
+
+		if !found || requestsErr != nil || periodErr != nil || parsedRequests < 1 || parsedPeriod <= 0 {
+			return errors.New("it must be the requests allowed during a period, like 10/1m")
+		}
+
+		*target = Rate{Requests: parsedRequests, Period: parsedPeriod}
+		return nil
+	}
+}
+
+func urlSetting(target *string) func(string) error {
+	return func(value string) error {
+		parsedValue, parsingErr := url.Parse(value)
+
+		if parsingErr != nil || (parsedValue.Scheme != "http" && parsedValue.Scheme != "https") || parsedValue.Host == "" {
+			return errors.New("it must be an absolute http or https url")
+		}
+
+		*target = value
+		return nil
+	}
+}
+
+func ipRangesSetting(target *[]*net.IPNet) func(string) error {
+	return func(value string) error {
+		ipRanges := []*net.IPNet{}
+
+		for _, cidr := range strings.Split(value, ",") {
+			_, ipRange, parsingErr := net.ParseCIDR(strings.TrimSpace(cidr))
+
+			if parsingErr != nil {
+				return errors.New("it must be a list of ip ranges separated by commas, like 10.0.0.0/8,192.168.1.0/24")
+			}
+
+			ipRanges = append(ipRanges, ipRange)
+		}
+
+		*target = ipRanges
+		return nil
+	}
+}
+
+func durationsSetting(target *map[string]time.Duration) func(string) error {
+	return func(value string) error {
+		durations := map[string]time.Duration{}
+
+		for _, entry := range strings.Split(value, ",") {
+			name, duration, found := strings.Cut(strings.TrimSpace(entry), "=")
+			parsedDuration, parsingErr := time.ParseDuration(duration)
+
+			if !found || name == "" || parsingErr != nil || parsedDuration <= 0 {
+				return errors.New("it must be a list of names with a positive duration separated by commas, like " +
+					"users.CreateMany=30s,users.SearchUsers=10s")
+			}
+
+			durations[name] = parsedDuration
+		}
+
+		*target = durations
+		return nil
+	}
+}
+
+func durationSetting(target *time.Duration) func(string) error {
+	return func(value string) error {
+		parsedValue, parsingErr := time.ParseDuration(value)
+
+		if parsingErr != nil || parsedValue <= 0 {
+			return errors.New("it must be a positive duration like 30s, 5m or 24h")
+		}
+
+		*target = parsedValue
+		return nil
+	}
+}
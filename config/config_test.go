@@ -0,0 +1,173 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var requiredEnviron = []string{
+	"APP_BASE_URL=http://localhost:8080",
+	"APP_PASSWORD_RESET_PAGE_URL=http://localhost:3000/reset-password",
+	"MONGODB_HOST=localhost",
+	"MONGODB_USER=admin",
+	"MONGODB_PASS=secret",
+}
+
+func writeFile(t *testing.T, name, content string) string {
+	path := filepath.Join(t.TempDir(), name)
+	assert.NoError(t, os.WriteFile(path, []byte(content), 0600))
+
+	return path
+}
+
+func TestLoadDefaults(t *testing.T) {
+	config, loadErr := load(nil, requiredEnviron, filepath.Join(t.TempDir(), ".env"))
+
+	assert.NoError(t, loadErr)
+	assert.Equal(t, ENV_PRODUCTION, config.Env)
+	assert.Equal(t, ":8080", config.Server.Address())
+	assert.Equal(t, "27017", config.Mongo.Port)
+	assert.Equal(t, 5*time.Second, config.Mongo.OperationTimeout)
+	assert.Equal(t, 3*time.Minute, config.Jwt.AccessTokenLifetime)
+	assert.Equal(t, 168*time.Hour, config.Jwt.KeyRotationInterval)
+	assert.Equal(t, 10, config.Password.MinLength)
+	assert.True(t, config.Password.RequireUpper)
+	assert.False(t, config.Password.RequireSymbol)
+	assert.Equal(t, LOG_LEVEL_INFO, config.Log.Level)
+	assert.Equal(t, LOG_FORMAT_JSON, config.Log.Format)
+	assert.Equal(t, Rate{Requests: 10, Period: time.Minute}, config.RateLimit.Auth)
+	assert.Empty(t, config.Server.TrustedProxies)
+	assert.Equal(t, 5*time.Second, config.Server.DrainDelay)
+}
+
+func TestLoadPrecedence(t *testing.T) {
+	configFile := writeFile(t, "config.yaml", `
+app:
+  port: 9000
+mongodb:
+  host: file-host
+  operation_timeout: 10s
+jwt:
+  access_token_lifetime: 10m
+`)
+	dotenv := writeFile(t, ".env", "MONGODB_HOST=dotenv-host\nMONGODB_OPERATION_TIMEOUT=8s\nAPP_PORT=\n")
+	environ := []string{
+		"APP_BASE_URL=http://localhost:8080",
+		"APP_PASSWORD_RESET_PAGE_URL=http://localhost:3000/reset-password",
+		"MONGODB_USER=admin",
+		"MONGODB_PASS=secret",
+		"MONGODB_OPERATION_TIMEOUT=2s",
+	}
+
+	config, loadErr := load([]string{CONFIG_FILE_FLAG + configFile, DEV_FLAG}, environ, dotenv)
+
+	assert.NoError(t, loadErr)
+	// only in the file, the empty value of the .env file does not replace it
+	assert.Equal(t, 9000, config.Server.Port)
+	assert.Equal(t, 10*time.Minute, config.Jwt.AccessTokenLifetime)
+	// the .env file replaces the file
+	assert.Equal(t, "dotenv-host", config.Mongo.Host)
+	// the environment replaces both
+	assert.Equal(t, 2*time.Second, config.Mongo.OperationTimeout)
+
+	// out of development the .env file is not read
+	config, loadErr = load([]string{CONFIG_FILE_FLAG + configFile}, environ, dotenv)
+
+	assert.NoError(t, loadErr)
+	assert.Equal(t, "file-host", config.Mongo.Host)
+}
+
+func TestLoadConfigFileFromEnvironment(t *testing.T) {
+	configFile := writeFile(t, "config.yaml", "app:\n  env: development\n")
+
+	config, loadErr := load(nil, append(requiredEnviron, CONFIG_FILE_KEY+"="+configFile), filepath.Join(t.TempDir(), ".env"))
+
+	assert.NoError(t, loadErr)
+	assert.True(t, config.IsDev())
+	assert.Equal(t, LOG_FORMAT_TEXT, config.Log.Format)
+}
+
+func TestLoadDevFlag(t *testing.T) {
+	config, loadErr := load([]string{DEV_FLAG}, requiredEnviron, filepath.Join(t.TempDir(), ".env"))
+
+	assert.NoError(t, loadErr)
+	assert.True(t, config.IsDev())
+}
+
+func TestLoadTrustedProxies(t *testing.T) {
+	config, loadErr := load(nil, append(requiredEnviron, "APP_TRUSTED_PROXIES=10.0.0.0/8, 192.168.1.0/24"),
+		filepath.Join(t.TempDir(), ".env"))
+
+	if assert.NoError(t, loadErr) && assert.Len(t, config.Server.TrustedProxies, 2) {
+		assert.Equal(t, "192.168.1.0/24", config.Server.TrustedProxies[1].String())
+	}
+
+	_, loadErr = load(nil, append(requiredEnviron, "APP_TRUSTED_PROXIES=10.0.0.1"), filepath.Join(t.TempDir(), ".env"))
+
+	assert.ErrorContains(t, loadErr, "APP_TRUSTED_PROXIES")
+}
+
+func TestLoadOperationTimeouts(t *testing.T) {
+	config, loadErr := load(nil, append(requiredEnviron,
+		"MONGODB_OPERATION_TIMEOUTS=users.CreateMany=30s, users.SearchUsers=10s"), filepath.Join(t.TempDir(), ".env"))
+
+	if assert.NoError(t, loadErr) {
+		assert.Equal(t, map[string]time.Duration{"users.CreateMany": 30 * time.Second, "users.SearchUsers": 10 * time.Second},
+			config.Mongo.OperationTimeouts)
+	}
+
+	_, loadErr = load(nil, append(requiredEnviron, "MONGODB_OPERATION_TIMEOUTS=users.CreateMany"),
+		filepath.Join(t.TempDir(), ".env"))
+
+	assert.ErrorContains(t, loadErr, "MONGODB_OPERATION_TIMEOUTS")
+}
+
+func TestLoadReport(t *testing.T) {
+	environ := []string{
+		"MONGODB_HOST=localhost",
+		"APP_PORT=eighty",
+		"APP_PASSWORD_RESET_PAGE_URL=/reset-password",
+		"JWT_ACCESS_TOKEN_LIFETIME=-1m",
+		"OIDC_ISSUER=https://accounts.example.com",
+	}
+
+	_, loadErr := load(nil, environ, filepath.Join(t.TempDir(), ".env"))
+
+	report, isReport := loadErr.(Report)
+
+	if assert.True(t, isReport) {
+		assert.Equal(t, []string{"APP_BASE_URL", "MONGODB_USER", "MONGODB_PASS", "OIDC_CLIENT_ID", "OIDC_REDIRECT_URL"},
+			report.Missing)
+		assert.Len(t, report.Invalid, 3)
+		assert.Contains(t, report.Error(), "missing settings: APP_BASE_URL, MONGODB_USER")
+		assert.Contains(t, report.Error(), "APP_PORT")
+		assert.Contains(t, report.Error(), "APP_PASSWORD_RESET_PAGE_URL")
+	}
+
+	// the links sent by email start with the base url, it must be absolute
+	_, loadErr = load(nil, append(requiredEnviron, "APP_BASE_URL=localhost:8080"), filepath.Join(t.TempDir(), ".env"))
+
+	assert.ErrorContains(t, loadErr, "APP_BASE_URL")
+}
+
+func TestLoadInvalidConfigFile(t *testing.T) {
+	testCases := []string{
+		"app: [8080]",
+		"app:\n  port: 8080\n    env: dev",
+	}
+
+	for _, testCase := range testCases {
+		configFile := writeFile(t, "config.yaml", testCase)
+
+		_, loadErr := load([]string{CONFIG_FILE_FLAG + configFile}, requiredEnviron, filepath.Join(t.TempDir(), ".env"))
+
+		assert.Error(t, loadErr, testCase)
+	}
+
+	_, loadErr := load([]string{CONFIG_FILE_FLAG + "missing.yaml"}, requiredEnviron, filepath.Join(t.TempDir(), ".env"))
+	assert.Error(t, loadErr)
+}
@@ -0,0 +1,171 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/joho/godotenv"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	DOTENV_FILE = ".env"
+	// the YAML file can also be set with this variable, in the environment or the .env file
+	CONFIG_FILE_KEY  = "CONFIG_FILE"
+	CONFIG_FILE_FLAG = "--config="
+)
+
+// merges the values of every source, the ones with higher precedence replace the others. The .env file is only read
+// in development, with --dev, so a file left on a server cannot change its configuration
+func readSources(args, environ []string, dotenvPath string) (map[string]string, error) {
+	environment := map[string]string{}
+
+	for _, variable := range environ {
+		if key, value, found := strings.Cut(variable, "="); found {
+			environment[key] = value
+		}
+	}
+
+	dotenv := map[string]string{}
+
+	if hasFlag(args, DEV_FLAG) {
+		var dotenvErr error
+
+		if dotenv, dotenvErr = readDotenv(dotenvPath); dotenvErr != nil {
+			return nil, dotenvErr
+		}
+	}
+
+	configFile := flagValue(args, CONFIG_FILE_FLAG)
+
+	for _, source := range []map[string]string{environment, dotenv} {
+		if configFile == "" {
+			configFile = source[CONFIG_FILE_KEY]
+		}
+	}
+
+	values := map[string]string{}
+
+	if configFile != "" {
+		fileValues, fileErr := readYaml(configFile)
+
+		if fileErr != nil {
+			return nil, fileErr
+		}
+
+		mergeValues(values, fileValues)
+	}
+
+	mergeValues(values, dotenv)
+	mergeValues(values, environment)
+
+	return values, nil
+}
+
+// the .env file is optional
+func readDotenv(path string) (map[string]string, error) {
+	values, readErr := godotenv.Read(path)
+
+	if errors.Is(readErr, os.ErrNotExist) {
+		return map[string]string{}, nil
+	}
+
+	if readErr != nil {
+		return nil, fmt.Errorf("cannot read %s, %w", path, readErr)
+	}
+
+	return values, nil
+}
+
+// reads a YAML file whose keys are the names of the variables in lower case, nested keys are joined with an
+// underscore, so mongodb: {host: localhost} sets MONGODB_HOST
+func readYaml(path string) (map[string]string, error) {
+	content, readErr := os.ReadFile(path)
+
+	if readErr != nil {
+		return nil, fmt.Errorf("cannot read the configuration file %s, %w", path, readErr)
+	}
+
+	document := map[string]any{}
+
+	if parsingErr := yaml.Unmarshal(content, &document); parsingErr != nil {
+		return nil, fmt.Errorf("cannot parse the configuration file %s, %w", path, parsingErr)
+	}
+
+	values := map[string]string{}
+
+	if flattenErr := flatten(values, "", document); flattenErr != nil {
+		return nil, fmt.Errorf("cannot parse the configuration file %s, %w", path, flattenErr)
+	}
+
+	return values, nil
+}
+
+func flatten(values map[string]string, prefix string, document map[string]any) error {
+	for key, value := range document {
+		name := strings.ToUpper(key)
+
+		if prefix != "" {
+			name = prefix + "_" + name
+		}
+
+		switch typedValue := value.(type) {
+		case map[string]any:
+			if flattenErr := flatten(values, name, typedValue); flattenErr != nil {
+				return flattenErr
+			}
+		case []any:
+			return fmt.Errorf("%s is a list, only values and sections are supported", name)
+		case nil:
+			values[name] = ""
+		default:
+			values[name] = fmt.Sprint(typedValue)
+		}
+	}
+
+	return nil
+}
+
+// the empty values do not replace the values of the sources with lower precedence
+func mergeValues(values, source map[string]string) {
+	for key, value := range source {
+		if value != "" {
+			values[key] = value
+		}
+	}
+}
+
+func flagValue(args []string, prefix string) string {
+	for _, arg := range args {
+		if strings.HasPrefix(arg, prefix) {
+			return strings.TrimPrefix(arg, prefix)
+		}
+	}
+
+	return ""
+}
+
+func hasFlag(args []string, flag string) bool {
+	for _, arg := range args {
+		if arg == flag {
+			return true
+		}
+	}
+
+	return false
+}
+
+func sortedKeys(values map[string]string) []string {
+	keys := []string{}
+
+	for key := range values {
+		keys = append(keys, key)
+	}
+
+	sort.Strings(keys)
+
+	return keys
+}
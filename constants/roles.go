@@ -4,4 +4,5 @@ const (
 	ROLE_ADMIN   = "ADMIN"
 	ROLE_ATLETHE = "ATLETHE"
 	ROLE_COACH   = "COACH"
+	ROLE_PARENT  = "PARENT"
 )
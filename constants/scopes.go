@@ -0,0 +1,11 @@
+package constants
+
+// scopes of the API keys, they grant the same access the authorization checks give to a role
+const (
+	// same access as an admin
+	SCOPE_ADMIN = "admin"
+	// same access as a coach
+	SCOPE_COACH = "coach"
+	// read the data of any athlete
+	SCOPE_ATHLETES = "athletes"
+)
@@ -0,0 +1,7 @@
+package constants
+
+const (
+	STATUS_ACTIVE   = "ACTIVE"
+	STATUS_PENDING  = "PENDING"
+	STATUS_REJECTED = "REJECTED"
+)
@@ -1,6 +1,28 @@
 package custom_error
 
+// DTO is the body of every failed response
 type DTO struct {
-	Message string   `json:"error"`
-	Details []string `json:"details"`
+	Message string `json:"error"`
+	// stable identifier of the error, the clients should check it instead of the message
+	Code    string       `json:"code"`
+	Details []string     `json:"details"`
+	Fields  []FieldError `json:"fields,omitempty"`
 }
+
+// ProblemDTO is the body of the failed responses as RFC 7807 problem details, sent to the clients that accept
+// application/problem+json
+type ProblemDTO struct {
+	Type     string       `json:"type"`
+	Title    string       `json:"title"`
+	Status   int          `json:"status"`
+	Instance string       `json:"instance"`
+	Code     string       `json:"code"`
+	Details  []string     `json:"details,omitempty"`
+	Fields   []FieldError `json:"fields,omitempty"`
+}
+
+// message of the responses to the requests that could not be answered in time, they can be retried
+const MESSAGE_TIMEOUT = "El servicio tardó demasiado en responder, intente nuevamente"
+
+// message of the responses to the requests the client canceled, they are only written when it still listens
+const MESSAGE_CANCELED = "La solicitud fue cancelada"
@@ -0,0 +1,153 @@
+package custom_error
+
+import (
+	"net/http"
+
+	"github.com/ncardozo92/gapef_swimming_metrics/i18n"
+)
+
+const (
+	CODE_INVALID_REQUEST     = "invalid_request"
+	CODE_UNAUTHORIZED        = "unauthorized"
+	CODE_FORBIDDEN           = "forbidden"
+	CODE_NOT_FOUND           = "not_found"
+	CODE_METHOD_NOT_ALLOWED  = "method_not_allowed"
+	CODE_CONFLICT            = "conflict"
+	CODE_PAYLOAD_TOO_LARGE   = "payload_too_large"
+	CODE_TOO_MANY_REQUESTS   = "too_many_requests"
+	CODE_INTERNAL_ERROR      = "internal_error"
+	CODE_SERVICE_UNAVAILABLE = "service_unavailable"
+	CODE_TIMEOUT             = "timeout"
+	CODE_CANCELED            = "canceled"
+
+	// the client closed the connection before the answer, like nginx does it is not a failure of the server
+	STATUS_CLIENT_CLOSED_REQUEST = 499
+
+	MESSAGE_INTERNAL_ERROR      = "Ocurrió un error inesperado"
+	MESSAGE_NOT_FOUND           = "El recurso solicitado no existe"
+	MESSAGE_METHOD_NOT_ALLOWED  = "El método no está permitido para el recurso"
+	MESSAGE_INVALID_REQUEST     = "La solicitud no es válida"
+	MESSAGE_UNAUTHORIZED        = "Debe autenticarse para acceder al recurso"
+	MESSAGE_FORBIDDEN           = "No tiene permisos para acceder al recurso"
+	MESSAGE_PAYLOAD_TOO_LARGE   = "El cuerpo de la solicitud es demasiado grande"
+	MESSAGE_TOO_MANY_REQUESTS   = "Se realizaron demasiadas solicitudes, intente nuevamente más tarde"
+	MESSAGE_SERVICE_UNAVAILABLE = "El servicio no está disponible, intente nuevamente más tarde"
+)
+
+var (
+	ErrInternal = New(http.StatusInternalServerError, CODE_INTERNAL_ERROR, MESSAGE_INTERNAL_ERROR)
+	ErrTimeout  = New(http.StatusGatewayTimeout, CODE_TIMEOUT, MESSAGE_TIMEOUT)
+	ErrCanceled = New(STATUS_CLIENT_CLOSED_REQUEST, CODE_CANCELED, MESSAGE_CANCELED)
+)
+
+// FieldError tells which field of the request is not valid and why. The message is the text of the code in the
+// language of the request
+type FieldError struct {
+	Field   string `json:"field"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+	// the values of the verbs of the text
+	Args []any `json:"-"`
+}
+
+// NewFieldError returns the error of a field that is not valid because of the message
+func NewFieldError(field string, message i18n.Message) FieldError {
+	return FieldError{Field: field, Code: message.Code, Args: message.Args}
+}
+
+func (field FieldError) message() i18n.Message {
+	return i18n.NewMessage(field.Code, field.Args...)
+}
+
+// Error is a failure of the application that is answered to the client. The handlers return it and the error
+// handler renders it, so every failed response has the same body. The message is translated by the code, it is
+// only answered as it is when the code is not in the catalog
+type Error struct {
+	Status  int
+	Code    string
+	Message string
+	Details []i18n.Message
+	Fields  []FieldError
+	// the error that caused it, it is logged but never sent to the client
+	cause error
+}
+
+// New returns an error answered with the status, the code must not change once the clients use it
+func New(status int, code, message string) *Error {
+	return &Error{Status: status, Code: code, Message: message}
+}
+
+func (err *Error) Error() string {
+	if err.cause != nil {
+		return err.Code + ": " + err.cause.Error()
+	}
+
+	return err.Code + ": " + err.Message
+}
+
+func (err *Error) Unwrap() error {
+	return err.cause
+}
+
+// Is matches the errors with the same code, so the copies made by the With methods match the original
+func (err *Error) Is(target error) bool {
+	targetErr, isError := target.(*Error)
+
+	return isError && targetErr.Code == err.Code
+}
+
+// WithDetails returns a copy of the error with the details
+func (err *Error) WithDetails(details ...i18n.Message) *Error {
+	copied := *err
+	copied.Details = append(append([]i18n.Message{}, err.Details...), details...)
+
+	return &copied
+}
+
+// WithFields returns a copy of the error with the invalid fields, their messages are answered as details too
+func (err *Error) WithFields(fields ...FieldError) *Error {
+	copied := *err
+	copied.Fields = append(append([]FieldError{}, err.Fields...), fields...)
+
+	return &copied
+}
+
+// Wrap returns a copy of the error caused by another one
+func (err *Error) Wrap(cause error) *Error {
+	copied := *err
+	copied.cause = cause
+
+	return &copied
+}
+
+// DTO is the body of the response of the error in the language
+func (err *Error) DTO(language string) DTO {
+	message, translated := i18n.Translate(language, err.Code)
+	if !translated {
+		message = err.Message
+	}
+
+	details := []string{}
+	for _, detail := range append(append([]i18n.Message{}, err.Details...), FieldMessages(err.Fields)...) {
+		details = append(details, detail.Text(language))
+	}
+
+	var fields []FieldError
+	for _, field := range err.Fields {
+		field.Message = field.message().Text(language)
+		fields = append(fields, field)
+	}
+
+	return DTO{Message: message, Code: err.Code, Details: details, Fields: fields}
+}
+
+// FieldMessages returns the messages of the fields
+func FieldMessages(fields []FieldError) []i18n.Message {
+	messages := []i18n.Message{}
+
+	for _, field := range fields {
+		messages = append(messages, field.message())
+	}
+
+	return messages
+}
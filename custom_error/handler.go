@@ -0,0 +1,123 @@
+package custom_error
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+	"github.com/ncardozo92/gapef_swimming_metrics/i18n"
+	"github.com/ncardozo92/gapef_swimming_metrics/logging"
+)
+
+const (
+	MIME_PROBLEM_JSON = "application/problem+json"
+	// the type of the problems is the code of the error, so it is stable
+	PROBLEM_TYPE_PREFIX = "urn:gapef:error:"
+)
+
+// HTTPErrorHandler answers the errors returned by the handlers and middlewares in the language of the request. The
+// errors of the application keep their status and code, the ones of echo are mapped by their status and the rest
+// are internal errors
+func HTTPErrorHandler(err error, c echo.Context) {
+	if c.Response().Committed {
+		return
+	}
+
+	appErr := toError(err)
+
+	if appErr.Status >= http.StatusInternalServerError {
+		logging.LogErrorContext(c.Request().Context(), "%s %s failed, %v", c.Request().Method, c.Path(), err)
+	}
+
+	language := i18n.FromContext(c.Request().Context())
+	c.Response().Header().Set(i18n.HEADER_CONTENT_LANGUAGE, language)
+
+	var writeErr error
+
+	switch {
+	case c.Request().Method == http.MethodHead:
+		writeErr = c.NoContent(appErr.Status)
+	case acceptsProblems(c.Request()):
+		writeErr = writeProblem(c, appErr.DTO(language), appErr.Status)
+	default:
+		writeErr = c.JSON(appErr.Status, appErr.DTO(language))
+	}
+
+	if writeErr != nil {
+		logging.LogErrorContext(c.Request().Context(), "could not write the error response, %v", writeErr)
+	}
+}
+
+func toError(err error) *Error {
+	var appErr *Error
+	if errors.As(err, &appErr) {
+		return appErr
+	}
+
+	if errors.Is(err, context.Canceled) {
+		return ErrCanceled.Wrap(err)
+	}
+
+	var httpErr *echo.HTTPError
+	if errors.As(err, &httpErr) {
+		return fromHTTPError(httpErr)
+	}
+
+	return ErrInternal.Wrap(err)
+}
+
+// the errors of echo, like the routes that do not exist or the bodies that cannot be bound
+func fromHTTPError(httpErr *echo.HTTPError) *Error {
+	var appErr *Error
+
+	switch httpErr.Code {
+	case http.StatusNotFound:
+		appErr = New(httpErr.Code, CODE_NOT_FOUND, MESSAGE_NOT_FOUND)
+	case http.StatusMethodNotAllowed:
+		appErr = New(httpErr.Code, CODE_METHOD_NOT_ALLOWED, MESSAGE_METHOD_NOT_ALLOWED)
+	case http.StatusUnauthorized:
+		appErr = New(httpErr.Code, CODE_UNAUTHORIZED, MESSAGE_UNAUTHORIZED)
+	case http.StatusForbidden:
+		appErr = New(httpErr.Code, CODE_FORBIDDEN, MESSAGE_FORBIDDEN)
+	case http.StatusRequestEntityTooLarge:
+		appErr = New(httpErr.Code, CODE_PAYLOAD_TOO_LARGE, MESSAGE_PAYLOAD_TOO_LARGE)
+	case http.StatusTooManyRequests:
+		appErr = New(httpErr.Code, CODE_TOO_MANY_REQUESTS, MESSAGE_TOO_MANY_REQUESTS)
+	case http.StatusServiceUnavailable:
+		appErr = New(httpErr.Code, CODE_SERVICE_UNAVAILABLE, MESSAGE_SERVICE_UNAVAILABLE)
+	default:
+		if httpErr.Code >= http.StatusInternalServerError {
+			return ErrInternal.Wrap(httpErr)
+		}
+
+		appErr = New(httpErr.Code, CODE_INVALID_REQUEST, MESSAGE_INVALID_REQUEST)
+	}
+
+	return appErr.Wrap(httpErr)
+}
+
+func acceptsProblems(request *http.Request) bool {
+	return strings.Contains(request.Header.Get(echo.HeaderAccept), MIME_PROBLEM_JSON)
+}
+
+func writeProblem(c echo.Context, response DTO, status int) error {
+	c.Response().Header().Set(echo.HeaderContentType, MIME_PROBLEM_JSON)
+	c.Response().WriteHeader(status)
+
+	problem := ProblemDTO{
+		Type:     PROBLEM_TYPE_PREFIX + response.Code,
+		Title:    response.Message,
+		Status:   status,
+		Instance: c.Request().URL.Path,
+		Code:     response.Code,
+		Fields:   response.Fields,
+	}
+
+	if len(response.Details) > 0 {
+		problem.Details = response.Details
+	}
+
+	return c.Echo().JSONSerializer.Serialize(c, problem, "")
+}
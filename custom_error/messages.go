@@ -0,0 +1,19 @@
+package custom_error
+
+import "github.com/ncardozo92/gapef_swimming_metrics/i18n"
+
+func init() {
+	i18n.Register(map[string]i18n.Translation{
+		CODE_INVALID_REQUEST:     {Es: MESSAGE_INVALID_REQUEST, En: "The request is not valid"},
+		CODE_UNAUTHORIZED:        {Es: MESSAGE_UNAUTHORIZED, En: "You must authenticate to access the resource"},
+		CODE_FORBIDDEN:           {Es: MESSAGE_FORBIDDEN, En: "You are not allowed to access the resource"},
+		CODE_NOT_FOUND:           {Es: MESSAGE_NOT_FOUND, En: "The requested resource does not exist"},
+		CODE_METHOD_NOT_ALLOWED:  {Es: MESSAGE_METHOD_NOT_ALLOWED, En: "The method is not allowed for the resource"},
+		CODE_PAYLOAD_TOO_LARGE:   {Es: MESSAGE_PAYLOAD_TOO_LARGE, En: "The body of the request is too large"},
+		CODE_TOO_MANY_REQUESTS:   {Es: MESSAGE_TOO_MANY_REQUESTS, En: "Too many requests, try again later"},
+		CODE_INTERNAL_ERROR:      {Es: MESSAGE_INTERNAL_ERROR, En: "An unexpected error occurred"},
+		CODE_SERVICE_UNAVAILABLE: {Es: MESSAGE_SERVICE_UNAVAILABLE, En: "The service is not available, try again later"},
+		CODE_TIMEOUT:             {Es: MESSAGE_TIMEOUT, En: "The service took too long to answer, try again"},
+		CODE_CANCELED:            {Es: MESSAGE_CANCELED, En: "The request was canceled"},
+	})
+}
@@ -1,4 +1,4 @@
 [
-    {"email": "ncardozo@gapef.com.ar", "username": "ncardozo", "password": "$2a$12$8HKZFQTtifYRXmiguKAO2OPp3IxtsnZPEV7f7MnQdl5uzCJwsttci", "role": "ADMIN"},
-    {"email": "joan@gapef.com.ar", "username": "joan", "password": "$2a$12$GxPrHirBXAky6hFhO.qgKOgv3p6Wzr5LK/SW/j2aucp/ZTmeU21Z.", "role": "TRAINER"}
+    {"email": "ncardozo@gapef.com.ar", "username": "ncardozo", "first_name": "Nicolás", "last_name": "Cardozo", "password": "$2a$12$8HKZFQTtifYRXmiguKAO2OPp3IxtsnZPEV7f7MnQdl5uzCJwsttci", "role": "ADMIN", "email_verified": true},
+    {"email": "joan@gapef.com.ar", "username": "joan", "first_name": "Joan", "last_name": "", "password": "$2a$12$GxPrHirBXAky6hFhO.qgKOgv3p6Wzr5LK/SW/j2aucp/ZTmeU21Z.", "role": "TRAINER", "email_verified": true}
 ]
\ No newline at end of file
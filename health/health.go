@@ -0,0 +1,162 @@
+package health
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/ncardozo92/gapef_swimming_metrics/logging"
+)
+
+const (
+	PATH_HEALTH = "/healthz"
+	PATH_READY  = "/readyz"
+
+	STATE_STARTING = "starting"
+	STATE_READY    = "ready"
+	STATE_STOPPING = "stopping"
+
+	STATUS_OK      = "ok"
+	STATUS_FAILING = "failing"
+
+	// the load balancer stops waiting before the operation timeout of the repositories
+	CHECK_TIMEOUT = 2 * time.Second
+)
+
+// Version of the build, set with -ldflags "-X github.com/ncardozo92/gapef_swimming_metrics/health.Version=<version>"
+var Version = "dev"
+
+// Check verifies a dependency of the application answers
+type Check func(ctx context.Context) error
+
+type DependencyDTO struct {
+	Status    string  `json:"status"`
+	LatencyMs float64 `json:"latency_ms"`
+}
+
+type ReportDTO struct {
+	Status        string                   `json:"status"`
+	State         string                   `json:"state"`
+	Version       string                   `json:"version"`
+	UptimeSeconds int64                    `json:"uptime_seconds"`
+	Dependencies  map[string]DependencyDTO `json:"dependencies"`
+}
+
+// Checker answers the health and readiness probes. It starts as starting, so the load balancer does not send
+// requests until SetReady is called, and it is stopping since SetStopping until the application ends
+type Checker struct {
+	mutex     sync.RWMutex
+	state     string
+	startedAt time.Time
+	checks    map[string]Check
+}
+
+// Returns a new instance of Checker that verifies the dependencies by their names
+func NewChecker(checks map[string]Check) *Checker {
+	return &Checker{state: STATE_STARTING, startedAt: time.Now(), checks: checks}
+}
+
+// SetReady marks the application as able to serve requests
+func (checker *Checker) SetReady() {
+	checker.setState(STATE_READY)
+}
+
+// SetStopping marks the application as finishing the requests in progress
+func (checker *Checker) SetStopping() {
+	checker.setState(STATE_STOPPING)
+}
+
+// Health is the liveness probe. A failing dependency is reported but does not fail it, restarting the application
+// does not fix the database
+func (checker *Checker) Health(context echo.Context) error {
+	report := checker.report(context.Request().Context())
+
+	if report.State != STATE_READY {
+		return context.JSON(http.StatusServiceUnavailable, report)
+	}
+
+	return context.JSON(http.StatusOK, report)
+}
+
+// Ready is the readiness probe, it fails while the application starts or stops and when a dependency does not answer
+func (checker *Checker) Ready(context echo.Context) error {
+	report := checker.report(context.Request().Context())
+
+	if report.State != STATE_READY || report.Status != STATUS_OK {
+		return context.JSON(http.StatusServiceUnavailable, report)
+	}
+
+	return context.JSON(http.StatusOK, report)
+}
+
+func (checker *Checker) setState(state string) {
+	checker.mutex.Lock()
+	defer checker.mutex.Unlock()
+
+	checker.state = state
+}
+
+func (checker *Checker) getState() string {
+	checker.mutex.RLock()
+	defer checker.mutex.RUnlock()
+
+	return checker.state
+}
+
+// runs the checks at the same time, so the probe takes as long as the slowest one
+func (checker *Checker) report(ctx context.Context) ReportDTO {
+	report := ReportDTO{
+		Status:        STATUS_OK,
+		State:         checker.getState(),
+		Version:       Version,
+		UptimeSeconds: int64(time.Since(checker.startedAt).Seconds()),
+		Dependencies:  map[string]DependencyDTO{},
+	}
+
+	var waitGroup sync.WaitGroup
+	var reportMutex sync.Mutex
+
+	for name, check := range checker.checks {
+		waitGroup.Add(1)
+
+		go func(name string, check Check) {
+			defer waitGroup.Done()
+
+			dependency := runCheck(ctx, name, check)
+
+			reportMutex.Lock()
+			defer reportMutex.Unlock()
+
+			report.Dependencies[name] = dependency
+
+			if dependency.Status != STATUS_OK {
+				report.Status = STATUS_FAILING
+			}
+		}(name, check)
+	}
+
+	waitGroup.Wait()
+
+	return report
+}
+
+// the error is only logged, the probes are public and it can describe the infrastructure
+func runCheck(ctx context.Context, name string, check Check) DependencyDTO {
+	checkContext, cancel := context.WithTimeout(ctx, CHECK_TIMEOUT)
+	defer cancel()
+
+	start := time.Now()
+	checkErr := check(checkContext)
+	latency := time.Since(start)
+
+	dependency := DependencyDTO{Status: STATUS_OK, LatencyMs: float64(latency.Microseconds()) / 1000}
+
+	if checkErr != nil {
+		logging.LogWarningContext(ctx, "the health check of %s failed, %v", name, checkErr)
+		dependency.Status = STATUS_FAILING
+	}
+
+	return dependency
+}
@@ -0,0 +1,81 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+func probe(t *testing.T, handler echo.HandlerFunc) (int, ReportDTO) {
+	e := echo.New()
+	recorder := httptest.NewRecorder()
+	context := e.NewContext(httptest.NewRequest(http.MethodGet, PATH_HEALTH, nil), recorder)
+
+	assert.NoError(t, handler(context))
+
+	report := ReportDTO{}
+	assert.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &report))
+
+	return recorder.Code, report
+}
+
+func answering(ctx context.Context) error {
+	return nil
+}
+
+func failing(ctx context.Context) error {
+	return errors.New("connection refused")
+}
+
+func TestProbesFailWhileStarting(t *testing.T) {
+	checker := NewChecker(map[string]Check{"mongodb": answering})
+
+	healthStatus, healthReport := probe(t, checker.Health)
+	readyStatus, _ := probe(t, checker.Ready)
+
+	assert.Equal(t, http.StatusServiceUnavailable, healthStatus)
+	assert.Equal(t, http.StatusServiceUnavailable, readyStatus)
+	assert.Equal(t, STATE_STARTING, healthReport.State)
+}
+
+func TestProbesPassWhenReady(t *testing.T) {
+	checker := NewChecker(map[string]Check{"mongodb": answering})
+	checker.SetReady()
+
+	status, report := probe(t, checker.Ready)
+
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, STATUS_OK, report.Status)
+	assert.Equal(t, Version, report.Version)
+	assert.Equal(t, STATUS_OK, report.Dependencies["mongodb"].Status)
+}
+
+func TestFailingDependencyOnlyFailsReadiness(t *testing.T) {
+	checker := NewChecker(map[string]Check{"mongodb": failing})
+	checker.SetReady()
+
+	healthStatus, healthReport := probe(t, checker.Health)
+	readyStatus, _ := probe(t, checker.Ready)
+
+	assert.Equal(t, http.StatusOK, healthStatus)
+	assert.Equal(t, STATUS_FAILING, healthReport.Status)
+	assert.Equal(t, STATUS_FAILING, healthReport.Dependencies["mongodb"].Status)
+	assert.Equal(t, http.StatusServiceUnavailable, readyStatus)
+}
+
+func TestProbesFailWhileStopping(t *testing.T) {
+	checker := NewChecker(map[string]Check{"mongodb": answering})
+	checker.SetReady()
+	checker.SetStopping()
+
+	status, report := probe(t, checker.Ready)
+
+	assert.Equal(t, http.StatusServiceUnavailable, status)
+	assert.Equal(t, STATE_STOPPING, report.State)
+}
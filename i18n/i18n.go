@@ -0,0 +1,178 @@
+package i18n
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	LANGUAGE_ES = "es"
+	LANGUAGE_EN = "en"
+	// the language of the clients that do not ask for a supported one
+	DEFAULT_LANGUAGE = LANGUAGE_ES
+
+	HEADER_ACCEPT_LANGUAGE  = "Accept-Language"
+	HEADER_CONTENT_LANGUAGE = "Content-Language"
+)
+
+// Languages are the languages of the catalog
+var Languages = []string{LANGUAGE_ES, LANGUAGE_EN}
+
+// Translation is a text of the catalog in every language. The texts can have fmt verbs, filled with the args of
+// the message
+type Translation struct {
+	Es string
+	En string
+}
+
+func (translation Translation) in(language string) string {
+	if language == LANGUAGE_EN && translation.En != "" {
+		return translation.En
+	}
+
+	return translation.Es
+}
+
+// the texts of every package, keyed by their code
+var catalog = map[string]Translation{}
+
+// key of the context where the language of the request is kept
+type languageKey struct{}
+
+// Register adds the texts of a package to the catalog, it must be called from an init function. A code registered
+// twice is a programming error
+func Register(translations map[string]Translation) {
+	for code, translation := range translations {
+		if _, registered := catalog[code]; registered {
+			panic("i18n: the code " + code + " is already registered")
+		}
+
+		catalog[code] = translation
+	}
+}
+
+// Message is a text of the catalog with the values of its verbs, translated once the language is known
+type Message struct {
+	Code string
+	Args []any
+}
+
+func NewMessage(code string, args ...any) Message {
+	return Message{Code: code, Args: args}
+}
+
+// Text translates the message, the args that are messages are translated too
+func (message Message) Text(language string) string {
+	text, _ := Translate(language, message.Code, message.Args...)
+
+	return text
+}
+
+// Translate returns the text of the code in the language, or in spanish when it has no translation. When the code
+// is not in the catalog it returns the code and false
+func Translate(language, code string, args ...any) (string, bool) {
+	translation, registered := catalog[code]
+
+	if !registered {
+		return code, false
+	}
+
+	if len(args) == 0 {
+		return translation.in(language), true
+	}
+
+	translatedArgs := make([]any, len(args))
+	for index, arg := range args {
+		if message, isMessage := arg.(Message); isMessage {
+			translatedArgs[index] = message.Text(language)
+		} else {
+			translatedArgs[index] = arg
+		}
+	}
+
+	return fmt.Sprintf(translation.in(language), translatedArgs...), true
+}
+
+// IsSupported checks if the catalog has texts in the language
+func IsSupported(language string) bool {
+	for _, supported := range Languages {
+		if supported == language {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Negotiate chooses the supported language the client prefers from an Accept-Language header, like
+// "en-US,en;q=0.9,es;q=0.8". Only the primary subtag is compared, so en-GB is english
+func Negotiate(acceptLanguage string) string {
+	type weightedLanguage struct {
+		language string
+		weight   float64
+	}
+
+	candidates := []weightedLanguage{}
+
+	for _, part := range strings.Split(acceptLanguage, ",") {
+		tag, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		weight := 1.0
+
+		if quality, hasQuality := strings.CutPrefix(strings.TrimSpace(params), "q="); hasQuality {
+			parsedWeight, parseErr := strconv.ParseFloat(quality, 64)
+			if parseErr != nil {
+				continue
+			}
+			weight = parsedWeight
+		}
+
+		language, _, _ := strings.Cut(strings.ToLower(strings.TrimSpace(tag)), "-")
+
+		if language == "*" {
+			language = DEFAULT_LANGUAGE
+		}
+
+		if weight > 0 && IsSupported(language) {
+			candidates = append(candidates, weightedLanguage{language: language, weight: weight})
+		}
+	}
+
+	if len(candidates) == 0 {
+		return DEFAULT_LANGUAGE
+	}
+
+	// the order of the header breaks the ties
+	sort.SliceStable(candidates, func(i, j int) bool { return candidates[i].weight > candidates[j].weight })
+
+	return candidates[0].language
+}
+
+// WithLanguage returns a context whose texts are translated to the language
+func WithLanguage(ctx context.Context, language string) context.Context {
+	return context.WithValue(ctx, languageKey{}, language)
+}
+
+// FromContext returns the language of the request, or the default one when it was not chosen
+func FromContext(ctx context.Context) string {
+	if language, chosen := ctx.Value(languageKey{}).(string); chosen {
+		return language
+	}
+
+	return DEFAULT_LANGUAGE
+}
+
+// Middleware chooses the language of the request from its Accept-Language header. The authenticated users that
+// stored a preference replace it later
+func Middleware(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		language := Negotiate(c.Request().Header.Get(HEADER_ACCEPT_LANGUAGE))
+		c.SetRequest(c.Request().WithContext(WithLanguage(c.Request().Context(), language)))
+
+		return next(c)
+	}
+}
@@ -0,0 +1,78 @@
+package i18n
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+func init() {
+	Register(map[string]Translation{
+		"greeting":    {Es: "Hola %s", En: "Hi %s"},
+		"only_es":     {Es: "Solo en español"},
+		"wrapped_row": {Es: "Fila %d: %s", En: "Row %d: %s"},
+	})
+}
+
+func TestNegotiate(t *testing.T) {
+	testCases := map[string]string{
+		"":                          LANGUAGE_ES,
+		"en":                        LANGUAGE_EN,
+		"en-US,en;q=0.9,es;q=0.8":   LANGUAGE_EN,
+		"es-AR, en;q=0.5":           LANGUAGE_ES,
+		"fr, en;q=0.4, es;q=0.3":    LANGUAGE_EN,
+		"en;q=0.2, es;q=0.9":        LANGUAGE_ES,
+		"EN-gb":                     LANGUAGE_EN,
+		"en;q=0, fr":                LANGUAGE_ES,
+		"*":                         LANGUAGE_ES,
+		"en;q=invalid, es;q=0.1":    LANGUAGE_ES,
+		"de, fr;q=0.9, pt-BR;q=0.8": DEFAULT_LANGUAGE,
+	}
+
+	for acceptLanguage, expectedLanguage := range testCases {
+		assert.Equal(t, expectedLanguage, Negotiate(acceptLanguage), acceptLanguage)
+	}
+}
+
+func TestTranslate(t *testing.T) {
+	text, translated := Translate(LANGUAGE_EN, "greeting", "Nico")
+	assert.True(t, translated)
+	assert.Equal(t, "Hi Nico", text)
+
+	// the texts without english translation fall back to spanish
+	text, _ = Translate(LANGUAGE_EN, "only_es")
+	assert.Equal(t, "Solo en español", text)
+
+	// the args that are messages are translated to the same language
+	text, _ = Translate(LANGUAGE_EN, "wrapped_row", 3, NewMessage("greeting", "Nico"))
+	assert.Equal(t, "Row 3: Hi Nico", text)
+	assert.Equal(t, "Fila 3: Hola Nico", NewMessage("wrapped_row", 3, NewMessage("greeting", "Nico")).Text(LANGUAGE_ES))
+
+	text, translated = Translate(LANGUAGE_EN, "not_in_catalog")
+	assert.False(t, translated)
+	assert.Equal(t, "not_in_catalog", text)
+}
+
+func TestRegisterTwiceFails(t *testing.T) {
+	assert.Panics(t, func() { Register(map[string]Translation{"greeting": {Es: "Buenas"}}) })
+}
+
+func TestMiddleware(t *testing.T) {
+	assert.Equal(t, DEFAULT_LANGUAGE, FromContext(context.Background()))
+
+	request := httptest.NewRequest(http.MethodGet, "/", nil)
+	request.Header.Set(HEADER_ACCEPT_LANGUAGE, "en-US")
+
+	var language string
+	handler := Middleware(func(c echo.Context) error {
+		language = FromContext(c.Request().Context())
+		return nil
+	})
+
+	assert.NoError(t, handler(echo.New().NewContext(request, httptest.NewRecorder())))
+	assert.Equal(t, LANGUAGE_EN, language)
+}
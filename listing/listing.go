@@ -0,0 +1,243 @@
+// Package listing implements the cursor pagination, sorting and response envelope shared by the listing endpoints
+package listing
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ncardozo92/gapef_swimming_metrics/i18n"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	DEFAULT_SIZE = 20
+	MAX_SIZE     = 100
+
+	PARAM_CURSOR = "cursor"
+	PARAM_SIZE   = "size"
+	// the field to sort by, prefixed by "-" to sort in descending order
+	PARAM_SORT = "sort"
+
+	DESCENDING_PREFIX = "-"
+
+	DETAIL_INVALID_SIZE   = "El tamaño de página debe ser un número entre 1 y %d"
+	DETAIL_INVALID_SORT   = "No se puede ordenar por %s"
+	DETAIL_INVALID_CURSOR = "El cursor no es válido"
+
+	CODE_INVALID_SIZE   = "invalid_page_size"
+	CODE_INVALID_SORT   = "invalid_sort"
+	CODE_INVALID_CURSOR = "invalid_cursor"
+)
+
+func init() {
+	i18n.Register(map[string]i18n.Translation{
+		CODE_INVALID_SIZE:   {Es: DETAIL_INVALID_SIZE, En: "The page size must be a number between 1 and %d"},
+		CODE_INVALID_SORT:   {Es: DETAIL_INVALID_SORT, En: "The list cannot be sorted by %s"},
+		CODE_INVALID_CURSOR: {Es: DETAIL_INVALID_CURSOR, En: "The cursor is not valid"},
+	})
+}
+
+// Request is a validated listing request
+type Request struct {
+	Size       int
+	SortField  string
+	Descending bool
+	// position after which the page starts, nil for the first page
+	after *cursor
+}
+
+// the cursor is the position of the last item of a page, it carries the sort so it cannot be used with another one
+type cursor struct {
+	SortField  string `json:"s"`
+	Descending bool   `json:"d"`
+	Value      any    `json:"v,omitempty"`
+	// the dates are kept apart because JSON would turn them into strings, which Mongo does not compare with dates
+	Time *time.Time `json:"t,omitempty"`
+	Id   string     `json:"i"`
+}
+
+// Page is the response envelope of the listing endpoints
+type Page[T any] struct {
+	Items []T `json:"items"`
+	// empty at the last page
+	NextCursor string `json:"next_cursor,omitempty"`
+	// amount of items that match the filters, in every page
+	Total int64 `json:"total"`
+}
+
+// ParseRequest reads the cursor, size and sort query params. The sort field must be one of sortFields, when it is
+// not present the list is sorted by defaultSort, which can also start with "-". The returned details describe the
+// invalid params
+func ParseRequest(query url.Values, sortFields []string, defaultSort string) (Request, []i18n.Message) {
+	details := []i18n.Message{}
+	request := Request{
+		Size:       DEFAULT_SIZE,
+		SortField:  strings.TrimPrefix(defaultSort, DESCENDING_PREFIX),
+		Descending: strings.HasPrefix(defaultSort, DESCENDING_PREFIX),
+	}
+
+	if size := query.Get(PARAM_SIZE); size != "" {
+		parsedSize, parsingErr := strconv.Atoi(size)
+
+		if parsingErr != nil || parsedSize < 1 || parsedSize > MAX_SIZE {
+			details = append(details, i18n.NewMessage(CODE_INVALID_SIZE, MAX_SIZE))
+		} else {
+			request.Size = parsedSize
+		}
+	}
+
+	if sort := query.Get(PARAM_SORT); sort != "" {
+		request.Descending = strings.HasPrefix(sort, DESCENDING_PREFIX)
+		request.SortField = strings.TrimPrefix(sort, DESCENDING_PREFIX)
+
+		if !contains(sortFields, request.SortField) {
+			details = append(details, i18n.NewMessage(CODE_INVALID_SORT, request.SortField))
+		}
+	}
+
+	if encodedCursor := query.Get(PARAM_CURSOR); encodedCursor != "" {
+		after, decodingErr := decodeCursor(encodedCursor)
+
+		if decodingErr != nil || after.SortField != request.SortField || after.Descending != request.Descending {
+			details = append(details, i18n.NewMessage(CODE_INVALID_CURSOR))
+		} else {
+			request.after = &after
+		}
+	}
+
+	return request, details
+}
+
+// Filter returns the condition of the items that go after the cursor, it is empty for the first page. The id
+// breaks the ties between items with the same value at the sort field
+func (request Request) Filter() bson.D {
+	if request.after == nil {
+		return bson.D{}
+	}
+
+	operator := "$gt"
+	if request.Descending {
+		operator = "$lt"
+	}
+
+	id := cursorId(request.after.Id)
+	value := request.after.Value
+
+	if request.after.Time != nil {
+		value = *request.after.Time
+	}
+
+	return bson.D{{Key: "$or", Value: bson.A{
+		bson.D{{Key: request.SortField, Value: bson.D{{Key: operator, Value: value}}}},
+		bson.D{
+			{Key: request.SortField, Value: value},
+			{Key: "_id", Value: bson.D{{Key: operator, Value: id}}},
+		},
+	}}}
+}
+
+// FindOptions sorts the items and fetches one more than the page size, so NewPage knows if there is a next page
+func (request Request) FindOptions() *options.FindOptions {
+	direction := 1
+	if request.Descending {
+		direction = -1
+	}
+
+	return options.Find().
+		SetSort(bson.D{{Key: request.SortField, Value: direction}, {Key: "_id", Value: direction}}).
+		SetLimit(int64(request.Size + 1))
+}
+
+// NewPage builds the page from the items fetched with FindOptions. The key returns the value of the sort field and
+// the id of an item
+func NewPage[T any](items []T, total int64, request Request, key func(item T) (any, string)) (Page[T], error) {
+	page := Page[T]{Items: items, Total: total}
+
+	if len(items) <= request.Size {
+		return page, nil
+	}
+
+	page.Items = items[:request.Size]
+	value, id := key(page.Items[request.Size-1])
+
+	position := cursor{SortField: request.SortField, Descending: request.Descending, Value: value, Id: id}
+
+	if timeValue, isTime := value.(time.Time); isTime {
+		position.Value = nil
+		position.Time = &timeValue
+	}
+
+	nextCursor, encodingErr := encodeCursor(position)
+
+	page.NextCursor = nextCursor
+
+	return page, encodingErr
+}
+
+// Map converts the items of a page, keeping its cursor and total
+func Map[T, R any](page Page[T], convert func(item T) R) Page[R] {
+	converted := Page[R]{Items: []R{}, NextCursor: page.NextCursor, Total: page.Total}
+
+	for _, item := range page.Items {
+		converted.Items = append(converted.Items, convert(item))
+	}
+
+	return converted
+}
+
+func encodeCursor(position cursor) (string, error) {
+	encoded, encodingErr := json.Marshal(position)
+
+	if encodingErr != nil {
+		return "", encodingErr
+	}
+
+	return base64.RawURLEncoding.EncodeToString(encoded), nil
+}
+
+func decodeCursor(encoded string) (cursor, error) {
+	position := cursor{}
+	decoded, decodingErr := base64.RawURLEncoding.DecodeString(encoded)
+
+	if decodingErr != nil {
+		return position, decodingErr
+	}
+
+	if unmarshalErr := json.Unmarshal(decoded, &position); unmarshalErr != nil {
+		return position, unmarshalErr
+	}
+
+	// the value goes into the filter, an object like {"$ne": null} would be taken as an operator
+	switch position.Value.(type) {
+	case nil, string, float64, bool:
+		return position, nil
+	default:
+		return position, fmt.Errorf("the cursor value %v is not a string, number or bool", position.Value)
+	}
+}
+
+// the ids generated by Mongo are compared as object ids, any other id as a string
+func cursorId(id string) any {
+	if objectId, idErr := primitive.ObjectIDFromHex(id); idErr == nil {
+		return objectId
+	}
+
+	return id
+}
+
+func contains(values []string, value string) bool {
+	for _, candidate := range values {
+		if candidate == value {
+			return true
+		}
+	}
+
+	return false
+}
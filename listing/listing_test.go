@@ -0,0 +1,130 @@
+package listing
+
+import (
+	"encoding/base64"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/ncardozo92/gapef_swimming_metrics/i18n"
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+type item struct {
+	Id   string
+	Name string
+}
+
+func itemKey(it item) (any, string) {
+	return it.Name, it.Id
+}
+
+func TestParseRequestDefaults(t *testing.T) {
+	request, details := ParseRequest(url.Values{}, []string{"name"}, "name")
+
+	assert.Empty(t, details)
+	assert.Equal(t, DEFAULT_SIZE, request.Size)
+	assert.Equal(t, "name", request.SortField)
+	assert.False(t, request.Descending)
+	assert.Empty(t, request.Filter())
+}
+
+func TestParseRequestInvalidParams(t *testing.T) {
+	testCases := []url.Values{
+		{PARAM_SIZE: {"0"}},
+		{PARAM_SIZE: {"1000"}},
+		{PARAM_SIZE: {"ten"}},
+		{PARAM_SORT: {"password"}},
+		{PARAM_CURSOR: {"not a cursor"}},
+	}
+
+	for _, testCase := range testCases {
+		_, details := ParseRequest(testCase, []string{"name"}, "name")
+		assert.Len(t, details, 1, testCase.Encode())
+	}
+}
+
+func TestPagination(t *testing.T) {
+	request, _ := ParseRequest(url.Values{PARAM_SIZE: {"2"}, PARAM_SORT: {"-name"}}, []string{"name"}, "name")
+
+	// the repository fetches one item more than the page size
+	page, pageErr := NewPage([]item{{"1", "c"}, {"2", "b"}, {"3", "a"}}, 3, request, itemKey)
+
+	if assert.NoError(t, pageErr) {
+		assert.Equal(t, []item{{"1", "c"}, {"2", "b"}}, page.Items)
+		assert.Equal(t, int64(3), page.Total)
+		assert.NotEmpty(t, page.NextCursor)
+	}
+
+	nextRequest, details := ParseRequest(url.Values{PARAM_SIZE: {"2"}, PARAM_SORT: {"-name"}, PARAM_CURSOR: {page.NextCursor}},
+		[]string{"name"}, "name")
+
+	assert.Empty(t, details)
+	assert.Equal(t, bson.D{{Key: "$or", Value: bson.A{
+		bson.D{{Key: "name", Value: bson.D{{Key: "$lt", Value: "b"}}}},
+		bson.D{{Key: "name", Value: "b"}, {Key: "_id", Value: bson.D{{Key: "$lt", Value: "2"}}}},
+	}}}, nextRequest.Filter())
+
+	lastPage, _ := NewPage([]item{{"3", "a"}}, 3, nextRequest, itemKey)
+	assert.Empty(t, lastPage.NextCursor)
+}
+
+func TestCursorBoundToSort(t *testing.T) {
+	request, _ := ParseRequest(url.Values{PARAM_SIZE: {"1"}}, []string{"name", "email"}, "name")
+	page, _ := NewPage([]item{{"1", "a"}, {"2", "b"}}, 2, request, itemKey)
+
+	_, details := ParseRequest(url.Values{PARAM_SORT: {"email"}, PARAM_CURSOR: {page.NextCursor}}, []string{"name", "email"}, "name")
+
+	assert.Equal(t, []i18n.Message{i18n.NewMessage(CODE_INVALID_CURSOR)}, details)
+}
+
+func TestMap(t *testing.T) {
+	page := Page[item]{Items: []item{{"1", "a"}}, NextCursor: "next", Total: 5}
+
+	names := Map(page, func(it item) string { return it.Name })
+
+	assert.Equal(t, Page[string]{Items: []string{"a"}, NextCursor: "next", Total: 5}, names)
+}
+
+func TestParseRequestDescendingDefault(t *testing.T) {
+	request, details := ParseRequest(url.Values{}, []string{"timestamp"}, "-timestamp")
+
+	assert.Empty(t, details)
+	assert.Equal(t, "timestamp", request.SortField)
+	assert.True(t, request.Descending)
+}
+
+func TestTimeCursor(t *testing.T) {
+	timestamp := time.Date(2026, 3, 1, 10, 0, 0, 0, time.UTC)
+	request, _ := ParseRequest(url.Values{PARAM_SIZE: {"1"}}, []string{"timestamp"}, "-timestamp")
+
+	page, _ := NewPage([]time.Time{timestamp, timestamp.Add(-time.Hour)}, 2, request, func(value time.Time) (any, string) {
+		return value, "1"
+	})
+
+	nextRequest, details := ParseRequest(url.Values{PARAM_SIZE: {"1"}, PARAM_CURSOR: {page.NextCursor}}, []string{"timestamp"}, "-timestamp")
+
+	assert.Empty(t, details)
+	assert.Equal(t, bson.D{{Key: "timestamp", Value: bson.D{{Key: "$lt", Value: timestamp}}}},
+		nextRequest.Filter()[0].Value.(bson.A)[0])
+}
+
+// only scalar values are accepted, an object or a list would change the meaning of the filter
+func TestCursorValueMustBeScalar(t *testing.T) {
+	testCases := []string{`{"$ne":null}`, `["a","b"]`}
+
+	for _, testCase := range testCases {
+		encoded := base64.RawURLEncoding.EncodeToString([]byte(`{"s":"name","d":false,"v":` + testCase + `,"i":"1"}`))
+
+		request, details := ParseRequest(url.Values{PARAM_CURSOR: {encoded}}, []string{"name"}, "name")
+
+		assert.Equal(t, []i18n.Message{i18n.NewMessage(CODE_INVALID_CURSOR)}, details, testCase)
+		assert.Empty(t, request.Filter())
+	}
+
+	encoded := base64.RawURLEncoding.EncodeToString([]byte(`{"s":"name","d":false,"v":42,"i":"1"}`))
+	_, details := ParseRequest(url.Values{PARAM_CURSOR: {encoded}}, []string{"name"}, "name")
+
+	assert.Empty(t, details)
+}
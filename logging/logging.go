@@ -1,37 +1,109 @@
 package logging
 
 import (
-	"log"
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
 	"os"
+	"strings"
+
+	"github.com/ncardozo92/gapef_swimming_metrics/config"
+	"go.opentelemetry.io/otel/trace"
 )
 
-var (
-	infoLogger    *log.Logger
-	warningLogger *log.Logger
-	errorLogger   *log.Logger
+const (
+	FIELD_TRACE_ID = "trace_id"
+	FIELD_SPAN_ID  = "span_id"
 )
 
-// Initialize the loggers
+var logger *slog.Logger
+
+// key of the context where the fields of the request are kept
+type fieldsKey struct{}
+
+// the lines are written as text until UseConfig reads the configuration
 func init() {
-	logOutput := os.Stdout
+	logger = slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelInfo}))
+}
 
-	infoLogger = log.New(logOutput, "INFO: ", log.Ldate|log.Ltime)
-	warningLogger = log.New(logOutput, "WARNING: ", log.Ldate|log.Ltime)
-	errorLogger = log.New(logOutput, "ERROR: ", log.Ldate|log.Ltime)
+// UseConfig sets the minimum level of the lines and their format, JSON in production and text in development
+func UseConfig(logConfig config.Log) {
+	logger = newLogger(os.Stdout, logConfig)
+}
+
+func newLogger(output io.Writer, logConfig config.Log) *slog.Logger {
+	options := &slog.HandlerOptions{Level: ParseLevel(logConfig.Level)}
+
+	if logConfig.Format == config.LOG_FORMAT_TEXT {
+		return slog.New(slog.NewTextHandler(output, options))
+	}
+
+	return slog.New(slog.NewJSONHandler(output, options))
+}
+
+// ParseLevel reads the names of the configuration, the unknown ones are info
+func ParseLevel(level string) slog.Level {
+	switch strings.ToLower(level) {
+	case config.LOG_LEVEL_WARNING:
+		return slog.LevelWarn
+	case config.LOG_LEVEL_ERROR:
+		return slog.LevelError
+	}
+
+	return slog.LevelInfo
+}
+
+// WithFields returns a context whose lines have the fields, given as key value pairs, besides the ones it had
+func WithFields(ctx context.Context, args ...any) context.Context {
+	fields, _ := ctx.Value(fieldsKey{}).([]any)
+
+	return context.WithValue(ctx, fieldsKey{}, append(append([]any{}, fields...), args...))
 }
 
 func LogInfo(textFormat string, args ...interface{}) {
-	infoLogger.Printf(textFormat, args...)
+	write(context.Background(), slog.LevelInfo, textFormat, args)
 }
 
 func LogWarning(textFormat string, args ...interface{}) {
-	warningLogger.Printf(textFormat, args...)
+	write(context.Background(), slog.LevelWarn, textFormat, args)
 }
 
 func LogError(textFormat string, args ...interface{}) {
-	errorLogger.Printf(textFormat, args...)
+	write(context.Background(), slog.LevelError, textFormat, args)
 }
 
 func LogFatal(textFormat string, args ...interface{}) {
-	errorLogger.Fatalf(textFormat, args...)
+	write(context.Background(), slog.LevelError, textFormat, args)
+	os.Exit(1)
+}
+
+// LogInfoContext writes the line with the fields of the context, like the id of the request
+func LogInfoContext(ctx context.Context, textFormat string, args ...interface{}) {
+	write(ctx, slog.LevelInfo, textFormat, args)
+}
+
+func LogWarningContext(ctx context.Context, textFormat string, args ...interface{}) {
+	write(ctx, slog.LevelWarn, textFormat, args)
+}
+
+func LogErrorContext(ctx context.Context, textFormat string, args ...interface{}) {
+	write(ctx, slog.LevelError, textFormat, args)
+}
+
+func write(ctx context.Context, level slog.Level, textFormat string, args []interface{}) {
+	// the message is not formatted when the level is disabled
+	if !logger.Enabled(ctx, level) {
+		return
+	}
+
+	fields, _ := ctx.Value(fieldsKey{}).([]any)
+
+	// the lines of a traced request can be found from its trace
+	if spanContext := trace.SpanContextFromContext(ctx); spanContext.IsValid() {
+		fields = append(append([]any{}, fields...), FIELD_TRACE_ID, spanContext.TraceID().String(),
+			FIELD_SPAN_ID, spanContext.SpanID().String())
+	}
+
+	logger.Log(ctx, level, fmt.Sprintf(textFormat, args...), fields...)
 }
@@ -0,0 +1,97 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/ncardozo92/gapef_swimming_metrics/config"
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// replaces the logger by one that writes to the returned buffer until the test ends
+func captureLines(t *testing.T, logConfig config.Log) *bytes.Buffer {
+	output := &bytes.Buffer{}
+	previous := logger
+	logger = newLogger(output, logConfig)
+	t.Cleanup(func() { logger = previous })
+
+	return output
+}
+
+// returns the request id of the response
+func serve(header string) string {
+	e := echo.New()
+	e.Use(RequestIdMiddleware)
+
+	e.GET("/", func(context echo.Context) error {
+		LogInfoContext(context.Request().Context(), "handling")
+		return context.NoContent(http.StatusOK)
+	})
+
+	request := httptest.NewRequest(http.MethodGet, "/", nil)
+	request.Header.Set(echo.HeaderXRequestID, header)
+	recorder := httptest.NewRecorder()
+	e.ServeHTTP(recorder, request)
+
+	return recorder.Header().Get(echo.HeaderXRequestID)
+}
+
+func TestRequestIdIsPropagated(t *testing.T) {
+	output := captureLines(t, config.Log{Level: config.LOG_LEVEL_INFO, Format: config.LOG_FORMAT_JSON})
+
+	requestId := serve("abc-123")
+
+	line := map[string]any{}
+	assert.NoError(t, json.Unmarshal(output.Bytes(), &line))
+
+	assert.Equal(t, "abc-123", requestId)
+	assert.Equal(t, "abc-123", line[FIELD_REQUEST_ID])
+	assert.Equal(t, "handling", line["msg"])
+	assert.Equal(t, "INFO", line["level"])
+}
+
+func TestRequestIdIsGenerated(t *testing.T) {
+	captureLines(t, config.Log{Level: config.LOG_LEVEL_INFO, Format: config.LOG_FORMAT_JSON})
+
+	for _, received := range []string{"", "has spaces", strings.Repeat("a", MAX_REQUEST_ID_LENGTH+1)} {
+		requestId := serve(received)
+
+		assert.Len(t, requestId, 2*REQUEST_ID_BYTES, received)
+		assert.NotEqual(t, received, requestId)
+	}
+}
+
+func TestMinimumLevel(t *testing.T) {
+	output := captureLines(t, config.Log{Level: config.LOG_LEVEL_WARNING, Format: config.LOG_FORMAT_TEXT})
+
+	LogInfo("hidden %d", 1)
+	LogWarning("shown %d", 2)
+
+	assert.NotContains(t, output.String(), "hidden")
+	assert.Contains(t, output.String(), "level=WARN")
+	assert.Contains(t, output.String(), `msg="shown 2"`)
+}
+
+func TestTraceIdIsLogged(t *testing.T) {
+	output := captureLines(t, config.Log{Level: config.LOG_LEVEL_INFO, Format: config.LOG_FORMAT_JSON})
+
+	traceId, _ := trace.TraceIDFromHex("4bf92f3577b34da6a3ce929d0e0e4736")
+	spanId, _ := trace.SpanIDFromHex("00f067aa0ba902b7")
+	ctx := trace.ContextWithSpanContext(context.Background(),
+		trace.NewSpanContext(trace.SpanContextConfig{TraceID: traceId, SpanID: spanId}))
+
+	LogErrorContext(ctx, "traced")
+
+	line := map[string]any{}
+	assert.NoError(t, json.Unmarshal(output.Bytes(), &line))
+
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", line[FIELD_TRACE_ID])
+	assert.Equal(t, "00f067aa0ba902b7", line[FIELD_SPAN_ID])
+}
@@ -0,0 +1,56 @@
+package logging
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	FIELD_REQUEST_ID = "request_id"
+	// the ids received from the clients are replaced when they are longer, so they cannot flood the logs
+	MAX_REQUEST_ID_LENGTH = 128
+	REQUEST_ID_BYTES      = 16
+)
+
+// RequestIdMiddleware keeps the X-Request-ID of the request, or generates one, and adds it to the response and to
+// the lines written with the context of the request
+func RequestIdMiddleware(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		requestId := c.Request().Header.Get(echo.HeaderXRequestID)
+
+		if !isValidRequestId(requestId) {
+			requestId = newRequestId()
+		}
+
+		c.Response().Header().Set(echo.HeaderXRequestID, requestId)
+		c.SetRequest(c.Request().WithContext(WithFields(c.Request().Context(), FIELD_REQUEST_ID, requestId)))
+
+		return next(c)
+	}
+}
+
+// only printable ascii, the id is copied to the logs and the response headers
+func isValidRequestId(requestId string) bool {
+	if requestId == "" || len(requestId) > MAX_REQUEST_ID_LENGTH {
+		return false
+	}
+
+	for _, character := range requestId {
+		if character < '!' || character > '~' {
+			return false
+		}
+	}
+
+	return true
+}
+
+func newRequestId() string {
+	randomBytes := make([]byte, REQUEST_ID_BYTES)
+
+	// the reader of crypto/rand does not fail on the supported platforms
+	rand.Read(randomBytes)
+
+	return hex.EncodeToString(randomBytes)
+}
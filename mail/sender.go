@@ -0,0 +1,67 @@
+package mail
+
+import (
+	"fmt"
+	"net/smtp"
+	"strings"
+
+	"github.com/ncardozo92/gapef_swimming_metrics/config"
+	"github.com/ncardozo92/gapef_swimming_metrics/logging"
+)
+
+type Sender interface {
+	Send(to, subject, body string) error
+}
+
+// SmtpSender sends plain text emails through an SMTP server
+type SmtpSender struct {
+	Host     string
+	Port     string
+	Username string
+	Password string
+	From     string
+}
+
+// LogSender only logs the emails, it is used when there is no SMTP server configured
+type LogSender struct{}
+
+// creates the Sender of the mail configuration
+func NewSender(mailConfig config.Mail) Sender {
+	if mailConfig.SmtpHost == "" {
+		logging.LogWarning("MAIL_SMTP_HOST is not set, emails will be logged instead of sent")
+		return LogSender{}
+	}
+
+	return SmtpSender{
+		Host:     mailConfig.SmtpHost,
+		Port:     mailConfig.SmtpPort,
+		Username: mailConfig.SmtpUser,
+		Password: mailConfig.SmtpPass,
+		From:     mailConfig.From,
+	}
+}
+
+func (sender SmtpSender) Send(to, subject, body string) error {
+	var auth smtp.Auth
+
+	if sender.Username != "" {
+		auth = smtp.PlainAuth("", sender.Username, sender.Password, sender.Host)
+	}
+
+	message := strings.Join([]string{
+		"From: " + sender.From,
+		"To: " + to,
+		"Subject: " + subject,
+		"MIME-Version: 1.0",
+		"Content-Type: text/plain; charset=\"UTF-8\"",
+		"",
+		body,
+	}, "\r\n")
+
+	return smtp.SendMail(fmt.Sprintf("%s:%s", sender.Host, sender.Port), auth, sender.From, []string{to}, []byte(message))
+}
+
+func (sender LogSender) Send(to, subject, body string) error {
+	logging.LogInfo("email to %s, subject: %s\n%s", to, subject, body)
+	return nil
+}
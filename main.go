@@ -1,61 +1,338 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
 	"os"
+	"os/signal"
+	"strconv"
+	"syscall"
+	"time"
 
-	"github.com/joho/godotenv"
 	"github.com/labstack/echo/v4"
+	"github.com/labstack/echo/v4/middleware"
+	"github.com/ncardozo92/gapef_swimming_metrics/audit"
+	"github.com/ncardozo92/gapef_swimming_metrics/config"
+	"github.com/ncardozo92/gapef_swimming_metrics/custom_error"
+	"github.com/ncardozo92/gapef_swimming_metrics/health"
+	"github.com/ncardozo92/gapef_swimming_metrics/i18n"
 	"github.com/ncardozo92/gapef_swimming_metrics/logging"
+	"github.com/ncardozo92/gapef_swimming_metrics/mail"
+	"github.com/ncardozo92/gapef_swimming_metrics/metrics"
+	"github.com/ncardozo92/gapef_swimming_metrics/oidc"
+	"github.com/ncardozo92/gapef_swimming_metrics/openapi"
+	"github.com/ncardozo92/gapef_swimming_metrics/password"
+	"github.com/ncardozo92/gapef_swimming_metrics/persistence"
+	"github.com/ncardozo92/gapef_swimming_metrics/ratelimit"
+	"github.com/ncardozo92/gapef_swimming_metrics/tracing"
 	"github.com/ncardozo92/gapef_swimming_metrics/user"
 )
 
-const DEV_FLAG string = "--dev"
-
 var UserHandler user.Handler
 
 func main() {
 
-	if isDevEnvironment() {
-		if err := godotenv.Load(".env"); err != nil {
-			logging.LogFatal("cannot read .env file, %v", err.Error())
-		}
+	appConfig, configErr := config.Load(os.Args[1:])
+
+	if configErr != nil {
+		logging.LogFatal("%v", configErr)
+	}
+
+	logging.UseConfig(appConfig.Log)
+
+	shutdownTracing, tracingErr := tracing.Setup(context.Background(), appConfig.Tracing, health.Version)
+
+	if tracingErr != nil {
+		logging.LogFatal("cannot set up the tracing, %v", tracingErr)
+	}
+
+	if appConfig.IsDev() {
+		logging.LogInfo("environment set for development")
 	}
 
+	// the application stops serving when it receives one of these signals
+	stopContext, stopListening := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stopListening()
+
+	persistence.UseConfig(appConfig.Mongo)
+	user.UseConfig(appConfig)
+
+	if _, connectErr := persistence.Connect(stopContext); connectErr != nil {
+		logging.LogFatal("cannot connect to the database, %v", connectErr)
+	}
+
+	// setting up the keys that sign the JWTs
+	keyRing, keyRingErr := user.NewKeyRing(appConfig.Jwt.Algorithm, appConfig.Jwt.KeyVerificationPeriod, appConfig.Jwt.KeysDir)
+
+	if keyRingErr != nil {
+		logging.LogFatal("cannot load JWT keys, %v", keyRingErr)
+	}
+
+	user.UseKeyRing(keyRing)
+	stopRotation := make(chan struct{})
+	keyRing.StartRotation(appConfig.Jwt.KeyRotationInterval, stopRotation)
+
+	passwordPolicy, passwordPolicyErr := password.NewPolicy(appConfig.Password)
+
+	if passwordPolicyErr != nil {
+		logging.LogFatal("cannot load the password policy, %v", passwordPolicyErr)
+	}
+
+	user.UsePasswordPolicy(passwordPolicy)
+
 	// setting up the handlers
-	UserHandler = user.NewUserHandler(user.NewUserRepository())
+	userRepository := user.NewUserRepository()
+
+	UserHandler = user.NewUserHandler(userRepository, mail.NewSender(appConfig.Mail), newIdentityProvider(appConfig.Oidc))
+	user.UseApiKeys(userRepository)
+
+	auditStore := audit.NewMongoStore(persistence.GetDatabase())
+	auditHandler := audit.NewHandler(auditStore)
+
+	healthChecker := health.NewChecker(map[string]health.Check{"mongodb": persistence.Ping})
 
 	e := echo.New()
+	e.HTTPErrorHandler = custom_error.HTTPErrorHandler
+	e.IPExtractor = newIPExtractor(appConfig.Server.TrustedProxies)
+
+	// registering middlewares, the request id and the span are the first so every line of the request has them, the
+	// language is chosen before anything can fail, the metrics include the time spent at the rest of them and the
+	// audit log wraps the authentication so the rejected requests are recorded. The clients are limited by their ip
+	// before the authentication, so the credentials and API keys cannot be guessed without limit, and by their
+	// identity after it
+	e.Use(logging.RequestIdMiddleware)
+	e.Use(i18n.Middleware)
+	e.Use(tracing.Middleware)
+	e.Use(metrics.Middleware)
+	e.Use(audit.Middleware(auditStore, user.AuditActor))
+
+	if appConfig.RateLimit.Enabled {
+		e.Use(newIpLimiter(appConfig.RateLimit).Middleware)
+	}
 
-	// registering middlewares
 	e.Use(user.CustomJwtMiddleware)
 
-	// Login and user CRUD
-	e.POST(user.PATH_LOGIN, UserHandler.Login)
+	if appConfig.RateLimit.Enabled {
+		e.Use(newLimiter(appConfig.RateLimit).Middleware)
+	}
 
-	e.GET(user.PATH_USERS, UserHandler.GetAllUsers, user.CoachAccessMiddleware)
-	e.POST(user.PATH_USERS, UserHandler.Create, user.CoachAccessMiddleware)
+	registerRoutes(e, UserHandler, auditHandler, healthChecker, appConfig.Metrics)
 
 	users_ops := e.Group(user.PATH_USERS)
 
 	users_ops.Use()
 
-	if launchErr := e.Start(":8080"); launchErr != nil {
-		logging.LogFatal("Cannot start application")
+	// the migrations end before the server starts, so a failed one does not stop the application while it serves
+	migrateDatabase(userRepository, auditStore)
+	healthChecker.SetReady()
+
+	serverErrors := make(chan error, 1)
+
+	go func() {
+		serverErrors <- e.Start(appConfig.Server.Address())
+	}()
+
+	logging.LogInfo("the application is ready")
+
+	select {
+	case launchErr := <-serverErrors:
+		if !errors.Is(launchErr, http.ErrServerClosed) {
+			logging.LogFatal("Cannot start application, %v", launchErr)
+		}
+	case <-stopContext.Done():
+		logging.LogInfo("shutting down the application")
 	}
+
+	// the readiness probe fails during the drain delay, so the load balancer stops sending requests before the
+	// server stops accepting them
+	healthChecker.SetStopping()
+	time.Sleep(appConfig.Server.DrainDelay)
+
+	shutdown(e, appConfig.Server.ShutdownTimeout, stopRotation, shutdownTracing)
 }
 
-func isDevEnvironment() bool {
-	var result bool
+// registers the routes of the API, every one must be described at the OpenAPI document
+func registerRoutes(e *echo.Echo, userHandler user.Handler, auditHandler *audit.Handler, healthChecker *health.Checker,
+	metricsConfig config.Metrics) {
 
-	if len(os.Args) > 1 {
-		for _, arg := range os.Args {
-			if arg == DEV_FLAG {
-				logging.LogInfo("environment set for development")
-				result = true
-				break
-			}
-		}
+	// Probes of the load balancer
+	e.GET(health.PATH_HEALTH, healthChecker.Health)
+	e.GET(health.PATH_READY, healthChecker.Ready)
+	e.GET(metrics.PATH_METRICS, metrics.Handler(metricsConfig))
+
+	// Public keys that verify the JWTs
+	e.GET(user.PATH_JWKS, user.GetJWKS)
+
+	// Login and user CRUD
+	e.POST(user.PATH_LOGIN, userHandler.Login)
+
+	// Login with an external OpenID Connect provider
+	e.GET(user.PATH_LOGIN_OIDC, userHandler.OidcLogin)
+	e.GET(user.PATH_LOGIN_OIDC_CALLBACK, userHandler.OidcCallback)
+
+	e.GET(user.PATH_USERS, userHandler.GetAllUsers, user.CoachAccessMiddleware)
+	e.POST(user.PATH_USERS, userHandler.Create, user.CoachAccessMiddleware)
+	e.POST(user.PATH_USERS_IMPORT, userHandler.ImportUsers, middleware.BodyLimit(strconv.Itoa(user.MAX_IMPORT_REQUEST_SIZE)),
+		user.CoachAccessMiddleware)
+	e.GET(user.PATH_USER, userHandler.GetUser, user.AthleteAccessMiddleware)
+	e.GET(user.PATH_USERS_SEARCH, userHandler.SearchUsers, user.CoachAccessMiddleware)
+
+	// Email verification
+	e.GET(user.PATH_VERIFY_EMAIL, userHandler.VerifyEmail)
+	e.POST(user.PATH_VERIFY_EMAIL_RESEND, userHandler.ResendVerification)
+
+	// Password change and reset
+	e.PUT(user.PATH_PASSWORD, userHandler.UpdatePassword)
+	e.POST(user.PATH_PASSWORD_RESET, userHandler.RequestPasswordReset)
+	e.POST(user.PATH_PASSWORD_RESET_CONFIRM, userHandler.ResetPassword)
+
+	// Language of the texts and emails
+	e.PUT(user.PATH_LANGUAGE, userHandler.UpdateLanguage)
+
+	// Two factor authentication
+	e.POST(user.PATH_LOGIN_2FA, userHandler.LoginTwoFactor)
+	e.POST(user.PATH_2FA, userHandler.EnrollTwoFactor)
+	e.POST(user.PATH_2FA_CONFIRM, userHandler.ConfirmTwoFactor)
+	e.DELETE(user.PATH_2FA, userHandler.DisableTwoFactor)
+	e.GET(user.PATH_2FA_POLICY, userHandler.GetTwoFactorPolicy, user.AdminAccessMiddleware)
+	e.PUT(user.PATH_2FA_POLICY, userHandler.SetTwoFactorPolicy, user.AdminAccessMiddleware)
+
+	// Login lockouts
+	e.GET(user.PATH_LOCKOUTS, userHandler.GetLockouts, user.AdminAccessMiddleware)
+	e.DELETE(user.PATH_LOCKOUT, userHandler.ClearLockout, user.AdminAccessMiddleware)
+
+	// API keys of machine clients
+	e.GET(user.PATH_API_KEYS, userHandler.GetApiKeys, user.AdminAccessMiddleware)
+	e.POST(user.PATH_API_KEYS, userHandler.CreateApiKey, user.AdminAccessMiddleware)
+	e.DELETE(user.PATH_API_KEY, userHandler.RevokeApiKey, user.AdminAccessMiddleware)
+
+	// Audit log
+	e.GET(audit.PATH_AUDIT, auditHandler.GetEntries, user.AdminAccessMiddleware)
+	e.GET(audit.PATH_AUDIT_EXPORT, auditHandler.Export, user.AdminAccessMiddleware)
+
+	// Self registration and approval queue
+	e.POST(user.PATH_SIGNUP, userHandler.SignUp)
+	e.GET(user.PATH_USERS_PENDING, userHandler.GetPendingUsers, user.CoachAccessMiddleware)
+	e.POST(user.PATH_USER_APPROVE, userHandler.Approve, user.CoachAccessMiddleware)
+	e.POST(user.PATH_USER_REJECT, userHandler.Reject, user.CoachAccessMiddleware)
+
+	// Parent and athlete links
+	e.POST(user.PATH_USER_ATHLETES, userHandler.LinkAthlete, user.CoachAccessMiddleware)
+
+	// Documentation of the API
+	e.GET(openapi.PATH_OPENAPI, openapi.Handler(apiDocument()))
+	e.GET(openapi.PATH_DOCS, openapi.SwaggerUI)
+}
+
+// the authentication routes have the strictest limit, so the passwords and codes cannot be guessed
+func newLimiter(rateLimitConfig config.RateLimit) *ratelimit.Limiter {
+	authPolicy := ratelimit.NewPolicy(ratelimit.POLICY_AUTH, rateLimitConfig.Auth)
+	listingPolicy := ratelimit.NewPolicy(ratelimit.POLICY_LISTING, rateLimitConfig.Listing)
+
+	return ratelimit.NewLimiter(ratelimit.NewMemoryStore(), user.RateLimitKey,
+		ratelimit.NewPolicy(ratelimit.POLICY_DEFAULT, rateLimitConfig.Default),
+		map[string]ratelimit.Policy{
+			http.MethodPost + " " + user.PATH_LOGIN:                  authPolicy,
+			http.MethodPost + " " + user.PATH_LOGIN_2FA:              authPolicy,
+			http.MethodGet + " " + user.PATH_LOGIN_OIDC:              authPolicy,
+			http.MethodPost + " " + user.PATH_SIGNUP:                 authPolicy,
+			http.MethodPost + " " + user.PATH_VERIFY_EMAIL_RESEND:    authPolicy,
+			http.MethodPost + " " + user.PATH_PASSWORD_RESET:         authPolicy,
+			http.MethodPost + " " + user.PATH_PASSWORD_RESET_CONFIRM: authPolicy,
+			http.MethodGet + " " + user.PATH_USERS:                   listingPolicy,
+			http.MethodGet + " " + user.PATH_USERS_SEARCH:            listingPolicy,
+			http.MethodGet + " " + user.PATH_USERS_PENDING:           listingPolicy,
+			http.MethodGet + " " + audit.PATH_AUDIT:                  listingPolicy,
+			http.MethodGet + " " + audit.PATH_AUDIT_EXPORT:           listingPolicy,
+		})
+}
+
+// limits every ip with the same policy, whether its requests carry valid credentials or not
+func newIpLimiter(rateLimitConfig config.RateLimit) *ratelimit.Limiter {
+	return ratelimit.NewLimiter(ratelimit.NewMemoryStore(), user.RateLimitIpKey,
+		ratelimit.NewPolicy(ratelimit.POLICY_IP, rateLimitConfig.Ip), nil)
+}
+
+// the lockouts, the rate limits and the audit log identify the clients by their ip, so X-Forwarded-For is only read
+// when the request comes from a trusted proxy, otherwise any client could choose its own ip
+func newIPExtractor(trustedProxies []*net.IPNet) echo.IPExtractor {
+	if len(trustedProxies) == 0 {
+		return echo.ExtractIPDirect()
+	}
+
+	trustOptions := []echo.TrustOption{echo.TrustLoopback(false), echo.TrustLinkLocal(false), echo.TrustPrivateNet(false)}
+
+	for _, ipRange := range trustedProxies {
+		trustOptions = append(trustOptions, echo.TrustIPRange(ipRange))
+	}
+
+	return echo.ExtractIPFromXFFHeader(trustOptions...)
+}
+
+// applies the pending migrations and creates the indexes missing at the database, updating the existing documents can
+// take a while
+func migrateDatabase(userRepository *user.UserRepository, auditStore *audit.MongoStore) {
+	if migrationErr := userRepository.MigrateEmailVerification(); migrationErr != nil {
+		logging.LogFatal("cannot mark the emails of the existing users as verified, %v", migrationErr)
+	}
+
+	if indexErr := userRepository.EnsureSearchIndexes(); indexErr != nil {
+		logging.LogFatal("cannot create the users search indexes, %v", indexErr)
+	}
+
+	if indexErr := userRepository.EnsureUniqueIndexes(); indexErr != nil {
+		logging.LogFatal("cannot create the users unique indexes, %v", indexErr)
+	}
+
+	if indexErr := userRepository.EnsureApiKeyIndexes(); indexErr != nil {
+		logging.LogFatal("cannot create the API keys indexes, %v", indexErr)
+	}
+
+	if indexErr := auditStore.EnsureIndexes(); indexErr != nil {
+		logging.LogFatal("cannot create the audit log indexes, %v", indexErr)
+	}
+}
+
+// waits for the requests in progress until the timeout ends, then releases the resources of the application
+func shutdown(e *echo.Echo, timeout time.Duration, stopRotation chan struct{}, shutdownTracing tracing.ShutdownFunc) {
+	shutdownContext, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	if shutdownErr := e.Shutdown(shutdownContext); shutdownErr != nil {
+		logging.LogError("the requests in progress did not finish in %v, %v", timeout, shutdownErr)
+	}
+
+	close(stopRotation)
+
+	if disconnectErr := persistence.Disconnect(shutdownContext); disconnectErr != nil {
+		logging.LogError("cannot close the database connections, %v", disconnectErr)
+	}
+
+	if tracingErr := shutdownTracing(shutdownContext); tracingErr != nil {
+		logging.LogError("cannot export the last spans, %v", tracingErr)
+	}
+
+	logging.LogInfo("application stopped")
+}
+
+// the external OpenID Connect provider, the login with it stays disabled when OIDC_ISSUER is not set
+func newIdentityProvider(oidcConfig config.Oidc) user.IdentityProvider {
+	if oidcConfig.Issuer == "" {
+		return nil
+	}
+
+	provider, discoveryErr := oidc.Discover(
+		context.Background(),
+		oidcConfig.Issuer,
+		oidcConfig.ClientId,
+		oidcConfig.ClientSecret,
+		oidcConfig.RedirectUrl)
+
+	if discoveryErr != nil {
+		logging.LogFatal("cannot discover the OIDC provider %s, %v", oidcConfig.Issuer, discoveryErr)
 	}
 
-	return result
+	return provider
 }
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/ncardozo92/gapef_swimming_metrics/audit"
+	"github.com/ncardozo92/gapef_swimming_metrics/config"
+	"github.com/ncardozo92/gapef_swimming_metrics/custom_error"
+	"github.com/ncardozo92/gapef_swimming_metrics/health"
+	"github.com/ncardozo92/gapef_swimming_metrics/openapi"
+	"github.com/ncardozo92/gapef_swimming_metrics/user"
+	"github.com/stretchr/testify/assert"
+)
+
+func newRoutedEcho() *echo.Echo {
+	e := echo.New()
+	registerRoutes(e, user.NewUserHandler(nil, nil, nil), audit.NewHandler(nil), health.NewChecker(nil), config.Metrics{})
+
+	return e
+}
+
+func TestEveryRouteIsDocumented(t *testing.T) {
+	document := apiDocument()
+	routes := map[string]bool{}
+
+	for _, route := range newRoutedEcho().Routes() {
+		routes[strings.ToLower(route.Method)+" "+openapi.ToPath(route.Path)] = true
+
+		assert.True(t, document.Has(route.Method, route.Path), "%s %s is not documented", route.Method, route.Path)
+	}
+
+	// the document does not describe routes that were removed
+	for path, pathItem := range document.Paths {
+		for method := range pathItem {
+			assert.True(t, routes[method+" "+path], "%s %s is documented but not registered", method, path)
+		}
+	}
+}
+
+func TestDocumentIsServed(t *testing.T) {
+	e := newRoutedEcho()
+
+	recorder := httptest.NewRecorder()
+	e.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, openapi.PATH_OPENAPI, nil))
+
+	served := map[string]any{}
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	assert.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &served))
+	assert.Equal(t, openapi.VERSION, served["openapi"])
+
+	schemas := served["components"].(map[string]any)["schemas"].(map[string]any)
+	for _, name := range []string{"user.DTO", "user.LoginDTO", "custom_error.DTO"} {
+		assert.Contains(t, schemas, name)
+	}
+
+	recorder = httptest.NewRecorder()
+	e.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, openapi.PATH_DOCS, nil))
+
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	assert.Contains(t, recorder.Body.String(), openapi.PATH_OPENAPI)
+}
+
+func TestSpoofedHeadersDoNotChangeTheClientIp(t *testing.T) {
+	_, proxyRange, _ := net.ParseCIDR("10.0.0.0/8")
+
+	testCases := []struct {
+		trustedProxies []*net.IPNet
+		remoteAddr     string
+		expectedIp     string
+	}{
+		{nil, "203.0.113.7:41000", "203.0.113.7"},
+		{nil, "10.0.0.2:41000", "10.0.0.2"},
+		// only the proxies can tell the address of the client
+		{[]*net.IPNet{proxyRange}, "203.0.113.7:41000", "203.0.113.7"},
+		{[]*net.IPNet{proxyRange}, "10.0.0.2:41000", "198.51.100.9"},
+	}
+
+	for _, testCase := range testCases {
+		e := echo.New()
+		e.IPExtractor = newIPExtractor(testCase.trustedProxies)
+
+		request := httptest.NewRequest(http.MethodPost, user.PATH_LOGIN, nil)
+		request.RemoteAddr = testCase.remoteAddr
+		request.Header.Set(echo.HeaderXForwardedFor, "198.51.100.9")
+		request.Header.Set(echo.HeaderXRealIP, "198.51.100.9")
+
+		assert.Equal(t, user.RATE_LIMIT_KEY_IP+testCase.expectedIp,
+			user.RateLimitKey(e.NewContext(request, httptest.NewRecorder())), testCase.remoteAddr)
+	}
+}
+
+// the wrong API keys are rejected by the authentication, they must still use the tokens of the ip
+func TestWrongCredentialsAreLimitedByIp(t *testing.T) {
+	e := echo.New()
+	e.HTTPErrorHandler = custom_error.HTTPErrorHandler
+	e.Use(newIpLimiter(config.RateLimit{Ip: config.Rate{Requests: 2, Period: time.Minute}}).Middleware)
+	e.Use(user.CustomJwtMiddleware)
+	e.GET(user.PATH_USERS, func(c echo.Context) error { return c.NoContent(http.StatusOK) })
+
+	statuses := []int{}
+
+	for attempt := 0; attempt < 3; attempt++ {
+		request := httptest.NewRequest(http.MethodGet, user.PATH_USERS, nil)
+		request.Header.Set(user.API_KEY_HEADER, user.API_KEY_PREFIX+"guessed")
+		recorder := httptest.NewRecorder()
+
+		e.ServeHTTP(recorder, request)
+		statuses = append(statuses, recorder.Code)
+	}
+
+	assert.Equal(t, []int{http.StatusUnauthorized, http.StatusUnauthorized, http.StatusTooManyRequests}, statuses)
+}
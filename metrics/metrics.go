@@ -0,0 +1,143 @@
+package metrics
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/ncardozo92/gapef_swimming_metrics/config"
+	"github.com/ncardozo92/gapef_swimming_metrics/custom_error"
+	"github.com/ncardozo92/gapef_swimming_metrics/i18n"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const (
+	PATH_METRICS = "/metrics"
+	NAMESPACE    = "gapef"
+
+	MESSAGE_INVALID_METRICS_TOKEN = "Debe enviarse el token de las métricas"
+	CODE_INVALID_METRICS_TOKEN    = "invalid_metrics_token"
+
+	OUTCOME_SUCCESS = "success"
+	OUTCOME_FAILURE = "failure"
+
+	REASON_NONE            = "none"
+	REASON_INVALID_REQUEST = "invalid_request"
+	REASON_BLOCKED         = "blocked"
+	REASON_USER_NOT_FOUND  = "user_not_found"
+	REASON_BAD_PASSWORD    = "bad_password"
+	REASON_NOT_APPROVED    = "not_approved"
+	REASON_JWT_ERROR       = "jwt_error"
+	REASON_DATABASE_ERROR  = "database_error"
+
+	// label of the requests that did not match a route, so unknown paths do not create new series
+	ROUTE_UNMATCHED = "unmatched"
+)
+
+var ErrInvalidMetricsToken = custom_error.New(http.StatusUnauthorized, CODE_INVALID_METRICS_TOKEN,
+	MESSAGE_INVALID_METRICS_TOKEN)
+
+var registry = prometheus.NewRegistry()
+
+var (
+	httpRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: NAMESPACE,
+		Name:      "http_requests_total",
+		Help:      "Requests answered by route, method and status.",
+	}, []string{"method", "route", "status"})
+
+	httpDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: NAMESPACE,
+		Name:      "http_request_duration_seconds",
+		Help:      "Time taken to answer the requests by route, method and status.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method", "route", "status"})
+
+	logins = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: NAMESPACE,
+		Name:      "logins_total",
+		Help:      "Login attempts by outcome and failure reason.",
+	}, []string{"outcome", "reason"})
+
+	databaseDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: NAMESPACE,
+		Name:      "database_operation_duration_seconds",
+		Help:      "Time taken by the repository operations.",
+		Buckets:   []float64{.001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5},
+	}, []string{"repository", "operation"})
+)
+
+func init() {
+	i18n.Register(map[string]i18n.Translation{
+		CODE_INVALID_METRICS_TOKEN: {Es: MESSAGE_INVALID_METRICS_TOKEN, En: "The metrics token must be sent"},
+	})
+
+	registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		httpRequests,
+		httpDuration,
+		logins,
+		databaseDuration,
+	)
+}
+
+// Middleware records the count and duration of every request, labelled by the route template instead of the path
+func Middleware(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		start := time.Now()
+
+		if err := next(c); err != nil {
+			c.Error(err)
+		}
+
+		route := c.Path()
+		if route == "" {
+			route = ROUTE_UNMATCHED
+		}
+
+		status := strconv.Itoa(c.Response().Status)
+
+		httpRequests.WithLabelValues(c.Request().Method, route, status).Inc()
+		httpDuration.WithLabelValues(c.Request().Method, route, status).Observe(time.Since(start).Seconds())
+
+		return nil
+	}
+}
+
+// Handler exposes the metrics to Prometheus. When a token is configured the scraper must send it as a bearer token
+func Handler(metricsConfig config.Metrics) echo.HandlerFunc {
+	exporter := echo.WrapHandler(promhttp.HandlerFor(registry, promhttp.HandlerOpts{}))
+
+	return func(context echo.Context) error {
+		if metricsConfig.Token != "" {
+			expected := "Bearer " + metricsConfig.Token
+			received := context.Request().Header.Get(echo.HeaderAuthorization)
+
+			if subtle.ConstantTimeCompare([]byte(received), []byte(expected)) != 1 {
+				return ErrInvalidMetricsToken
+			}
+		}
+
+		return exporter(context)
+	}
+}
+
+// LoginSucceeded counts a user that got a token
+func LoginSucceeded() {
+	logins.WithLabelValues(OUTCOME_SUCCESS, REASON_NONE).Inc()
+}
+
+// LoginFailed counts a login rejected for the reason, one of the REASON constants
+func LoginFailed(reason string) {
+	logins.WithLabelValues(OUTCOME_FAILURE, reason).Inc()
+}
+
+// ObserveOperation records the duration of a repository operation started at start, it is meant to be deferred
+func ObserveOperation(repository, operation string, start time.Time) {
+	databaseDuration.WithLabelValues(repository, operation).Observe(time.Since(start).Seconds())
+}
@@ -0,0 +1,57 @@
+package metrics
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/ncardozo92/gapef_swimming_metrics/config"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMiddlewareLabelsByRoute(t *testing.T) {
+	e := echo.New()
+	e.Use(Middleware)
+	e.GET("/users/:id", func(context echo.Context) error {
+		return context.NoContent(http.StatusOK)
+	})
+
+	for _, path := range []string{"/users/1", "/users/2", "/unknown"} {
+		e.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, path, nil))
+	}
+
+	assert.Equal(t, 2.0, testutil.ToFloat64(httpRequests.WithLabelValues(http.MethodGet, "/users/:id", "200")))
+	assert.Equal(t, 1.0, testutil.ToFloat64(httpRequests.WithLabelValues(http.MethodGet, ROUTE_UNMATCHED, "404")))
+}
+
+func TestLoginCounters(t *testing.T) {
+	before := testutil.ToFloat64(logins.WithLabelValues(OUTCOME_FAILURE, REASON_BAD_PASSWORD))
+
+	LoginFailed(REASON_BAD_PASSWORD)
+	LoginSucceeded()
+
+	assert.Equal(t, before+1, testutil.ToFloat64(logins.WithLabelValues(OUTCOME_FAILURE, REASON_BAD_PASSWORD)))
+	assert.GreaterOrEqual(t, testutil.ToFloat64(logins.WithLabelValues(OUTCOME_SUCCESS, REASON_NONE)), 1.0)
+}
+
+func TestHandlerRequiresTheToken(t *testing.T) {
+	handler := Handler(config.Metrics{Token: "scraper"})
+
+	for _, header := range []string{"", "Bearer other"} {
+		request := httptest.NewRequest(http.MethodGet, PATH_METRICS, nil)
+		request.Header.Set(echo.HeaderAuthorization, header)
+
+		assert.ErrorIs(t, handler(echo.New().NewContext(request, httptest.NewRecorder())), ErrInvalidMetricsToken, header)
+	}
+
+	request := httptest.NewRequest(http.MethodGet, PATH_METRICS, nil)
+	request.Header.Set(echo.HeaderAuthorization, "Bearer scraper")
+	recorder := httptest.NewRecorder()
+
+	assert.NoError(t, handler(echo.New().NewContext(request, recorder)))
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	assert.True(t, strings.Contains(recorder.Body.String(), "go_goroutines"))
+}
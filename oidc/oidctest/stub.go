@@ -0,0 +1,148 @@
+// Package oidctest provides a local OpenID Connect provider to test the login flow without a real provider
+package oidctest
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	CLIENT_ID     = "gapef-test-client"
+	CLIENT_SECRET = "gapef-test-secret"
+	KEY_ID        = "stub-key"
+)
+
+// Authorization is what the user accepted at the provider login page
+type Authorization struct {
+	Email         string
+	EmailVerified bool
+	Nonce         string
+	CodeChallenge string
+}
+
+// StubProvider is an OpenID Connect provider that serves the discovery document, its keys and the token endpoint
+type StubProvider struct {
+	Server *httptest.Server
+	key    *rsa.PrivateKey
+
+	mutex sync.Mutex
+	codes map[string]Authorization
+}
+
+// NewStubProvider starts the provider, it must be closed with Close
+func NewStubProvider() (*StubProvider, error) {
+	key, keyErr := rsa.GenerateKey(rand.Reader, 2048)
+
+	if keyErr != nil {
+		return nil, keyErr
+	}
+
+	stub := &StubProvider{key: key, codes: map[string]Authorization{}}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", stub.discovery)
+	mux.HandleFunc("/jwks", stub.jwks)
+	mux.HandleFunc("/token", stub.token)
+
+	stub.Server = httptest.NewServer(mux)
+
+	return stub, nil
+}
+
+func (stub *StubProvider) Issuer() string {
+	return stub.Server.URL
+}
+
+func (stub *StubProvider) Close() {
+	stub.Server.Close()
+}
+
+// Authorize simulates the user logging in at the provider, the returned code is the one sent to the callback
+func (stub *StubProvider) Authorize(code string, authorization Authorization) {
+	stub.mutex.Lock()
+	defer stub.mutex.Unlock()
+
+	stub.codes[code] = authorization
+}
+
+// IdToken signs an id token for the email, used to test the validations of the token
+func (stub *StubProvider) IdToken(claims jwt.MapClaims) string {
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = KEY_ID
+
+	signedToken, _ := token.SignedString(stub.key)
+
+	return signedToken
+}
+
+func (stub *StubProvider) discovery(writer http.ResponseWriter, request *http.Request) {
+	writeJSON(writer, http.StatusOK, map[string]string{
+		"issuer":                 stub.Issuer(),
+		"authorization_endpoint": stub.Issuer() + "/authorize",
+		"token_endpoint":         stub.Issuer() + "/token",
+		"jwks_uri":               stub.Issuer() + "/jwks",
+	})
+}
+
+func (stub *StubProvider) jwks(writer http.ResponseWriter, request *http.Request) {
+	writeJSON(writer, http.StatusOK, map[string]any{
+		"keys": []map[string]string{{
+			"kty": "RSA",
+			"kid": KEY_ID,
+			"alg": "RS256",
+			"use": "sig",
+			"n":   base64.RawURLEncoding.EncodeToString(stub.key.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(stub.key.E)).Bytes()),
+		}},
+	})
+}
+
+// exchanges a code registered by Authorize, checking the client credentials and the PKCE verifier
+func (stub *StubProvider) token(writer http.ResponseWriter, request *http.Request) {
+	if request.ParseForm() != nil || request.PostForm.Get("grant_type") != "authorization_code" ||
+		request.PostForm.Get("client_id") != CLIENT_ID || request.PostForm.Get("client_secret") != CLIENT_SECRET {
+		writeJSON(writer, http.StatusBadRequest, map[string]string{"error": "invalid_request"})
+		return
+	}
+
+	stub.mutex.Lock()
+	authorization, codeFound := stub.codes[request.PostForm.Get("code")]
+	delete(stub.codes, request.PostForm.Get("code"))
+	stub.mutex.Unlock()
+
+	verifierHash := sha256.Sum256([]byte(request.PostForm.Get("code_verifier")))
+
+	if !codeFound || base64.RawURLEncoding.EncodeToString(verifierHash[:]) != authorization.CodeChallenge {
+		writeJSON(writer, http.StatusBadRequest, map[string]string{"error": "invalid_grant"})
+		return
+	}
+
+	idToken := stub.IdToken(jwt.MapClaims{
+		"iss":            stub.Issuer(),
+		"aud":            CLIENT_ID,
+		"sub":            "stub|" + authorization.Email,
+		"email":          authorization.Email,
+		"email_verified": authorization.EmailVerified,
+		"nonce":          authorization.Nonce,
+		"iat":            time.Now().Unix(),
+		"exp":            time.Now().Add(time.Minute).Unix(),
+	})
+
+	writeJSON(writer, http.StatusOK, map[string]string{"access_token": "stub-access-token", "token_type": "Bearer", "id_token": idToken})
+}
+
+func writeJSON(writer http.ResponseWriter, status int, body any) {
+	writer.Header().Set("Content-Type", "application/json")
+	writer.WriteHeader(status)
+	json.NewEncoder(writer).Encode(body)
+}
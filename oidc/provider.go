@@ -0,0 +1,298 @@
+// Package oidc implements the OpenID Connect authorization code flow with PKCE against an external identity
+// provider, like Google Workspace
+package oidc
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	DISCOVERY_PATH        = "/.well-known/openid-configuration"
+	SCOPES                = "openid email profile"
+	CODE_CHALLENGE_METHOD = "S256"
+	HTTP_TIMEOUT          = 10 * time.Second
+	// the keys of the provider are fetched again after this period, or when a token has an unknown key id
+	JWKS_CACHE_LIFETIME = time.Hour
+)
+
+var (
+	ErrInvalidIdToken = errors.New("the id token is not valid")
+	ErrTokenExchange  = errors.New("the authorization code could not be exchanged")
+)
+
+// Identity is the user authenticated by the provider
+type Identity struct {
+	Subject       string
+	Email         string
+	EmailVerified bool
+}
+
+type discoveryDocument struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JwksURI               string `json:"jwks_uri"`
+}
+
+type jsonWebKey struct {
+	KeyType  string `json:"kty"`
+	KeyId    string `json:"kid"`
+	Modulus  string `json:"n"`
+	Exponent string `json:"e"`
+	Curve    string `json:"crv"`
+	X        string `json:"x"`
+	Y        string `json:"y"`
+}
+
+type idTokenClaims struct {
+	Email         string `json:"email"`
+	EmailVerified any    `json:"email_verified"`
+	Nonce         string `json:"nonce"`
+	jwt.RegisteredClaims
+}
+
+// Provider is an OpenID Connect provider configured from its discovery document
+type Provider struct {
+	ClientId     string
+	ClientSecret string
+	RedirectURL  string
+	discovery    discoveryDocument
+	httpClient   *http.Client
+
+	keysMutex     sync.Mutex
+	keys          map[string]any
+	keysFetchedAt time.Time
+}
+
+// Discover reads the discovery document of the issuer and returns the provider configured with it
+func Discover(ctx context.Context, issuer, clientId, clientSecret, redirectURL string) (*Provider, error) {
+
+	provider := &Provider{
+		ClientId:     clientId,
+		ClientSecret: clientSecret,
+		RedirectURL:  redirectURL,
+		httpClient:   &http.Client{Timeout: HTTP_TIMEOUT},
+	}
+
+	discoveryURL := strings.TrimSuffix(issuer, "/") + DISCOVERY_PATH
+
+	if fetchErr := provider.getJSON(ctx, discoveryURL, &provider.discovery); fetchErr != nil {
+		return nil, fmt.Errorf("cannot read the discovery document, %w", fetchErr)
+	}
+
+	// the document must belong to the configured issuer, otherwise its tokens would not validate
+	if provider.discovery.Issuer != issuer {
+		return nil, fmt.Errorf("the discovery document issuer %s does not match %s", provider.discovery.Issuer, issuer)
+	}
+
+	return provider, nil
+}
+
+// AuthCodeURL returns the URL of the provider login page the user must be redirected to
+func (provider *Provider) AuthCodeURL(state, nonce, codeChallenge string) string {
+	query := url.Values{}
+	query.Set("response_type", "code")
+	query.Set("client_id", provider.ClientId)
+	query.Set("redirect_uri", provider.RedirectURL)
+	query.Set("scope", SCOPES)
+	query.Set("state", state)
+	query.Set("nonce", nonce)
+	query.Set("code_challenge", codeChallenge)
+	query.Set("code_challenge_method", CODE_CHALLENGE_METHOD)
+
+	separator := "?"
+	if strings.Contains(provider.discovery.AuthorizationEndpoint, "?") {
+		separator = "&"
+	}
+
+	return provider.discovery.AuthorizationEndpoint + separator + query.Encode()
+}
+
+// Exchange trades the authorization code for the tokens of the user and returns the identity of the validated id token
+func (provider *Provider) Exchange(ctx context.Context, code, codeVerifier, nonce string) (Identity, error) {
+
+	form := url.Values{}
+	form.Set("grant_type", "authorization_code")
+	form.Set("code", code)
+	form.Set("redirect_uri", provider.RedirectURL)
+	form.Set("client_id", provider.ClientId)
+	form.Set("client_secret", provider.ClientSecret)
+	form.Set("code_verifier", codeVerifier)
+
+	request, requestErr := http.NewRequestWithContext(ctx, http.MethodPost, provider.discovery.TokenEndpoint, strings.NewReader(form.Encode()))
+
+	if requestErr != nil {
+		return Identity{}, requestErr
+	}
+
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	request.Header.Set("Accept", "application/json")
+
+	response, responseErr := provider.httpClient.Do(request)
+
+	if responseErr != nil {
+		return Identity{}, fmt.Errorf("%w, %v", ErrTokenExchange, responseErr)
+	}
+
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		return Identity{}, fmt.Errorf("%w, the provider answered %d", ErrTokenExchange, response.StatusCode)
+	}
+
+	tokens := struct {
+		IdToken string `json:"id_token"`
+	}{}
+
+	if decodingErr := json.NewDecoder(response.Body).Decode(&tokens); decodingErr != nil || tokens.IdToken == "" {
+		return Identity{}, fmt.Errorf("%w, the response has no id token", ErrTokenExchange)
+	}
+
+	return provider.VerifyIdToken(ctx, tokens.IdToken, nonce)
+}
+
+// VerifyIdToken checks the signature, issuer, audience, expiration and nonce of the id token
+func (provider *Provider) VerifyIdToken(ctx context.Context, rawIdToken, nonce string) (Identity, error) {
+
+	claims := idTokenClaims{}
+
+	_, parsingErr := jwt.ParseWithClaims(rawIdToken, &claims, func(token *jwt.Token) (interface{}, error) {
+		keyId, _ := token.Header["kid"].(string)
+		return provider.publicKey(ctx, keyId)
+	},
+		jwt.WithValidMethods([]string{"RS256", "ES256"}),
+		jwt.WithIssuer(provider.discovery.Issuer),
+		jwt.WithAudience(provider.ClientId),
+		jwt.WithExpirationRequired(),
+	)
+
+	if parsingErr != nil {
+		return Identity{}, fmt.Errorf("%w, %v", ErrInvalidIdToken, parsingErr)
+	}
+
+	if claims.Nonce == "" || claims.Nonce != nonce {
+		return Identity{}, fmt.Errorf("%w, the nonce does not match", ErrInvalidIdToken)
+	}
+
+	// some providers send email_verified as a string
+	emailVerified := claims.EmailVerified == true || claims.EmailVerified == "true"
+
+	return Identity{Subject: claims.Subject, Email: claims.Email, EmailVerified: emailVerified}, nil
+}
+
+// finds the key of the provider, fetching its JWKS again when the key is unknown or the cache expired
+func (provider *Provider) publicKey(ctx context.Context, keyId string) (any, error) {
+	provider.keysMutex.Lock()
+	defer provider.keysMutex.Unlock()
+
+	if key, known := provider.keys[keyId]; known && time.Since(provider.keysFetchedAt) < JWKS_CACHE_LIFETIME {
+		return key, nil
+	}
+
+	jwks := struct {
+		Keys []jsonWebKey `json:"keys"`
+	}{}
+
+	if fetchErr := provider.getJSON(ctx, provider.discovery.JwksURI, &jwks); fetchErr != nil {
+		return nil, fmt.Errorf("cannot read the provider keys, %w", fetchErr)
+	}
+
+	provider.keys = map[string]any{}
+	provider.keysFetchedAt = time.Now()
+
+	for _, jwk := range jwks.Keys {
+		if key, keyErr := jwk.publicKey(); keyErr == nil {
+			provider.keys[jwk.KeyId] = key
+		}
+	}
+
+	key, known := provider.keys[keyId]
+
+	if !known {
+		return nil, fmt.Errorf("the provider has no key %s", keyId)
+	}
+
+	return key, nil
+}
+
+func (provider *Provider) getJSON(ctx context.Context, resourceURL string, target any) error {
+	request, requestErr := http.NewRequestWithContext(ctx, http.MethodGet, resourceURL, nil)
+
+	if requestErr != nil {
+		return requestErr
+	}
+
+	response, responseErr := provider.httpClient.Do(request)
+
+	if responseErr != nil {
+		return responseErr
+	}
+
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s answered %d", resourceURL, response.StatusCode)
+	}
+
+	return json.NewDecoder(response.Body).Decode(target)
+}
+
+// converts the JSON Web Key into a RSA or ECDSA public key
+func (jwk jsonWebKey) publicKey() (any, error) {
+	switch jwk.KeyType {
+	case "RSA":
+		modulus, modulusErr := base64.RawURLEncoding.DecodeString(jwk.Modulus)
+		exponent, exponentErr := base64.RawURLEncoding.DecodeString(jwk.Exponent)
+
+		if modulusErr != nil || exponentErr != nil {
+			return nil, errors.New("invalid RSA key")
+		}
+
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(modulus), E: int(new(big.Int).SetBytes(exponent).Int64())}, nil
+	case "EC":
+		x, xErr := base64.RawURLEncoding.DecodeString(jwk.X)
+		y, yErr := base64.RawURLEncoding.DecodeString(jwk.Y)
+
+		if xErr != nil || yErr != nil || jwk.Curve != "P-256" {
+			return nil, errors.New("invalid EC key")
+		}
+
+		return &ecdsa.PublicKey{Curve: elliptic.P256(), X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}, nil
+	default:
+		return nil, fmt.Errorf("the key type %s is not supported", jwk.KeyType)
+	}
+}
+
+// RandomString returns a random URL safe string, used for the state, nonce and PKCE code verifier
+func RandomString() (string, error) {
+	randomBytes := make([]byte, 32)
+
+	if _, randomErr := rand.Read(randomBytes); randomErr != nil {
+		return "", randomErr
+	}
+
+	return base64.RawURLEncoding.EncodeToString(randomBytes), nil
+}
+
+// CodeChallenge returns the S256 PKCE challenge of the code verifier
+func CodeChallenge(codeVerifier string) string {
+	hash := sha256.Sum256([]byte(codeVerifier))
+	return base64.RawURLEncoding.EncodeToString(hash[:])
+}
@@ -0,0 +1,96 @@
+package oidc
+
+import (
+	"context"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/ncardozo92/gapef_swimming_metrics/oidc/oidctest"
+	"github.com/stretchr/testify/assert"
+)
+
+const redirectURL = "http://localhost:8080/login/oidc/callback"
+
+func newTestProvider(t *testing.T) (*Provider, *oidctest.StubProvider) {
+	stub, stubErr := oidctest.NewStubProvider()
+	assert.NoError(t, stubErr)
+	t.Cleanup(stub.Close)
+
+	provider, discoveryErr := Discover(context.Background(), stub.Issuer(), oidctest.CLIENT_ID, oidctest.CLIENT_SECRET, redirectURL)
+	assert.NoError(t, discoveryErr)
+
+	return provider, stub
+}
+
+func TestAuthCodeURL(t *testing.T) {
+	provider, stub := newTestProvider(t)
+
+	authURL, parsingErr := url.Parse(provider.AuthCodeURL("the-state", "the-nonce", CodeChallenge("verifier")))
+	assert.NoError(t, parsingErr)
+
+	assert.Equal(t, stub.Issuer()+"/authorize", authURL.Scheme+"://"+authURL.Host+authURL.Path)
+	assert.Equal(t, "the-state", authURL.Query().Get("state"))
+	assert.Equal(t, "the-nonce", authURL.Query().Get("nonce"))
+	assert.Equal(t, CODE_CHALLENGE_METHOD, authURL.Query().Get("code_challenge_method"))
+	assert.Equal(t, redirectURL, authURL.Query().Get("redirect_uri"))
+}
+
+func TestExchange(t *testing.T) {
+	provider, stub := newTestProvider(t)
+
+	verifier, _ := RandomString()
+	stub.Authorize("the-code", oidctest.Authorization{Email: "joan@gapef.com.ar", EmailVerified: true, Nonce: "the-nonce", CodeChallenge: CodeChallenge(verifier)})
+
+	identity, exchangeErr := provider.Exchange(context.Background(), "the-code", verifier, "the-nonce")
+
+	assert.NoError(t, exchangeErr)
+	assert.Equal(t, "joan@gapef.com.ar", identity.Email)
+	assert.True(t, identity.EmailVerified)
+}
+
+func TestExchangeWithWrongVerifierFails(t *testing.T) {
+	provider, stub := newTestProvider(t)
+
+	stub.Authorize("the-code", oidctest.Authorization{Email: "joan@gapef.com.ar", Nonce: "the-nonce", CodeChallenge: CodeChallenge("verifier")})
+
+	_, exchangeErr := provider.Exchange(context.Background(), "the-code", "another-verifier", "the-nonce")
+
+	assert.ErrorIs(t, exchangeErr, ErrTokenExchange)
+}
+
+func TestVerifyIdTokenValidations(t *testing.T) {
+	provider, stub := newTestProvider(t)
+
+	validClaims := func() jwt.MapClaims {
+		return jwt.MapClaims{
+			"iss":   stub.Issuer(),
+			"aud":   oidctest.CLIENT_ID,
+			"sub":   "1",
+			"email": "joan@gapef.com.ar",
+			"nonce": "the-nonce",
+			"exp":   time.Now().Add(time.Minute).Unix(),
+		}
+	}
+
+	wrongIssuer := validClaims()
+	wrongIssuer["iss"] = "https://evil.example.com"
+
+	wrongAudience := validClaims()
+	wrongAudience["aud"] = "another-client"
+
+	expired := validClaims()
+	expired["exp"] = time.Now().Add(-time.Minute).Unix()
+
+	wrongNonce := validClaims()
+	wrongNonce["nonce"] = "another-nonce"
+
+	_, validErr := provider.VerifyIdToken(context.Background(), stub.IdToken(validClaims()), "the-nonce")
+	assert.NoError(t, validErr)
+
+	for _, claims := range []jwt.MapClaims{wrongIssuer, wrongAudience, expired, wrongNonce} {
+		_, verificationErr := provider.VerifyIdToken(context.Background(), stub.IdToken(claims), "the-nonce")
+		assert.ErrorIs(t, verificationErr, ErrInvalidIdToken)
+	}
+}
@@ -0,0 +1,47 @@
+package openapi
+
+import (
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	PATH_OPENAPI = "/openapi.json"
+	PATH_DOCS    = "/docs"
+
+	// version of the Swagger UI bundle loaded by the docs page
+	SWAGGER_UI_VERSION = "5.17.14"
+)
+
+// the docs page loads Swagger UI from a CDN, so the application does not serve its assets
+const swaggerUIPage = `<!DOCTYPE html>
+<html lang="en">
+<head>
+  <meta charset="utf-8">
+  <meta name="viewport" content="width=device-width, initial-scale=1">
+  <title>GAPEF Swimming Metrics API</title>
+  <link rel="stylesheet" href="https://unpkg.com/swagger-ui-dist@` + SWAGGER_UI_VERSION + `/swagger-ui.css">
+</head>
+<body>
+  <div id="swagger-ui"></div>
+  <script src="https://unpkg.com/swagger-ui-dist@` + SWAGGER_UI_VERSION + `/swagger-ui-bundle.js" crossorigin></script>
+  <script>
+    window.onload = () => {
+      window.ui = SwaggerUIBundle({ url: "` + PATH_OPENAPI + `", dom_id: "#swagger-ui" });
+    };
+  </script>
+</body>
+</html>`
+
+// Handler answers the document
+func Handler(document *Document) echo.HandlerFunc {
+	return func(context echo.Context) error {
+		return context.JSON(http.StatusOK, document)
+	}
+}
+
+// SwaggerUI answers the page to browse and try the operations of the document
+func SwaggerUI(context echo.Context) error {
+	return context.HTML(http.StatusOK, swaggerUIPage)
+}
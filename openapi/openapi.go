@@ -0,0 +1,255 @@
+// Package openapi describes the API as an OpenAPI 3 document and serves it with an interactive page
+package openapi
+
+import (
+	"path"
+	"reflect"
+	"regexp"
+	"strings"
+	"time"
+)
+
+const (
+	VERSION = "3.0.3"
+
+	IN_PATH   = "path"
+	IN_QUERY  = "query"
+	IN_HEADER = "header"
+
+	MIME_JSON      = "application/json"
+	MIME_MULTIPART = "multipart/form-data"
+	MIME_TEXT      = "text/plain"
+	MIME_CSV       = "text/csv"
+
+	// prefix of the references to the schemas of the components
+	SCHEMA_REF_PREFIX = "#/components/schemas/"
+)
+
+// the params of the echo paths, like :id, are written {id} in the document
+var pathParamRegex = regexp.MustCompile(`:([A-Za-z0-9_]+)`)
+
+type Document struct {
+	OpenAPI    string              `json:"openapi"`
+	Info       Info                `json:"info"`
+	Paths      map[string]PathItem `json:"paths"`
+	Components Components          `json:"components"`
+}
+
+type Info struct {
+	Title       string `json:"title"`
+	Description string `json:"description,omitempty"`
+	Version     string `json:"version"`
+}
+
+// PathItem are the operations of a path keyed by their method in lower case
+type PathItem map[string]Operation
+
+type Operation struct {
+	Summary     string                `json:"summary"`
+	Description string                `json:"description,omitempty"`
+	Tags        []string              `json:"tags,omitempty"`
+	Parameters  []Parameter           `json:"parameters,omitempty"`
+	RequestBody *RequestBody          `json:"requestBody,omitempty"`
+	Responses   map[string]Response   `json:"responses"`
+	Security    []map[string][]string `json:"security,omitempty"`
+}
+
+type Parameter struct {
+	Name        string  `json:"name"`
+	In          string  `json:"in"`
+	Description string  `json:"description,omitempty"`
+	Required    bool    `json:"required,omitempty"`
+	Schema      *Schema `json:"schema"`
+}
+
+type RequestBody struct {
+	Required bool                 `json:"required"`
+	Content  map[string]MediaType `json:"content"`
+}
+
+type Response struct {
+	Description string               `json:"description"`
+	Content     map[string]MediaType `json:"content,omitempty"`
+}
+
+type MediaType struct {
+	Schema *Schema `json:"schema"`
+}
+
+type Schema struct {
+	Ref                  string             `json:"$ref,omitempty"`
+	Type                 string             `json:"type,omitempty"`
+	Format               string             `json:"format,omitempty"`
+	Nullable             bool               `json:"nullable,omitempty"`
+	Enum                 []string           `json:"enum,omitempty"`
+	Items                *Schema            `json:"items,omitempty"`
+	Properties           map[string]*Schema `json:"properties,omitempty"`
+	AdditionalProperties *Schema            `json:"additionalProperties,omitempty"`
+}
+
+type Components struct {
+	Schemas         map[string]*Schema        `json:"schemas"`
+	SecuritySchemes map[string]SecurityScheme `json:"securitySchemes"`
+}
+
+type SecurityScheme struct {
+	Type         string `json:"type"`
+	Description  string `json:"description,omitempty"`
+	Scheme       string `json:"scheme,omitempty"`
+	BearerFormat string `json:"bearerFormat,omitempty"`
+	In           string `json:"in,omitempty"`
+	Name         string `json:"name,omitempty"`
+}
+
+// Returns a new empty document of the API
+func New(info Info) *Document {
+	return &Document{
+		OpenAPI: VERSION,
+		Info:    info,
+		Paths:   map[string]PathItem{},
+		Components: Components{
+			Schemas:         map[string]*Schema{},
+			SecuritySchemes: map[string]SecurityScheme{},
+		},
+	}
+}
+
+// Add documents the operation of an echo route, the params of the path are added when the operation does not
+// describe them
+func (document *Document) Add(method, echoPath string, operation Operation) {
+	documentPath := ToPath(echoPath)
+
+	for _, match := range pathParamRegex.FindAllStringSubmatch(echoPath, -1) {
+		if !hasParameter(operation.Parameters, match[1], IN_PATH) {
+			operation.Parameters = append(operation.Parameters,
+				Parameter{Name: match[1], In: IN_PATH, Required: true, Schema: &Schema{Type: "string"}})
+		}
+	}
+
+	if document.Paths[documentPath] == nil {
+		document.Paths[documentPath] = PathItem{}
+	}
+
+	document.Paths[documentPath][strings.ToLower(method)] = operation
+}
+
+// Has checks if the operation of an echo route is documented
+func (document *Document) Has(method, echoPath string) bool {
+	_, documented := document.Paths[ToPath(echoPath)][strings.ToLower(method)]
+
+	return documented
+}
+
+// Schema returns a reference to the schema of the type of the value, which is added to the components with the
+// schemas of its fields. The properties are the JSON fields of the structs
+func (document *Document) Schema(value any) *Schema {
+	return document.schemaOf(reflect.TypeOf(value))
+}
+
+// JSON returns the content of a JSON body with the schema of the value
+func (document *Document) JSON(value any) map[string]MediaType {
+	return map[string]MediaType{MIME_JSON: {Schema: document.Schema(value)}}
+}
+
+func (document *Document) schemaOf(valueType reflect.Type) *Schema {
+	if valueType == nil {
+		return &Schema{}
+	}
+
+	if valueType == reflect.TypeOf(time.Time{}) {
+		return &Schema{Type: "string", Format: "date-time"}
+	}
+
+	switch valueType.Kind() {
+	case reflect.Pointer:
+		schema := *document.schemaOf(valueType.Elem())
+		if schema.Ref != "" {
+			return &schema
+		}
+		schema.Nullable = true
+		return &schema
+	case reflect.Bool:
+		return &Schema{Type: "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Uint, reflect.Uint8, reflect.Uint16,
+		reflect.Uint32:
+		return &Schema{Type: "integer", Format: "int32"}
+	case reflect.Int64, reflect.Uint64:
+		return &Schema{Type: "integer", Format: "int64"}
+	case reflect.Float32, reflect.Float64:
+		return &Schema{Type: "number"}
+	case reflect.String:
+		return &Schema{Type: "string"}
+	case reflect.Slice, reflect.Array:
+		return &Schema{Type: "array", Items: document.schemaOf(valueType.Elem())}
+	case reflect.Map:
+		return &Schema{Type: "object", AdditionalProperties: document.schemaOf(valueType.Elem())}
+	case reflect.Struct:
+		return document.structSchema(valueType)
+	default:
+		// interfaces can have any value
+		return &Schema{}
+	}
+}
+
+// the named structs are added once to the components and referenced by their name, the anonymous ones are inlined
+func (document *Document) structSchema(structType reflect.Type) *Schema {
+	schema := &Schema{Type: "object", Properties: map[string]*Schema{}}
+	reference := schema
+
+	if structType.Name() != "" {
+		name := schemaName(structType)
+		reference = &Schema{Ref: SCHEMA_REF_PREFIX + name}
+
+		if _, added := document.Components.Schemas[name]; added {
+			return reference
+		}
+
+		// added before the fields, so the structs that reference themselves end
+		document.Components.Schemas[name] = schema
+	}
+
+	for index := 0; index < structType.NumField(); index++ {
+		field := structType.Field(index)
+		jsonName, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+
+		if !field.IsExported() || jsonName == "-" {
+			continue
+		}
+
+		if jsonName == "" {
+			jsonName = field.Name
+		}
+
+		schema.Properties[jsonName] = document.schemaOf(field.Type)
+	}
+
+	return reference
+}
+
+// ToPath writes an echo path the way the document does
+func ToPath(echoPath string) string {
+	return pathParamRegex.ReplaceAllString(echoPath, "{$1}")
+}
+
+// the name of a struct is qualified by its package, as several packages have a DTO. The generic types are named
+// after their type argument, like listing.Page_user.DTO
+func schemaName(structType reflect.Type) string {
+	name := structType.Name()
+
+	if typeParams, isGeneric := strings.CutSuffix(name, "]"); isGeneric {
+		genericName, typeArgument, _ := strings.Cut(typeParams, "[")
+		name = genericName + "_" + path.Base(typeArgument)
+	}
+
+	return path.Base(structType.PkgPath()) + "." + name
+}
+
+func hasParameter(parameters []Parameter, name, in string) bool {
+	for _, parameter := range parameters {
+		if parameter.Name == name && parameter.In == in {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,60 @@
+package openapi
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type lane struct {
+	Number int `json:"number"`
+}
+
+type swimmer struct {
+	Name     string             `json:"name"`
+	Birth    time.Time          `json:"birth"`
+	Coach    *string            `json:"coach,omitempty"`
+	Lanes    []lane             `json:"lanes"`
+	Times    map[string]float64 `json:"times"`
+	Extra    any                `json:"extra"`
+	Password string             `json:"-"`
+	internal string
+}
+
+type page[T any] struct {
+	Items []T `json:"items"`
+}
+
+func TestSchema(t *testing.T) {
+	document := New(Info{Title: "test", Version: "1"})
+
+	assert.Equal(t, &Schema{Ref: SCHEMA_REF_PREFIX + "openapi.swimmer"}, document.Schema(swimmer{}))
+	assert.Equal(t, &Schema{Type: "array", Items: &Schema{Ref: SCHEMA_REF_PREFIX + "openapi.lane"}}, document.Schema([]lane{}))
+
+	assert.Equal(t, &Schema{Type: "object", Properties: map[string]*Schema{
+		"name":  {Type: "string"},
+		"birth": {Type: "string", Format: "date-time"},
+		"coach": {Type: "string", Nullable: true},
+		"lanes": {Type: "array", Items: &Schema{Ref: SCHEMA_REF_PREFIX + "openapi.lane"}},
+		"times": {Type: "object", AdditionalProperties: &Schema{Type: "number"}},
+		"extra": {},
+	}}, document.Components.Schemas["openapi.swimmer"])
+
+	// the generic types are named after their type argument
+	assert.Equal(t, &Schema{Ref: SCHEMA_REF_PREFIX + "openapi.page_openapi.lane"}, document.Schema(page[lane]{}))
+}
+
+func TestAdd(t *testing.T) {
+	document := New(Info{Title: "test", Version: "1"})
+
+	document.Add(http.MethodPost, "/users/:id/athletes", Operation{Summary: "link"})
+
+	assert.True(t, document.Has(http.MethodPost, "/users/:id/athletes"))
+	assert.False(t, document.Has(http.MethodGet, "/users/:id/athletes"))
+
+	operation := document.Paths["/users/{id}/athletes"]["post"]
+	assert.Equal(t, []Parameter{{Name: "id", In: IN_PATH, Required: true, Schema: &Schema{Type: "string"}}},
+		operation.Parameters)
+}
@@ -0,0 +1,140 @@
+package password
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	// length of the SHA-1 prefix used to group the hashes, the same used by the Pwned Passwords range API
+	HASH_PREFIX_LENGTH = 5
+	SHA1_HEX_LENGTH    = 40
+)
+
+// BreachedList holds the SHA-1 hashes of leaked passwords grouped by the first characters of the hash, like the
+// k-anonymity ranges of Pwned Passwords. The passwords themselves are never stored
+type BreachedList struct {
+	ranges map[string]map[string]struct{}
+}
+
+// LoadBreachedList reads the hashes from a file or a directory. A file has a full SHA-1 hash per line, a directory
+// has a file per range named after the hash prefix, with the rest of the hash per line. In both cases the hash can
+// be followed by ":" and the times it was seen, as downloaded from Pwned Passwords
+func LoadBreachedList(path string) (*BreachedList, error) {
+	info, statErr := os.Stat(path)
+
+	if statErr != nil {
+		return nil, statErr
+	}
+
+	list := &BreachedList{ranges: map[string]map[string]struct{}{}}
+
+	if !info.IsDir() {
+		return list, list.readFile(path, "")
+	}
+
+	rangeFiles, readDirErr := os.ReadDir(path)
+
+	if readDirErr != nil {
+		return nil, readDirErr
+	}
+
+	for _, rangeFile := range rangeFiles {
+		if rangeFile.IsDir() {
+			continue
+		}
+
+		prefix := strings.TrimSuffix(rangeFile.Name(), filepath.Ext(rangeFile.Name()))
+
+		if len(prefix) != HASH_PREFIX_LENGTH {
+			continue
+		}
+
+		if readErr := list.readFile(filepath.Join(path, rangeFile.Name()), prefix); readErr != nil {
+			return nil, readErr
+		}
+	}
+
+	return list, nil
+}
+
+// Contains checks if the password is one of the leaked passwords
+func (list *BreachedList) Contains(password string) bool {
+	hash := sha1Hex(password)
+
+	_, found := list.Range(hash[:HASH_PREFIX_LENGTH])[hash[HASH_PREFIX_LENGTH:]]
+
+	return found
+}
+
+// Range returns the hash suffixes of the leaked passwords whose hash starts with the prefix
+func (list *BreachedList) Range(prefix string) map[string]struct{} {
+	return list.ranges[strings.ToUpper(prefix)]
+}
+
+// Size returns how many hashes are loaded
+func (list *BreachedList) Size() int {
+	size := 0
+
+	for _, suffixes := range list.ranges {
+		size += len(suffixes)
+	}
+
+	return size
+}
+
+// reads the hashes of a file, the prefix is empty when the file has full hashes
+func (list *BreachedList) readFile(path, prefix string) error {
+	file, openErr := os.Open(path)
+
+	if openErr != nil {
+		return openErr
+	}
+
+	defer file.Close()
+
+	return list.read(file, strings.ToUpper(prefix))
+}
+
+func (list *BreachedList) read(reader io.Reader, prefix string) error {
+	scanner := bufio.NewScanner(reader)
+	lineNumber := 0
+
+	for scanner.Scan() {
+		lineNumber++
+		hash, _, _ := strings.Cut(strings.TrimSpace(scanner.Text()), ":")
+
+		if hash == "" {
+			continue
+		}
+
+		hash = prefix + strings.ToUpper(hash)
+
+		if _, decodingErr := hex.DecodeString(hash); decodingErr != nil || len(hash) != SHA1_HEX_LENGTH {
+			return fmt.Errorf("invalid SHA-1 hash at line %d of the breached passwords", lineNumber)
+		}
+
+		suffixes, rangeExists := list.ranges[hash[:HASH_PREFIX_LENGTH]]
+
+		if !rangeExists {
+			suffixes = map[string]struct{}{}
+			list.ranges[hash[:HASH_PREFIX_LENGTH]] = suffixes
+		}
+
+		suffixes[hash[HASH_PREFIX_LENGTH:]] = struct{}{}
+	}
+
+	return scanner.Err()
+}
+
+func sha1Hex(password string) string {
+	hash := sha1.Sum([]byte(password))
+
+	return strings.ToUpper(hex.EncodeToString(hash[:]))
+}
@@ -0,0 +1,164 @@
+// Package password checks that the passwords chosen by the users follow the password policy of the club
+package password
+
+import (
+	"strings"
+	"unicode"
+
+	"github.com/ncardozo92/gapef_swimming_metrics/config"
+	"github.com/ncardozo92/gapef_swimming_metrics/i18n"
+)
+
+const (
+	DEFAULT_MIN_LENGTH = 10
+	// bcrypt refuses the passwords longer than this, in bytes
+	MAX_LENGTH = 72
+	// usernames and emails shorter than this are not searched inside the password
+	MIN_PERSONAL_DATA_LENGTH = 3
+
+	DETAIL_TOO_SHORT         = "La contraseña debe tener al menos %d caracteres"
+	DETAIL_TOO_LONG          = "La contraseña no puede superar los %d bytes"
+	DETAIL_MISSING_LOWER     = "La contraseña debe tener al menos una letra minúscula"
+	DETAIL_MISSING_UPPER     = "La contraseña debe tener al menos una letra mayúscula"
+	DETAIL_MISSING_DIGIT     = "La contraseña debe tener al menos un número"
+	DETAIL_MISSING_SYMBOL    = "La contraseña debe tener al menos un símbolo"
+	DETAIL_CONTAINS_USERNAME = "La contraseña no puede contener el nombre de usuario"
+	DETAIL_CONTAINS_EMAIL    = "La contraseña no puede contener el email"
+	DETAIL_BREACHED          = "La contraseña apareció en una filtración de datos, elija otra"
+
+	CODE_TOO_SHORT         = "password_too_short"
+	CODE_TOO_LONG          = "password_too_long"
+	CODE_MISSING_LOWER     = "password_missing_lower"
+	CODE_MISSING_UPPER     = "password_missing_upper"
+	CODE_MISSING_DIGIT     = "password_missing_digit"
+	CODE_MISSING_SYMBOL    = "password_missing_symbol"
+	CODE_CONTAINS_USERNAME = "password_contains_username"
+	CODE_CONTAINS_EMAIL    = "password_contains_email"
+	CODE_BREACHED          = "password_breached"
+)
+
+func init() {
+	i18n.Register(map[string]i18n.Translation{
+		CODE_TOO_SHORT:         {Es: DETAIL_TOO_SHORT, En: "The password must have at least %d characters"},
+		CODE_TOO_LONG:          {Es: DETAIL_TOO_LONG, En: "The password cannot be longer than %d bytes"},
+		CODE_MISSING_LOWER:     {Es: DETAIL_MISSING_LOWER, En: "The password must have at least one lowercase letter"},
+		CODE_MISSING_UPPER:     {Es: DETAIL_MISSING_UPPER, En: "The password must have at least one uppercase letter"},
+		CODE_MISSING_DIGIT:     {Es: DETAIL_MISSING_DIGIT, En: "The password must have at least one number"},
+		CODE_MISSING_SYMBOL:    {Es: DETAIL_MISSING_SYMBOL, En: "The password must have at least one symbol"},
+		CODE_CONTAINS_USERNAME: {Es: DETAIL_CONTAINS_USERNAME, En: "The password cannot contain the username"},
+		CODE_CONTAINS_EMAIL:    {Es: DETAIL_CONTAINS_EMAIL, En: "The password cannot contain the email"},
+		CODE_BREACHED:          {Es: DETAIL_BREACHED, En: "The password appeared in a data breach, choose another one"},
+	})
+}
+
+// Policy describes the rules a password must follow
+type Policy struct {
+	MinLength     int
+	RequireLower  bool
+	RequireUpper  bool
+	RequireDigit  bool
+	RequireSymbol bool
+	// passwords known to be leaked, nil when no list was loaded
+	Breached *BreachedList
+}
+
+// DefaultPolicy returns the policy used when nothing is configured
+func DefaultPolicy() Policy {
+	return Policy{
+		MinLength:    DEFAULT_MIN_LENGTH,
+		RequireLower: true,
+		RequireUpper: true,
+		RequireDigit: true,
+	}
+}
+
+// NewPolicy builds the policy of the password configuration, loading the breached passwords when a file is set
+func NewPolicy(passwordConfig config.Password) (Policy, error) {
+	policy := Policy{
+		MinLength:     passwordConfig.MinLength,
+		RequireLower:  passwordConfig.RequireLower,
+		RequireUpper:  passwordConfig.RequireUpper,
+		RequireDigit:  passwordConfig.RequireDigit,
+		RequireSymbol: passwordConfig.RequireSymbol,
+	}
+
+	if passwordConfig.BreachedFile != "" {
+		breached, loadingErr := LoadBreachedList(passwordConfig.BreachedFile)
+
+		if loadingErr != nil {
+			return policy, loadingErr
+		}
+
+		policy.Breached = breached
+	}
+
+	return policy, nil
+}
+
+// Validate returns the rules the password breaks, it is empty when the password is valid
+func (policy Policy) Validate(password, username, email string) []i18n.Message {
+	details := []i18n.Message{}
+
+	if len([]rune(password)) < policy.MinLength {
+		details = append(details, i18n.NewMessage(CODE_TOO_SHORT, policy.MinLength))
+	}
+
+	// the characters that are not ASCII take more than one byte
+	if len(password) > MAX_LENGTH {
+		details = append(details, i18n.NewMessage(CODE_TOO_LONG, MAX_LENGTH))
+	}
+
+	var hasLower, hasUpper, hasDigit, hasSymbol bool
+
+	for _, character := range password {
+		switch {
+		case unicode.IsLower(character):
+			hasLower = true
+		case unicode.IsUpper(character):
+			hasUpper = true
+		case unicode.IsDigit(character):
+			hasDigit = true
+		case unicode.IsPunct(character) || unicode.IsSymbol(character) || unicode.IsSpace(character):
+			hasSymbol = true
+		}
+	}
+
+	if policy.RequireLower && !hasLower {
+		details = append(details, i18n.NewMessage(CODE_MISSING_LOWER))
+	}
+
+	if policy.RequireUpper && !hasUpper {
+		details = append(details, i18n.NewMessage(CODE_MISSING_UPPER))
+	}
+
+	if policy.RequireDigit && !hasDigit {
+		details = append(details, i18n.NewMessage(CODE_MISSING_DIGIT))
+	}
+
+	if policy.RequireSymbol && !hasSymbol {
+		details = append(details, i18n.NewMessage(CODE_MISSING_SYMBOL))
+	}
+
+	if containsPersonalData(password, username) {
+		details = append(details, i18n.NewMessage(CODE_CONTAINS_USERNAME))
+	}
+
+	// the domain is shared by many users, only the local part identifies the user
+	localPart, _, _ := strings.Cut(email, "@")
+
+	if containsPersonalData(password, localPart) {
+		details = append(details, i18n.NewMessage(CODE_CONTAINS_EMAIL))
+	}
+
+	if policy.Breached != nil && policy.Breached.Contains(password) {
+		details = append(details, i18n.NewMessage(CODE_BREACHED))
+	}
+
+	return details
+}
+
+func containsPersonalData(password, personalData string) bool {
+	personalData = strings.ToLower(strings.TrimSpace(personalData))
+
+	return len([]rune(personalData)) >= MIN_PERSONAL_DATA_LENGTH && strings.Contains(strings.ToLower(password), personalData)
+}
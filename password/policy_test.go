@@ -0,0 +1,105 @@
+package password
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ncardozo92/gapef_swimming_metrics/i18n"
+	"github.com/stretchr/testify/assert"
+)
+
+// hash of a password that appears in the test breached lists
+func breachedHash() string {
+	return sha1Hex("Password123456")
+}
+
+func TestValidate(t *testing.T) {
+	testCases := []struct {
+		password        string
+		expectedDetails []i18n.Message
+	}{
+		{"NadarMariposa2024", []i18n.Message{}},
+		{"Nadar2024", []i18n.Message{i18n.NewMessage(CODE_TOO_SHORT, DEFAULT_MIN_LENGTH)}},
+		{"nadarmariposa2024", []i18n.Message{i18n.NewMessage(CODE_MISSING_UPPER)}},
+		{"NADARMARIPOSA2024", []i18n.Message{i18n.NewMessage(CODE_MISSING_LOWER)}},
+		{"NadarMariposa", []i18n.Message{i18n.NewMessage(CODE_MISSING_DIGIT)}},
+		{"NCardozo92Mariposa", []i18n.Message{i18n.NewMessage(CODE_CONTAINS_USERNAME)}},
+		{"Nadador.Gapef1", []i18n.Message{i18n.NewMessage(CODE_CONTAINS_EMAIL)}},
+		{"NadarMariposa2024" + strings.Repeat("a", MAX_LENGTH-17), []i18n.Message{}},
+		{"NadarMariposa2024" + strings.Repeat("a", MAX_LENGTH-16), []i18n.Message{i18n.NewMessage(CODE_TOO_LONG, MAX_LENGTH)}},
+		// each ñ takes two bytes
+		{"NadarMariposa2024" + strings.Repeat("ñ", 28), []i18n.Message{i18n.NewMessage(CODE_TOO_LONG, MAX_LENGTH)}},
+	}
+
+	policy := DefaultPolicy()
+
+	for _, testCase := range testCases {
+		assert.Equal(t, testCase.expectedDetails, policy.Validate(testCase.password, "ncardozo92", "nadador.gapef@gapef.com.ar"),
+			testCase.password)
+	}
+}
+
+func TestValidateTranslations(t *testing.T) {
+	details := DefaultPolicy().Validate("Nadar2024", "ncardozo92", "")
+
+	if assert.Len(t, details, 1) {
+		assert.Equal(t, "La contraseña debe tener al menos 10 caracteres", details[0].Text(i18n.LANGUAGE_ES))
+		assert.Equal(t, "The password must have at least 10 characters", details[0].Text(i18n.LANGUAGE_EN))
+	}
+
+	details = DefaultPolicy().Validate("NadarMariposa2024"+strings.Repeat("a", MAX_LENGTH), "ncardozo92", "")
+
+	if assert.Len(t, details, 1) {
+		assert.Equal(t, "La contraseña no puede superar los 72 bytes", details[0].Text(i18n.LANGUAGE_ES))
+		assert.Equal(t, "The password cannot be longer than 72 bytes", details[0].Text(i18n.LANGUAGE_EN))
+	}
+}
+
+func TestValidateSymbol(t *testing.T) {
+	policy := DefaultPolicy()
+	policy.RequireSymbol = true
+
+	assert.Equal(t, []i18n.Message{i18n.NewMessage(CODE_MISSING_SYMBOL)}, policy.Validate("NadarMariposa2024", "ncardozo", ""))
+	assert.Empty(t, policy.Validate("Nadar Mariposa 2024", "ncardozo", ""))
+}
+
+func TestBreachedListFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "breached.txt")
+	os.WriteFile(path, []byte(breachedHash()+":3861493\n7C4A8D09CA3762AF61E59520943DC26494F8941B:37359195\n"), 0600)
+
+	list, loadingErr := LoadBreachedList(path)
+
+	if assert.NoError(t, loadingErr) {
+		assert.Equal(t, 2, list.Size())
+		assert.True(t, list.Contains("Password123456"))
+		assert.False(t, list.Contains("NadarMariposa2024"))
+
+		policy := DefaultPolicy()
+		policy.Breached = list
+		assert.Equal(t, []i18n.Message{i18n.NewMessage(CODE_BREACHED)}, policy.Validate("Password123456", "ncardozo", ""))
+	}
+}
+
+func TestBreachedListRangeDirectory(t *testing.T) {
+	directory := t.TempDir()
+	hash := breachedHash()
+	os.WriteFile(filepath.Join(directory, hash[:HASH_PREFIX_LENGTH]+".txt"), []byte(hash[HASH_PREFIX_LENGTH:]+":10\r\n"), 0600)
+
+	list, loadingErr := LoadBreachedList(directory)
+
+	if assert.NoError(t, loadingErr) {
+		assert.True(t, list.Contains("Password123456"))
+		assert.Len(t, list.Range(hash[:HASH_PREFIX_LENGTH]), 1)
+	}
+}
+
+func TestBreachedListInvalidFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "breached.txt")
+	os.WriteFile(path, []byte("not a hash\n"), 0600)
+
+	_, loadingErr := LoadBreachedList(path)
+
+	assert.Error(t, loadingErr)
+}
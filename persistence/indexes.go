@@ -0,0 +1,43 @@
+package persistence
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// ErrDuplicateKey is returned when a write would repeat the value of a unique index
+var ErrDuplicateKey = errors.New("the document repeats a value that must be unique")
+
+// EnsureUniqueIndexes creates a unique index for every field of the collection. It fails when the collection already
+// has repeated values, they must be fixed by hand before the application starts
+func EnsureUniqueIndexes(collection *mongo.Collection, fields ...string) error {
+	indexes := []mongo.IndexModel{}
+
+	for _, field := range fields {
+		indexes = append(indexes, mongo.IndexModel{
+			Keys:    bson.D{{Key: field, Value: 1}},
+			Options: options.Index().SetName(collection.Name() + "_" + field + "_unique").SetUnique(true),
+		})
+	}
+
+	if _, indexErr := collection.Indexes().CreateMany(context.TODO(), indexes); indexErr != nil {
+		return fmt.Errorf("cannot create the unique indexes of %s %v, %w", collection.Name(), fields, CheckDuplicateKey(indexErr))
+	}
+
+	return nil
+}
+
+// CheckDuplicateKey wraps the duplicate key errors of mongo with ErrDuplicateKey, so the callers do not depend on the
+// driver to tell them apart
+func CheckDuplicateKey(err error) error {
+	if err != nil && mongo.IsDuplicateKeyError(err) {
+		return fmt.Errorf("%w, %v", ErrDuplicateKey, err)
+	}
+
+	return err
+}
@@ -0,0 +1,43 @@
+package persistence
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// the collection with the names of the migrations already applied
+const MIGRATIONS_COLLECTION = "migrations"
+
+// Migrate applies a change to the stored documents unless it was already applied, so it runs only once and not on
+// every start. A migration that fails is retried at the next start, so it must be safe to apply it again
+func Migrate(database *mongo.Database, name string, migration func(ctx context.Context) error) error {
+	ctx := context.TODO()
+	collection := database.Collection(MIGRATIONS_COLLECTION)
+
+	findErr := collection.FindOne(ctx, bson.D{{Key: "_id", Value: name}}).Err()
+
+	if findErr == nil {
+		return nil
+	}
+
+	if findErr != mongo.ErrNoDocuments {
+		return fmt.Errorf("cannot check the migration %s, %w", name, findErr)
+	}
+
+	if migrationErr := migration(ctx); migrationErr != nil {
+		return fmt.Errorf("the migration %s failed, %w", name, migrationErr)
+	}
+
+	_, insertErr := collection.InsertOne(ctx, bson.D{{Key: "_id", Value: name}, {Key: "applied_at", Value: time.Now().UTC()}})
+
+	// another instance that started at the same time applied it too
+	if mongo.IsDuplicateKeyError(insertErr) {
+		return nil
+	}
+
+	return insertErr
+}
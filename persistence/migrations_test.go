@@ -0,0 +1,46 @@
+package persistence
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+func TestMigrate(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+
+	mt.Run("not applied", func(mt *mtest.T) {
+		mt.AddMockResponses(
+			mtest.CreateCursorResponse(0, "test."+MIGRATIONS_COLLECTION, mtest.FirstBatch),
+			mtest.CreateSuccessResponse())
+
+		applied := false
+
+		assert.NoError(t, Migrate(mt.DB, "email_verified", func(ctx context.Context) error {
+			applied = true
+			return nil
+		}))
+		assert.True(t, applied)
+
+		mt.GetStartedEvent()
+		insert := mt.GetStartedEvent()
+
+		if assert.Equal(t, "insert", insert.CommandName) {
+			document := insert.Command.Lookup("documents").Array().Index(0).Value().Document()
+			assert.Equal(t, "email_verified", document.Lookup("_id").StringValue())
+		}
+	})
+
+	mt.Run("applied", func(mt *mtest.T) {
+		mt.AddMockResponses(mtest.CreateCursorResponse(0, "test."+MIGRATIONS_COLLECTION, mtest.FirstBatch,
+			bson.D{{Key: "_id", Value: "email_verified"}}))
+
+		assert.NoError(t, Migrate(mt.DB, "email_verified", func(ctx context.Context) error {
+			t.Error("an applied migration must not run again")
+			return nil
+		}))
+	})
+}
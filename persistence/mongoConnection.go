@@ -2,39 +2,150 @@ package persistence
 
 import (
 	"context"
+	"errors"
 	"fmt"
-	"log"
-	"os"
+	"net"
+	"net/url"
+	"time"
 
+	"github.com/ncardozo92/gapef_swimming_metrics/config"
 	"github.com/ncardozo92/gapef_swimming_metrics/logging"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
-const DATABASE_NAME string = "gapef_swimming_metrics"
+const (
+	// the database opened when the configuration does not name one
+	DATABASE_NAME string = "gapef_swimming_metrics"
+	// replaces the password in the connection strings that are logged
+	REDACTED_PASSWORD = "xxxxx"
+	// the wait between two connection attempts doubles until this limit
+	MAX_CONNECT_BACKOFF = 30 * time.Second
+)
 
 var database *mongo.Database
 
-func GetDatabase() *mongo.Database {
+var settings config.Mongo
+
+// UseConfig sets the server the database is connected to and how long the operations can take
+func UseConfig(mongoConfig config.Mongo) {
+	settings = mongoConfig
+	operationTimeout = mongoConfig.OperationTimeout
+	operationTimeouts = mongoConfig.OperationTimeouts
+}
 
-	host := os.Getenv("MONGODB_HOST")
-	username := os.Getenv("MONGODB_USER")
-	password := os.Getenv("MONGODB_PASS")
-	port := os.Getenv("MONGODB_PORT")
-	dbName := os.Getenv("MONGODB_DATABASE_NAME")
+// Connect opens the connection to the database and checks the server answers, retrying with a growing wait when it
+// does not. The application should not start serving requests until it succeeds
+func Connect(ctx context.Context) (*mongo.Database, error) {
+	connectionUrl := connectionUrl(settings)
+	logging.LogInfo("connecting to the database %s", redact(connectionUrl))
 
-	connectionString := fmt.Sprintf("mongodb://%s:%s@%s:%s/%s?authSource=admin", username, password, host, port, dbName)
-	logging.LogInfo("Database connection string: %s", connectionString)
+	mongoClient, connectErr := mongo.Connect(ctx, options.Client().ApplyURI(connectionUrl.String()))
 
-	if database == nil {
+	if connectErr != nil {
+		return nil, fmt.Errorf("cannot connect to %s, %w", redact(connectionUrl), connectErr)
+	}
+
+	backoff := settings.ConnectBackoff
+
+	for attempt := 1; ; attempt++ {
+		pingErr := ping(ctx, mongoClient)
+
+		if pingErr == nil {
+			break
+		}
+
+		if attempt >= settings.ConnectAttempts {
+			mongoClient.Disconnect(context.Background())
+			return nil, fmt.Errorf("the database %s did not answer after %d attempts, %w", redact(connectionUrl),
+				attempt, pingErr)
+		}
 
-		mongoClient, getClientErr := mongo.Connect(context.TODO(), options.Client().ApplyURI(connectionString))
+		logging.LogWarning("the database did not answer, attempt %d of %d, retrying in %v, %v", attempt,
+			settings.ConnectAttempts, backoff, pingErr)
 
-		if getClientErr != nil {
-			log.Fatalln(getClientErr.Error())
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			mongoClient.Disconnect(context.Background())
+			return nil, ctx.Err()
 		}
 
-		database = mongoClient.Database(DATABASE_NAME)
+		backoff = min(2*backoff, MAX_CONNECT_BACKOFF)
 	}
+
+	logging.LogInfo("connected to the database")
+	database = mongoClient.Database(databaseName(settings))
+
+	return database, nil
+}
+
+// GetDatabase returns the database opened by Connect
+func GetDatabase() *mongo.Database {
+	if database == nil {
+		logging.LogFatal("the database is used before connecting to it")
+	}
+
 	return database
 }
+
+// Disconnect closes the connections to the database, waiting for the operations in progress until the context ends
+func Disconnect(ctx context.Context) error {
+	if database == nil {
+		return nil
+	}
+
+	disconnectErr := database.Client().Disconnect(ctx)
+	database = nil
+
+	return disconnectErr
+}
+
+func ping(ctx context.Context, mongoClient *mongo.Client) error {
+	pingContext, cancel := WithTimeout(ctx)
+	defer cancel()
+
+	return mongoClient.Ping(pingContext, nil)
+}
+
+// the database of MONGODB_DATABASE_NAME, the name at the connection string only sets where the user is authenticated
+// when there is no authSource
+func databaseName(mongoConfig config.Mongo) string {
+	if mongoConfig.Database == "" {
+		return DATABASE_NAME
+	}
+
+	return mongoConfig.Database
+}
+
+func connectionUrl(mongoConfig config.Mongo) *url.URL {
+	return &url.URL{
+		Scheme:   "mongodb",
+		User:     url.UserPassword(mongoConfig.User, mongoConfig.Password),
+		Host:     net.JoinHostPort(mongoConfig.Host, mongoConfig.Port),
+		Path:     "/" + mongoConfig.Database,
+		RawQuery: "authSource=admin",
+	}
+}
+
+// the connection string without the password, so it can be logged
+func redact(connectionUrl *url.URL) string {
+	redacted := *connectionUrl
+
+	if redacted.User != nil {
+		if _, hasPassword := redacted.User.Password(); hasPassword {
+			redacted.User = url.UserPassword(redacted.User.Username(), REDACTED_PASSWORD)
+		}
+	}
+
+	return redacted.String()
+}
+
+// Ping checks the database answers, for the health checks of the application
+func Ping(ctx context.Context) error {
+	if database == nil {
+		return errors.New("the database is not connected")
+	}
+
+	return ping(ctx, database.Client())
+}
@@ -0,0 +1,66 @@
+package persistence
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/ncardozo92/gapef_swimming_metrics/metrics"
+	"github.com/ncardozo92/gapef_swimming_metrics/tracing"
+	"go.mongodb.org/mongo-driver/mongo"
+	semconv "go.opentelemetry.io/otel/semconv/v1.24.0"
+)
+
+// how long an operation waits for the database until UseConfig sets the configured timeout
+const DEFAULT_OPERATION_TIMEOUT = 5 * time.Second
+
+var operationTimeout = DEFAULT_OPERATION_TIMEOUT
+
+// the operations with their own timeout, by repository and operation like users.CreateMany
+var operationTimeouts map[string]time.Duration
+
+// WithTimeout limits an operation started by a request, it stops when the timeout expires or the client disconnects
+func WithTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	return context.WithTimeout(ctx, operationTimeout)
+}
+
+// the timeout configured for the operation, or the one of every operation when it has none
+func timeoutOf(repository, operation string) time.Duration {
+	if timeout, found := operationTimeouts[repository+"."+operation]; found {
+		return timeout
+	}
+
+	return operationTimeout
+}
+
+// IsTimeout checks if the operation failed because the database did not answer in time
+func IsTimeout(err error) bool {
+	return err != nil && (errors.Is(err, context.DeadlineExceeded) || mongo.IsTimeout(err))
+}
+
+// IsCanceled checks if the operation stopped because the client of the request went away, it is not a failure of
+// the database
+func IsCanceled(err error) bool {
+	return errors.Is(err, context.Canceled)
+}
+
+// StartOperation starts an operation of a repository, limited by the operation timeout, traced and measured. The
+// returned function ends it with the error the operation returns and must be deferred, like
+// defer func() { done(err) }() with a named error result
+func StartOperation(ctx context.Context, repository, operation string) (context.Context, func(err error)) {
+	start := time.Now()
+	ctx, span := tracing.Start(ctx, repository+"."+operation, semconv.DBSystemMongoDB, semconv.DBOperation(operation))
+	ctx, cancel := context.WithTimeout(ctx, timeoutOf(repository, operation))
+
+	return ctx, func(err error) {
+		cancel()
+
+		// a document that is not found is an answer of the database, not a failure
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			err = nil
+		}
+
+		tracing.End(span, err)
+		metrics.ObserveOperation(repository, operation, start)
+	}
+}
@@ -0,0 +1,50 @@
+package persistence
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/ncardozo92/gapef_swimming_metrics/config"
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestOperationTimeoutOverrides(t *testing.T) {
+	UseConfig(config.Mongo{
+		OperationTimeout:  5 * time.Second,
+		OperationTimeouts: map[string]time.Duration{"users.CreateMany": 30 * time.Second},
+	})
+	t.Cleanup(func() { UseConfig(config.Mongo{OperationTimeout: DEFAULT_OPERATION_TIMEOUT}) })
+
+	assert.Equal(t, 30*time.Second, timeoutOf("users", "CreateMany"))
+	assert.Equal(t, 5*time.Second, timeoutOf("users", "FindById"))
+	assert.Equal(t, 5*time.Second, timeoutOf("audit", "CreateMany"))
+}
+
+func TestOperationSpanRecordsTheError(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	previousProvider := otel.GetTracerProvider()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	t.Cleanup(func() { otel.SetTracerProvider(previousProvider) })
+
+	_, done := StartOperation(context.Background(), "users", "Create")
+	done(errors.New("write failed"))
+
+	// a user that does not exist is not a failure of the operation
+	_, done = StartOperation(context.Background(), "users", "FindById")
+	done(mongo.ErrNoDocuments)
+
+	spans := recorder.Ended()
+
+	if assert.Len(t, spans, 2) {
+		assert.Equal(t, codes.Error, spans[0].Status().Code)
+		assert.Equal(t, "write failed", spans[0].Status().Description)
+		assert.Equal(t, codes.Unset, spans[1].Status().Code)
+	}
+}
@@ -0,0 +1,102 @@
+package ratelimit
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/ncardozo92/gapef_swimming_metrics/config"
+	"github.com/ncardozo92/gapef_swimming_metrics/custom_error"
+	"github.com/ncardozo92/gapef_swimming_metrics/logging"
+)
+
+const (
+	HEADER_LIMIT     = "X-RateLimit-Limit"
+	HEADER_REMAINING = "X-RateLimit-Remaining"
+
+	POLICY_DEFAULT = "default"
+	POLICY_AUTH    = "auth"
+	POLICY_LISTING = "listing"
+	POLICY_IP      = "ip"
+)
+
+// the same error the handler answers to the 429 of echo, so the clients get one code for every rate limit
+var ErrTooManyRequests = custom_error.New(http.StatusTooManyRequests, custom_error.CODE_TOO_MANY_REQUESTS,
+	custom_error.MESSAGE_TOO_MANY_REQUESTS)
+
+// Policy is a token bucket of Burst tokens, refilled with Burst tokens every Period
+type Policy struct {
+	Name   string
+	Burst  int
+	Period time.Duration
+}
+
+// NewPolicy returns the policy of a configured rate
+func NewPolicy(name string, rate config.Rate) Policy {
+	return Policy{Name: name, Burst: rate.Requests, Period: rate.Period}
+}
+
+func (policy Policy) tokensPerSecond() float64 {
+	return float64(policy.Burst) / policy.Period.Seconds()
+}
+
+// how long the bucket takes to get the tokens back
+func (policy Policy) refillTime(tokens float64) time.Duration {
+	return time.Duration(tokens / policy.tokensPerSecond() * float64(time.Second))
+}
+
+// KeyResolver identifies the client of a request, the authenticated ones by their id and the anonymous by their ip
+type KeyResolver func(c echo.Context) string
+
+// Limiter rejects the requests of the clients that used all the tokens of the policy of the route
+type Limiter struct {
+	store         Store
+	resolveKey    KeyResolver
+	defaultPolicy Policy
+	// the policies of the routes, by method and path template like "POST /login"
+	routePolicies map[string]Policy
+}
+
+// Returns a new instance of Limiter, the routes without a policy share the default one
+func NewLimiter(store Store, resolveKey KeyResolver, defaultPolicy Policy, routePolicies map[string]Policy) *Limiter {
+	return &Limiter{store: store, resolveKey: resolveKey, defaultPolicy: defaultPolicy, routePolicies: routePolicies}
+}
+
+// Middleware limits the requests of the clients told apart by the key resolver. Before the authentication they can
+// only be told apart by their ip, after it the users and API keys can be identified by their id
+func (limiter *Limiter) Middleware(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		policy := limiter.policyOf(c)
+		ctx := c.Request().Context()
+		key := limiter.resolveKey(c)
+
+		decision, takeErr := limiter.store.Take(ctx, policy.Name+":"+key, policy)
+
+		// the requests are not rejected because the store failed
+		if takeErr != nil {
+			logging.LogErrorContext(ctx, "could not check the rate limit, %v", takeErr)
+			return next(c)
+		}
+
+		c.Response().Header().Set(HEADER_LIMIT, strconv.Itoa(policy.Burst))
+		c.Response().Header().Set(HEADER_REMAINING, strconv.Itoa(decision.Remaining))
+
+		if !decision.Allowed {
+			logging.LogWarningContext(ctx, "rate limit %s exceeded by %s", policy.Name, key)
+			c.Response().Header().Set(echo.HeaderRetryAfter, strconv.Itoa(int(math.Ceil(decision.RetryAfter.Seconds()))))
+			return ErrTooManyRequests
+		}
+
+		return next(c)
+	}
+}
+
+func (limiter *Limiter) policyOf(c echo.Context) Policy {
+	if policy, found := limiter.routePolicies[c.Request().Method+" "+c.Path()]; found {
+		return policy
+	}
+
+	return limiter.defaultPolicy
+}
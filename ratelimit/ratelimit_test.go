@@ -0,0 +1,109 @@
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/ncardozo92/gapef_swimming_metrics/custom_error"
+	"github.com/stretchr/testify/assert"
+)
+
+var loginPolicy = Policy{Name: POLICY_AUTH, Burst: 2, Period: time.Minute}
+
+// a store whose clock is moved by the tests
+func newTestStore() (*MemoryStore, *time.Time) {
+	now := time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC)
+	store := NewMemoryStore()
+	store.now = func() time.Time { return now }
+	store.lastSweep = now
+
+	return store, &now
+}
+
+type failingStore struct{}
+
+func (store failingStore) Take(ctx context.Context, key string, policy Policy) (Decision, error) {
+	return Decision{}, errors.New("connection refused")
+}
+
+func TestMemoryStoreRefillsTheBucket(t *testing.T) {
+	store, now := newTestStore()
+
+	first, _ := store.Take(context.Background(), "ip:1", loginPolicy)
+	second, _ := store.Take(context.Background(), "ip:1", loginPolicy)
+	third, _ := store.Take(context.Background(), "ip:1", loginPolicy)
+
+	assert.Equal(t, Decision{Allowed: true, Remaining: 1}, first)
+	assert.Equal(t, Decision{Allowed: true, Remaining: 0}, second)
+	assert.False(t, third.Allowed)
+	assert.Equal(t, 30*time.Second, third.RetryAfter)
+
+	// another client has its own bucket
+	other, _ := store.Take(context.Background(), "ip:2", loginPolicy)
+	assert.True(t, other.Allowed)
+
+	*now = now.Add(30 * time.Second)
+	refilled, _ := store.Take(context.Background(), "ip:1", loginPolicy)
+	assert.True(t, refilled.Allowed)
+}
+
+func TestMemoryStoreForgetsFullBuckets(t *testing.T) {
+	store, now := newTestStore()
+
+	store.Take(context.Background(), "ip:1", loginPolicy)
+	*now = now.Add(SWEEP_INTERVAL)
+	store.Take(context.Background(), "ip:2", loginPolicy)
+
+	assert.Len(t, store.buckets, 1)
+	assert.Contains(t, store.buckets, "ip:2")
+}
+
+func serve(limiter *Limiter, method, path string) *httptest.ResponseRecorder {
+	e := echo.New()
+	e.HTTPErrorHandler = custom_error.HTTPErrorHandler
+	e.Use(limiter.Middleware)
+
+	handler := func(context echo.Context) error {
+		return context.NoContent(http.StatusOK)
+	}
+	e.POST("/login", handler)
+	e.GET("/users", handler)
+
+	recorder := httptest.NewRecorder()
+	e.ServeHTTP(recorder, httptest.NewRequest(method, path, nil))
+
+	return recorder
+}
+
+func TestMiddlewareAppliesTheRoutePolicy(t *testing.T) {
+	store, _ := newTestStore()
+	limiter := NewLimiter(store, func(c echo.Context) string { return "ip:1" },
+		Policy{Name: POLICY_DEFAULT, Burst: 100, Period: time.Minute},
+		map[string]Policy{http.MethodPost + " /login": loginPolicy})
+
+	serve(limiter, http.MethodPost, "/login")
+	serve(limiter, http.MethodPost, "/login")
+	rejected := serve(limiter, http.MethodPost, "/login")
+
+	assert.Equal(t, http.StatusTooManyRequests, rejected.Code)
+	assert.Contains(t, rejected.Body.String(), custom_error.CODE_TOO_MANY_REQUESTS)
+	assert.Equal(t, "30", rejected.Header().Get(echo.HeaderRetryAfter))
+	assert.Equal(t, "2", rejected.Header().Get(HEADER_LIMIT))
+
+	// the other routes use the default bucket
+	allowed := serve(limiter, http.MethodGet, "/users")
+
+	assert.Equal(t, http.StatusOK, allowed.Code)
+	assert.Equal(t, "99", allowed.Header().Get(HEADER_REMAINING))
+}
+
+func TestMiddlewareAllowsWhenTheStoreFails(t *testing.T) {
+	limiter := NewLimiter(failingStore{}, func(c echo.Context) string { return "ip:1" }, loginPolicy, nil)
+
+	assert.Equal(t, http.StatusOK, serve(limiter, http.MethodPost, "/login").Code)
+}
@@ -0,0 +1,91 @@
+package ratelimit
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+)
+
+// the memory store forgets the buckets that are full again, checking them at most this often
+const SWEEP_INTERVAL = time.Minute
+
+// Decision is the answer of a store to a request
+type Decision struct {
+	Allowed bool
+	// tokens left in the bucket after the request
+	Remaining int
+	// how long until the bucket has a token again, only set when the request is not allowed
+	RetryAfter time.Duration
+}
+
+// Store keeps the token buckets of the clients. The memory store is enough for a single instance, the instances
+// behind a load balancer need a shared one
+type Store interface {
+	// Take removes a token from the bucket of the key, which is refilled at the rate of the policy
+	Take(ctx context.Context, key string, policy Policy) (Decision, error)
+}
+
+type bucket struct {
+	tokens  float64
+	updated time.Time
+	// the bucket is full again at this time, so it can be forgotten
+	fullAt time.Time
+}
+
+// MemoryStore keeps the buckets in the memory of the instance
+type MemoryStore struct {
+	mutex     sync.Mutex
+	buckets   map[string]*bucket
+	lastSweep time.Time
+	now       func() time.Time
+}
+
+// Returns a new instance of MemoryStore
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{buckets: map[string]*bucket{}, lastSweep: time.Now(), now: time.Now}
+}
+
+func (store *MemoryStore) Take(ctx context.Context, key string, policy Policy) (Decision, error) {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	now := store.now()
+	store.sweep(now)
+
+	capacity := float64(policy.Burst)
+	current, tracked := store.buckets[key]
+
+	if !tracked {
+		current = &bucket{tokens: capacity, updated: now}
+		store.buckets[key] = current
+	}
+
+	// the tokens refilled since the last request, up to the capacity
+	current.tokens = math.Min(capacity, current.tokens+now.Sub(current.updated).Seconds()*policy.tokensPerSecond())
+	current.updated = now
+
+	if current.tokens < 1 {
+		current.fullAt = now.Add(policy.refillTime(capacity - current.tokens))
+		return Decision{Allowed: false, RetryAfter: policy.refillTime(1 - current.tokens)}, nil
+	}
+
+	current.tokens--
+	current.fullAt = now.Add(policy.refillTime(capacity - current.tokens))
+
+	return Decision{Allowed: true, Remaining: int(current.tokens)}, nil
+}
+
+func (store *MemoryStore) sweep(now time.Time) {
+	if now.Sub(store.lastSweep) < SWEEP_INTERVAL {
+		return
+	}
+
+	for key, current := range store.buckets {
+		if !current.fullAt.After(now) {
+			delete(store.buckets, key)
+		}
+	}
+
+	store.lastSweep = now
+}
@@ -0,0 +1,159 @@
+// Package roster reads the rows of the roster spreadsheets, in CSV or XLSX format
+package roster
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+
+	"github.com/xuri/excelize/v2"
+)
+
+const (
+	EXTENSION_CSV  = ".csv"
+	EXTENSION_XLSX = ".xlsx"
+	// spreadsheets exported with a Spanish locale separate the columns with semicolons
+	CSV_SEMICOLON = ';'
+	CSV_COMMA     = ','
+	// the first row has the column names, so the first data row is the second of the sheet
+	FIRST_DATA_ROW  = 2
+	BYTE_ORDER_MARK = "\uFEFF"
+)
+
+var ErrUnsupportedFormat = errors.New("the roster must be a CSV or XLSX file")
+
+// column names accepted in Spanish, the rest are used as they are
+var columnAliases = map[string]string{
+	"correo":     "email",
+	"mail":       "email",
+	"usuario":    "username",
+	"nombre":     "first_name",
+	"apellido":   "last_name",
+	"rol":        "role",
+	"grupo":      "group",
+	"contraseña": "password",
+	"contrasena": "password",
+}
+
+// Row is a row of the roster with its values by column name
+type Row struct {
+	// number of the row at the spreadsheet, to report errors the way the user sees them
+	Number int
+	Values map[string]string
+}
+
+// Read reads the rows of a roster, the format is chosen by the extension of the file name. The columns are
+// identified by the first row, which must have their names
+func Read(filename string, reader io.Reader) ([]Row, error) {
+	var records [][]string
+	var readErr error
+
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case EXTENSION_CSV:
+		records, readErr = readCSV(reader)
+	case EXTENSION_XLSX:
+		records, readErr = readXLSX(reader)
+	default:
+		return nil, ErrUnsupportedFormat
+	}
+
+	if readErr != nil {
+		return nil, readErr
+	}
+
+	if len(records) == 0 {
+		return []Row{}, nil
+	}
+
+	columns := []string{}
+	for _, name := range records[0] {
+		columns = append(columns, columnName(name))
+	}
+
+	rows := []Row{}
+
+	for index, record := range records[1:] {
+		row := Row{Number: index + FIRST_DATA_ROW, Values: map[string]string{}}
+		empty := true
+
+		for column, value := range record {
+			value = strings.TrimSpace(value)
+
+			if column < len(columns) && columns[column] != "" {
+				row.Values[columns[column]] = value
+			}
+
+			empty = empty && value == ""
+		}
+
+		// the spreadsheets usually end with empty rows
+		if !empty {
+			rows = append(rows, row)
+		}
+	}
+
+	return rows, nil
+}
+
+func readCSV(reader io.Reader) ([][]string, error) {
+	content, readErr := io.ReadAll(reader)
+
+	if readErr != nil {
+		return nil, readErr
+	}
+
+	// Excel adds a byte order mark to the UTF-8 files
+	content = bytes.TrimPrefix(content, []byte(BYTE_ORDER_MARK))
+
+	csvReader := csv.NewReader(bytes.NewReader(content))
+	csvReader.FieldsPerRecord = -1
+	csvReader.Comma = CSV_COMMA
+
+	firstLine, _ := bufio.NewReader(bytes.NewReader(content)).ReadString('\n')
+
+	if strings.Count(firstLine, string(CSV_SEMICOLON)) > strings.Count(firstLine, string(CSV_COMMA)) {
+		csvReader.Comma = CSV_SEMICOLON
+	}
+
+	records, csvErr := csvReader.ReadAll()
+
+	if csvErr != nil {
+		return nil, fmt.Errorf("invalid CSV roster, %w", csvErr)
+	}
+
+	return records, nil
+}
+
+// reads the first sheet of the workbook
+func readXLSX(reader io.Reader) ([][]string, error) {
+	workbook, openErr := excelize.OpenReader(reader)
+
+	if openErr != nil {
+		return nil, fmt.Errorf("invalid XLSX roster, %w", openErr)
+	}
+
+	defer workbook.Close()
+
+	sheets := workbook.GetSheetList()
+
+	if len(sheets) == 0 {
+		return [][]string{}, nil
+	}
+
+	return workbook.GetRows(sheets[0])
+}
+
+func columnName(name string) string {
+	normalized := strings.ToLower(strings.TrimSpace(strings.TrimPrefix(name, BYTE_ORDER_MARK)))
+
+	if alias, aliasExists := columnAliases[normalized]; aliasExists {
+		return alias
+	}
+
+	return strings.ReplaceAll(normalized, " ", "_")
+}
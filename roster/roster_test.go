@@ -0,0 +1,50 @@
+package roster
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/xuri/excelize/v2"
+)
+
+func TestReadCSV(t *testing.T) {
+	content := BYTE_ORDER_MARK + "Email;Usuario;Nombre;Apellido;Grupo\n" +
+		"ana@gapef.com.ar;aperez;Ana;Pérez;Juveniles\n" +
+		";;;;\n" +
+		"luis@gapef.com.ar;lsosa;Luis;Sosa\n"
+
+	rows, readErr := Read("plantel.CSV", strings.NewReader(content))
+
+	if assert.NoError(t, readErr) && assert.Len(t, rows, 2) {
+		assert.Equal(t, Row{Number: 2, Values: map[string]string{"email": "ana@gapef.com.ar", "username": "aperez",
+			"first_name": "Ana", "last_name": "Pérez", "group": "Juveniles"}}, rows[0])
+
+		// the empty row is skipped but counted
+		assert.Equal(t, 4, rows[1].Number)
+		assert.Equal(t, "lsosa", rows[1].Values["username"])
+	}
+}
+
+func TestReadXLSX(t *testing.T) {
+	workbook := excelize.NewFile()
+	workbook.SetSheetRow("Sheet1", "A1", &[]any{"email", "username", "first name", "role"})
+	workbook.SetSheetRow("Sheet1", "A2", &[]any{"ana@gapef.com.ar", "aperez", "Ana", "ATLETHE"})
+
+	content := bytes.Buffer{}
+	workbook.Write(&content)
+
+	rows, readErr := Read("plantel.xlsx", &content)
+
+	if assert.NoError(t, readErr) && assert.Len(t, rows, 1) {
+		assert.Equal(t, map[string]string{"email": "ana@gapef.com.ar", "username": "aperez", "first_name": "Ana",
+			"role": "ATLETHE"}, rows[0].Values)
+	}
+}
+
+func TestReadUnsupportedFormat(t *testing.T) {
+	_, readErr := Read("plantel.pdf", strings.NewReader(""))
+
+	assert.ErrorIs(t, readErr, ErrUnsupportedFormat)
+}
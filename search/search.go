@@ -0,0 +1,135 @@
+// Package search implements the accent-insensitive fuzzy matching used to look people up by their names
+package search
+
+import (
+	"sort"
+	"strings"
+	"unicode"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+const (
+	GRAM_SIZE = 3
+	// the words are padded so their first and last letters are part of as many grams as the rest
+	GRAM_PADDING = " "
+	// a word that starts with the searched text is a perfect match, so autocomplete works while typing
+	PREFIX_SCORE = 1.0
+)
+
+// Normalize lowercases the text and removes the accents and any character that is not a letter, a number or a space
+func Normalize(text string) string {
+	var builder strings.Builder
+
+	for _, character := range norm.NFD.String(strings.ToLower(text)) {
+		switch {
+		case unicode.Is(unicode.Mn, character):
+			// the accents are separated from their letters by the decomposition
+		case unicode.IsLetter(character) || unicode.IsDigit(character):
+			builder.WriteRune(character)
+		default:
+			builder.WriteRune(' ')
+		}
+	}
+
+	return strings.Join(strings.Fields(builder.String()), " ")
+}
+
+// Words returns the normalized words of the texts
+func Words(texts ...string) []string {
+	words := []string{}
+
+	for _, text := range texts {
+		words = append(words, strings.Fields(Normalize(text))...)
+	}
+
+	return words
+}
+
+// Grams returns the distinct trigrams of the normalized words of the texts, sorted so they can be stored and
+// compared
+func Grams(texts ...string) []string {
+	unique := map[string]bool{}
+
+	for _, word := range Words(texts...) {
+		for _, gram := range wordGrams(word) {
+			unique[gram] = true
+		}
+	}
+
+	grams := make([]string, 0, len(unique))
+	for gram := range unique {
+		grams = append(grams, gram)
+	}
+
+	sort.Strings(grams)
+
+	return grams
+}
+
+// Score measures from 0 to 1 how well the query matches the texts. Every word of the query is compared with its
+// most similar word of the texts, so the order of the words and the missing words of the texts do not matter
+func Score(query string, texts ...string) float64 {
+	queryWords := Words(query)
+	words := Words(texts...)
+
+	if len(queryWords) == 0 || len(words) == 0 {
+		return 0
+	}
+
+	total := 0.0
+
+	for _, queryWord := range queryWords {
+		best := 0.0
+
+		for _, word := range words {
+			if similarity := wordSimilarity(queryWord, word); similarity > best {
+				best = similarity
+			}
+		}
+
+		total += best
+	}
+
+	return total / float64(len(queryWords))
+}
+
+// compares two normalized words with the Dice coefficient of their trigrams
+func wordSimilarity(queryWord, word string) float64 {
+	if strings.HasPrefix(word, queryWord) {
+		return PREFIX_SCORE
+	}
+
+	queryGrams := wordGrams(queryWord)
+	grams := map[string]bool{}
+
+	for _, gram := range wordGrams(word) {
+		grams[gram] = true
+	}
+
+	shared := 0
+	for _, gram := range queryGrams {
+		if grams[gram] {
+			shared++
+		}
+	}
+
+	return 2 * float64(shared) / float64(len(queryGrams)+len(grams))
+}
+
+func wordGrams(word string) []string {
+	padded := []rune(GRAM_PADDING + word + GRAM_PADDING)
+	grams := []string{}
+	seen := map[string]bool{}
+
+	for index := 0; index+GRAM_SIZE <= len(padded); index++ {
+		gram := string(padded[index : index+GRAM_SIZE])
+
+		if !seen[gram] {
+			seen[gram] = true
+			grams = append(grams, gram)
+		}
+	}
+
+	return grams
+}
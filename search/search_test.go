@@ -0,0 +1,45 @@
+package search
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNormalize(t *testing.T) {
+	assert.Equal(t, "nicolas cardozo", Normalize("  Nicolás   CARDOZO "))
+	assert.Equal(t, "munoz o brien", Normalize("Muñoz O'Brien"))
+}
+
+func TestGrams(t *testing.T) {
+	assert.Equal(t, []string{" an", " lu", "ana", "lu ", "na "}, Grams("Ana", "Lu"))
+	assert.Equal(t, Grams("maria"), Grams("María"))
+}
+
+func TestScore(t *testing.T) {
+	testCases := []struct {
+		query    string
+		texts    []string
+		minScore float64
+		maxScore float64
+	}{
+		// accents and case do not matter
+		{"martin", []string{"Martín", "Gómez"}, 1, 1},
+		// partial words while typing
+		{"gom", []string{"Martín", "Gómez"}, 1, 1},
+		{"gomez martin", []string{"Martín", "Gómez"}, 1, 1},
+		// misspelled names still match
+		{"gomes", []string{"Martín", "Gómez"}, 0.5, 0.99},
+		{"martn", []string{"Martín", "Gómez"}, 0.4, 0.99},
+		// unrelated names do not
+		{"rodriguez", []string{"Martín", "Gómez"}, 0, 0.2},
+		{"", []string{"Martín"}, 0, 0},
+	}
+
+	for _, testCase := range testCases {
+		score := Score(testCase.query, testCase.texts...)
+
+		assert.GreaterOrEqual(t, score, testCase.minScore, testCase.query)
+		assert.LessOrEqual(t, score, testCase.maxScore, testCase.query)
+	}
+}
@@ -0,0 +1,122 @@
+// Package totp implements the time-based one-time passwords of RFC 6238 used by authenticator apps
+package totp
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/binary"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	DIGITS         = 6
+	PERIOD         = 30 * time.Second
+	SECRET_LENGTH  = 20
+	ALLOWED_SKEW   = 1
+	URI_ALGORITHM  = "SHA1"
+	URI_SCHEME     = "otpauth"
+	URI_TOTP_TYPE  = "totp"
+	codeModulo     = 1000000
+	codeFormatting = "%06d"
+)
+
+var secretEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// GenerateSecret returns a random base32 secret to share with the authenticator app
+func GenerateSecret() (string, error) {
+	secret := make([]byte, SECRET_LENGTH)
+
+	if _, randomErr := rand.Read(secret); randomErr != nil {
+		return "", randomErr
+	}
+
+	return secretEncoding.EncodeToString(secret), nil
+}
+
+// Code returns the code of the secret for the period that contains the given time
+func Code(secret string, at time.Time) (string, error) {
+	key, decodingErr := secretEncoding.DecodeString(strings.ToUpper(strings.TrimRight(secret, "=")))
+
+	if decodingErr != nil {
+		return "", decodingErr
+	}
+
+	return hotp(key, uint64(Step(at))), nil
+}
+
+// Validate checks the code against the current period and the ALLOWED_SKEW periods around it,
+// so small clock differences with the phone are tolerated
+func Validate(secret, code string, at time.Time) bool {
+	_, valid := Match(secret, code, at)
+
+	return valid
+}
+
+// Match validates the code like Validate and returns the time step of the period it belongs to. The verifier must
+// not accept a code of the same step or an earlier one again, as RFC 6238 section 5.2 requires
+func Match(secret, code string, at time.Time) (int64, bool) {
+	if len(code) != DIGITS {
+		return 0, false
+	}
+
+	for skew := -ALLOWED_SKEW; skew <= ALLOWED_SKEW; skew++ {
+		stepTime := at.Add(time.Duration(skew) * PERIOD)
+		expectedCode, codeErr := Code(secret, stepTime)
+
+		if codeErr != nil {
+			return 0, false
+		}
+
+		if subtle.ConstantTimeCompare([]byte(expectedCode), []byte(code)) == 1 {
+			return Step(stepTime), true
+		}
+	}
+
+	return 0, false
+}
+
+// Step returns the number of the period that contains the given time
+func Step(at time.Time) int64 {
+	return at.Unix() / int64(PERIOD.Seconds())
+}
+
+// ProvisioningURI returns the otpauth URI that authenticator apps read from a QR code
+func ProvisioningURI(issuer, account, secret string) string {
+	query := url.Values{}
+	query.Set("secret", secret)
+	query.Set("issuer", issuer)
+	query.Set("algorithm", URI_ALGORITHM)
+	query.Set("digits", fmt.Sprint(DIGITS))
+	query.Set("period", fmt.Sprint(int(PERIOD.Seconds())))
+
+	uri := url.URL{
+		Scheme:   URI_SCHEME,
+		Host:     URI_TOTP_TYPE,
+		Path:     "/" + issuer + ":" + account,
+		RawQuery: query.Encode(),
+	}
+
+	return uri.String()
+}
+
+// the HMAC-based one-time password of RFC 4226 for the given counter
+func hotp(key []byte, counter uint64) string {
+	message := make([]byte, 8)
+	binary.BigEndian.PutUint64(message, counter)
+
+	mac := hmac.New(sha1.New, key)
+	mac.Write(message)
+	sum := mac.Sum(nil)
+
+	// dynamic truncation
+	offset := sum[len(sum)-1] & 0x0f
+	binaryCode := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+
+	return fmt.Sprintf(codeFormatting, binaryCode%codeModulo)
+}
@@ -0,0 +1,70 @@
+package totp
+
+import (
+	"encoding/base32"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// the SHA1 test vectors of RFC 6238, truncated to six digits
+var rfcSecret = base32.StdEncoding.EncodeToString([]byte("12345678901234567890"))
+
+func TestCodeMatchesRFCVectors(t *testing.T) {
+	testCases := map[int64]string{
+		59:          "287082",
+		1111111109:  "081804",
+		1111111111:  "050471",
+		1234567890:  "005924",
+		2000000000:  "279037",
+		20000000000: "353130",
+	}
+
+	for unixTime, expectedCode := range testCases {
+		code, codeErr := Code(rfcSecret, time.Unix(unixTime, 0))
+
+		assert.NoError(t, codeErr)
+		assert.Equal(t, expectedCode, code, unixTime)
+	}
+}
+
+func TestValidateToleratesSkew(t *testing.T) {
+	now := time.Unix(1111111109, 0)
+
+	assert.True(t, Validate(rfcSecret, "081804", now))
+	assert.True(t, Validate(rfcSecret, "081804", now.Add(PERIOD)))
+	assert.False(t, Validate(rfcSecret, "081804", now.Add(3*PERIOD)))
+	assert.False(t, Validate(rfcSecret, "81804", now))
+	assert.False(t, Validate("not base32!", "081804", now))
+}
+
+// the step is the one of the code, not the one of the time it is checked at
+func TestMatchReturnsTheStepOfTheCode(t *testing.T) {
+	now := time.Unix(1111111109, 0)
+
+	step, valid := Match(rfcSecret, "081804", now.Add(PERIOD))
+
+	assert.True(t, valid)
+	assert.Equal(t, Step(now), step)
+}
+
+func TestGeneratedSecretProducesCodes(t *testing.T) {
+	secret, secretErr := GenerateSecret()
+	assert.NoError(t, secretErr)
+
+	now := time.Now()
+	code, codeErr := Code(secret, now)
+
+	assert.NoError(t, codeErr)
+	assert.True(t, Validate(secret, code, now))
+}
+
+func TestProvisioningURI(t *testing.T) {
+	uri := ProvisioningURI("GAPEF", "ncardozo", "JBSWY3DPEHPK3PXP")
+
+	assert.True(t, strings.HasPrefix(uri, "otpauth://totp/GAPEF:ncardozo?"))
+	assert.Contains(t, uri, "secret=JBSWY3DPEHPK3PXP")
+	assert.Contains(t, uri, "issuer=GAPEF")
+}
@@ -0,0 +1,112 @@
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+	"github.com/ncardozo92/gapef_swimming_metrics/config"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.24.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const TRACER_NAME = "github.com/ncardozo92/gapef_swimming_metrics"
+
+// ShutdownFunc sends the spans that were not exported yet
+type ShutdownFunc func(ctx context.Context) error
+
+// Setup registers the tracer provider of the exporter set at the configuration. Without an exporter the spans are
+// not recorded, but the trace context received from the clients is still propagated
+func Setup(ctx context.Context, tracingConfig config.Tracing, version string) (ShutdownFunc, error) {
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+
+	var exporter sdktrace.SpanExporter
+	var exporterErr error
+
+	switch tracingConfig.Exporter {
+	case config.TRACING_EXPORTER_NONE:
+		return func(ctx context.Context) error { return nil }, nil
+	case config.TRACING_EXPORTER_STDOUT:
+		exporter, exporterErr = stdouttrace.New(stdouttrace.WithPrettyPrint())
+	case config.TRACING_EXPORTER_OTLP:
+		exporter, exporterErr = otlptracehttp.New(ctx, otlptracehttp.WithEndpointURL(tracingConfig.OtlpEndpoint))
+	default:
+		exporterErr = fmt.Errorf("unknown exporter %s", tracingConfig.Exporter)
+	}
+
+	if exporterErr != nil {
+		return nil, exporterErr
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(resource.NewWithAttributes(semconv.SchemaURL,
+			semconv.ServiceName(tracingConfig.ServiceName),
+			semconv.ServiceVersion(version))),
+	)
+
+	otel.SetTracerProvider(provider)
+
+	return provider.Shutdown, nil
+}
+
+// Start starts a span that is a child of the span of the context
+func Start(ctx context.Context, name string, attributes ...attribute.KeyValue) (context.Context, trace.Span) {
+	return otel.Tracer(TRACER_NAME).Start(ctx, name, trace.WithAttributes(attributes...))
+}
+
+// End ends the span, marking it as failed when there is an error
+func End(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+
+	span.End()
+}
+
+// Middleware starts the span of every request, continuing the trace of the client when it sent one. The span is
+// named by the route template, so the requests to the same endpoint are grouped
+func Middleware(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		request := c.Request()
+		ctx := otel.GetTextMapPropagator().Extract(request.Context(), propagation.HeaderCarrier(request.Header))
+
+		route := c.Path()
+		if route == "" {
+			route = request.URL.Path
+		}
+
+		ctx, span := otel.Tracer(TRACER_NAME).Start(ctx, request.Method+" "+route,
+			trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(
+				semconv.HTTPRequestMethodKey.String(request.Method),
+				semconv.HTTPRoute(c.Path()),
+			))
+		defer span.End()
+
+		c.SetRequest(request.WithContext(ctx))
+
+		if err := next(c); err != nil {
+			c.Error(err)
+		}
+
+		status := c.Response().Status
+		span.SetAttributes(semconv.HTTPResponseStatusCode(status))
+
+		if status >= http.StatusInternalServerError {
+			span.SetStatus(codes.Error, http.StatusText(status))
+		}
+
+		return nil
+	}
+}
@@ -0,0 +1,67 @@
+package tracing
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	semconv "go.opentelemetry.io/otel/semconv/v1.24.0"
+)
+
+// records the spans in memory until the test ends
+func recordSpans(t *testing.T) *tracetest.SpanRecorder {
+	recorder := tracetest.NewSpanRecorder()
+	previousProvider := otel.GetTracerProvider()
+	previousPropagator := otel.GetTextMapPropagator()
+
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+
+	t.Cleanup(func() {
+		otel.SetTracerProvider(previousProvider)
+		otel.SetTextMapPropagator(previousPropagator)
+	})
+
+	return recorder
+}
+
+func TestMiddlewareContinuesTheTrace(t *testing.T) {
+	recorder := recordSpans(t)
+
+	e := echo.New()
+	e.Use(Middleware)
+	e.GET("/users/:id", func(context echo.Context) error {
+		_, span := Start(context.Request().Context(), "users.FindById")
+		End(span, errors.New("timeout"))
+
+		return context.NoContent(http.StatusInternalServerError)
+	})
+
+	request := httptest.NewRequest(http.MethodGet, "/users/1", nil)
+	request.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	e.ServeHTTP(httptest.NewRecorder(), request)
+
+	spans := recorder.Ended()
+
+	if assert.Len(t, spans, 2) {
+		child, server := spans[0], spans[1]
+
+		assert.Equal(t, "GET /users/:id", server.Name())
+		assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", server.SpanContext().TraceID().String())
+		assert.Equal(t, "00f067aa0ba902b7", server.Parent().SpanID().String())
+		assert.Contains(t, server.Attributes(), semconv.HTTPResponseStatusCode(http.StatusInternalServerError))
+		assert.Equal(t, codes.Error, server.Status().Code)
+
+		assert.Equal(t, server.SpanContext().SpanID(), child.Parent().SpanID())
+		assert.Equal(t, codes.Error, child.Status().Code)
+		assert.Len(t, child.Events(), 1)
+	}
+}
@@ -0,0 +1,151 @@
+package user
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/ncardozo92/gapef_swimming_metrics/audit"
+	"github.com/ncardozo92/gapef_swimming_metrics/constants"
+	"github.com/ncardozo92/gapef_swimming_metrics/i18n"
+	"github.com/ncardozo92/gapef_swimming_metrics/logging"
+)
+
+const (
+	MESSAGE_INVALID_API_KEY     = "La API key no es válida"
+	MESSAGE_INVALID_API_KEY_DTO = "Los datos de la API key no son válidos"
+	MESSAGE_API_KEY_NOT_FOUND   = "No existe la API key"
+	MESSAGE_CANNOT_SAVE_API_KEY = "No se pudo guardar la API key"
+	MESSAGE_CANNOT_GET_API_KEYS = "No se pudieron obtener las API keys"
+
+	DETAIL_API_KEY_NAME_EMPTY   = "Debe indicarse el nombre de la API key"
+	DETAIL_API_KEY_SCOPES_EMPTY = "Debe indicarse al menos un scope"
+	DETAIL_INVALID_SCOPE        = "Scope inválido: %s"
+	DETAIL_EXPIRATION_IN_PAST   = "La fecha de expiración debe ser futura"
+)
+
+// CreateApiKey creates an API key for a machine client, the key is only returned in this response
+func (handler UserHandler) CreateApiKey(context echo.Context) error {
+	request := ApiKeyRequestDTO{}
+
+	if bindErr := context.Bind(&request); bindErr != nil {
+		logging.LogErrorContext(context.Request().Context(), "could not bind the API key request, %v", bindErr)
+		return ErrInvalidApiKeyRequest
+	}
+
+	if details := validateApiKeyRequest(request); len(details) > 0 {
+		return ErrInvalidApiKeyRequest.WithDetails(details...)
+	}
+
+	claims, claimsErr := getRequestClaims(context)
+
+	if claimsErr != nil {
+		logging.LogErrorContext(context.Request().Context(), "Could not read JWT claims, %v", claimsErr)
+		return ErrJwtNotPresent
+	}
+
+	key, hash, generationErr := generateApiKey()
+
+	if generationErr != nil {
+		logging.LogErrorContext(context.Request().Context(), "could not generate the API key, %v", generationErr)
+		return ErrCannotSaveApiKey
+	}
+
+	createdBy, _ := claims[JWT_FIELD_ID].(string)
+
+	apiKey := ApiKey{
+		Name:      strings.TrimSpace(request.Name),
+		Prefix:    key[:len(API_KEY_PREFIX)+API_KEY_SHOWN_LENGTH],
+		Hash:      hash,
+		Scopes:    request.Scopes,
+		CreatedBy: createdBy,
+		CreatedAt: time.Now().UTC(),
+		ExpiresAt: request.ExpiresAt,
+	}
+
+	apiKeyId, createErr := handler.userRepository.CreateApiKey(context.Request().Context(), apiKey)
+
+	if createErr != nil {
+		logging.LogErrorContext(context.Request().Context(), "could not save the API key, %v", createErr)
+		return repositoryError(createErr, ErrCannotSaveApiKey)
+	}
+
+	apiKey.Id = apiKeyId
+	logging.LogInfoContext(context.Request().Context(), "API key %s created by %s", apiKeyId, createdBy)
+	audit.SetTarget(context, AUDIT_TARGET_API_KEY, apiKeyId)
+	audit.SetChanges(context, nil, apiKey)
+
+	response := toApiKeyDTO(apiKey)
+	response.Key = key
+
+	return context.JSON(http.StatusCreated, response)
+}
+
+// GetApiKeys lists the API keys without the keys themselves
+func (handler UserHandler) GetApiKeys(context echo.Context) error {
+	apiKeys, getErr := handler.userRepository.GetApiKeys(context.Request().Context())
+
+	if getErr != nil {
+		logging.LogErrorContext(context.Request().Context(), "could not retrieve the API keys, %v", getErr)
+		return repositoryError(getErr, ErrCannotGetApiKeys)
+	}
+
+	apiKeyDTOs := []ApiKeyDTO{}
+	for _, apiKey := range apiKeys {
+		apiKeyDTOs = append(apiKeyDTOs, toApiKeyDTO(apiKey))
+	}
+
+	return context.JSON(http.StatusOK, apiKeyDTOs)
+}
+
+// RevokeApiKey stops accepting an API key, the key is kept so its last use can still be consulted
+func (handler UserHandler) RevokeApiKey(context echo.Context) error {
+	apiKeyId := context.Param("id")
+
+	found, revokeErr := handler.userRepository.RevokeApiKey(context.Request().Context(), apiKeyId, time.Now().UTC())
+
+	if revokeErr != nil {
+		logging.LogErrorContext(context.Request().Context(), "could not revoke the API key %s, %v", apiKeyId, revokeErr)
+		return repositoryError(revokeErr, ErrCannotSaveApiKey)
+	}
+
+	if !found {
+		logging.LogWarningContext(context.Request().Context(), "API key %s not found", apiKeyId)
+		return ErrApiKeyNotFound
+	}
+
+	logging.LogInfoContext(context.Request().Context(), "API key %s revoked", apiKeyId)
+	audit.SetTarget(context, AUDIT_TARGET_API_KEY, apiKeyId)
+
+	return context.NoContent(http.StatusNoContent)
+}
+
+func validateApiKeyRequest(request ApiKeyRequestDTO) []i18n.Message {
+	details := []i18n.Message{}
+
+	if strings.TrimSpace(request.Name) == "" {
+		details = append(details, i18n.NewMessage(CODE_API_KEY_NAME_REQUIRED))
+	}
+
+	if len(request.Scopes) == 0 {
+		details = append(details, i18n.NewMessage(CODE_API_KEY_SCOPES_REQUIRED))
+	}
+
+	for _, scope := range request.Scopes {
+		if !isValidScope(scope) {
+			details = append(details, i18n.NewMessage(CODE_INVALID_SCOPE, scope))
+		}
+	}
+
+	if request.ExpiresAt != nil && !request.ExpiresAt.After(time.Now()) {
+		details = append(details, i18n.NewMessage(CODE_EXPIRATION_IN_PAST))
+	}
+
+	return details
+}
+
+// checks that the scope is one of the known scopes
+func isValidScope(scope string) bool {
+	return scope == constants.SCOPE_ADMIN || scope == constants.SCOPE_COACH || scope == constants.SCOPE_ATHLETES
+}
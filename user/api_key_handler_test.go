@@ -0,0 +1,164 @@
+package user
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/labstack/echo/v4"
+	"github.com/ncardozo92/gapef_swimming_metrics/constants"
+	"github.com/ncardozo92/gapef_swimming_metrics/mail"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCreateApiKey(t *testing.T) {
+	controller := gomock.NewController(t)
+	mockUserRepository := NewMockRepository(controller)
+	handler := NewUserHandler(mockUserRepository, mail.NewMockSender(controller), nil)
+	defer controller.Finish()
+
+	var storedApiKey ApiKey
+	mockUserRepository.EXPECT().CreateApiKey(gomock.Any(), gomock.Any()).DoAndReturn(func(_ context.Context, apiKey ApiKey) (string, error) {
+		storedApiKey = apiKey
+		return "10", nil
+	})
+
+	token, _ := generateJWT(Entity{Id: "1", Username: "admin", Role: constants.ROLE_ADMIN, EmailVerified: true})
+
+	e := newEcho()
+	request := httptest.NewRequest(http.MethodPost, PATH_API_KEYS, strings.NewReader(`{"name":"consola pileta","scopes":["coach"]}`))
+	request.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	request.Header.Set(AUTHORIZATION_HEADER, BEARER_PREFIX+token)
+	recorder := httptest.NewRecorder()
+
+	serve(handler.CreateApiKey, e.NewContext(request, recorder))
+
+	response := ApiKeyDTO{}
+	json.Unmarshal(recorder.Body.Bytes(), &response)
+
+	assert.Equal(t, http.StatusCreated, recorder.Code)
+	assert.Equal(t, "10", response.Id)
+	assert.Equal(t, "1", storedApiKey.CreatedBy)
+	assert.True(t, strings.HasPrefix(response.Key, response.Prefix))
+
+	// only the hash of the key is stored
+	assert.Equal(t, hashApiKey(response.Key), storedApiKey.Hash)
+}
+
+func TestCreateApiKeyInvalidRequest(t *testing.T) {
+	testCases := []string{
+		`{"name":"","scopes":["coach"]}`,
+		`{"name":"script","scopes":[]}`,
+		`{"name":"script","scopes":["root"]}`,
+		`{"name":"script","scopes":["coach"],"expires_at":"2000-01-01T00:00:00Z"}`,
+	}
+
+	e := newEcho()
+
+	for _, testCase := range testCases {
+		controller := gomock.NewController(t)
+		handler := NewUserHandler(NewMockRepository(controller), mail.NewMockSender(controller), nil)
+
+		request := httptest.NewRequest(http.MethodPost, PATH_API_KEYS, strings.NewReader(testCase))
+		request.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		recorder := httptest.NewRecorder()
+
+		serve(handler.CreateApiKey, e.NewContext(request, recorder))
+
+		assert.Equal(t, http.StatusBadRequest, recorder.Code, testCase)
+		controller.Finish()
+	}
+}
+
+func TestRevokeApiKeyNotFound(t *testing.T) {
+	controller := gomock.NewController(t)
+	mockUserRepository := NewMockRepository(controller)
+	handler := NewUserHandler(mockUserRepository, mail.NewMockSender(controller), nil)
+	defer controller.Finish()
+
+	mockUserRepository.EXPECT().RevokeApiKey(gomock.Any(), "10", gomock.Any()).Return(false, nil)
+
+	e := newEcho()
+	recorder := httptest.NewRecorder()
+	context := e.NewContext(httptest.NewRequest(http.MethodDelete, "/api-keys/10", nil), recorder)
+	context.SetParamNames("id")
+	context.SetParamValues("10")
+
+	serve(handler.RevokeApiKey, context)
+
+	assert.Equal(t, http.StatusNotFound, recorder.Code)
+}
+
+func TestApiKeyAuthorization(t *testing.T) {
+	key, hash, _ := generateApiKey()
+	expired := time.Now().Add(-time.Hour)
+
+	testCases := []struct {
+		name           string
+		apiKey         ApiKey
+		expectedStatus int
+	}{
+		{"coach scope", ApiKey{Id: "10", Scopes: []string{constants.SCOPE_COACH}}, http.StatusOK},
+		{"admin scope", ApiKey{Id: "10", Scopes: []string{constants.SCOPE_ADMIN}}, http.StatusOK},
+		{"athletes scope", ApiKey{Id: "10", Scopes: []string{constants.SCOPE_ATHLETES}}, http.StatusForbidden},
+		{"revoked", ApiKey{Id: "10", Scopes: []string{constants.SCOPE_COACH}, RevokedAt: &expired}, http.StatusUnauthorized},
+		{"expired", ApiKey{Id: "10", Scopes: []string{constants.SCOPE_COACH}, ExpiresAt: &expired}, http.StatusUnauthorized},
+	}
+
+	e := newEcho()
+	next := func(c echo.Context) error {
+		return c.NoContent(http.StatusOK)
+	}
+
+	defer UseApiKeys(nil)
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			controller := gomock.NewController(t)
+			mockUserRepository := NewMockRepository(controller)
+			UseApiKeys(mockUserRepository)
+			defer controller.Finish()
+
+			mockUserRepository.EXPECT().FindApiKeyByHash(gomock.Any(), hash).Return(testCase.apiKey, nil, false)
+			mockUserRepository.EXPECT().TouchApiKey(gomock.Any(), "10", gomock.Any()).Return(nil).MaxTimes(1)
+
+			request := httptest.NewRequest(http.MethodGet, PATH_USERS, nil)
+			request.Header.Set(API_KEY_HEADER, key)
+			recorder := httptest.NewRecorder()
+			context := e.NewContext(request, recorder)
+			context.SetPath(PATH_USERS)
+
+			serve(CustomJwtMiddleware(CoachAccessMiddleware(next)), context)
+			assert.Equal(t, testCase.expectedStatus, recorder.Code)
+		})
+	}
+}
+
+func TestUnknownApiKeyRejected(t *testing.T) {
+	controller := gomock.NewController(t)
+	mockUserRepository := NewMockRepository(controller)
+	UseApiKeys(mockUserRepository)
+	defer UseApiKeys(nil)
+	defer controller.Finish()
+
+	mockUserRepository.EXPECT().FindApiKeyByHash(gomock.Any(), gomock.Any()).Return(ApiKey{}, assert.AnError, true)
+
+	e := newEcho()
+	request := httptest.NewRequest(http.MethodGet, PATH_USERS, nil)
+	request.Header.Set(API_KEY_HEADER, API_KEY_PREFIX+"unknown")
+	recorder := httptest.NewRecorder()
+	context := e.NewContext(request, recorder)
+	context.SetPath(PATH_USERS)
+
+	next := func(c echo.Context) error {
+		return c.NoContent(http.StatusOK)
+	}
+
+	serve(CustomJwtMiddleware(next), context)
+	assert.Equal(t, http.StatusUnauthorized, recorder.Code)
+}
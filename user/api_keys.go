@@ -0,0 +1,98 @@
+package user
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/ncardozo92/gapef_swimming_metrics/logging"
+)
+
+const (
+	API_KEY_HEADER = "X-API-Key"
+	// every key starts with the prefix, so a leaked key can be recognized by secret scanners
+	API_KEY_PREFIX       = "gapef_"
+	API_KEY_BYTES        = 32
+	API_KEY_SHOWN_LENGTH = 8
+	// the last use is stored at most once per interval, so every request does not write to the database
+	API_KEY_TOUCH_INTERVAL = time.Minute
+)
+
+var apiKeyRepository Repository
+
+// UseApiKeys sets the repository where the middleware looks up the API keys, without one only JWTs are accepted
+func UseApiKeys(repository Repository) {
+	apiKeyRepository = repository
+}
+
+// generates a new API key and returns it with its hash
+func generateApiKey() (string, string, error) {
+	randomBytes := make([]byte, API_KEY_BYTES)
+
+	if _, randomErr := rand.Read(randomBytes); randomErr != nil {
+		return "", "", randomErr
+	}
+
+	key := API_KEY_PREFIX + base64.RawURLEncoding.EncodeToString(randomBytes)
+
+	return key, hashApiKey(key), nil
+}
+
+// API keys are random, so a fast hash is enough to store them
+func hashApiKey(key string) string {
+	hash := sha256.Sum256([]byte(strings.TrimSpace(key)))
+
+	return hex.EncodeToString(hash[:])
+}
+
+// validates an API key and returns the claims of its principal, so the authorization checks treat it like a JWT.
+// The principal has no role, only the scopes of the key
+func authenticateApiKey(ctx context.Context, key string) (jwt.MapClaims, error) {
+
+	if apiKeyRepository == nil || !strings.HasPrefix(key, API_KEY_PREFIX) {
+		return nil, errors.New("the API key is not valid")
+	}
+
+	apiKey, findErr, notFound := apiKeyRepository.FindApiKeyByHash(ctx, hashApiKey(key))
+
+	if findErr != nil {
+		if notFound {
+			return nil, errors.New("the API key does not exist")
+		}
+		return nil, findErr
+	}
+
+	now := time.Now().UTC()
+
+	if apiKey.RevokedAt != nil {
+		return nil, errors.New("the API key " + apiKey.Id + " was revoked")
+	}
+
+	if apiKey.ExpiresAt != nil && !now.Before(*apiKey.ExpiresAt) {
+		return nil, errors.New("the API key " + apiKey.Id + " expired")
+	}
+
+	if apiKey.LastUsedAt == nil || now.Sub(*apiKey.LastUsedAt) >= API_KEY_TOUCH_INTERVAL {
+		if touchErr := apiKeyRepository.TouchApiKey(ctx, apiKey.Id, now); touchErr != nil {
+			logging.LogErrorContext(ctx, "could not store the last use of the API key %s, %v", apiKey.Id, touchErr)
+		}
+	}
+
+	scopes := []any{}
+	for _, scope := range apiKey.Scopes {
+		scopes = append(scopes, scope)
+	}
+
+	return jwt.MapClaims{
+		JWT_FIELD_ID:      apiKey.Id,
+		JWT_FIELD_SCOPES:  scopes,
+		JWT_FIELD_API_KEY: true,
+		"sub":             apiKey.Name,
+	}, nil
+}
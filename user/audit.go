@@ -0,0 +1,54 @@
+package user
+
+import (
+	"github.com/labstack/echo/v4"
+	"github.com/ncardozo92/gapef_swimming_metrics/audit"
+)
+
+// names of the audited actions that are not identified by their method and path
+const (
+	AUDIT_LOGIN        = "login"
+	AUDIT_LOGIN_2FA    = "login_2fa"
+	AUDIT_LOGIN_OIDC   = "login_oidc"
+	AUDIT_VERIFY_EMAIL = "verify_email"
+	AUDIT_IMPORT_USERS = "import_users"
+
+	AUDIT_TARGET_USER     = "user"
+	AUDIT_TARGET_API_KEY  = "api_key"
+	AUDIT_TARGET_LOCKOUT  = "lockout"
+	AUDIT_TARGET_SETTINGS = "settings"
+)
+
+// AuditActor returns who made the request, from the claims left by CustomJwtMiddleware
+func AuditActor(c echo.Context) audit.Actor {
+	claims, claimsErr := getRequestClaims(c)
+
+	if claimsErr != nil {
+		return audit.Actor{Type: audit.ACTOR_ANONYMOUS}
+	}
+
+	id, _ := claims[JWT_FIELD_ID].(string)
+	name, _ := claims.GetSubject()
+
+	if claims[JWT_FIELD_API_KEY] == true {
+		return audit.Actor{Type: audit.ACTOR_API_KEY, Id: id, Name: name}
+	}
+
+	return audit.Actor{Type: audit.ACTOR_USER, Id: id, Name: name}
+}
+
+// records the user as the actor of the request, for the actions that authenticate him
+func auditAuthenticated(context echo.Context, user Entity) {
+	audit.SetActor(context, audit.ACTOR_USER, user.Id, user.Username)
+}
+
+// records the changes of a user, before is empty when the user is created
+func auditUserChange(context echo.Context, before, after Entity) {
+	audit.SetTarget(context, AUDIT_TARGET_USER, after.Id)
+
+	if before.Id == "" {
+		audit.SetChanges(context, nil, after)
+	} else {
+		audit.SetChanges(context, before, after)
+	}
+}
@@ -0,0 +1,47 @@
+package user
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/labstack/echo/v4"
+	"github.com/ncardozo92/gapef_swimming_metrics/audit"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAuditActor(t *testing.T) {
+	testCases := []struct {
+		name     string
+		claims   jwt.MapClaims
+		expected audit.Actor
+	}{
+		{
+			name:     "user",
+			claims:   jwt.MapClaims{JWT_FIELD_ID: "1", "sub": "coach"},
+			expected: audit.Actor{Type: audit.ACTOR_USER, Id: "1", Name: "coach"},
+		},
+		{
+			name:     "API key",
+			claims:   jwt.MapClaims{JWT_FIELD_ID: "2", "sub": "timing system", JWT_FIELD_API_KEY: true},
+			expected: audit.Actor{Type: audit.ACTOR_API_KEY, Id: "2", Name: "timing system"},
+		},
+		{
+			name:     "without credentials",
+			expected: audit.Actor{Type: audit.ACTOR_ANONYMOUS},
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			context := echo.New().NewContext(httptest.NewRequest(http.MethodPost, PATH_USERS, nil), httptest.NewRecorder())
+
+			if testCase.claims != nil {
+				context.Set(CONTEXT_CLAIMS, testCase.claims)
+			}
+
+			assert.Equal(t, testCase.expected, AuditActor(context))
+		})
+	}
+}
@@ -0,0 +1,21 @@
+package user
+
+import "github.com/ncardozo92/gapef_swimming_metrics/config"
+
+// settings of the package, UseConfig replaces the defaults with the configured values
+var (
+	appBaseUrl           string
+	passwordResetPageUrl string
+	jwtConfig            = config.Jwt{
+		AccessTokenLifetime:       ACCESS_TOKEN_LIFETIME,
+		EmailVerificationLifetime: EMAIL_VERIFICATION_LINK_LIFETIME,
+		PasswordResetLifetime:     PASSWORD_RESET_LINK_LIFETIME,
+	}
+)
+
+// UseConfig sets the public addresses used in the links sent by email and the lifetimes of the tokens
+func UseConfig(appConfig config.Config) {
+	appBaseUrl = appConfig.Server.BaseUrl
+	passwordResetPageUrl = appConfig.Server.PasswordResetPageUrl
+	jwtConfig = appConfig.Jwt
+}
@@ -1,31 +1,151 @@
 package user
 
+import (
+	"strings"
+	"time"
+)
+
 type DTO struct {
-	Id       string `json:"id"`
-	Email    string `json:"email"`
-	Username string `json:"username"`
-	Password string `json:"password"`
-	Role     string `json:"role"`
+	Id        string   `json:"id"`
+	Email     string   `json:"email"`
+	Username  string   `json:"username"`
+	FirstName string   `json:"first_name"`
+	LastName  string   `json:"last_name"`
+	Password  string   `json:"password"`
+	Role      string   `json:"role"`
+	Athletes  []string `json:"athletes,omitempty"`
+	Status    string   `json:"status,omitempty"`
+	Group     string   `json:"group,omitempty"`
+	Language  string   `json:"language,omitempty"`
 }
 
 type LoginDTO struct {
 	Token string `json:"token"`
+	// when false the token only gives access to the user own profile until the email is verified
+	EmailVerified bool `json:"email_verified"`
+	// when the user has two factor authentication the token is empty and the challenge must be sent with a code
+	TwoFactorRequired bool   `json:"two_factor_required,omitempty"`
+	ChallengeToken    string `json:"challenge_token,omitempty"`
+	// when true the token only allows to enrol the second factor required for the user role
+	TwoFactorEnrollmentRequired bool `json:"two_factor_enrollment_required,omitempty"`
+}
+
+type TwoFactorLoginDTO struct {
+	ChallengeToken string `json:"challenge_token"`
+	// a code of the authenticator app or one of the recovery codes
+	Code string `json:"code"`
+}
+
+type TwoFactorCodeDTO struct {
+	Code string `json:"code"`
+}
+
+type TwoFactorEnrollmentDTO struct {
+	Secret          string `json:"secret"`
+	ProvisioningURI string `json:"provisioning_uri"`
+}
+
+type RecoveryCodesDTO struct {
+	RecoveryCodes []string `json:"recovery_codes"`
+}
+
+type TwoFactorPolicyDTO struct {
+	// roles that must use two factor authentication
+	Roles []string `json:"roles"`
+}
+
+type LinkAthleteDTO struct {
+	AthleteId string `json:"athlete_id"`
+}
+
+type ApprovalDTO struct {
+	Group string `json:"group"`
+}
+
+type RejectionDTO struct {
+	Reason string `json:"reason"`
 }
 
 func toDTO(e Entity) DTO {
 	return DTO{
-		Id:       e.Id,
-		Email:    e.Email,
-		Username: e.Username,
-		Role:     e.Role,
+		Id:        e.Id,
+		Email:     e.Email,
+		Username:  e.Username,
+		FirstName: e.FirstName,
+		LastName:  e.LastName,
+		Role:      e.Role,
+		Athletes:  e.Athletes,
+		Status:    e.Status,
+		Group:     e.Group,
+		Language:  e.Language,
 	}
 }
 
 func fromDTO(d DTO) Entity {
 	return Entity{
-		Email:    d.Email,
-		Username: d.Username,
-		Password: d.Password,
-		Role:     d.Role,
+		Email:     d.Email,
+		Username:  d.Username,
+		FirstName: d.FirstName,
+		LastName:  d.LastName,
+		Password:  d.Password,
+		Role:      d.Role,
+		Status:    d.Status,
+		Group:     d.Group,
+		Language:  d.Language,
 	}
 }
+
+// usernames and emails are case insensitive, they are stored and looked up in lower case
+func normalizeIdentity(value string) string {
+	return strings.ToLower(strings.TrimSpace(value))
+}
+
+type LockoutDTO struct {
+	Key          string    `json:"key"`
+	Failures     int       `json:"failures"`
+	BlockedUntil time.Time `json:"blocked_until"`
+}
+
+type ApiKeyDTO struct {
+	Id     string   `json:"id"`
+	Name   string   `json:"name"`
+	Prefix string   `json:"prefix"`
+	Scopes []string `json:"scopes"`
+	// the key is only returned when it is created
+	Key        string     `json:"key,omitempty"`
+	CreatedBy  string     `json:"created_by"`
+	CreatedAt  time.Time  `json:"created_at"`
+	ExpiresAt  *time.Time `json:"expires_at,omitempty"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty"`
+}
+
+type ApiKeyRequestDTO struct {
+	Name      string     `json:"name"`
+	Scopes    []string   `json:"scopes"`
+	ExpiresAt *time.Time `json:"expires_at"`
+}
+
+func toApiKeyDTO(apiKey ApiKey) ApiKeyDTO {
+	return ApiKeyDTO{
+		Id:         apiKey.Id,
+		Name:       apiKey.Name,
+		Prefix:     apiKey.Prefix,
+		Scopes:     apiKey.Scopes,
+		CreatedBy:  apiKey.CreatedBy,
+		CreatedAt:  apiKey.CreatedAt,
+		ExpiresAt:  apiKey.ExpiresAt,
+		LastUsedAt: apiKey.LastUsedAt,
+		RevokedAt:  apiKey.RevokedAt,
+	}
+}
+
+// SearchResultDTO is a compact user, enough to show it at an autocomplete
+type SearchResultDTO struct {
+	Id       string  `json:"id"`
+	Username string  `json:"username"`
+	Name     string  `json:"name"`
+	Role     string  `json:"role"`
+	Group    string  `json:"group,omitempty"`
+	Score    float64 `json:"score"`
+}
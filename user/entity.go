@@ -1,9 +1,48 @@
 package user
 
+import "time"
+
 type Entity struct {
-	Id       string `bson:"_id,omitempty"`
-	Email    string `bson:"email"`
-	Username string `bson:"username"`
-	Password string `bson:"password"`
-	Role     string `bson:"role"`
+	Id        string `bson:"_id,omitempty"`
+	Email     string `bson:"email"`
+	Username  string `bson:"username"`
+	FirstName string `bson:"first_name"`
+	LastName  string `bson:"last_name"`
+	Password  string `bson:"password"`
+	Role      string `bson:"role"`
+	// ids of the athletes linked to a parent user
+	Athletes []string `bson:"athletes,omitempty"`
+	// users created before the approval workflow have no status and are considered active
+	Status          string     `bson:"status,omitempty"`
+	Group           string     `bson:"group,omitempty"`
+	EmailVerified   bool       `bson:"email_verified"`
+	EmailVerifiedAt *time.Time `bson:"email_verified_at,omitempty"`
+	RejectionReason string     `bson:"rejection_reason,omitempty"`
+	// language of the emails and the responses, empty when the user did not choose one
+	Language string `bson:"language,omitempty"`
+	// the second factor is only enabled once the user confirms a code generated with the secret
+	TotpSecret  string `bson:"totp_secret,omitempty"`
+	TotpEnabled bool   `bson:"totp_enabled"`
+	// time step of the last code accepted, the codes of that step and the earlier ones cannot be used again
+	TotpLastStep int64 `bson:"totp_last_step,omitempty"`
+	// SHA-256 hashes of the unused recovery codes
+	RecoveryCodes []string `bson:"recovery_codes,omitempty"`
+	// trigrams of the names, kept by the repository for the fuzzy search
+	SearchGrams []string `bson:"search_grams,omitempty"`
+}
+
+// ApiKey authenticates a machine client, like a timing console or an import script
+type ApiKey struct {
+	Id   string `bson:"_id,omitempty"`
+	Name string `bson:"name"`
+	// first characters of the key, so it can be recognized without storing it
+	Prefix string `bson:"prefix"`
+	// SHA-256 hash of the key, the key itself is only shown when it is created
+	Hash       string     `bson:"hash"`
+	Scopes     []string   `bson:"scopes"`
+	CreatedBy  string     `bson:"created_by"`
+	CreatedAt  time.Time  `bson:"created_at"`
+	ExpiresAt  *time.Time `bson:"expires_at,omitempty"`
+	LastUsedAt *time.Time `bson:"last_used_at,omitempty"`
+	RevokedAt  *time.Time `bson:"revoked_at,omitempty"`
 }
@@ -0,0 +1,106 @@
+package user
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/ncardozo92/gapef_swimming_metrics/custom_error"
+)
+
+// the fields of the requests that can be invalid
+const (
+	FIELD_EMAIL    = "email"
+	FIELD_USERNAME = "username"
+	FIELD_PASSWORD = "password"
+	FIELD_ROLE     = "role"
+	FIELD_ROLES    = "roles"
+	FIELD_LANGUAGE = "language"
+)
+
+// the codes of the details of the invalid requests, the texts of the catalog are keyed by them
+const (
+	CODE_INVALID_EMAIL           = "invalid_email"
+	CODE_USERNAME_REQUIRED       = "username_required"
+	CODE_PASSWORD_REQUIRED       = "password_required"
+	CODE_INVALID_ROLE            = "invalid_role"
+	CODE_INVALID_LANGUAGE        = "invalid_language"
+	CODE_INVALID_ACTIVE          = "invalid_active_filter"
+	CODE_SEARCH_TOO_SHORT        = "search_too_short"
+	CODE_INVALID_SEARCH_LIMIT    = "invalid_search_limit"
+	CODE_API_KEY_NAME_REQUIRED   = "api_key_name_required"
+	CODE_API_KEY_SCOPES_REQUIRED = "api_key_scopes_required"
+	CODE_INVALID_SCOPE           = "invalid_scope"
+	CODE_EXPIRATION_IN_PAST      = "expiration_in_past"
+	CODE_IMPORT_ROW              = "import_row"
+	CODE_DUPLICATED_IN_FILE      = "duplicated_in_file"
+	CODE_ROLE_NOT_GRANTED        = "role_not_granted"
+	CODE_EMAIL_VERIFIED          = "email_verified"
+)
+
+// the errors answered by the handlers, their codes are part of the API and must not change
+var (
+	ErrBinding                     = custom_error.New(http.StatusBadRequest, "invalid_body", MESSAGE_BINDING_ERROR)
+	ErrValidation                  = custom_error.New(http.StatusBadRequest, "validation_error", MESSAGE_VALIDATION_ERROR)
+	ErrAuthentication              = custom_error.New(http.StatusInternalServerError, "authentication_error", MESSAGE_INTERNAL_ERROR)
+	ErrJwtNotPresent               = custom_error.New(http.StatusUnauthorized, "jwt_not_present", MESSAGE_JWT_NOT_PRESENT)
+	ErrInvalidJwt                  = custom_error.New(http.StatusForbidden, "invalid_jwt", MESSAGE_JWT_NOT_PRESENT)
+	ErrJwtNotCreated               = custom_error.New(http.StatusInternalServerError, "jwt_not_created", MESSAGE_JWT_NOT_CREATED)
+	ErrAccessDenied                = custom_error.New(http.StatusForbidden, "access_denied", MESSAGE_ACCESS_DENIED)
+	ErrCoachRequired               = custom_error.New(http.StatusForbidden, "coach_required", MESSAGE_COACH_REQUIRED)
+	ErrAdminRequired               = custom_error.New(http.StatusForbidden, "admin_required", MESSAGE_ADMIN_REQUIRED)
+	ErrEmailUnverified             = custom_error.New(http.StatusForbidden, "email_unverified", MESSAGE_EMAIL_UNVERIFIED)
+	ErrTwoFactorEnrollmentRequired = custom_error.New(http.StatusForbidden, "two_factor_enrollment_required", MESSAGE_2FA_ENROLLMENT_REQUIRED)
+	ErrInvalidCredentials          = custom_error.New(http.StatusUnauthorized, "invalid_credentials", MESSAGE_INVALID_CREDENTIALS)
+	ErrTooManyLoginAttempts        = custom_error.New(http.StatusTooManyRequests, "too_many_login_attempts", MESSAGE_TOO_MANY_LOGIN_ATTEMPTS)
+	ErrIncorrectPassword           = custom_error.New(http.StatusForbidden, "incorrect_password", MESSAGE_INCORRECT_PASSWORD)
+	ErrUserNotFound                = custom_error.New(http.StatusNotFound, "user_not_found", MESSAGE_USER_NOT_FOUND)
+	ErrUserAlreadyExists           = custom_error.New(http.StatusConflict, "user_already_exists", MESSAGE_USER_ALREADY_EXISTS)
+	ErrUserCreation                = custom_error.New(http.StatusInternalServerError, "user_creation_error", MESSAGE_USER_CREATION_ERROR)
+	ErrCannotRetrieveUsers         = custom_error.New(http.StatusInternalServerError, "cannot_retrieve_users", MESSAGE_CANNOT_RETRIEVE_USERS)
+	ErrCannotRetrieveUser          = custom_error.New(http.StatusInternalServerError, "cannot_retrieve_user", MESSAGE_CANNOT_RETRIEVE_USER)
+	ErrCannotSearchUsers           = custom_error.New(http.StatusInternalServerError, "cannot_search_users", MESSAGE_CANNOT_SEARCH_USERS)
+	ErrUserIsNotParent             = custom_error.New(http.StatusBadRequest, "user_is_not_parent", MESSAGE_USER_IS_NOT_PARENT)
+	ErrUserIsNotAthlete            = custom_error.New(http.StatusBadRequest, "user_is_not_athlete", MESSAGE_USER_IS_NOT_ATHLETE)
+	ErrAthleteNotLinked            = custom_error.New(http.StatusInternalServerError, "athlete_not_linked", MESSAGE_ATHLETE_NOT_LINKED)
+	ErrUserPendingApproval         = custom_error.New(http.StatusForbidden, "user_pending_approval", MESSAGE_USER_PENDING_APPROVAL)
+	ErrUserRejected                = custom_error.New(http.StatusForbidden, "user_rejected", MESSAGE_USER_REJECTED)
+	ErrUserNotPending              = custom_error.New(http.StatusConflict, "user_not_pending", MESSAGE_USER_NOT_PENDING)
+	ErrGroupRequired               = custom_error.New(http.StatusBadRequest, "group_required", MESSAGE_GROUP_REQUIRED)
+	ErrReasonRequired              = custom_error.New(http.StatusBadRequest, "reason_required", MESSAGE_REASON_REQUIRED)
+	ErrUserReview                  = custom_error.New(http.StatusInternalServerError, "user_review_error", MESSAGE_USER_REVIEW_ERROR)
+	ErrInvalidVerification         = custom_error.New(http.StatusBadRequest, "invalid_verification", MESSAGE_INVALID_VERIFICATION)
+	ErrEmailNotVerified            = custom_error.New(http.StatusInternalServerError, "email_not_verified", MESSAGE_EMAIL_NOT_VERIFIED)
+	ErrTooManyResends              = custom_error.New(http.StatusTooManyRequests, "too_many_resends", MESSAGE_TOO_MANY_RESENDS)
+	ErrInvalidPassword             = custom_error.New(http.StatusBadRequest, "invalid_password", MESSAGE_INVALID_PASSWORD)
+	ErrPasswordNotUpdated          = custom_error.New(http.StatusInternalServerError, "password_not_updated", MESSAGE_PASSWORD_NOT_UPDATED)
+	ErrInvalidPasswordReset        = custom_error.New(http.StatusBadRequest, "invalid_password_reset", MESSAGE_INVALID_PASSWORD_RESET)
+	ErrTooManyResets               = custom_error.New(http.StatusTooManyRequests, "too_many_resets", MESSAGE_TOO_MANY_RESETS)
+	ErrInvalidTwoFactorChallenge   = custom_error.New(http.StatusUnauthorized, "invalid_two_factor_challenge", MESSAGE_INVALID_2FA_CHALLENGE)
+	ErrInvalidTwoFactorCode        = custom_error.New(http.StatusBadRequest, "invalid_two_factor_code", MESSAGE_INVALID_2FA_CODE)
+	ErrTwoFactorLoginFailed        = custom_error.New(http.StatusUnauthorized, "two_factor_login_failed", MESSAGE_INVALID_2FA_CODE)
+	ErrTwoFactorAlreadyEnabled     = custom_error.New(http.StatusConflict, "two_factor_already_enabled", MESSAGE_2FA_ALREADY_ENABLED)
+	ErrTwoFactorNotStarted         = custom_error.New(http.StatusBadRequest, "two_factor_not_started", MESSAGE_2FA_NOT_STARTED)
+	ErrTwoFactorNotEnabled         = custom_error.New(http.StatusBadRequest, "two_factor_not_enabled", MESSAGE_2FA_NOT_ENABLED)
+	ErrTwoFactorRequiredByRole     = custom_error.New(http.StatusForbidden, "two_factor_required_by_role", MESSAGE_2FA_REQUIRED_BY_ROLE)
+	ErrTwoFactor                   = custom_error.New(http.StatusInternalServerError, "two_factor_error", MESSAGE_2FA_ERROR)
+	ErrTwoFactorPolicy             = custom_error.New(http.StatusInternalServerError, "two_factor_policy_error", MESSAGE_2FA_POLICY_ERROR)
+	ErrInvalidApiKey               = custom_error.New(http.StatusUnauthorized, "invalid_api_key", MESSAGE_INVALID_API_KEY)
+	ErrInvalidApiKeyRequest        = custom_error.New(http.StatusBadRequest, "invalid_api_key_request", MESSAGE_INVALID_API_KEY_DTO)
+	ErrApiKeyNotFound              = custom_error.New(http.StatusNotFound, "api_key_not_found", MESSAGE_API_KEY_NOT_FOUND)
+	ErrCannotSaveApiKey            = custom_error.New(http.StatusInternalServerError, "cannot_save_api_key", MESSAGE_CANNOT_SAVE_API_KEY)
+	ErrCannotGetApiKeys            = custom_error.New(http.StatusInternalServerError, "cannot_get_api_keys", MESSAGE_CANNOT_GET_API_KEYS)
+	ErrLockoutNotFound             = custom_error.New(http.StatusNotFound, "lockout_not_found", MESSAGE_LOCKOUT_NOT_FOUND)
+	ErrOidcNotConfigured           = custom_error.New(http.StatusNotFound, "oidc_not_configured", MESSAGE_OIDC_NOT_CONFIGURED)
+	ErrInvalidOidcState            = custom_error.New(http.StatusBadRequest, "invalid_oidc_state", MESSAGE_INVALID_OIDC_STATE)
+	ErrOidcFailed                  = custom_error.New(http.StatusUnauthorized, "oidc_failed", MESSAGE_OIDC_FAILED)
+	ErrOidcEmailUntrusted          = custom_error.New(http.StatusForbidden, "oidc_email_untrusted", MESSAGE_OIDC_EMAIL_UNTRUSTED)
+	ErrOidcUserNotFound            = custom_error.New(http.StatusForbidden, "oidc_user_not_found", MESSAGE_OIDC_USER_NOT_FOUND)
+	ErrImportFileRequired          = custom_error.New(http.StatusBadRequest, "import_file_required", MESSAGE_IMPORT_FILE_REQUIRED)
+	ErrImportFileInvalid           = custom_error.New(http.StatusBadRequest, "import_file_invalid", MESSAGE_IMPORT_FILE_INVALID)
+	ErrImportFileTooLarge          = custom_error.New(http.StatusRequestEntityTooLarge, "import_file_too_large", fmt.Sprintf(MESSAGE_IMPORT_FILE_TOO_BIG, MAX_IMPORT_FILE_SIZE>>20))
+	ErrImportFileEmpty             = custom_error.New(http.StatusBadRequest, "import_file_empty", MESSAGE_IMPORT_FILE_EMPTY)
+	ErrImportTooManyRows           = custom_error.New(http.StatusBadRequest, "import_too_many_rows", fmt.Sprintf(MESSAGE_IMPORT_TOO_MANY_ROWS, MAX_IMPORT_ROWS))
+	ErrImportInvalidRows           = custom_error.New(http.StatusBadRequest, "import_invalid_rows", MESSAGE_IMPORT_INVALID_ROWS)
+	ErrImport                      = custom_error.New(http.StatusInternalServerError, "import_error", MESSAGE_IMPORT_ERROR)
+	ErrLanguageNotUpdated          = custom_error.New(http.StatusInternalServerError, "language_not_updated", MESSAGE_LANGUAGE_NOT_UPDATED)
+)
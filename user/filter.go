@@ -0,0 +1,113 @@
+package user
+
+import (
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/ncardozo92/gapef_swimming_metrics/constants"
+	"github.com/ncardozo92/gapef_swimming_metrics/i18n"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+const (
+	SORT_USERNAME   = "username"
+	SORT_EMAIL      = "email"
+	SORT_FIRST_NAME = "first_name"
+	SORT_LAST_NAME  = "last_name"
+	SORT_ROLE       = "role"
+
+	DETAIL_INVALID_ACTIVE = "El filtro active debe ser true o false"
+)
+
+// fields the users can be sorted by
+var USER_SORT_FIELDS = []string{SORT_USERNAME, SORT_EMAIL, SORT_FIRST_NAME, SORT_LAST_NAME, SORT_ROLE}
+
+// Filter selects the users of a listing, the empty fields do not filter
+type Filter struct {
+	Role  string
+	Group string
+	// nil lists both active and inactive users
+	Active *bool
+	// text searched at the names, username and email
+	Search string
+}
+
+// reads the filter from the role, group, active and q query params
+func parseFilter(query url.Values) (Filter, []i18n.Message) {
+	details := []i18n.Message{}
+	filter := Filter{
+		Role:   query.Get("role"),
+		Group:  query.Get("group"),
+		Search: strings.TrimSpace(query.Get("q")),
+	}
+
+	if filter.Role != "" && !isValidRole(filter.Role) {
+		details = append(details, i18n.NewMessage(CODE_INVALID_ROLE))
+	}
+
+	if active := query.Get("active"); active != "" {
+		parsedActive, parsingErr := strconv.ParseBool(active)
+
+		if parsingErr != nil {
+			details = append(details, i18n.NewMessage(CODE_INVALID_ACTIVE))
+		} else {
+			filter.Active = &parsedActive
+		}
+	}
+
+	return filter, details
+}
+
+func (filter Filter) query() bson.D {
+	query := bson.D{}
+
+	if filter.Role != "" {
+		query = append(query, bson.E{Key: "role", Value: filter.Role})
+	}
+
+	if filter.Group != "" {
+		query = append(query, bson.E{Key: "group", Value: filter.Group})
+	}
+
+	// users created before the approval workflow have no status and are active
+	if filter.Active != nil {
+		activeStatuses := bson.A{constants.STATUS_ACTIVE, nil}
+
+		if *filter.Active {
+			query = append(query, bson.E{Key: "status", Value: bson.D{{Key: "$in", Value: activeStatuses}}})
+		} else {
+			query = append(query, bson.E{Key: "status", Value: bson.D{{Key: "$nin", Value: activeStatuses}}})
+		}
+	}
+
+	if filter.Search != "" {
+		pattern := bson.D{{Key: "$regex", Value: regexp.QuoteMeta(filter.Search)}, {Key: "$options", Value: "i"}}
+		searchFields := bson.A{}
+
+		for _, field := range []string{SORT_FIRST_NAME, SORT_LAST_NAME, SORT_USERNAME, SORT_EMAIL} {
+			searchFields = append(searchFields, bson.D{{Key: field, Value: pattern}})
+		}
+
+		query = append(query, bson.E{Key: "$or", Value: searchFields})
+	}
+
+	return query
+}
+
+// the value of the field the listing is sorted by, it is stored at the cursor of the next page
+func (user Entity) sortValue(field string) any {
+	switch field {
+	case SORT_EMAIL:
+		return user.Email
+	case SORT_FIRST_NAME:
+		return user.FirstName
+	case SORT_LAST_NAME:
+		return user.LastName
+	case SORT_ROLE:
+		return user.Role
+	default:
+		return user.Username
+	}
+}
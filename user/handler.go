@@ -1,84 +1,262 @@
 package user
 
 import (
+	"context"
+	"errors"
 	"net/http"
 	"regexp"
 	"strconv"
+	"sync"
 
 	"github.com/labstack/echo/v4"
+	"github.com/ncardozo92/gapef_swimming_metrics/audit"
 	"github.com/ncardozo92/gapef_swimming_metrics/constants"
 	"github.com/ncardozo92/gapef_swimming_metrics/custom_error"
+	"github.com/ncardozo92/gapef_swimming_metrics/i18n"
+	"github.com/ncardozo92/gapef_swimming_metrics/listing"
 	"github.com/ncardozo92/gapef_swimming_metrics/logging"
+	"github.com/ncardozo92/gapef_swimming_metrics/mail"
+	"github.com/ncardozo92/gapef_swimming_metrics/metrics"
+	"github.com/ncardozo92/gapef_swimming_metrics/persistence"
 	"golang.org/x/crypto/bcrypt"
 )
 
 const (
-	MESSAGE_USER_NOT_FOUND        = "ususario no encontrado"
-	MESSAGE_INCORRECT_PASSWORD    = "la contraseña es incorrecta"
-	MESSAGE_INTERNAL_ERROR        = "no pudimos autenticar al usuario"
-	MESSAGE_BINDING_ERROR         = "el formato del cuerpo de la solicitud no es válido"
-	MESSAGE_VALIDATION_ERROR      = "la solicitud posee datos inválidos"
-	MESSAGE_USER_ALREADY_EXISTS   = "Ya existe un usuario con el mismo username o email"
-	MESSAGE_USER_CREATION_ERROR   = "No se ha podido crear al usuario"
-	MESSAGE_JWT_NOT_CREATED       = "No se pudo iniciar la sesión"
-	MESSAGE_CANNOT_RETRIEVE_USERS = "No se pudo recuperar los usuarios"
-	DETAIL_INVALID_EMAIL          = "El email no es válido"
-	DETAIL_INVALID_USERNAME       = "El username no puede ser un string vacío"
-	DETAIL_INVALID_PASSWORD       = "La password no puede ser un string vacío"
-	DETAIL_INVALID_ROLE           = "El rol suministrado no es válido"
-
-	PATH_LOGIN = "/login"
-	PATH_USERS = "/users"
+	MESSAGE_USER_NOT_FOUND          = "ususario no encontrado"
+	MESSAGE_INCORRECT_PASSWORD      = "la contraseña es incorrecta"
+	MESSAGE_INVALID_CREDENTIALS     = "el usuario o la contraseña son incorrectos"
+	MESSAGE_TOO_MANY_LOGIN_ATTEMPTS = "demasiados intentos fallidos, intente más tarde"
+	MESSAGE_INTERNAL_ERROR          = "no pudimos autenticar al usuario"
+	MESSAGE_BINDING_ERROR           = "el formato del cuerpo de la solicitud no es válido"
+	MESSAGE_VALIDATION_ERROR        = "la solicitud posee datos inválidos"
+	MESSAGE_USER_ALREADY_EXISTS     = "Ya existe un usuario con el mismo username o email"
+	MESSAGE_USER_CREATION_ERROR     = "No se ha podido crear al usuario"
+	MESSAGE_JWT_NOT_CREATED         = "No se pudo iniciar la sesión"
+	MESSAGE_CANNOT_RETRIEVE_USERS   = "No se pudo recuperar los usuarios"
+	DETAIL_INVALID_EMAIL            = "El email no es válido"
+	DETAIL_INVALID_USERNAME         = "El username no puede ser un string vacío"
+	DETAIL_INVALID_PASSWORD         = "La password no puede ser un string vacío"
+	DETAIL_INVALID_ROLE             = "El rol suministrado no es válido"
+	DETAIL_INVALID_LANGUAGE         = "El idioma debe ser es o en"
+	MESSAGE_CANNOT_RETRIEVE_USER    = "No se pudo recuperar el usuario"
+	MESSAGE_USER_IS_NOT_PARENT      = "El usuario no es un padre o tutor"
+	MESSAGE_USER_IS_NOT_ATHLETE     = "El usuario a vincular no es un atleta"
+	MESSAGE_ATHLETE_NOT_LINKED      = "No se pudo vincular al atleta"
+
+	PATH_LOGIN         = "/login"
+	PATH_USERS         = "/users"
+	PATH_USER          = "/users/:id"
+	PATH_USER_ATHLETES = "/users/:id/athletes"
+	PATH_SIGNUP        = "/signup"
+	PATH_USERS_PENDING = "/users/pending"
+	PATH_USERS_SEARCH  = "/users/search"
+	PATH_USERS_IMPORT  = "/users/import"
+	PATH_USER_APPROVE  = "/users/:id/approve"
+	PATH_USER_REJECT   = "/users/:id/reject"
+
+	PATH_VERIFY_EMAIL        = "/verify-email"
+	PATH_VERIFY_EMAIL_RESEND = "/verify-email/resend"
+
+	PATH_LOCKOUTS = "/lockouts"
+	PATH_LOCKOUT  = "/lockouts/:key"
+
+	PATH_LOGIN_2FA   = "/login/2fa"
+	PATH_2FA         = "/users/me/2fa"
+	PATH_2FA_CONFIRM = "/users/me/2fa/confirm"
+	PATH_2FA_POLICY  = "/security/2fa-policy"
+
+	PATH_LOGIN_OIDC          = "/login/oidc"
+	PATH_LOGIN_OIDC_CALLBACK = "/login/oidc/callback"
+
+	PATH_PASSWORD               = "/users/me/password"
+	PATH_PASSWORD_RESET         = "/password/reset"
+	PATH_PASSWORD_RESET_CONFIRM = "/password/reset/confirm"
+
+	PATH_API_KEYS = "/api-keys"
+	PATH_API_KEY  = "/api-keys/:id"
+
+	PATH_LANGUAGE = "/users/me/language"
 )
 
+// hash compared when the user does not exist, it is generated once because bcrypt is slow on purpose
+var dummyPasswordHash = sync.OnceValue(func() string {
+	hash, _ := bcrypt.GenerateFromPassword([]byte("dummy password"), bcrypt.DefaultCost)
+	return string(hash)
+})
+
 type Handler interface {
 	Login(context echo.Context) error
 	GetAllUsers(context echo.Context) error
 	Create(context echo.Context) error
+	GetUser(context echo.Context) error
+	LinkAthlete(context echo.Context) error
+	SignUp(context echo.Context) error
+	VerifyEmail(context echo.Context) error
+	ResendVerification(context echo.Context) error
+	GetPendingUsers(context echo.Context) error
+	Approve(context echo.Context) error
+	Reject(context echo.Context) error
+	GetLockouts(context echo.Context) error
+	ClearLockout(context echo.Context) error
+	LoginTwoFactor(context echo.Context) error
+	EnrollTwoFactor(context echo.Context) error
+	ConfirmTwoFactor(context echo.Context) error
+	DisableTwoFactor(context echo.Context) error
+	GetTwoFactorPolicy(context echo.Context) error
+	SetTwoFactorPolicy(context echo.Context) error
+	OidcLogin(context echo.Context) error
+	OidcCallback(context echo.Context) error
+	CreateApiKey(context echo.Context) error
+	GetApiKeys(context echo.Context) error
+	RevokeApiKey(context echo.Context) error
+	UpdatePassword(context echo.Context) error
+	RequestPasswordReset(context echo.Context) error
+	ResetPassword(context echo.Context) error
+	SearchUsers(context echo.Context) error
+	ImportUsers(context echo.Context) error
+	UpdateLanguage(context echo.Context) error
 }
 
 type UserHandler struct {
-	userRepository Repository
+	userRepository   Repository
+	mailSender       mail.Sender
+	resendLimiter    *emailRateLimiter
+	resetLimiter     *emailRateLimiter
+	loginAttempts    *loginAttemptTracker
+	identityProvider IdentityProvider
 }
 
 // Login finds the user and generates the jwt for authorization
 func (handler UserHandler) Login(context echo.Context) error {
 
+	audit.SetAction(context, AUDIT_LOGIN)
+
 	// binding the json body
 	dto := new(DTO)
 	if err := context.Bind(dto); err != nil || !isLoginValidRequest(dto) {
-		logging.LogError(MESSAGE_BINDING_ERROR)
-		return context.JSON(http.StatusBadRequest, custom_error.DTO{Message: MESSAGE_BINDING_ERROR})
+		logging.LogErrorContext(context.Request().Context(), MESSAGE_BINDING_ERROR)
+		metrics.LoginFailed(metrics.REASON_INVALID_REQUEST)
+		return ErrBinding
+	}
+
+	// the username is case insensitive, so its variants share the lockout
+	dto.Username = normalizeIdentity(dto.Username)
+
+	usernameKey := LOGIN_KEY_USERNAME_PREFIX + dto.Username
+	ipKey := LOGIN_KEY_IP_PREFIX + context.RealIP()
+
+	// too many failed attempts block the username and the ip for a while
+	if wait := handler.loginAttempts.Blocked(usernameKey, ipKey); wait > 0 {
+		logging.LogWarningContext(context.Request().Context(), "login blocked for %s from %s", dto.Username, context.RealIP())
+		metrics.LoginFailed(metrics.REASON_BLOCKED)
+		context.Response().Header().Set(echo.HeaderRetryAfter, strconv.Itoa(int(wait.Seconds())+1))
+		return ErrTooManyLoginAttempts
 	}
 
 	// finding the user by his username
-	user, findUserErr, userNotFound := handler.userRepository.FindByUsername(dto.Username)
+	user, findUserErr, userNotFound := handler.userRepository.FindByUsername(context.Request().Context(), dto.Username)
 
-	if findUserErr != nil {
-		if userNotFound {
-			logging.LogError("User not found")
-			return context.JSON(http.StatusNotFound, custom_error.DTO{Message: MESSAGE_USER_NOT_FOUND})
-		}
-		return context.JSON(http.StatusNotFound, nil)
+	if findUserErr != nil && !userNotFound {
+		logging.LogErrorContext(context.Request().Context(), "could not retrieve user, %v", findUserErr)
+		metrics.LoginFailed(metrics.REASON_DATABASE_ERROR)
+		return repositoryError(findUserErr, ErrAuthentication)
+	}
+
+	// an unknown user is compared against a dummy hash, so both failures take the same time and get the same response
+	storedPassword := user.Password
+	if userNotFound {
+		storedPassword = dummyPasswordHash()
 	}
 
 	// Comparing the received password with the storaged password
-	passwordValidationErr := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(dto.Password))
+	passwordValidationErr := bcrypt.CompareHashAndPassword([]byte(storedPassword), []byte(dto.Password))
+
+	if userNotFound || passwordValidationErr != nil {
+		logging.LogErrorContext(context.Request().Context(), "invalid credentials for %s, user not found: %t",
+			dto.Username, userNotFound)
+		audit.SetActor(context, audit.ACTOR_ANONYMOUS, "", dto.Username)
+		handler.loginAttempts.RegisterFailure(usernameKey, ipKey)
+		metrics.LoginFailed(loginFailureReason(userNotFound))
+		return ErrInvalidCredentials
+	}
+
+	handler.loginAttempts.RegisterSuccess(usernameKey)
+	auditAuthenticated(context, user)
+
+	if statusErr := checkLoginStatus(context.Request().Context(), user); statusErr != nil {
+		metrics.LoginFailed(metrics.REASON_NOT_APPROVED)
+		return statusErr
+	}
+
+	// users with two factor authentication must send a code before getting the token
+	if user.TotpEnabled {
+		return handler.startTwoFactorChallenge(context, user)
+	}
+
+	return handler.issueLoginResponse(context, user)
+}
+
+// the unknown users and the wrong passwords get the same response, only the metrics tell them apart
+func loginFailureReason(userNotFound bool) string {
+	if userNotFound {
+		return metrics.REASON_USER_NOT_FOUND
+	}
+
+	return metrics.REASON_BAD_PASSWORD
+}
 
-	if passwordValidationErr != nil {
-		logging.LogError("the password is incorrect")
-		return context.JSON(http.StatusUnauthorized, nil)
+// self registered users cannot log in until a coach approves them, it returns the error answered when the user
+// cannot log in
+func checkLoginStatus(ctx context.Context, user Entity) *custom_error.Error {
+	switch user.Status {
+	case constants.STATUS_PENDING:
+		logging.LogWarningContext(ctx, "User %s is pending of approval", user.Username)
+		return ErrUserPendingApproval
+	case constants.STATUS_REJECTED:
+		logging.LogWarningContext(ctx, "User %s was rejected", user.Username)
+		return ErrUserRejected
+	}
+
+	return nil
+}
+
+// generates the JWT of an authenticated user. When the user role must use two factor authentication and the user
+// has not enrolled yet, the token only allows the enrolment
+func (handler UserHandler) issueLoginResponse(context echo.Context, user Entity) error {
+
+	enrollmentRequired, policyErr := handler.mustEnrollTwoFactor(context, user)
+
+	if policyErr != nil {
+		logging.LogErrorContext(context.Request().Context(), "could not read the two factor policy, %v", policyErr)
+		metrics.LoginFailed(metrics.REASON_DATABASE_ERROR)
+		return repositoryError(policyErr, ErrAuthentication)
 	}
 
 	// Generating the jwt
-	jwt, jwtGenerationErr := generateJWT(user)
+	var jwt string
+	var jwtGenerationErr error
+
+	if enrollmentRequired {
+		logging.LogWarningContext(context.Request().Context(), "User %s must enrol a second factor", user.Username)
+		jwt, jwtGenerationErr = generateEnrollmentJWT(user)
+	} else {
+		jwt, jwtGenerationErr = generateJWT(user)
+	}
 
 	if jwtGenerationErr != nil {
-		logging.LogError("Cannot generate JWT %v", jwtGenerationErr)
-		return context.JSON(http.StatusInternalServerError, custom_error.DTO{Message: MESSAGE_JWT_NOT_CREATED})
+		logging.LogErrorContext(context.Request().Context(), "Cannot generate JWT %v", jwtGenerationErr)
+		metrics.LoginFailed(metrics.REASON_JWT_ERROR)
+		return ErrJwtNotCreated
+	}
+
+	if !user.EmailVerified {
+		logging.LogWarningContext(context.Request().Context(), "User %s logged in without verifying the email", user.Username)
 	}
 
-	return context.JSON(http.StatusOK, LoginDTO{Token: jwt})
+	metrics.LoginSucceeded()
+
+	return context.JSON(http.StatusOK,
+		LoginDTO{Token: jwt, EmailVerified: user.EmailVerified, TwoFactorEnrollmentRequired: enrollmentRequired})
 }
 
 // Validates the login DTO has not blank username and password
@@ -91,25 +269,24 @@ func isLoginValidRequest(dto *DTO) bool {
 	return result
 }
 
-// Get all users in the database
+// Gets a page of the users that match the filters of the query params
 func (handler UserHandler) GetAllUsers(context echo.Context) error {
-	page, _ := strconv.Atoi(context.QueryParams().Get("page"))
-	size, _ := strconv.Atoi(context.QueryParams().Get("size"))
+	request, details := listing.ParseRequest(context.QueryParams(), USER_SORT_FIELDS, SORT_USERNAME)
+	filter, filterDetails := parseFilter(context.QueryParams())
 
-	usersDTOs := []DTO{}
+	if details = append(details, filterDetails...); len(details) > 0 {
+		logging.LogErrorContext(context.Request().Context(), "invalid users listing request, %v", details)
+		return ErrValidation.WithDetails(details...)
+	}
 
-	users, getUsersErr := handler.userRepository.GetUsers(int64(page), int64(size))
+	users, getUsersErr := handler.userRepository.ListUsers(context.Request().Context(), filter, request)
 
 	if getUsersErr != nil {
-		logging.LogError("could not retrieve users from collection")
-		context.JSON(http.StatusInternalServerError, custom_error.DTO{Message: MESSAGE_CANNOT_RETRIEVE_USERS})
+		logging.LogErrorContext(context.Request().Context(), "could not retrieve users from collection, %v", getUsersErr)
+		return repositoryError(getUsersErr, ErrCannotRetrieveUsers)
 	}
 
-	for _, user := range users {
-		usersDTOs = append(usersDTOs, toDTO(user))
-	}
-
-	return context.JSON(http.StatusOK, usersDTOs)
+	return context.JSON(http.StatusOK, listing.Map(users, toDTO))
 }
 
 func (handler UserHandler) Create(context echo.Context) error {
@@ -117,78 +294,214 @@ func (handler UserHandler) Create(context echo.Context) error {
 	dto := DTO{}
 
 	if bindingErr := context.Bind(&dto); bindingErr != nil {
-		logging.LogError("DTO is not valid")
-		return context.JSON(http.StatusBadRequest, custom_error.DTO{Message: "Los datos no son válidos"})
+		logging.LogErrorContext(context.Request().Context(), "DTO is not valid")
+		return ErrBinding
+	}
+
+	dto.Status = constants.STATUS_ACTIVE
+
+	entity, storeNewUserErr := handler.storeNewUser(context, dto)
+
+	if storeNewUserErr != nil {
+		return storeNewUserErr
 	}
 
-	var validationErrorDetails []string = validateDTO(dto)
+	auditUserChange(context, Entity{}, entity)
+	handler.sendVerificationEmail(context.Request().Context(), entity)
+
+	return context.NoContent(http.StatusCreated)
+}
+
+// Validates the DTO and stores it as a new user with a hashed password. When the user cannot be stored
+// it returns the error to answer
+func (handler UserHandler) storeNewUser(context echo.Context, dto DTO) (Entity, error) {
+
+	dto.Email = normalizeIdentity(dto.Email)
+	dto.Username = normalizeIdentity(dto.Username)
+
+	invalidFields := validateDTO(dto)
 
-	if len(validationErrorDetails) > 0 {
-		logging.LogError("there are DTO validation errors, %v", validationErrorDetails)
-		return context.JSON(http.StatusBadRequest,
-			custom_error.DTO{Message: MESSAGE_VALIDATION_ERROR, Details: validationErrorDetails})
+	if len(invalidFields) > 0 {
+		logging.LogErrorContext(context.Request().Context(), "there are DTO validation errors, %v", invalidFields)
+		return Entity{}, ErrValidation.WithFields(invalidFields...)
 	}
 
 	entity := fromDTO(dto)
 
-	userExists, findingUserErr := handler.userRepository.Exists(entity)
+	userExists, findingUserErr := handler.userRepository.Exists(context.Request().Context(), entity)
 
 	if findingUserErr != nil {
-		logging.LogError("User could not be created")
-		return context.JSON(http.StatusInternalServerError, custom_error.DTO{Message: MESSAGE_USER_CREATION_ERROR})
+		logging.LogErrorContext(context.Request().Context(), "User could not be created, %v", findingUserErr)
+		return entity, repositoryError(findingUserErr, ErrUserCreation)
 	}
 
 	if userExists {
-		logging.LogWarning("User already exists")
-		return context.JSON(http.StatusConflict, custom_error.DTO{Message: MESSAGE_USER_ALREADY_EXISTS})
+		logging.LogWarningContext(context.Request().Context(), "User already exists")
+		return entity, ErrUserAlreadyExists
 	}
 
 	// Storing hashed password
 	hashedPassword, hashingErr := bcrypt.GenerateFromPassword([]byte(entity.Password), bcrypt.DefaultCost)
 
 	if hashingErr != nil {
-		logging.LogError("Error hashing the password, %v", hashingErr)
-		return hashingErr
+		logging.LogErrorContext(context.Request().Context(), "Error hashing the password, %v", hashingErr)
+		return entity, ErrUserCreation.Wrap(hashingErr)
 	}
 
 	entity.Password = string(hashedPassword)
 
 	// Storing the entity into the Database collection
-	saveErr := handler.userRepository.Create(entity)
+	id, saveErr := handler.userRepository.Create(context.Request().Context(), entity)
+
+	// a concurrent request stored the same user after the existence check
+	if errors.Is(saveErr, persistence.ErrDuplicateKey) {
+		logging.LogWarningContext(context.Request().Context(), "User already exists, %v", saveErr)
+		return entity, ErrUserAlreadyExists
+	}
 
 	if saveErr != nil {
-		logging.LogError("could not save user, %v", saveErr)
-		return context.JSON(http.StatusInternalServerError, custom_error.DTO{Message: MESSAGE_USER_CREATION_ERROR})
+		logging.LogErrorContext(context.Request().Context(), "could not save user, %v", saveErr)
+		return entity, repositoryError(saveErr, ErrUserCreation)
 	}
 
-	return context.NoContent(http.StatusCreated)
+	entity.Id = id
+
+	return entity, nil
+}
+
+// Gets a single user by his id
+func (handler UserHandler) GetUser(context echo.Context) error {
+	user, findUserErr, userNotFound := handler.userRepository.FindById(context.Request().Context(), context.Param("id"))
+
+	if findUserErr != nil {
+		if userNotFound {
+			logging.LogErrorContext(context.Request().Context(), "User not found")
+			return ErrUserNotFound
+		}
+		logging.LogErrorContext(context.Request().Context(), "could not retrieve user, %v", findUserErr)
+		return repositoryError(findUserErr, ErrCannotRetrieveUser)
+	}
+
+	return context.JSON(http.StatusOK, toDTO(user))
+}
+
+// Links an athlete to a parent user, so the parent can see the athlete data from his next login
+func (handler UserHandler) LinkAthlete(context echo.Context) error {
+	dto := LinkAthleteDTO{}
+
+	if bindingErr := context.Bind(&dto); bindingErr != nil || dto.AthleteId == "" {
+		logging.LogErrorContext(context.Request().Context(), MESSAGE_BINDING_ERROR)
+		return ErrBinding
+	}
+
+	parent, findParentErr, parentNotFound := handler.userRepository.FindById(context.Request().Context(), context.Param("id"))
+
+	if findParentErr != nil {
+		if parentNotFound {
+			logging.LogErrorContext(context.Request().Context(), "Parent not found")
+			return ErrUserNotFound
+		}
+		logging.LogErrorContext(context.Request().Context(), "could not retrieve parent, %v", findParentErr)
+		return repositoryError(findParentErr, ErrAthleteNotLinked)
+	}
+
+	if parent.Role != constants.ROLE_PARENT {
+		logging.LogWarningContext(context.Request().Context(), "User %s is not a parent", parent.Id)
+		return ErrUserIsNotParent
+	}
+
+	athlete, findAthleteErr, athleteNotFound := handler.userRepository.FindById(context.Request().Context(), dto.AthleteId)
+
+	if findAthleteErr != nil {
+		if athleteNotFound {
+			logging.LogErrorContext(context.Request().Context(), "Athlete not found")
+			return ErrUserNotFound
+		}
+		logging.LogErrorContext(context.Request().Context(), "could not retrieve athlete, %v", findAthleteErr)
+		return repositoryError(findAthleteErr, ErrAthleteNotLinked)
+	}
+
+	if athlete.Role != constants.ROLE_ATLETHE {
+		logging.LogWarningContext(context.Request().Context(), "User %s is not an athlete", athlete.Id)
+		return ErrUserIsNotAthlete
+	}
+
+	if linkErr := handler.userRepository.LinkAthlete(context.Request().Context(), parent.Id, athlete.Id); linkErr != nil {
+		logging.LogErrorContext(context.Request().Context(), "could not link athlete, %v", linkErr)
+		return repositoryError(linkErr, ErrAthleteNotLinked)
+	}
+
+	linkedParent := parent
+	linkedParent.Athletes = append(append([]string{}, parent.Athletes...), athlete.Id)
+	auditUserChange(context, parent, linkedParent)
+
+	return context.NoContent(http.StatusNoContent)
+}
+
+// chooses the response to a failed repository operation, the ones that timed out are answered with a 504 so the
+// client knows it can retry
+func repositoryError(repositoryErr error, appErr *custom_error.Error) *custom_error.Error {
+	if persistence.IsCanceled(repositoryErr) {
+		return custom_error.ErrCanceled.Wrap(repositoryErr)
+	}
+
+	if persistence.IsTimeout(repositoryErr) {
+		return custom_error.ErrTimeout.Wrap(repositoryErr)
+	}
+
+	return appErr.Wrap(repositoryErr)
 }
 
 // Validates that user creation/updating DTO has the right fields
-func validateDTO(dto DTO) []string {
-	details := []string{}
+func validateDTO(dto DTO) []custom_error.FieldError {
+	fields := []custom_error.FieldError{}
 	emailRegex := regexp.MustCompile(constants.REGEX_EMAIL_VALIDATION)
 
 	if !emailRegex.Match([]byte(dto.Email)) {
-		details = append(details, DETAIL_INVALID_EMAIL)
+		fields = append(fields, custom_error.NewFieldError(FIELD_EMAIL, i18n.NewMessage(CODE_INVALID_EMAIL)))
 	}
 
 	if len(dto.Username) == 0 {
-		details = append(details, DETAIL_INVALID_USERNAME)
+		fields = append(fields, custom_error.NewFieldError(FIELD_USERNAME, i18n.NewMessage(CODE_USERNAME_REQUIRED)))
 	}
 
 	if len(dto.Password) == 0 {
-		details = append(details, DETAIL_INVALID_PASSWORD)
+		fields = append(fields, custom_error.NewFieldError(FIELD_PASSWORD, i18n.NewMessage(CODE_PASSWORD_REQUIRED)))
+	} else {
+		fields = append(fields, passwordFields(passwordPolicy.Validate(dto.Password, dto.Username, dto.Email))...)
 	}
 
-	if dto.Role != constants.ROLE_ADMIN && dto.Role != constants.ROLE_ATLETHE && dto.Role != constants.ROLE_COACH {
-		details = append(details, DETAIL_INVALID_ROLE)
+	if !isValidRole(dto.Role) {
+		fields = append(fields, custom_error.NewFieldError(FIELD_ROLE, i18n.NewMessage(CODE_INVALID_ROLE)))
 	}
 
-	return details
+	if dto.Language != "" && !i18n.IsSupported(dto.Language) {
+		fields = append(fields, custom_error.NewFieldError(FIELD_LANGUAGE, i18n.NewMessage(CODE_INVALID_LANGUAGE)))
+	}
+
+	return fields
 }
 
-// Returns a new instance of UserHandler
-func NewUserHandler(userRepository Repository) *UserHandler {
-	return &UserHandler{userRepository: userRepository}
+// the rules of the password policy the password does not follow
+func passwordFields(details []i18n.Message) []custom_error.FieldError {
+	fields := []custom_error.FieldError{}
+
+	for _, detail := range details {
+		fields = append(fields, custom_error.NewFieldError(FIELD_PASSWORD, detail))
+	}
+
+	return fields
+}
+
+// Returns a new instance of UserHandler, the identity provider is nil when the login with an external provider is
+// not configured
+func NewUserHandler(userRepository Repository, mailSender mail.Sender, identityProvider IdentityProvider) *UserHandler {
+	return &UserHandler{
+		userRepository:   userRepository,
+		mailSender:       mailSender,
+		identityProvider: identityProvider,
+		resendLimiter:    newEmailRateLimiter(RESEND_WINDOW, RESEND_MAX_PER_WINDOW, RESEND_MIN_INTERVAL),
+		resetLimiter:     newEmailRateLimiter(RESEND_WINDOW, RESEND_MAX_PER_WINDOW, RESEND_MIN_INTERVAL),
+		loginAttempts:    newLoginAttemptTracker(),
+	}
 }
@@ -1,6 +1,7 @@
 package user
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"net/http"
@@ -11,17 +12,36 @@ import (
 
 	"github.com/golang/mock/gomock"
 	"github.com/labstack/echo/v4"
+	"github.com/ncardozo92/gapef_swimming_metrics/constants"
+	"github.com/ncardozo92/gapef_swimming_metrics/custom_error"
+	"github.com/ncardozo92/gapef_swimming_metrics/listing"
+	"github.com/ncardozo92/gapef_swimming_metrics/mail"
 	"github.com/stretchr/testify/assert"
 	"go.mongodb.org/mongo-driver/mongo"
 )
 
 var requestBody string = `{"username": "ncardozo","password":"ncardozo"}`
 
+// returns an echo instance that answers the errors like the application does
+func newEcho() *echo.Echo {
+	e := echo.New()
+	e.HTTPErrorHandler = custom_error.HTTPErrorHandler
+
+	return e
+}
+
+// runs the handler the way echo does, answering the error it returns, so the tests can check the response
+func serve(handlerFunc echo.HandlerFunc, context echo.Context) {
+	if err := handlerFunc(context); err != nil {
+		custom_error.HTTPErrorHandler(err, context)
+	}
+}
+
 func TestLoginOK(t *testing.T) {
 	// setup the mocks into the SUT
 	controller := gomock.NewController(t)
 	mockUserRepository := NewMockRepository(controller)
-	handler := NewUserHandler(mockUserRepository)
+	handler := NewUserHandler(mockUserRepository, mail.NewMockSender(controller), nil)
 	defer controller.Finish()
 
 	foundUser := Entity{
@@ -33,10 +53,11 @@ func TestLoginOK(t *testing.T) {
 	}
 
 	// we define the spected vehabior of the mock
-	mockUserRepository.EXPECT().FindByUsername("ncardozo").Return(foundUser, nil, false)
+	mockUserRepository.EXPECT().FindByUsername(gomock.Any(), "ncardozo").Return(foundUser, nil, false)
+	mockUserRepository.EXPECT().GetTwoFactorRoles(gomock.Any()).Return([]string{}, nil)
 
 	// setup the application
-	e := echo.New()
+	e := newEcho()
 	request := httptest.NewRequest(http.MethodPost, "/login", strings.NewReader(requestBody))
 	request.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
 
@@ -44,109 +65,200 @@ func TestLoginOK(t *testing.T) {
 	context := e.NewContext(request, recorder)
 
 	// Assertions
-	if assert.NoError(t, handler.Login(context)) {
-		assert.Equal(t, http.StatusOK, recorder.Code)
-		assert.Regexp(t, regexp.MustCompile(`^\n{0,1}.{1,}[\w\-]{1,}\.{1,1}[\w\-]{1,}\.{1,1}[\w\-]{1,}.{1,}\n{0,1}$`),
-			recorder.Body)
-	}
+	serve(handler.Login, context)
+
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	assert.Regexp(t, regexp.MustCompile(`^\n{0,1}.{1,}[\w\-]{1,}\.{1,1}[\w\-]{1,}\.{1,1}[\w\-]{1,}.{1,}\n{0,1}$`),
+		recorder.Body)
 }
 
 func TestLoginUserNotFound(t *testing.T) {
 	controller := gomock.NewController(t)
 	mockUserRepository := NewMockRepository(controller)
-	handler := NewUserHandler(mockUserRepository)
+	handler := NewUserHandler(mockUserRepository, mail.NewMockSender(controller), nil)
 	defer controller.Finish()
 
-	mockUserRepository.EXPECT().FindByUsername("ncardozo").Return(Entity{}, mongo.ErrNoDocuments, true)
+	mockUserRepository.EXPECT().FindByUsername(gomock.Any(), "ncardozo").Return(Entity{}, mongo.ErrNoDocuments, true)
 
-	e := echo.New()
+	e := newEcho()
 	request := httptest.NewRequest(http.MethodPost, "/login", strings.NewReader(requestBody))
 	request.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
 	recorder := httptest.NewRecorder() // The recorder records the response of the handler
 	context := e.NewContext(request, recorder)
 
-	if assert.NoError(t, handler.Login(context)) {
-		assert.Equal(t, http.StatusNotFound, recorder.Code)
-		assert.Contains(t, recorder.Body.String(), MESSAGE_USER_NOT_FOUND)
-	}
+	// an unknown user gets the same response as a wrong password, so account existence is not leaked
+	serve(handler.Login, context)
+
+	assert.Equal(t, http.StatusUnauthorized, recorder.Code)
+	assert.Contains(t, recorder.Body.String(), MESSAGE_INVALID_CREDENTIALS)
 
 }
 
+func TestLoginWrongPassword(t *testing.T) {
+	controller := gomock.NewController(t)
+	mockUserRepository := NewMockRepository(controller)
+	handler := NewUserHandler(mockUserRepository, mail.NewMockSender(controller), nil)
+	defer controller.Finish()
+
+	foundUser := Entity{Id: "asdf", Username: "ncardozo", Password: "$2a$10$invalidhashinvalidhashinvalidhashinvalidhashinvalidha", Role: "ATLETHE"}
+
+	mockUserRepository.EXPECT().FindByUsername(gomock.Any(), "ncardozo").Return(foundUser, nil, false)
+
+	e := newEcho()
+	request := httptest.NewRequest(http.MethodPost, "/login", strings.NewReader(requestBody))
+	request.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	recorder := httptest.NewRecorder()
+	context := e.NewContext(request, recorder)
+
+	serve(handler.Login, context)
+
+	assert.Equal(t, http.StatusUnauthorized, recorder.Code)
+	assert.Contains(t, recorder.Body.String(), MESSAGE_INVALID_CREDENTIALS)
+}
+
+func TestLoginBlockedAfterFailures(t *testing.T) {
+	controller := gomock.NewController(t)
+	mockUserRepository := NewMockRepository(controller)
+	handler := NewUserHandler(mockUserRepository, mail.NewMockSender(controller), nil)
+	defer controller.Finish()
+
+	// once the free attempts are spent the repository is not queried anymore
+	mockUserRepository.EXPECT().FindByUsername(gomock.Any(), "ncardozo").Return(Entity{}, mongo.ErrNoDocuments, true).Times(LOGIN_FREE_ATTEMPTS + 1)
+
+	e := newEcho()
+
+	for attempt := 0; attempt <= LOGIN_FREE_ATTEMPTS+1; attempt++ {
+		request := httptest.NewRequest(http.MethodPost, "/login", strings.NewReader(requestBody))
+		request.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		recorder := httptest.NewRecorder()
+		context := e.NewContext(request, recorder)
+
+		serve(handler.Login, context)
+
+		if attempt <= LOGIN_FREE_ATTEMPTS {
+			assert.Equal(t, http.StatusUnauthorized, recorder.Code)
+		} else {
+			assert.Equal(t, http.StatusTooManyRequests, recorder.Code)
+			assert.NotEmpty(t, recorder.Header().Get(echo.HeaderRetryAfter))
+		}
+	}
+}
+
 func TestLoginBadRequest(t *testing.T) {
 	controller := gomock.NewController(t)
 	mockUserRepository := NewMockRepository(controller)
-	handler := NewUserHandler(mockUserRepository)
+	handler := NewUserHandler(mockUserRepository, mail.NewMockSender(controller), nil)
 	defer controller.Finish()
 
-	mockUserRepository.EXPECT().FindByUsername("ncardozo").Times(0)
+	mockUserRepository.EXPECT().FindByUsername(gomock.Any(), "ncardozo").Times(0)
 
 	badRequests := []string{`{"uname": "ncardozo","password":"ncardozo"}`,
 		`{"username": "ncardozo","pass":"ncardozo"}`}
 
 	for _, badRequest := range badRequests {
-		e := echo.New()
+		e := newEcho()
 		request := httptest.NewRequest(http.MethodPost, "/login", strings.NewReader(badRequest))
 		request.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
 
 		recorder := httptest.NewRecorder() // The recorder records the response of the handler
 		context := e.NewContext(request, recorder)
 
-		if assert.NoError(t, handler.Login(context)) {
-			assert.Equal(t, http.StatusBadRequest, recorder.Code)
-			assert.Contains(t, recorder.Body.String(), MESSAGE_BINDING_ERROR)
-		}
+		serve(handler.Login, context)
+
+		assert.Equal(t, http.StatusBadRequest, recorder.Code)
+		assert.Contains(t, recorder.Body.String(), MESSAGE_BINDING_ERROR)
 	}
 }
 
 func TestGetAllUsers(t *testing.T) {
 	controller := gomock.NewController(t)
 	mockUserRepository := NewMockRepository(controller)
-	handler := NewUserHandler(mockUserRepository)
+	handler := NewUserHandler(mockUserRepository, mail.NewMockSender(controller), nil)
 	defer controller.Finish()
 
 	// what the repository will return
-	users := []Entity{
-		{
-			Username: "ncardozo",
-			Password: "ANITALAVALATINA",
-			Id:       "1",
-			Email:    "ncardozo@gapef.com.ar",
-			Role:     "ATLETHE",
-		},
-		{
-			Username: "joan",
-			Password: "ANITALAVALATINA",
-			Id:       "2",
-			Email:    "joan@gapef.com.ar",
-			Role:     "COACH",
+	users := Page{
+		Items: []Entity{
+			{
+				Username: "ncardozo",
+				Password: "ANITALAVALATINA",
+				Id:       "1",
+				Email:    "ncardozo@gapef.com.ar",
+				Role:     "ATLETHE",
+			},
+			{
+				Username: "joan",
+				Password: "ANITALAVALATINA",
+				Id:       "2",
+				Email:    "joan@gapef.com.ar",
+				Role:     "COACH",
+			},
 		},
+		NextCursor: "next",
+		Total:      7,
 	}
 
-	usersDTOs := []DTO{
-		{Id: "1", Username: "ncardozo", Email: "ncardozo@gapef.com.ar", Role: "ATLETHE", Password: ""},
-		{Id: "2", Username: "joan", Email: "joan@gapef.com.ar", Role: "COACH", Password: ""},
+	usersDTOs := listing.Page[DTO]{
+		Items: []DTO{
+			{Id: "1", Username: "ncardozo", Email: "ncardozo@gapef.com.ar", Role: "ATLETHE", Password: ""},
+			{Id: "2", Username: "joan", Email: "joan@gapef.com.ar", Role: "COACH", Password: ""},
+		},
+		NextCursor: "next",
+		Total:      7,
 	}
 
-	e := echo.New()
+	e := newEcho()
 	request := httptest.NewRequest(http.MethodGet, "/users", strings.NewReader(""))
 	request.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
 
 	// We create the query string and set it in the request
 	requestQueryString := request.URL.Query()
-	requestQueryString.Add("page", "1")
-	requestQueryString.Add("size", "4")
+	requestQueryString.Add("size", "2")
+	requestQueryString.Add("sort", "-last_name")
+	requestQueryString.Add("role", constants.ROLE_ATLETHE)
+	requestQueryString.Add("active", "true")
+	requestQueryString.Add("q", "card")
 
 	request.URL.RawQuery = requestQueryString.Encode()
 
+	active := true
+	expectedFilter := Filter{Role: constants.ROLE_ATLETHE, Active: &active, Search: "card"}
+
+	mockUserRepository.EXPECT().ListUsers(gomock.Any(), expectedFilter, gomock.Any()).DoAndReturn(
+		func(_ context.Context, filter Filter, listingRequest listing.Request) (Page, error) {
+			assert.Equal(t, 2, listingRequest.Size)
+			assert.Equal(t, SORT_LAST_NAME, listingRequest.SortField)
+			assert.True(t, listingRequest.Descending)
+			return users, nil
+		})
+
 	recorder := httptest.NewRecorder() // The recorder records the response of the handler
 	context := e.NewContext(request, recorder)
 
-	mockUserRepository.EXPECT().GetUsers(int64(1), int64(4)).Return(users, nil)
+	serve(handler.GetAllUsers, context)
+
+	responseJson, _ := json.Marshal(usersDTOs)
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	assert.Equal(t, string(responseJson), strings.Replace(recorder.Body.String(), "\n", "", 1))
+}
+
+func TestGetAllUsersInvalidParams(t *testing.T) {
+	testCases := []string{"size=0", "size=abc", "sort=password", "cursor=abc", "active=maybe", "role=KING"}
+
+	e := newEcho()
+
+	for _, testCase := range testCases {
+		controller := gomock.NewController(t)
+		handler := NewUserHandler(NewMockRepository(controller), mail.NewMockSender(controller), nil)
+
+		request := httptest.NewRequest(http.MethodGet, "/users?"+testCase, strings.NewReader(""))
+		recorder := httptest.NewRecorder()
+
+		serve(handler.GetAllUsers, e.NewContext(request, recorder))
 
-	if assert.NoError(t, handler.GetAllUsers(context)) {
-		responseJson, _ := json.Marshal(usersDTOs)
-		assert.Equal(t, http.StatusOK, recorder.Code)
-		assert.Equal(t, string(responseJson), strings.Replace(recorder.Body.String(), "\n", "", 1))
+		assert.Equal(t, http.StatusBadRequest, recorder.Code, testCase)
+
+		controller.Finish()
 	}
 }
 
@@ -154,25 +266,141 @@ func TestGetAllUsersError(t *testing.T) {
 
 	controller := gomock.NewController(t)
 	mockUserRepository := NewMockRepository(controller)
-	handler := NewUserHandler(mockUserRepository)
+	handler := NewUserHandler(mockUserRepository, mail.NewMockSender(controller), nil)
 	defer controller.Finish()
 
-	e := echo.New()
+	e := newEcho()
 	request := httptest.NewRequest(http.MethodGet, "/users", strings.NewReader(""))
 	request.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
 
-	// We create the query string and set it in the request
-	requestQueryString := request.URL.Query()
-	requestQueryString.Add("page", "1")
-	requestQueryString.Add("size", "4")
-
-	request.URL.RawQuery = requestQueryString.Encode()
-
 	recorder := httptest.NewRecorder() // The recorder records the response of the handler
 	context := e.NewContext(request, recorder)
 
-	mockUserRepository.EXPECT().GetUsers(int64(1), int64(4)).Return([]Entity{}, errors.New("Error"))
+	mockUserRepository.EXPECT().ListUsers(gomock.Any(), Filter{}, gomock.Any()).Return(Page{}, errors.New("Error"))
 
-	assert.NoError(t, handler.GetAllUsers(context))
+	serve(handler.GetAllUsers, context)
 	assert.Equal(t, http.StatusInternalServerError, recorder.Code)
 }
+
+func TestGetUser(t *testing.T) {
+	controller := gomock.NewController(t)
+	mockUserRepository := NewMockRepository(controller)
+	handler := NewUserHandler(mockUserRepository, mail.NewMockSender(controller), nil)
+	defer controller.Finish()
+
+	foundUser := Entity{
+		Id:       "1",
+		Email:    "parent@gapef.com.ar",
+		Username: "parent",
+		Password: "ANITALAVALATINA",
+		Role:     "PARENT",
+		Athletes: []string{"2"},
+	}
+
+	e := newEcho()
+	request := httptest.NewRequest(http.MethodGet, "/users/1", strings.NewReader(""))
+	recorder := httptest.NewRecorder()
+	context := e.NewContext(request, recorder)
+	context.SetParamNames("id")
+	context.SetParamValues("1")
+
+	mockUserRepository.EXPECT().FindById(gomock.Any(), "1").Return(foundUser, nil, false)
+
+	serve(handler.GetUser, context)
+
+	responseJson, _ := json.Marshal(toDTO(foundUser))
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	assert.Equal(t, string(responseJson), strings.Replace(recorder.Body.String(), "\n", "", 1))
+}
+
+// a slow database is answered with a 504, so the client knows the request can be retried
+func TestGetUserTimeout(t *testing.T) {
+	controller := gomock.NewController(t)
+	mockUserRepository := NewMockRepository(controller)
+	handler := NewUserHandler(mockUserRepository, mail.NewMockSender(controller), nil)
+	defer controller.Finish()
+
+	mockUserRepository.EXPECT().FindById(gomock.Any(), "1").Return(Entity{}, context.DeadlineExceeded, false)
+
+	e := newEcho()
+	request := httptest.NewRequest(http.MethodGet, "/users/1", strings.NewReader(""))
+	recorder := httptest.NewRecorder()
+	context := e.NewContext(request, recorder)
+	context.SetParamNames("id")
+	context.SetParamValues("1")
+
+	serve(handler.GetUser, context)
+
+	assert.Equal(t, http.StatusGatewayTimeout, recorder.Code)
+	assert.Contains(t, recorder.Body.String(), custom_error.MESSAGE_TIMEOUT)
+}
+
+// a request canceled by the client is not a failure of the server
+func TestGetUserCanceled(t *testing.T) {
+	controller := gomock.NewController(t)
+	mockUserRepository := NewMockRepository(controller)
+	handler := NewUserHandler(mockUserRepository, mail.NewMockSender(controller), nil)
+	defer controller.Finish()
+
+	mockUserRepository.EXPECT().FindById(gomock.Any(), "1").Return(Entity{}, context.Canceled, false)
+
+	e := newEcho()
+	request := httptest.NewRequest(http.MethodGet, "/users/1", strings.NewReader(""))
+	recorder := httptest.NewRecorder()
+	context := e.NewContext(request, recorder)
+	context.SetParamNames("id")
+	context.SetParamValues("1")
+
+	serve(handler.GetUser, context)
+
+	assert.Equal(t, custom_error.STATUS_CLIENT_CLOSED_REQUEST, recorder.Code)
+}
+
+func TestGetUserNotFound(t *testing.T) {
+	controller := gomock.NewController(t)
+	mockUserRepository := NewMockRepository(controller)
+	handler := NewUserHandler(mockUserRepository, mail.NewMockSender(controller), nil)
+	defer controller.Finish()
+
+	e := newEcho()
+	request := httptest.NewRequest(http.MethodGet, "/users/1", strings.NewReader(""))
+	recorder := httptest.NewRecorder()
+	context := e.NewContext(request, recorder)
+	context.SetParamNames("id")
+	context.SetParamValues("1")
+
+	mockUserRepository.EXPECT().FindById(gomock.Any(), "1").Return(Entity{}, mongo.ErrNoDocuments, true)
+
+	serve(handler.GetUser, context)
+
+	assert.Equal(t, http.StatusNotFound, recorder.Code)
+	assert.Contains(t, recorder.Body.String(), MESSAGE_USER_NOT_FOUND)
+}
+
+func TestLoginPendingUserFails(t *testing.T) {
+	controller := gomock.NewController(t)
+	mockUserRepository := NewMockRepository(controller)
+	handler := NewUserHandler(mockUserRepository, mail.NewMockSender(controller), nil)
+	defer controller.Finish()
+
+	pendingUser := Entity{
+		Id:       "asdf",
+		Username: "ncardozo",
+		Password: "$2a$12$8HKZFQTtifYRXmiguKAO2OPp3IxtsnZPEV7f7MnQdl5uzCJwsttci",
+		Role:     "ATLETHE",
+		Status:   "PENDING",
+	}
+
+	mockUserRepository.EXPECT().FindByUsername(gomock.Any(), "ncardozo").Return(pendingUser, nil, false)
+
+	e := newEcho()
+	request := httptest.NewRequest(http.MethodPost, "/login", strings.NewReader(requestBody))
+	request.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	recorder := httptest.NewRecorder()
+	context := e.NewContext(request, recorder)
+
+	serve(handler.Login, context)
+
+	assert.Equal(t, http.StatusForbidden, recorder.Code)
+	assert.Contains(t, recorder.Body.String(), MESSAGE_USER_PENDING_APPROVAL)
+}
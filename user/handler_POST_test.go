@@ -1,8 +1,10 @@
 package user
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
 	"strings"
@@ -11,23 +13,27 @@ import (
 
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/golang/mock/gomock"
-	"github.com/labstack/echo/v4"
 	"github.com/ncardozo92/gapef_swimming_metrics/constants"
+	"github.com/ncardozo92/gapef_swimming_metrics/custom_error"
+	"github.com/ncardozo92/gapef_swimming_metrics/mail"
+	"github.com/ncardozo92/gapef_swimming_metrics/persistence"
 	"github.com/stretchr/testify/assert"
 )
 
 func TestCreateUserSuccess(t *testing.T) {
 	controller := gomock.NewController(t)
 	mockUserRepository := NewMockRepository(controller)
-	handler := NewUserHandler(mockUserRepository)
+	mockMailSender := mail.NewMockSender(controller)
+	handler := NewUserHandler(mockUserRepository, mockMailSender, nil)
 	defer controller.Finish()
 
-	e := echo.New()
+	e := newEcho()
 
-	requestDTO, _ := json.Marshal(DTO{Email: "ncardozo@gapef.com.ar", Username: "ncardozo", Password: "anitaLAVAlaTina", Role: "ATLETHE"})
+	requestDTO, _ := json.Marshal(DTO{Email: "ncardozo@gapef.com.ar", Username: "ncardozo", Password: "anitaLAVAlaTina2024", Role: "ATLETHE"})
 
-	mockUserRepository.EXPECT().Create(gomock.Any()).Return(nil)
-	mockUserRepository.EXPECT().Exists(gomock.Any()).Return(false, nil)
+	mockUserRepository.EXPECT().Create(gomock.Any(), gomock.Any()).Return("1", nil)
+	mockUserRepository.EXPECT().Exists(gomock.Any(), gomock.Any()).Return(false, nil)
+	mockMailSender.EXPECT().Send("ncardozo@gapef.com.ar", SUBJECT_EMAIL_VERIFICATION, gomock.Any()).Return(nil)
 
 	request := httptest.NewRequest(http.MethodPost, "/users", strings.NewReader(string(requestDTO)))
 	request.Header.Set("Content-Type", "application/json")
@@ -35,14 +41,14 @@ func TestCreateUserSuccess(t *testing.T) {
 	recorder := httptest.NewRecorder()
 	context := e.NewContext(request, recorder)
 
-	assert.NoError(t, handler.Create(context))
+	serve(handler.Create, context)
 	assert.Equal(t, http.StatusCreated, recorder.Code)
 }
 
 func TestCreateUserInvalidDTOFails(t *testing.T) {
 	controller := gomock.NewController(t)
 	mockUserRepository := NewMockRepository(controller)
-	handler := NewUserHandler(mockUserRepository)
+	handler := NewUserHandler(mockUserRepository, mail.NewMockSender(controller), nil)
 	defer controller.Finish()
 
 	// test table
@@ -51,9 +57,10 @@ func TestCreateUserInvalidDTOFails(t *testing.T) {
 		{Email: "ncardozo@gapef.com.ar", Username: "", Password: "1234asdf", Role: constants.ROLE_ATLETHE},
 		{Email: "ncardozo@gapef.com.ar", Username: "ncardozo", Password: "", Role: constants.ROLE_ATLETHE},
 		{Email: "ncardozo@gapef.com.ar", Username: "ncardozo", Password: "1234asdf", Role: "undefined"},
+		{Email: "ncardozo@gapef.com.ar", Username: "ncardozo", Password: "1234asdf", Role: constants.ROLE_ATLETHE, Language: "fr"},
 	}
 
-	e := echo.New()
+	e := newEcho()
 
 	for _, testCase := range testCases {
 
@@ -65,8 +72,13 @@ func TestCreateUserInvalidDTOFails(t *testing.T) {
 		recorder := httptest.NewRecorder()
 		context := e.NewContext(request, recorder)
 
-		assert.NoError(t, handler.Create(context))
+		serve(handler.Create, context)
 		assert.Equal(t, http.StatusBadRequest, recorder.Code)
+
+		response := custom_error.DTO{}
+		json.Unmarshal(recorder.Body.Bytes(), &response)
+		assert.Equal(t, ErrValidation.Code, response.Code)
+		assert.NotEmpty(t, response.Fields)
 	}
 
 }
@@ -74,20 +86,20 @@ func TestCreateUserInvalidDTOFails(t *testing.T) {
 func TestCreateDuplicatedUserFails(t *testing.T) {
 	controller := gomock.NewController(t)
 	mockUserRepository := NewMockRepository(controller)
-	handler := NewUserHandler(mockUserRepository)
+	handler := NewUserHandler(mockUserRepository, mail.NewMockSender(controller), nil)
 	defer controller.Finish()
 
-	e := echo.New()
+	e := newEcho()
 
 	testCasesDtos := []DTO{
-		{Email: "ncardozo@gapef.com.ar", Username: "ncardozo92", Password: "1234asdf", Role: constants.ROLE_ATLETHE},
-		{Email: "nc92030@gapef.com.ar", Username: "ncardozo", Password: "1234asdf", Role: constants.ROLE_ATLETHE},
+		{Email: "ncardozo@gapef.com.ar", Username: "ncardozo92", Password: "NadarMariposa2024", Role: constants.ROLE_ATLETHE},
+		{Email: "nc92030@gapef.com.ar", Username: "ncardozo", Password: "NadarMariposa2024", Role: constants.ROLE_ATLETHE},
 	}
 
 	for _, dto := range testCasesDtos {
 
-		mockUserRepository.EXPECT().Exists(gomock.Any()).Return(true, nil)
-		mockUserRepository.EXPECT().Create(gomock.Any()).Times(0)
+		mockUserRepository.EXPECT().Exists(gomock.Any(), gomock.Any()).Return(true, nil)
+		mockUserRepository.EXPECT().Create(gomock.Any(), gomock.Any()).Times(0)
 
 		json, _ := json.Marshal(dto)
 		request := httptest.NewRequest(http.MethodPost, "/users", strings.NewReader(string(json)))
@@ -96,23 +108,78 @@ func TestCreateDuplicatedUserFails(t *testing.T) {
 		recorder := httptest.NewRecorder()
 		context := e.NewContext(request, recorder)
 
-		assert.NoError(t, handler.Create(context))
+		serve(handler.Create, context)
 		assert.Equal(t, http.StatusConflict, recorder.Code)
 	}
 }
 
+func TestCreateUserNormalizesIdentity(t *testing.T) {
+	controller := gomock.NewController(t)
+	mockUserRepository := NewMockRepository(controller)
+	mockMailSender := mail.NewMockSender(controller)
+	handler := NewUserHandler(mockUserRepository, mockMailSender, nil)
+	defer controller.Finish()
+
+	e := newEcho()
+
+	requestDTO, _ := json.Marshal(DTO{Email: " NCardozo@Gapef.com.ar", Username: "NCardozo ", Password: "anitaLAVAlaTina2024", Role: "ATLETHE"})
+
+	mockUserRepository.EXPECT().Exists(gomock.Any(), gomock.Any()).Return(false, nil)
+	mockUserRepository.EXPECT().Create(gomock.Any(), gomock.Any()).DoAndReturn(func(_ context.Context, entity Entity) (string, error) {
+		assert.Equal(t, "ncardozo", entity.Username)
+		assert.Equal(t, "ncardozo@gapef.com.ar", entity.Email)
+		return "1", nil
+	})
+	mockMailSender.EXPECT().Send("ncardozo@gapef.com.ar", SUBJECT_EMAIL_VERIFICATION, gomock.Any()).Return(nil)
+
+	request := httptest.NewRequest(http.MethodPost, "/users", strings.NewReader(string(requestDTO)))
+	request.Header.Set("Content-Type", "application/json")
+
+	recorder := httptest.NewRecorder()
+	context := e.NewContext(request, recorder)
+
+	serve(handler.Create, context)
+	assert.Equal(t, http.StatusCreated, recorder.Code)
+}
+
+// two concurrent requests pass the existence check, the unique index rejects the second one
+func TestCreateUserDuplicateKeyFails(t *testing.T) {
+	controller := gomock.NewController(t)
+	mockUserRepository := NewMockRepository(controller)
+	handler := NewUserHandler(mockUserRepository, mail.NewMockSender(controller), nil)
+	defer controller.Finish()
+
+	e := newEcho()
+
+	dto := DTO{Email: "nc92030@gapef.com.ar", Username: "ncardozo", Password: "NadarMariposa2024", Role: constants.ROLE_ATLETHE}
+
+	mockUserRepository.EXPECT().Exists(gomock.Any(), gomock.Any()).Return(false, nil)
+	mockUserRepository.EXPECT().Create(gomock.Any(), gomock.Any()).Return("", fmt.Errorf("%w, E11000", persistence.ErrDuplicateKey))
+
+	json, _ := json.Marshal(dto)
+	request := httptest.NewRequest(http.MethodPost, "/users", strings.NewReader(string(json)))
+	request.Header.Set("Content-Type", "application/json")
+
+	recorder := httptest.NewRecorder()
+	context := e.NewContext(request, recorder)
+
+	serve(handler.Create, context)
+	assert.Equal(t, http.StatusConflict, recorder.Code)
+	assert.Contains(t, recorder.Body.String(), MESSAGE_USER_ALREADY_EXISTS)
+}
+
 func TestCreateUserFindExistingFails(t *testing.T) {
 	controller := gomock.NewController(t)
 	mockUserRepository := NewMockRepository(controller)
-	handler := NewUserHandler(mockUserRepository)
+	handler := NewUserHandler(mockUserRepository, mail.NewMockSender(controller), nil)
 	defer controller.Finish()
 
-	e := echo.New()
+	e := newEcho()
 
-	dto := DTO{Email: "nc92030@gapef.com.ar", Username: "ncardozo", Password: "1234asdf", Role: constants.ROLE_ATLETHE}
+	dto := DTO{Email: "nc92030@gapef.com.ar", Username: "ncardozo", Password: "NadarMariposa2024", Role: constants.ROLE_ATLETHE}
 
-	mockUserRepository.EXPECT().Exists(gomock.Any()).Return(false, errors.New("Opps..."))
-	mockUserRepository.EXPECT().Create(gomock.Any()).Times(0)
+	mockUserRepository.EXPECT().Exists(gomock.Any(), gomock.Any()).Return(false, errors.New("Opps..."))
+	mockUserRepository.EXPECT().Create(gomock.Any(), gomock.Any()).Times(0)
 
 	json, _ := json.Marshal(dto)
 	request := httptest.NewRequest(http.MethodPost, "/users", strings.NewReader(string(json)))
@@ -121,7 +188,7 @@ func TestCreateUserFindExistingFails(t *testing.T) {
 	recorder := httptest.NewRecorder()
 	context := e.NewContext(request, recorder)
 
-	assert.NoError(t, handler.Create(context))
+	serve(handler.Create, context)
 	assert.Equal(t, http.StatusInternalServerError, recorder.Code)
 }
 
@@ -135,14 +202,68 @@ func TestValidateJWTSuccess(t *testing.T) {
 
 func generateJWTForTesting(id, username string, erxpireDateInSeconds int64) (string, error) {
 	now := time.Now().Unix()
-	tokenGenerator := jwt.NewWithClaims(jwt.SigningMethodHS256,
-		jwt.MapClaims{
-			"iss":        "GAPEF",
-			"sub":        username,
-			JWT_FIELD_ID: id,
-			"iat":        now,
-			"exp":        erxpireDateInSeconds,
-		})
-
-	return tokenGenerator.SignedString([]byte(JWT_SECRET))
+
+	return signJWT(jwt.MapClaims{
+		"iss":        "GAPEF",
+		"sub":        username,
+		JWT_FIELD_ID: id,
+		"iat":        now,
+		"exp":        erxpireDateInSeconds,
+	})
+}
+
+func TestLinkAthleteSuccess(t *testing.T) {
+	controller := gomock.NewController(t)
+	mockUserRepository := NewMockRepository(controller)
+	handler := NewUserHandler(mockUserRepository, mail.NewMockSender(controller), nil)
+	defer controller.Finish()
+
+	e := newEcho()
+
+	mockUserRepository.EXPECT().FindById(gomock.Any(), "1").Return(Entity{Id: "1", Role: constants.ROLE_PARENT}, nil, false)
+	mockUserRepository.EXPECT().FindById(gomock.Any(), "2").Return(Entity{Id: "2", Role: constants.ROLE_ATLETHE}, nil, false)
+	mockUserRepository.EXPECT().LinkAthlete(gomock.Any(), "1", "2").Return(nil)
+
+	request := httptest.NewRequest(http.MethodPost, "/users/1/athletes", strings.NewReader(`{"athlete_id": "2"}`))
+	request.Header.Set("Content-Type", "application/json")
+
+	recorder := httptest.NewRecorder()
+	context := e.NewContext(request, recorder)
+	context.SetParamNames("id")
+	context.SetParamValues("1")
+
+	serve(handler.LinkAthlete, context)
+	assert.Equal(t, http.StatusNoContent, recorder.Code)
+}
+
+func TestLinkAthleteWrongRolesFails(t *testing.T) {
+	e := newEcho()
+
+	// test table, parent role and athlete role
+	testCases := [][]string{
+		{constants.ROLE_COACH, constants.ROLE_ATLETHE},
+		{constants.ROLE_PARENT, constants.ROLE_PARENT},
+	}
+
+	for _, testCase := range testCases {
+		controller := gomock.NewController(t)
+		mockUserRepository := NewMockRepository(controller)
+		handler := NewUserHandler(mockUserRepository, mail.NewMockSender(controller), nil)
+
+		mockUserRepository.EXPECT().FindById(gomock.Any(), "1").Return(Entity{Id: "1", Role: testCase[0]}, nil, false)
+		mockUserRepository.EXPECT().FindById(gomock.Any(), "2").Return(Entity{Id: "2", Role: testCase[1]}, nil, false).MaxTimes(1)
+		mockUserRepository.EXPECT().LinkAthlete(gomock.Any(), gomock.Any(), gomock.Any()).Times(0)
+
+		request := httptest.NewRequest(http.MethodPost, "/users/1/athletes", strings.NewReader(`{"athlete_id": "2"}`))
+		request.Header.Set("Content-Type", "application/json")
+
+		recorder := httptest.NewRecorder()
+		context := e.NewContext(request, recorder)
+		context.SetParamNames("id")
+		context.SetParamValues("1")
+
+		serve(handler.LinkAthlete, context)
+		assert.Equal(t, http.StatusBadRequest, recorder.Code)
+		controller.Finish()
+	}
 }
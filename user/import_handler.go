@@ -0,0 +1,331 @@
+package user
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/labstack/echo/v4"
+	"github.com/ncardozo92/gapef_swimming_metrics/audit"
+	"github.com/ncardozo92/gapef_swimming_metrics/constants"
+	"github.com/ncardozo92/gapef_swimming_metrics/custom_error"
+	"github.com/ncardozo92/gapef_swimming_metrics/i18n"
+	"github.com/ncardozo92/gapef_swimming_metrics/logging"
+	"github.com/ncardozo92/gapef_swimming_metrics/persistence"
+	"github.com/ncardozo92/gapef_swimming_metrics/roster"
+	"go.mongodb.org/mongo-driver/bson"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	MESSAGE_IMPORT_FILE_REQUIRED = "Debe enviarse el archivo del plantel en el campo file"
+	MESSAGE_IMPORT_FILE_INVALID  = "El archivo del plantel debe ser un CSV o XLSX válido"
+	MESSAGE_IMPORT_FILE_EMPTY    = "El archivo del plantel no tiene filas"
+	MESSAGE_IMPORT_FILE_TOO_BIG  = "El archivo del plantel supera los %d MB"
+	MESSAGE_IMPORT_TOO_MANY_ROWS = "El archivo del plantel tiene más de %d filas"
+	MESSAGE_IMPORT_INVALID_ROWS  = "El plantel tiene filas inválidas, no se creó ningún usuario"
+	MESSAGE_IMPORT_ERROR         = "No se pudo importar el plantel"
+	DETAIL_IMPORT_ROW            = "Fila %d: %s"
+	DETAIL_DUPLICATED_IN_FILE    = "El username o email está repetido en el archivo"
+	DETAIL_ROLE_NOT_GRANTED      = "No tiene permisos para crear usuarios con el rol %s"
+	SUBJECT_ACCOUNT_CREATED      = "GAPEF - Tu cuenta fue creada"
+	BODY_ACCOUNT_CREATED         = "Hola %s, se creó tu cuenta de GAPEF. Tu usuario es %s . " +
+		"Para verificar tu email ingresá al siguiente enlace: %s y para elegir tu contraseña a este otro: %s"
+
+	IMPORT_FILE_FIELD = "file"
+	// when true the rows without password get a random one nobody knows, the new user chooses his own with the
+	// password reset link sent by email
+	IMPORT_GENERATE_PASSWORDS_FIELD = "generate_passwords"
+	MAX_IMPORT_FILE_SIZE            = 5 << 20
+	// the limit of the whole upload, with room for the multipart headers and the other fields
+	MAX_IMPORT_REQUEST_SIZE  = MAX_IMPORT_FILE_SIZE + 1<<20
+	MAX_IMPORT_ROWS          = 2000
+	TEMPORARY_PASSWORD_BYTES = 12
+	// bcrypt is slow on purpose, so the passwords of a roster are hashed in parallel
+	IMPORT_HASHING_WORKERS = 4
+)
+
+type ImportResultDTO struct {
+	Created int   `json:"created"`
+	Users   []DTO `json:"users"`
+}
+
+// a user of the roster waiting to be created
+type importedUser struct {
+	entity Entity
+	// the password was generated, so the user must choose one before logging in
+	generatedPassword bool
+}
+
+// ImportUsers creates the users of a roster spreadsheet. The rows are validated like a single user creation and, if
+// any row is invalid or already exists, nothing is created and the errors of every row are returned
+func (handler UserHandler) ImportUsers(context echo.Context) error {
+	fileHeader, fileErr := context.FormFile(IMPORT_FILE_FIELD)
+
+	// the body limit of the route stopped the upload before the whole file was read
+	if errors.Is(fileErr, echo.ErrStatusRequestEntityTooLarge) {
+		logging.LogErrorContext(context.Request().Context(), "roster upload too big, %v", fileErr)
+		return ErrImportFileTooLarge
+	}
+
+	if fileErr != nil {
+		logging.LogErrorContext(context.Request().Context(), "roster file not present, %v", fileErr)
+		return ErrImportFileRequired
+	}
+
+	if fileHeader.Size > MAX_IMPORT_FILE_SIZE {
+		logging.LogErrorContext(context.Request().Context(), "roster file too big, %d bytes", fileHeader.Size)
+		return ErrImportFileTooLarge
+	}
+
+	file, openErr := fileHeader.Open()
+
+	if openErr != nil {
+		logging.LogErrorContext(context.Request().Context(), "could not open the roster file, %v", openErr)
+		return ErrImportFileInvalid
+	}
+
+	defer file.Close()
+
+	rows, readErr := roster.Read(fileHeader.Filename, file)
+
+	if readErr != nil {
+		logging.LogErrorContext(context.Request().Context(), "could not read the roster %s, %v", fileHeader.Filename, readErr)
+		return ErrImportFileInvalid
+	}
+
+	if len(rows) == 0 {
+		return ErrImportFileEmpty
+	}
+
+	if len(rows) > MAX_IMPORT_ROWS {
+		return ErrImportTooManyRows
+	}
+
+	claims, claimsErr := getRequestClaims(context)
+
+	if claimsErr != nil {
+		logging.LogErrorContext(context.Request().Context(), "Could not read JWT claims, %v", claimsErr)
+		return ErrJwtNotPresent
+	}
+
+	generatePasswords := context.FormValue(IMPORT_GENERATE_PASSWORDS_FIELD) == "true"
+
+	users, details, validationErr := handler.validateRoster(context, claims, rows, generatePasswords)
+
+	if validationErr != nil {
+		logging.LogErrorContext(context.Request().Context(), "could not validate the roster, %v", validationErr)
+		return repositoryError(validationErr, ErrImport)
+	}
+
+	if len(details) > 0 {
+		logging.LogWarningContext(context.Request().Context(), "the roster %s has %d invalid rows",
+			fileHeader.Filename, len(details))
+		return ErrImportInvalidRows.WithDetails(details...)
+	}
+
+	if hashingErr := hashImportedPasswords(users); hashingErr != nil {
+		logging.LogErrorContext(context.Request().Context(), "Error hashing the password, %v", hashingErr)
+		return ErrImport
+	}
+
+	entities := []Entity{}
+	for _, user := range users {
+		entities = append(entities, user.entity)
+	}
+
+	ids, createErr := handler.userRepository.CreateMany(context.Request().Context(), entities)
+
+	// a user of the roster was created by another request after the validation
+	if errors.Is(createErr, persistence.ErrDuplicateKey) {
+		logging.LogWarningContext(context.Request().Context(), "the roster %s has users that already exist, %v",
+			fileHeader.Filename, createErr)
+		return ErrUserAlreadyExists
+	}
+
+	if createErr != nil {
+		logging.LogErrorContext(context.Request().Context(), "could not save the roster users, %v", createErr)
+		return repositoryError(createErr, ErrImport)
+	}
+
+	result := ImportResultDTO{Created: len(ids), Users: []DTO{}}
+
+	for index, user := range users {
+		user.entity.Id = ids[index]
+		handler.sendImportEmail(context.Request().Context(), user)
+		result.Users = append(result.Users, toDTO(user.entity))
+	}
+
+	logging.LogInfoContext(context.Request().Context(), "%d users imported from %s", len(ids), fileHeader.Filename)
+	audit.SetAction(context, AUDIT_IMPORT_USERS)
+	audit.SetChanges(context, nil, bson.M{"file": fileHeader.Filename, "users": ids})
+
+	return context.JSON(http.StatusCreated, result)
+}
+
+// validates every row and returns the users to create, or the errors of the invalid rows. The rows can only have the
+// roles the importer can grant
+func (handler UserHandler) validateRoster(context echo.Context, claims jwt.MapClaims, rows []roster.Row,
+	generatePasswords bool) ([]importedUser, []i18n.Message, error) {
+	users := []importedUser{}
+	details := []i18n.Message{}
+	seen := map[string]bool{}
+
+	for _, row := range rows {
+		dto := DTO{
+			Email:     normalizeIdentity(row.Values["email"]),
+			Username:  normalizeIdentity(row.Values["username"]),
+			FirstName: row.Values["first_name"],
+			LastName:  row.Values["last_name"],
+			Password:  row.Values["password"],
+			Role:      strings.ToUpper(row.Values["role"]),
+			Group:     row.Values["group"],
+			Status:    constants.STATUS_ACTIVE,
+		}
+
+		// the rosters list the athletes of the season
+		if dto.Role == "" {
+			dto.Role = constants.ROLE_ATLETHE
+		}
+
+		user := importedUser{}
+
+		if dto.Password == "" && generatePasswords {
+			temporaryPassword, passwordErr := generateTemporaryPassword(dto)
+
+			if passwordErr != nil {
+				return nil, nil, passwordErr
+			}
+
+			dto.Password = temporaryPassword
+			user.generatedPassword = true
+		}
+
+		rowDetails := custom_error.FieldMessages(validateDTO(dto))
+
+		if isValidRole(dto.Role) && !canGrantRole(claims, dto.Role) {
+			rowDetails = append(rowDetails, i18n.NewMessage(CODE_ROLE_NOT_GRANTED, dto.Role))
+		}
+
+		usernameKey := "username:" + dto.Username
+		emailKey := "email:" + dto.Email
+
+		if seen[usernameKey] || seen[emailKey] {
+			rowDetails = append(rowDetails, i18n.NewMessage(CODE_DUPLICATED_IN_FILE))
+		}
+
+		seen[usernameKey] = true
+		seen[emailKey] = true
+
+		user.entity = fromDTO(dto)
+
+		// the database is only queried for the rows that could be created
+		if len(rowDetails) == 0 {
+			userExists, existsErr := handler.userRepository.Exists(context.Request().Context(), user.entity)
+
+			if existsErr != nil {
+				return nil, nil, existsErr
+			}
+
+			if userExists {
+				rowDetails = append(rowDetails, i18n.NewMessage(ErrUserAlreadyExists.Code))
+			}
+		}
+
+		for _, detail := range rowDetails {
+			details = append(details, i18n.NewMessage(CODE_IMPORT_ROW, row.Number, detail))
+		}
+
+		users = append(users, user)
+	}
+
+	return users, details, nil
+}
+
+// replaces the passwords of the users by their hashes
+func hashImportedPasswords(users []importedUser) error {
+	var waitGroup sync.WaitGroup
+	var firstErr error
+	var errMutex sync.Mutex
+	indexes := make(chan int)
+
+	for worker := 0; worker < IMPORT_HASHING_WORKERS; worker++ {
+		waitGroup.Add(1)
+
+		go func() {
+			defer waitGroup.Done()
+
+			for index := range indexes {
+				hashedPassword, hashingErr := bcrypt.GenerateFromPassword([]byte(users[index].entity.Password), bcrypt.DefaultCost)
+
+				if hashingErr != nil {
+					errMutex.Lock()
+					firstErr = hashingErr
+					errMutex.Unlock()
+					continue
+				}
+
+				users[index].entity.Password = string(hashedPassword)
+			}
+		}()
+	}
+
+	for index := range users {
+		indexes <- index
+	}
+
+	close(indexes)
+	waitGroup.Wait()
+
+	return firstErr
+}
+
+// generates a random password that follows the password policy
+func generateTemporaryPassword(dto DTO) (string, error) {
+	for {
+		randomBytes := make([]byte, TEMPORARY_PASSWORD_BYTES)
+
+		if _, randomErr := rand.Read(randomBytes); randomErr != nil {
+			return "", randomErr
+		}
+
+		// the symbol makes it valid when the policy requires one
+		candidate := base64.RawURLEncoding.EncodeToString(randomBytes) + "!"
+
+		if len(passwordPolicy.Validate(candidate, dto.Username, dto.Email)) == 0 {
+			return candidate, nil
+		}
+	}
+}
+
+// the users with a generated password get the link to choose their own with the verification link, the rest only
+// get the verification link. The generated password is never sent, so it cannot be read from the mailbox later
+func (handler UserHandler) sendImportEmail(ctx context.Context, user importedUser) {
+	if !user.generatedPassword {
+		handler.sendVerificationEmail(ctx, user.entity)
+		return
+	}
+
+	link, linkErr := verificationLink(user.entity)
+
+	if linkErr != nil {
+		logging.LogErrorContext(ctx, "could not generate verification token, %v", linkErr)
+		return
+	}
+
+	// it lasts as long as the verification link, the new users may not read the email right away
+	resetLink, resetLinkErr := passwordResetLink(user.entity, jwtConfig.EmailVerificationLifetime)
+
+	if resetLinkErr != nil {
+		logging.LogErrorContext(ctx, "could not build the password reset link, %v", resetLinkErr)
+		return
+	}
+
+	handler.sendEmail(ctx, user.entity, EMAIL_ACCOUNT_CREATED, user.entity.FirstName, user.entity.Username, link,
+		resetLink)
+}
@@ -0,0 +1,247 @@
+package user
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/golang/mock/gomock"
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/echo/v4/middleware"
+	"github.com/ncardozo92/gapef_swimming_metrics/constants"
+	"github.com/ncardozo92/gapef_swimming_metrics/custom_error"
+	"github.com/ncardozo92/gapef_swimming_metrics/mail"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// builds the multipart request that uploads the roster
+func newImportRequest(filename, content string, generatePasswords bool) *http.Request {
+	body := bytes.Buffer{}
+	writer := multipart.NewWriter(&body)
+
+	fileWriter, _ := writer.CreateFormFile(IMPORT_FILE_FIELD, filename)
+	fileWriter.Write([]byte(content))
+
+	if generatePasswords {
+		writer.WriteField(IMPORT_GENERATE_PASSWORDS_FIELD, "true")
+	}
+
+	writer.Close()
+
+	request := httptest.NewRequest(http.MethodPost, PATH_USERS_IMPORT, &body)
+	request.Header.Set(echo.HeaderContentType, writer.FormDataContentType())
+
+	return request
+}
+
+// the context of the import requested by a user with the role
+func newImportContext(e *echo.Echo, request *http.Request, recorder *httptest.ResponseRecorder, role string) echo.Context {
+	context := e.NewContext(request, recorder)
+	context.Set(CONTEXT_CLAIMS, jwt.MapClaims{JWT_FIELD_ID: "9", JWT_FIELD_ROLE: role})
+
+	return context
+}
+
+func TestImportUsers(t *testing.T) {
+	controller := gomock.NewController(t)
+	mockUserRepository := NewMockRepository(controller)
+	mockMailSender := mail.NewMockSender(controller)
+	handler := NewUserHandler(mockUserRepository, mockMailSender, nil)
+	defer controller.Finish()
+
+	roster := "email;usuario;nombre;apellido;grupo;contraseña\n" +
+		"ana@gapef.com.ar;aperez;Ana;Pérez;Juveniles;\n" +
+		"luis@gapef.com.ar;lsosa;Luis;Sosa;Juveniles;NadarMariposa2024\n"
+
+	mockUserRepository.EXPECT().Exists(gomock.Any(), gomock.Any()).Return(false, nil).Times(2)
+	mockUserRepository.EXPECT().CreateMany(gomock.Any(), gomock.Any()).DoAndReturn(func(_ context.Context, entities []Entity) ([]string, error) {
+		assert.Len(t, entities, 2)
+		assert.Equal(t, constants.ROLE_ATLETHE, entities[0].Role)
+		assert.Equal(t, constants.STATUS_ACTIVE, entities[0].Status)
+		assert.Equal(t, "Juveniles", entities[0].Group)
+		assert.NoError(t, bcrypt.CompareHashAndPassword([]byte(entities[1].Password), []byte("NadarMariposa2024")))
+		return []string{"1", "2"}, nil
+	})
+
+	// the athlete without password gets the link to choose one, never the generated password, the other one only
+	// the verification link
+	mockMailSender.EXPECT().Send("ana@gapef.com.ar", SUBJECT_ACCOUNT_CREATED, gomock.Any()).DoAndReturn(func(_, _, body string) error {
+		assert.Contains(t, body, "token=")
+		assert.NotContains(t, body, "contraseña temporal")
+		return nil
+	})
+	mockMailSender.EXPECT().Send("luis@gapef.com.ar", SUBJECT_EMAIL_VERIFICATION, gomock.Any()).Return(nil)
+
+	e := newEcho()
+	recorder := httptest.NewRecorder()
+
+	serve(handler.ImportUsers, newImportContext(e, newImportRequest("plantel.csv", roster, true), recorder,
+		constants.ROLE_COACH))
+
+	result := ImportResultDTO{}
+	json.Unmarshal(recorder.Body.Bytes(), &result)
+
+	assert.Equal(t, http.StatusCreated, recorder.Code)
+	assert.Equal(t, 2, result.Created)
+	assert.Equal(t, "1", result.Users[0].Id)
+	assert.Empty(t, result.Users[0].Password)
+}
+
+func TestImportUsersInvalidRows(t *testing.T) {
+	controller := gomock.NewController(t)
+	mockUserRepository := NewMockRepository(controller)
+	handler := NewUserHandler(mockUserRepository, mail.NewMockSender(controller), nil)
+	defer controller.Finish()
+
+	roster := "email,username,password\n" +
+		"ana@gapef.com.ar,aperez,NadarMariposa2024\n" +
+		"no es un email,lsosa,NadarMariposa2024\n" +
+		"ana@gapef.com.ar,aperez2,NadarMariposa2024\n" +
+		"juan@gapef.com.ar,jgomez,NadarMariposa2024\n" +
+		"sol@gapef.com.ar,sdiaz,\n"
+
+	mockUserRepository.EXPECT().Exists(gomock.Any(), gomock.Any()).DoAndReturn(func(_ context.Context, entity Entity) (bool, error) {
+		return entity.Username == "jgomez", nil
+	}).Times(2)
+
+	e := newEcho()
+	recorder := httptest.NewRecorder()
+
+	serve(handler.ImportUsers, newImportContext(e, newImportRequest("plantel.csv", roster, false), recorder,
+		constants.ROLE_COACH))
+
+	response := custom_error.DTO{}
+	json.Unmarshal(recorder.Body.Bytes(), &response)
+
+	assert.Equal(t, http.StatusBadRequest, recorder.Code)
+	assert.Equal(t, MESSAGE_IMPORT_INVALID_ROWS, response.Message)
+	assert.Equal(t, []string{
+		"Fila 3: " + DETAIL_INVALID_EMAIL,
+		"Fila 4: " + DETAIL_DUPLICATED_IN_FILE,
+		"Fila 5: " + MESSAGE_USER_ALREADY_EXISTS,
+		"Fila 6: " + DETAIL_INVALID_PASSWORD,
+	}, response.Details)
+}
+
+// the coaches can only import athletes and parents, the admins any role
+func TestImportUsersRolesTheImporterCanGrant(t *testing.T) {
+	roster := "email,username,password,role\n" +
+		"ana@gapef.com.ar,aperez,NadarMariposa2024,parent\n" +
+		"luis@gapef.com.ar,lsosa,NadarMariposa2024,admin\n" +
+		"juan@gapef.com.ar,jgomez,NadarMariposa2024,coach\n"
+
+	t.Run("coach", func(t *testing.T) {
+		controller := gomock.NewController(t)
+		mockUserRepository := NewMockRepository(controller)
+		handler := NewUserHandler(mockUserRepository, mail.NewMockSender(controller), nil)
+		defer controller.Finish()
+
+		// nothing is created, only the parent could be
+		mockUserRepository.EXPECT().Exists(gomock.Any(), gomock.Any()).Return(false, nil).Times(1)
+
+		e := newEcho()
+		recorder := httptest.NewRecorder()
+
+		serve(handler.ImportUsers, newImportContext(e, newImportRequest("plantel.csv", roster, false), recorder,
+			constants.ROLE_COACH))
+
+		response := custom_error.DTO{}
+		json.Unmarshal(recorder.Body.Bytes(), &response)
+
+		assert.Equal(t, http.StatusBadRequest, recorder.Code)
+		assert.Equal(t, []string{
+			"Fila 3: No tiene permisos para crear usuarios con el rol ADMIN",
+			"Fila 4: No tiene permisos para crear usuarios con el rol COACH",
+		}, response.Details)
+	})
+
+	t.Run("admin", func(t *testing.T) {
+		controller := gomock.NewController(t)
+		mockUserRepository := NewMockRepository(controller)
+		mockMailSender := mail.NewMockSender(controller)
+		handler := NewUserHandler(mockUserRepository, mockMailSender, nil)
+		defer controller.Finish()
+
+		mockUserRepository.EXPECT().Exists(gomock.Any(), gomock.Any()).Return(false, nil).Times(3)
+		mockUserRepository.EXPECT().CreateMany(gomock.Any(), gomock.Any()).Return([]string{"1", "2", "3"}, nil)
+		mockMailSender.EXPECT().Send(gomock.Any(), SUBJECT_EMAIL_VERIFICATION, gomock.Any()).Return(nil).Times(3)
+
+		e := newEcho()
+		recorder := httptest.NewRecorder()
+
+		serve(handler.ImportUsers, newImportContext(e, newImportRequest("plantel.csv", roster, false), recorder,
+			constants.ROLE_ADMIN))
+
+		assert.Equal(t, http.StatusCreated, recorder.Code)
+	})
+}
+
+func TestImportUsersInvalidFile(t *testing.T) {
+	testCases := []*http.Request{
+		newImportRequest("plantel.pdf", "email\nana@gapef.com.ar\n", false),
+		newImportRequest("plantel.csv", "email,username\n", false),
+		httptest.NewRequest(http.MethodPost, PATH_USERS_IMPORT, strings.NewReader("")),
+	}
+
+	e := newEcho()
+
+	for _, request := range testCases {
+		controller := gomock.NewController(t)
+		handler := NewUserHandler(NewMockRepository(controller), mail.NewMockSender(controller), nil)
+		recorder := httptest.NewRecorder()
+
+		serve(handler.ImportUsers, e.NewContext(request, recorder))
+
+		assert.Equal(t, http.StatusBadRequest, recorder.Code)
+
+		controller.Finish()
+	}
+}
+
+// the files over the limit are refused whether the handler or the body limit of the route stops them
+func TestImportUsersFileTooLarge(t *testing.T) {
+	testCases := []struct {
+		name string
+		size int
+		// without it the body limit can only stop the upload while the handler reads it
+		contentLength bool
+		code          string
+	}{
+		{"file over the limit", MAX_IMPORT_FILE_SIZE + 1, true, ErrImportFileTooLarge.Code},
+		{"request over the limit", MAX_IMPORT_REQUEST_SIZE + 1, true, custom_error.CODE_PAYLOAD_TOO_LARGE},
+		{"chunked request over the limit", MAX_IMPORT_REQUEST_SIZE + 1, false, ErrImportFileTooLarge.Code},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			controller := gomock.NewController(t)
+			handler := NewUserHandler(NewMockRepository(controller), mail.NewMockSender(controller), nil)
+			defer controller.Finish()
+
+			e := newEcho()
+			e.POST(PATH_USERS_IMPORT, handler.ImportUsers, middleware.BodyLimit(strconv.Itoa(MAX_IMPORT_REQUEST_SIZE)))
+
+			request := newImportRequest("plantel.csv", strings.Repeat("a", testCase.size), false)
+			if !testCase.contentLength {
+				request.ContentLength = -1
+			}
+
+			recorder := httptest.NewRecorder()
+			e.ServeHTTP(recorder, request)
+
+			response := custom_error.DTO{}
+			json.Unmarshal(recorder.Body.Bytes(), &response)
+
+			assert.Equal(t, http.StatusRequestEntityTooLarge, recorder.Code)
+			assert.Equal(t, testCase.code, response.Code)
+		})
+	}
+}
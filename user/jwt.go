@@ -1,11 +1,7 @@
 package user
 
 import (
-	"encoding/base64"
-	"encoding/json"
 	"errors"
-	"net/http"
-	"os"
 	"strings"
 	"time"
 
@@ -13,21 +9,73 @@ import (
 	"github.com/labstack/echo/v4"
 	"github.com/ncardozo92/gapef_swimming_metrics/constants"
 	"github.com/ncardozo92/gapef_swimming_metrics/custom_error"
+	"github.com/ncardozo92/gapef_swimming_metrics/health"
+	"github.com/ncardozo92/gapef_swimming_metrics/i18n"
 	"github.com/ncardozo92/gapef_swimming_metrics/logging"
+	"github.com/ncardozo92/gapef_swimming_metrics/metrics"
+	"github.com/ncardozo92/gapef_swimming_metrics/openapi"
+	"github.com/ncardozo92/gapef_swimming_metrics/tracing"
 )
 
 const (
-	JWT_FIELD_ROLE          = "role"
-	JWT_FIELD_ID            = "id"
-	JWT_BEARER_PREFIX       = "Bearer "
-	AUTHORIZATION_HEADER    = "Authorization"
-	ISSUER                  = "GAPEF"
-	ROLE_TRAINNER           = "TRAINER"
-	BEARER_PREFIX           = "Bearer "
-	MESSAGE_JWT_NOT_PRESENT = "Debe enviarse un JWT válido"
+	JWT_FIELD_ROLE       = "role"
+	JWT_FIELD_ID         = "id"
+	JWT_FIELD_ATHLETES   = "athletes"
+	JWT_FIELD_PURPOSE    = "purpose"
+	JWT_FIELD_VERIFIED   = "email_verified"
+	JWT_FIELD_ENROLL_2FA = "2fa_enrollment_required"
+	JWT_FIELD_SCOPES     = "scopes"
+	JWT_FIELD_API_KEY    = "api_key"
+	JWT_FIELD_LANGUAGE   = "language"
+	// key of the echo context where the middleware leaves the claims of the authenticated request
+	CONTEXT_CLAIMS                  = "claims"
+	JWT_BEARER_PREFIX               = "Bearer "
+	AUTHORIZATION_HEADER            = "Authorization"
+	ISSUER                          = "GAPEF"
+	ROLE_TRAINNER                   = "TRAINER"
+	BEARER_PREFIX                   = "Bearer "
+	MESSAGE_JWT_NOT_PRESENT         = "Debe enviarse un JWT válido"
+	MESSAGE_ACCESS_DENIED           = "No tiene permisos para acceder a los datos del atleta"
+	MESSAGE_EMAIL_UNVERIFIED        = "Debe verificar su email para acceder"
+	MESSAGE_ADMIN_REQUIRED          = "El usuario debe ser administrador"
+	MESSAGE_COACH_REQUIRED          = "El usuario debe ser entrenador"
+	MESSAGE_2FA_ENROLLMENT_REQUIRED = "Debe configurar la autenticación en dos pasos para acceder"
+
+	PURPOSE_EMAIL_VERIFICATION = "email_verification"
+	PURPOSE_2FA_CHALLENGE      = "2fa_challenge"
+	PURPOSE_OIDC_STATE         = "oidc_state"
+
+	// lifetime of the authentication tokens until UseConfig sets the configured one
+	ACCESS_TOKEN_LIFETIME = 3 * time.Minute
 )
 
-var JWT_SECRET string = os.Getenv("JWT_SECRET")
+// paths that can be requested without a JWT
+var publicPaths = map[string]bool{
+	PATH_LOGIN:                  true,
+	PATH_SIGNUP:                 true,
+	PATH_VERIFY_EMAIL:           true,
+	PATH_VERIFY_EMAIL_RESEND:    true,
+	PATH_LOGIN_2FA:              true,
+	PATH_JWKS:                   true,
+	PATH_LOGIN_OIDC:             true,
+	PATH_LOGIN_OIDC_CALLBACK:    true,
+	PATH_PASSWORD_RESET:         true,
+	PATH_PASSWORD_RESET_CONFIRM: true,
+	// the load balancer probes have no credentials
+	health.PATH_HEALTH: true,
+	health.PATH_READY:  true,
+	// the scraper is checked by the metrics handler, it sends its own token
+	metrics.PATH_METRICS: true,
+	// the documentation of the API
+	openapi.PATH_OPENAPI: true,
+	openapi.PATH_DOCS:    true,
+}
+
+// paths that a user required to enrol a second factor can request
+var twoFactorEnrollmentPaths = map[string]bool{
+	PATH_2FA:         true,
+	PATH_2FA_CONFIRM: true,
+}
 
 type AuthenticationClaims struct {
 	Role      string `json:"role"`
@@ -36,36 +84,144 @@ type AuthenticationClaims struct {
 }
 
 func generateJWT(user Entity) (string, error) {
+	return signJWT(authenticationClaims(user))
+}
+
+// generates a token that only allows the user to enrol a second factor, required by the two factor policy of his role
+func generateEnrollmentJWT(user Entity) (string, error) {
+	claims := authenticationClaims(user)
+	claims[JWT_FIELD_ENROLL_2FA] = true
+
+	return signJWT(claims)
+}
+
+// the claims of the token that authenticates the user
+func authenticationClaims(user Entity) jwt.MapClaims {
 
-	tokenGenerator := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+	claims := jwt.MapClaims{
 		"id":           user.Id,
 		JWT_FIELD_ROLE: user.Role,
 		"iss":          ISSUER,
 		"sub":          user.Username,
 		"iat":          time.Now().Unix(),
-		"exp":          time.Now().Add(3 * time.Minute).Unix(),
+		"exp":          time.Now().Add(jwtConfig.AccessTokenLifetime).Unix(),
+	}
+
+	// users that did not verify their email get a restricted token
+	if !user.EmailVerified {
+		claims[JWT_FIELD_VERIFIED] = false
+	}
+
+	// parents carry the athletes they are linked to, so their access can be checked without querying the database.
+	// The links are the ones of the login: an athlete linked afterwards can only be accessed after logging in again
+	if user.Role == constants.ROLE_PARENT {
+		claims[JWT_FIELD_ATHLETES] = user.Athletes
+	}
+
+	// the language the user chose replaces the one of the Accept-Language header
+	if user.Language != "" {
+		claims[JWT_FIELD_LANGUAGE] = user.Language
+	}
+
+	return claims
+}
+
+// signs the claims with the current key of the key ring, the key id goes at the token header
+func signJWT(claims jwt.MapClaims) (string, error) {
+	key := getKeyRing().signingKey()
+
+	tokenGenerator := jwt.NewWithClaims(signingMethod(key.Algorithm), claims)
+	tokenGenerator.Header[JWT_HEADER_KEY_ID] = key.Id
+
+	return tokenGenerator.SignedString(key.PrivateKey)
+}
+
+// generates a JWT that is only useful for a single purpose, like verifying an email, and cannot be used to authenticate
+func generatePurposeJWT(userId, purpose string, lifetime time.Duration) (string, error) {
+
+	return signJWT(jwt.MapClaims{
+		JWT_FIELD_PURPOSE: purpose,
+		"iss":             ISSUER,
+		"sub":             userId,
+		"iat":             time.Now().Unix(),
+		"exp":             time.Now().Add(lifetime).Unix(),
 	})
+}
+
+// validates a JWT generated for the given purpose and returns the id of the user it was generated for
+func parsePurposeJWT(tokenString, purpose string) (string, error) {
+
+	parsedToken, parsingErr := parseJWT(tokenString)
+
+	if parsingErr != nil {
+		return "", parsingErr
+	}
 
-	return tokenGenerator.SignedString([]byte(JWT_SECRET))
+	claims, claimsOk := parsedToken.Claims.(jwt.MapClaims)
+
+	if !claimsOk || claims[JWT_FIELD_PURPOSE] != purpose || claims["iss"] != ISSUER {
+		return "", errors.New("the JWT provided is not valid for " + purpose)
+	}
+
+	return claims.GetSubject()
 }
 
 func CustomJwtMiddleware(next echo.HandlerFunc) echo.HandlerFunc {
 	return func(c echo.Context) error {
 
-		if c.Path() != PATH_LOGIN {
+		if !publicPaths[c.Path()] {
+
+			// machine clients authenticate with an API key instead of a JWT
+			if apiKey := c.Request().Header.Get(API_KEY_HEADER); apiKey != "" {
+				claims, apiKeyErr := authenticateApiKey(c.Request().Context(), apiKey)
+
+				if apiKeyErr != nil {
+					logging.LogErrorContext(c.Request().Context(), "Error validating the API key: %v", apiKeyErr)
+					return ErrInvalidApiKey
+				}
+
+				c.Set(CONTEXT_CLAIMS, claims)
+
+				if err := next(c); err != nil {
+					c.Error(err)
+				}
+				return nil
+			}
+
 			authenticationHeader := c.Request().Header.Get(AUTHORIZATION_HEADER)
 
 			if authenticationHeader == "" {
-				logging.LogError("JWT not present at the request")
-				return c.JSON(http.StatusUnauthorized, custom_error.DTO{Message: MESSAGE_JWT_NOT_PRESENT})
+				logging.LogErrorContext(c.Request().Context(), "JWT not present at the request")
+				return ErrJwtNotPresent
 			}
 
+			_, validationSpan := tracing.Start(c.Request().Context(), "jwt.validate")
 			validationErr := validateJWT(strings.Replace(authenticationHeader, JWT_BEARER_PREFIX, "", 1))
+			tracing.End(validationSpan, validationErr)
 
 			if validationErr != nil {
-				logging.LogError("Error validating the JWT: %v", validationErr)
-				return c.JSON(http.StatusForbidden, custom_error.DTO{Message: "Debe enviarse un JWT válido"})
+				logging.LogErrorContext(c.Request().Context(), "Error validating the JWT: %v", validationErr)
+				return ErrInvalidJwt.Wrap(validationErr)
+			}
+
+			claims, claimsErr := getRequestClaims(c)
+
+			if claimsErr != nil {
+				logging.LogErrorContext(c.Request().Context(), "Could not read JWT claims, %v", claimsErr)
+				return ErrInvalidJwt
+			}
+
+			if restriction := tokenRestriction(c, claims); restriction != nil {
+				logging.LogWarningContext(c.Request().Context(), "User %v with a restricted token tried to access %s",
+					claims[JWT_FIELD_ID], c.Path())
+				return restriction
+			}
+
+			if language, hasLanguage := claims[JWT_FIELD_LANGUAGE].(string); hasLanguage && i18n.IsSupported(language) {
+				c.SetRequest(c.Request().WithContext(i18n.WithLanguage(c.Request().Context(), language)))
 			}
+
+			c.Set(CONTEXT_CLAIMS, claims)
 		}
 
 		if err := next(c); err != nil {
@@ -75,58 +231,201 @@ func CustomJwtMiddleware(next echo.HandlerFunc) echo.HandlerFunc {
 	}
 }
 
+// CoachAccessMiddleware only lets coaches, admins and API keys with the coach or admin scope through
 func CoachAccessMiddleware(next echo.HandlerFunc) echo.HandlerFunc {
 	return func(c echo.Context) error {
-		authorizationHeader := c.Request().Header.Get(AUTHORIZATION_HEADER)
-		if authorizationHeader == "" {
-			logging.LogError("JWT not present at the request")
-			return c.JSON(http.StatusUnauthorized, custom_error.DTO{Message: MESSAGE_JWT_NOT_PRESENT})
+		claims, claimsErr := getRequestClaims(c)
+
+		if claimsErr != nil {
+			logging.LogErrorContext(c.Request().Context(), "Could not read JWT claims, %v", claimsErr)
+			return ErrJwtNotPresent
+		}
+
+		// admins can do everything a coach does
+		if !isAuthorized(claims, []string{constants.ROLE_COACH, constants.ROLE_ADMIN},
+			[]string{constants.SCOPE_COACH, constants.SCOPE_ADMIN}) {
+			logging.LogWarningContext(c.Request().Context(), "User %v is not a coach", claims[JWT_FIELD_ID])
+			return ErrCoachRequired
+		}
+
+		if err := next(c); err != nil {
+			c.Error(err)
+		}
+		return nil
+	}
+}
+
+// returns why a restricted token cannot access the requested path, or nil when it can.
+// Users that must enrol a second factor can only do that, and users with an unverified email can only see their
+// own profile
+func tokenRestriction(c echo.Context, claims jwt.MapClaims) *custom_error.Error {
+	if claims[JWT_FIELD_ENROLL_2FA] == true && !twoFactorEnrollmentPaths[c.Path()] {
+		return ErrTwoFactorEnrollmentRequired
+	}
+
+	if verified, verifiedPresent := claims[JWT_FIELD_VERIFIED]; verifiedPresent && verified == false &&
+		!(c.Path() == PATH_USER && c.Param("id") == claims[JWT_FIELD_ID]) {
+		return ErrEmailUnverified
+	}
+
+	return nil
+}
+
+// AdminAccessMiddleware only lets administrators and API keys with the admin scope through
+func AdminAccessMiddleware(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		claims, claimsErr := getRequestClaims(c)
+
+		if claimsErr != nil {
+			logging.LogErrorContext(c.Request().Context(), "Could not read JWT claims, %v", claimsErr)
+			return ErrJwtNotPresent
+		}
+
+		if !isAuthorized(claims, []string{constants.ROLE_ADMIN}, []string{constants.SCOPE_ADMIN}) {
+			logging.LogWarningContext(c.Request().Context(), "User %v is not an admin", claims[JWT_FIELD_ID])
+			return ErrAdminRequired
 		}
 
-		if validationTokenErr := validateJWT(authorizationHeader); validationTokenErr != nil {
-			logging.LogError("Could not validate JWT, %s", validationTokenErr)
-			return c.JSON(http.StatusUnauthorized, custom_error.DTO{Message: "The JWT is not valid"})
+		if err := next(c); err != nil {
+			c.Error(err)
 		}
+		return nil
+	}
+}
+
+// AthleteAccessMiddleware allows access to the data of the athlete identified by the ":id" path param only to
+// coaches, admins, the user himself, the parents linked to him and API keys with the athletes scope
+func AthleteAccessMiddleware(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		claims, claimsErr := getRequestClaims(c)
 
-		// we must deserialize the token to retrieve user data
-		encodedPayload := strings.Split(authorizationHeader, ".")[1]
-		rawPayload := make(map[string]any)
+		if claimsErr != nil {
+			logging.LogErrorContext(c.Request().Context(), "Could not read JWT claims, %v", claimsErr)
+			return ErrJwtNotPresent
+		}
 
-		// Now we decode the payload
-		decodedPayload, decodingErr := base64.RawURLEncoding.DecodeString(encodedPayload)
+		if !canAccessAthlete(claims, c.Param("id")) {
+			logging.LogWarningContext(c.Request().Context(), "User %v tried to access athlete %s data",
+				claims[JWT_FIELD_ID], c.Param("id"))
+			return ErrAccessDenied
+		}
 
-		if decodingErr != nil {
-			logging.LogError("Could not decode JWT payload")
-			return c.JSON(http.StatusInternalServerError, custom_error.DTO{Message: "Cannot authorize user"})
+		if err := next(c); err != nil {
+			c.Error(err)
 		}
+		return nil
+	}
+}
 
-		unmarshallErr := json.Unmarshal(decodedPayload, &rawPayload)
+// checks if the owner of the claims can see the data of the given athlete, or his own data. The athletes of a parent
+// are the ones linked when the token was issued
+func canAccessAthlete(claims jwt.MapClaims, athleteId string) bool {
+	if hasAnyScope(claims, []string{constants.SCOPE_ATHLETES, constants.SCOPE_COACH, constants.SCOPE_ADMIN}) {
+		return true
+	}
 
-		if unmarshallErr != nil {
-			logging.LogError("Could not unmarshall JWT payload")
-			return c.JSON(http.StatusInternalServerError, custom_error.DTO{Message: "Cannot authorize user"})
+	switch claims[JWT_FIELD_ROLE] {
+	case constants.ROLE_COACH, constants.ROLE_ADMIN:
+		return true
+	case constants.ROLE_PARENT:
+		if athleteId != "" && claims[JWT_FIELD_ID] == athleteId {
+			return true
 		}
 
-		if userRole, userRolePresent := rawPayload[JWT_FIELD_ROLE]; userRolePresent && userRole == constants.ROLE_COACH {
-			if err := next(c); err != nil {
-				c.Error(err)
+		linkedAthletes, _ := claims[JWT_FIELD_ATHLETES].([]any)
+		for _, linkedAthlete := range linkedAthletes {
+			if linkedAthlete == athleteId {
+				return true
 			}
-		} else {
-			logging.LogError("Role not present at JWT")
-			return c.JSON(http.StatusInternalServerError, custom_error.DTO{Message: "User must be Coach"})
 		}
-		return nil
+		return false
+	default:
+		return athleteId != "" && claims[JWT_FIELD_ID] == athleteId
+	}
+}
+
+// only the admins can create coaches and other admins
+func canGrantRole(claims jwt.MapClaims, role string) bool {
+	if role == constants.ROLE_ATLETHE || role == constants.ROLE_PARENT {
+		return true
 	}
+
+	return isAuthorized(claims, []string{constants.ROLE_ADMIN}, []string{constants.SCOPE_ADMIN})
+}
+
+// checks if the owner of the claims has one of the roles, or one of the scopes when it is an API key
+func isAuthorized(claims jwt.MapClaims, roles, scopes []string) bool {
+	if claims[JWT_FIELD_API_KEY] == true {
+		return hasAnyScope(claims, scopes)
+	}
+
+	for _, role := range roles {
+		if claims[JWT_FIELD_ROLE] == role {
+			return true
+		}
+	}
+
+	return false
+}
+
+// only API keys carry scopes, user tokens are authorized by their role
+func hasAnyScope(claims jwt.MapClaims, scopes []string) bool {
+	if claims[JWT_FIELD_API_KEY] != true {
+		return false
+	}
+
+	grantedScopes, _ := claims[JWT_FIELD_SCOPES].([]any)
+
+	for _, grantedScope := range grantedScopes {
+		for _, scope := range scopes {
+			if grantedScope == scope {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// returns the claims left by CustomJwtMiddleware, or parses the JWT sent at the Authorization header when the
+// request did not go through it
+func getRequestClaims(c echo.Context) (jwt.MapClaims, error) {
+	if claims, claimsOk := c.Get(CONTEXT_CLAIMS).(jwt.MapClaims); claimsOk {
+		return claims, nil
+	}
+
+	parsedToken, parsingErr := parseJWT(c.Request().Header.Get(AUTHORIZATION_HEADER))
+
+	if parsingErr != nil {
+		return nil, parsingErr
+	}
+
+	claims, claimsOk := parsedToken.Claims.(jwt.MapClaims)
+
+	if !claimsOk {
+		return nil, errors.New("the JWT claims cannot be read")
+	}
+
+	return claims, nil
 }
 
 func parseJWT(tokenString string) (*jwt.Token, error) {
 	return jwt.Parse(strings.Replace(tokenString, BEARER_PREFIX, "", 1), func(token *jwt.Token) (interface{}, error) {
-		if _, okToken := token.Method.(*jwt.SigningMethodHMAC); !okToken {
+		keyId, _ := token.Header[JWT_HEADER_KEY_ID].(string)
+
+		key, keyValid := getKeyRing().verificationKey(keyId)
+
+		if !keyValid {
+			return nil, errors.New("the JWT provided was not signed by a valid key")
+		}
+
+		// the algorithm of the token must be the one of the key, so a token cannot choose how it is verified
+		if token.Method.Alg() != signingMethod(key.Algorithm).Alg() {
 			return nil, errors.New("the JWT provided haven't got the right signing method")
 		}
 
-		return []byte(JWT_SECRET), nil
-	})
+		return key.PrivateKey.Public(), nil
+	}, jwt.WithValidMethods([]string{ALGORITHM_RS256, ALGORITHM_EDDSA}))
 }
 
 func validateJWT(tokenString string) error {
@@ -143,5 +442,10 @@ func validateJWT(tokenString string) error {
 		return errors.New("the JWT provided is not valid")
 	}
 
+	// single purpose tokens cannot be used to authenticate
+	if claims, claimsOk := parsedToken.Claims.(jwt.MapClaims); !claimsOk || claims[JWT_FIELD_PURPOSE] != nil {
+		return errors.New("the JWT provided is not an authentication token")
+	}
+
 	return nil
 }
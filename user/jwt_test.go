@@ -0,0 +1,73 @@
+package user
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/ncardozo92/gapef_swimming_metrics/constants"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAthleteAccessMiddleware(t *testing.T) {
+	testCases := []struct {
+		user           Entity
+		athleteId      string
+		expectedStatus int
+	}{
+		{Entity{Id: "1", Username: "coach", Role: constants.ROLE_COACH}, "2", http.StatusOK},
+		{Entity{Id: "2", Username: "athlete", Role: constants.ROLE_ATLETHE}, "2", http.StatusOK},
+		{Entity{Id: "3", Username: "other", Role: constants.ROLE_ATLETHE}, "2", http.StatusForbidden},
+		{Entity{Id: "4", Username: "parent", Role: constants.ROLE_PARENT, Athletes: []string{"2"}}, "2", http.StatusOK},
+		{Entity{Id: "4", Username: "parent", Role: constants.ROLE_PARENT, Athletes: []string{"2"}}, "3", http.StatusForbidden},
+		{Entity{Id: "4", Username: "parent", Role: constants.ROLE_PARENT, Athletes: []string{"2"}}, "4", http.StatusOK},
+	}
+
+	e := newEcho()
+	next := func(c echo.Context) error {
+		return c.NoContent(http.StatusOK)
+	}
+
+	for _, testCase := range testCases {
+		token, _ := generateJWT(testCase.user)
+
+		request := httptest.NewRequest(http.MethodGet, "/users/"+testCase.athleteId, strings.NewReader(""))
+		request.Header.Set(AUTHORIZATION_HEADER, BEARER_PREFIX+token)
+
+		recorder := httptest.NewRecorder()
+		context := e.NewContext(request, recorder)
+		context.SetParamNames("id")
+		context.SetParamValues(testCase.athleteId)
+
+		serve(AthleteAccessMiddleware(next), context)
+		assert.Equal(t, testCase.expectedStatus, recorder.Code)
+	}
+}
+
+func TestAdminAccessMiddleware(t *testing.T) {
+	testCases := map[string]int{
+		constants.ROLE_ADMIN:   http.StatusOK,
+		constants.ROLE_COACH:   http.StatusForbidden,
+		constants.ROLE_ATLETHE: http.StatusForbidden,
+	}
+
+	e := newEcho()
+	next := func(c echo.Context) error {
+		return c.NoContent(http.StatusOK)
+	}
+
+	for role, expectedStatus := range testCases {
+		token, _ := generateJWT(Entity{Id: "1", Username: "user", Role: role, EmailVerified: true})
+
+		request := httptest.NewRequest(http.MethodGet, "/lockouts", strings.NewReader(""))
+		request.Header.Set(AUTHORIZATION_HEADER, BEARER_PREFIX+token)
+
+		recorder := httptest.NewRecorder()
+		context := e.NewContext(request, recorder)
+
+		serve(AdminAccessMiddleware(next), context)
+		assert.Equal(t, expectedStatus, recorder.Code, role)
+	}
+}
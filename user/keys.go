@@ -0,0 +1,450 @@
+package user
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/labstack/echo/v4"
+	"github.com/ncardozo92/gapef_swimming_metrics/logging"
+)
+
+const (
+	ALGORITHM_RS256 = "RS256"
+	ALGORITHM_EDDSA = "EdDSA"
+	RSA_KEY_BITS    = 2048
+
+	// a replaced key keeps verifying tokens during this period, it must be longer than the longest token lifetime
+	DEFAULT_KEY_VERIFICATION_PERIOD = 2 * EMAIL_VERIFICATION_LINK_LIFETIME
+
+	KEY_FILE_EXTENSION = ".pem"
+	PEM_TYPE_KEY       = "PRIVATE KEY"
+	JWT_HEADER_KEY_ID  = "kid"
+	// the key ids start with their creation date in this format
+	KEY_ID_TIME_FORMAT = "20060102T150405"
+	// a failed rotation is retried after this delay
+	KEY_ROTATION_RETRY_DELAY = time.Minute
+
+	PATH_JWKS = "/.well-known/jwks.json"
+	// how long the clients may cache the JWKS, a new key is published this long before it signs so the clients that
+	// cached the previous key set can verify its tokens
+	JWKS_MAX_AGE = 5 * time.Minute
+)
+
+// signingKey is a private key used to sign JWTs, identified by the kid header of the tokens
+type signingKey struct {
+	Id         string
+	Algorithm  string
+	PrivateKey crypto.Signer
+	CreatedAt  time.Time
+}
+
+// KeyRing holds the keys that sign and verify the JWTs. A new key is published in the JWKS right away but only signs
+// once the JWKS cached before it expired, and the keys it replaced keep verifying until their verification period
+// ends, so rotating a key does not invalidate the tokens already issued.
+// The ring lives in memory unless it has a directory: the replicas of the API must share the same directory, or each
+// one generates its own keys and the tokens signed by one replica are refused by the others
+type KeyRing struct {
+	mutex              sync.RWMutex
+	keys               []*signingKey
+	algorithm          string
+	verificationPeriod time.Duration
+	// when not empty the keys are stored in this directory so they survive restarts
+	directory string
+	now       func() time.Time
+}
+
+type JwkDTO struct {
+	KeyType   string `json:"kty"`
+	KeyId     string `json:"kid"`
+	Use       string `json:"use"`
+	Algorithm string `json:"alg"`
+	// RSA public keys
+	Modulus  string `json:"n,omitempty"`
+	Exponent string `json:"e,omitempty"`
+	// Ed25519 public keys
+	Curve string `json:"crv,omitempty"`
+	X     string `json:"x,omitempty"`
+}
+
+type JwksDTO struct {
+	Keys []JwkDTO `json:"keys"`
+}
+
+var (
+	keyRing     *KeyRing
+	keyRingOnce sync.Once
+)
+
+// UseKeyRing sets the keys used to sign and verify the JWTs
+func UseKeyRing(ring *KeyRing) {
+	keyRingOnce.Do(func() {})
+	keyRing = ring
+}
+
+// returns the key ring in use, when none was set an ephemeral one is generated
+func getKeyRing() *KeyRing {
+	keyRingOnce.Do(func() {
+		ring, ringErr := NewKeyRing(ALGORITHM_EDDSA, DEFAULT_KEY_VERIFICATION_PERIOD, "")
+
+		if ringErr != nil {
+			logging.LogFatal("cannot generate JWT keys, %v", ringErr)
+		}
+
+		keyRing = ring
+	})
+
+	return keyRing
+}
+
+// NewKeyRing loads the keys stored in the directory, when there is no directory or it has no keys a new key is
+// generated
+func NewKeyRing(algorithm string, verificationPeriod time.Duration, directory string) (*KeyRing, error) {
+
+	if algorithm != ALGORITHM_RS256 && algorithm != ALGORITHM_EDDSA {
+		return nil, fmt.Errorf("the JWT algorithm %s is not supported", algorithm)
+	}
+
+	ring := &KeyRing{algorithm: algorithm, verificationPeriod: verificationPeriod, directory: directory, now: time.Now}
+
+	if directory != "" {
+		if loadErr := ring.load(); loadErr != nil {
+			return nil, loadErr
+		}
+	}
+
+	if len(ring.keys) == 0 {
+		if rotationErr := ring.Rotate(); rotationErr != nil {
+			return nil, rotationErr
+		}
+	}
+
+	return ring, nil
+}
+
+// Rotate generates the next signing key, it signs once it was published for JWKS_MAX_AGE and the previous ones keep
+// verifying until their verification period ends
+func (ring *KeyRing) Rotate() error {
+
+	key, generationErr := generateSigningKey(ring.algorithm, ring.now())
+
+	if generationErr != nil {
+		return generationErr
+	}
+
+	if ring.directory != "" {
+		if storeErr := storeSigningKey(ring.directory, key); storeErr != nil {
+			return storeErr
+		}
+	}
+
+	ring.mutex.Lock()
+	defer ring.mutex.Unlock()
+
+	ring.keys = append(ring.keys, key)
+	ring.retireKeys()
+
+	logging.LogInfo("JWT signing key rotated, new key id %s", key.Id)
+
+	return nil
+}
+
+// StartRotation rotates the signing key when it gets older than the interval, until the stop channel is closed. The
+// age of a loaded key counts, so a key older than the interval is replaced right away and restarting the application
+// does not delay the next rotation
+func (ring *KeyRing) StartRotation(interval time.Duration, stop <-chan struct{}) {
+	if ring.nextRotation(interval) == 0 {
+		ring.rotateOrLog()
+	}
+
+	timer := time.NewTimer(ring.nextRotation(interval))
+
+	go func() {
+		defer timer.Stop()
+
+		for {
+			select {
+			case <-timer.C:
+				if !ring.rotateOrLog() {
+					timer.Reset(KEY_ROTATION_RETRY_DELAY)
+					continue
+				}
+
+				timer.Reset(ring.nextRotation(interval))
+			case <-stop:
+				return
+			}
+		}
+	}()
+}
+
+// how long until the newest key is older than the interval, zero when it already is
+func (ring *KeyRing) nextRotation(interval time.Duration) time.Duration {
+	ring.mutex.RLock()
+	defer ring.mutex.RUnlock()
+
+	return max(0, interval-ring.now().Sub(ring.keys[len(ring.keys)-1].CreatedAt))
+}
+
+// rotates the signing key, returning if it could
+func (ring *KeyRing) rotateOrLog() bool {
+	if rotationErr := ring.Rotate(); rotationErr != nil {
+		logging.LogError("could not rotate the JWT signing key, %v", rotationErr)
+		return false
+	}
+
+	return true
+}
+
+// the key that signs the new tokens, the newest one that is not pending. The first key of the ring signs right away
+// as there is no other one
+func (ring *KeyRing) signingKey() *signingKey {
+	ring.mutex.RLock()
+	defer ring.mutex.RUnlock()
+
+	now := ring.now()
+
+	for index := len(ring.keys) - 1; index > 0; index-- {
+		if !ring.isPending(index, now) {
+			return ring.keys[index]
+		}
+	}
+
+	return ring.keys[0]
+}
+
+// a key is pending while the JWKS the clients cached before it was published may not have it
+func (ring *KeyRing) isPending(index int, now time.Time) bool {
+	return now.Before(ring.keys[index].CreatedAt.Add(JWKS_MAX_AGE))
+}
+
+// finds a key that can still verify tokens
+func (ring *KeyRing) verificationKey(keyId string) (*signingKey, bool) {
+	ring.mutex.RLock()
+	defer ring.mutex.RUnlock()
+
+	now := ring.now()
+
+	for index, key := range ring.keys {
+		if key.Id == keyId {
+			return key, !ring.isRetired(index, now)
+		}
+	}
+
+	return nil, false
+}
+
+// a key is retired when the verification period passed since the next key started signing
+func (ring *KeyRing) isRetired(index int, now time.Time) bool {
+	return index < len(ring.keys)-1 &&
+		now.After(ring.keys[index+1].CreatedAt.Add(JWKS_MAX_AGE).Add(ring.verificationPeriod))
+}
+
+// drops the retired keys, it must be called holding the lock
+func (ring *KeyRing) retireKeys() {
+	now := ring.now()
+	activeKeys := []*signingKey{}
+
+	for index, key := range ring.keys {
+		if ring.isRetired(index, now) {
+			logging.LogInfo("JWT key %s retired", key.Id)
+
+			if ring.directory != "" {
+				if removeErr := os.Remove(filepath.Join(ring.directory, key.Id+KEY_FILE_EXTENSION)); removeErr != nil {
+					logging.LogWarning("could not remove retired key %s, %v", key.Id, removeErr)
+				}
+			}
+			continue
+		}
+
+		activeKeys = append(activeKeys, key)
+	}
+
+	ring.keys = activeKeys
+}
+
+// JWKS returns the public keys that verify tokens, in JSON Web Key format, the pending ones included
+func (ring *KeyRing) JWKS() JwksDTO {
+	ring.mutex.RLock()
+	defer ring.mutex.RUnlock()
+
+	now := ring.now()
+	jwks := JwksDTO{Keys: []JwkDTO{}}
+
+	for index, key := range ring.keys {
+		if ring.isRetired(index, now) {
+			continue
+		}
+
+		jwk := JwkDTO{KeyId: key.Id, Use: "sig", Algorithm: key.Algorithm}
+
+		switch publicKey := key.PrivateKey.Public().(type) {
+		case *rsa.PublicKey:
+			jwk.KeyType = "RSA"
+			jwk.Modulus = base64.RawURLEncoding.EncodeToString(publicKey.N.Bytes())
+			jwk.Exponent = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(publicKey.E)).Bytes())
+		case ed25519.PublicKey:
+			jwk.KeyType = "OKP"
+			jwk.Curve = "Ed25519"
+			jwk.X = base64.RawURLEncoding.EncodeToString(publicKey)
+		}
+
+		jwks.Keys = append(jwks.Keys, jwk)
+	}
+
+	return jwks
+}
+
+// loads the keys of the directory, sorted from the oldest to the newest
+func (ring *KeyRing) load() error {
+
+	if mkdirErr := os.MkdirAll(ring.directory, 0700); mkdirErr != nil {
+		return mkdirErr
+	}
+
+	files, globErr := filepath.Glob(filepath.Join(ring.directory, "*"+KEY_FILE_EXTENSION))
+
+	if globErr != nil {
+		return globErr
+	}
+
+	for _, file := range files {
+		key, loadErr := loadSigningKey(file)
+
+		if loadErr != nil {
+			return fmt.Errorf("cannot load JWT key %s, %w", file, loadErr)
+		}
+
+		ring.keys = append(ring.keys, key)
+	}
+
+	sort.Slice(ring.keys, func(i, j int) bool { return ring.keys[i].CreatedAt.Before(ring.keys[j].CreatedAt) })
+
+	ring.retireKeys()
+
+	return nil
+}
+
+func generateSigningKey(algorithm string, createdAt time.Time) (*signingKey, error) {
+	var privateKey crypto.Signer
+	var generationErr error
+
+	if algorithm == ALGORITHM_RS256 {
+		privateKey, generationErr = rsa.GenerateKey(rand.Reader, RSA_KEY_BITS)
+	} else {
+		_, privateKey, generationErr = ed25519.GenerateKey(rand.Reader)
+	}
+
+	if generationErr != nil {
+		return nil, generationErr
+	}
+
+	// the id starts with the creation date so the keys can be told apart at a glance
+	randomSuffix := make([]byte, 4)
+	if _, randomErr := rand.Read(randomSuffix); randomErr != nil {
+		return nil, randomErr
+	}
+
+	return &signingKey{
+		Id:         createdAt.UTC().Format(KEY_ID_TIME_FORMAT) + "-" + hex.EncodeToString(randomSuffix),
+		Algorithm:  algorithm,
+		PrivateKey: privateKey,
+		CreatedAt:  createdAt,
+	}, nil
+}
+
+// stores the key in PKCS #8 PEM format, the file name is the key id
+func storeSigningKey(directory string, key *signingKey) error {
+	encodedKey, encodingErr := x509.MarshalPKCS8PrivateKey(key.PrivateKey)
+
+	if encodingErr != nil {
+		return encodingErr
+	}
+
+	keyPem := pem.EncodeToMemory(&pem.Block{Type: PEM_TYPE_KEY, Bytes: encodedKey})
+
+	return os.WriteFile(filepath.Join(directory, key.Id+KEY_FILE_EXTENSION), keyPem, 0600)
+}
+
+// loads a key stored by storeSigningKey, the creation date is read from the key id, as the modification date of the
+// file changes when it is copied or restored. The keys with other names use the modification date
+func loadSigningKey(file string) (*signingKey, error) {
+	content, readErr := os.ReadFile(file)
+
+	if readErr != nil {
+		return nil, readErr
+	}
+
+	block, _ := pem.Decode(content)
+
+	if block == nil || block.Type != PEM_TYPE_KEY {
+		return nil, errors.New("the file is not a PEM private key")
+	}
+
+	privateKey, parsingErr := x509.ParsePKCS8PrivateKey(block.Bytes)
+
+	if parsingErr != nil {
+		return nil, parsingErr
+	}
+
+	fileInfo, statErr := os.Stat(file)
+
+	if statErr != nil {
+		return nil, statErr
+	}
+
+	key := &signingKey{
+		Id:        strings.TrimSuffix(filepath.Base(file), KEY_FILE_EXTENSION),
+		CreatedAt: fileInfo.ModTime(),
+	}
+
+	idDate, _, _ := strings.Cut(key.Id, "-")
+
+	if createdAt, parsingErr := time.Parse(KEY_ID_TIME_FORMAT, idDate); parsingErr == nil {
+		key.CreatedAt = createdAt
+	}
+
+	switch typedKey := privateKey.(type) {
+	case *rsa.PrivateKey:
+		key.Algorithm = ALGORITHM_RS256
+		key.PrivateKey = typedKey
+	case ed25519.PrivateKey:
+		key.Algorithm = ALGORITHM_EDDSA
+		key.PrivateKey = typedKey
+	default:
+		return nil, errors.New("only RSA and Ed25519 keys are supported")
+	}
+
+	return key, nil
+}
+
+// the signing method of the algorithm
+func signingMethod(algorithm string) jwt.SigningMethod {
+	if algorithm == ALGORITHM_RS256 {
+		return jwt.SigningMethodRS256
+	}
+
+	return jwt.SigningMethodEdDSA
+}
+
+// GetJWKS publishes the public keys so other club services can verify our tokens
+func GetJWKS(context echo.Context) error {
+	context.Response().Header().Set("Cache-Control", fmt.Sprintf("public, max-age=%d", int(JWKS_MAX_AGE.Seconds())))
+	return context.JSON(http.StatusOK, getKeyRing().JWKS())
+}
@@ -0,0 +1,112 @@
+package user
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRotatedKeyVerifiesUntilRetired(t *testing.T) {
+	now := time.Now()
+	ring, ringErr := NewKeyRing(ALGORITHM_EDDSA, time.Hour, "")
+	assert.NoError(t, ringErr)
+	ring.now = func() time.Time { return now }
+
+	oldKey := ring.signingKey()
+	assert.NoError(t, ring.Rotate())
+
+	// the new key is published, but the old one signs until the JWKS the clients cached expired
+	assert.Equal(t, oldKey.Id, ring.signingKey().Id)
+	assert.Len(t, ring.JWKS().Keys, 2)
+
+	now = now.Add(JWKS_MAX_AGE)
+
+	newKey := ring.signingKey()
+	assert.NotEqual(t, oldKey.Id, newKey.Id)
+
+	_, oldKeyValid := ring.verificationKey(oldKey.Id)
+	assert.True(t, oldKeyValid)
+	assert.Len(t, ring.JWKS().Keys, 2)
+
+	now = now.Add(2 * time.Hour)
+
+	_, oldKeyValid = ring.verificationKey(oldKey.Id)
+	assert.False(t, oldKeyValid)
+	assert.Len(t, ring.JWKS().Keys, 1)
+
+	_, newKeyValid := ring.verificationKey(newKey.Id)
+	assert.True(t, newKeyValid)
+}
+
+func TestKeyRingIsStoredAtDirectory(t *testing.T) {
+	directory := t.TempDir()
+
+	ring, ringErr := NewKeyRing(ALGORITHM_RS256, time.Hour, directory)
+	assert.NoError(t, ringErr)
+
+	reloadedRing, reloadErr := NewKeyRing(ALGORITHM_RS256, time.Hour, directory)
+	assert.NoError(t, reloadErr)
+
+	assert.Equal(t, ring.signingKey().Id, reloadedRing.signingKey().Id)
+	assert.Equal(t, ring.JWKS(), reloadedRing.JWKS())
+}
+
+func TestLoadedKeyKeepsItsAgeForTheRotation(t *testing.T) {
+	directory := t.TempDir()
+	interval := 7 * 24 * time.Hour
+
+	// the file is written now, but the key was created before
+	oldKey, _ := generateSigningKey(ALGORITHM_EDDSA, time.Now().Add(-10*24*time.Hour))
+	assert.NoError(t, storeSigningKey(directory, oldKey))
+
+	ring, ringErr := NewKeyRing(ALGORITHM_EDDSA, time.Hour, directory)
+	assert.NoError(t, ringErr)
+	assert.Equal(t, oldKey.CreatedAt.UTC().Truncate(time.Second), ring.signingKey().CreatedAt)
+	assert.Equal(t, time.Duration(0), ring.nextRotation(interval))
+
+	// the key older than the interval is replaced before the rotation is scheduled
+	stop := make(chan struct{})
+	defer close(stop)
+	ring.StartRotation(interval, stop)
+
+	assert.Len(t, ring.JWKS().Keys, 2)
+	assert.InDelta(t, interval, ring.nextRotation(interval), float64(time.Minute))
+}
+
+func TestTokensAreSignedWithTheKeyRing(t *testing.T) {
+	ring, _ := NewKeyRing(ALGORITHM_RS256, time.Hour, "")
+	previousRing := getKeyRing()
+	UseKeyRing(ring)
+	defer UseKeyRing(previousRing)
+
+	token, _ := generateJWT(Entity{Id: "1", Username: "ncardozo", Role: "COACH", EmailVerified: true})
+
+	parsedToken, parsingErr := parseJWT(token)
+	assert.NoError(t, parsingErr)
+	assert.Equal(t, ALGORITHM_RS256, parsedToken.Method.Alg())
+	assert.Equal(t, ring.signingKey().Id, parsedToken.Header[JWT_HEADER_KEY_ID])
+
+	// a token signed with a shared secret is not accepted, even with a valid key id
+	hmacToken := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{"iss": ISSUER, "sub": "ncardozo"})
+	hmacToken.Header[JWT_HEADER_KEY_ID] = ring.signingKey().Id
+	signedHmacToken, _ := hmacToken.SignedString([]byte("secret"))
+
+	assert.Error(t, validateJWT(signedHmacToken))
+}
+
+func TestGetJWKS(t *testing.T) {
+	e := newEcho()
+	request := httptest.NewRequest(http.MethodGet, "/.well-known/jwks.json", strings.NewReader(""))
+	recorder := httptest.NewRecorder()
+
+	serve(GetJWKS, e.NewContext(request, recorder))
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	assert.Contains(t, recorder.Body.String(), getKeyRing().signingKey().Id)
+	assert.Equal(t, "public, max-age=300", recorder.Header().Get("Cache-Control"))
+	assert.NotContains(t, recorder.Body.String(), `"d"`)
+}
@@ -0,0 +1,54 @@
+package user
+
+import (
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+	"github.com/ncardozo92/gapef_swimming_metrics/custom_error"
+	"github.com/ncardozo92/gapef_swimming_metrics/i18n"
+	"github.com/ncardozo92/gapef_swimming_metrics/logging"
+)
+
+const (
+	MESSAGE_LANGUAGE_NOT_UPDATED = "No se pudo actualizar el idioma"
+)
+
+type LanguageDTO struct {
+	Language string `json:"language"`
+}
+
+// UpdateLanguage stores the language of the texts and emails of the authenticated user. The tokens carry it, so it
+// replaces the Accept-Language header from the next login on
+func (handler UserHandler) UpdateLanguage(context echo.Context) error {
+	dto := LanguageDTO{}
+
+	if bindingErr := context.Bind(&dto); bindingErr != nil {
+		logging.LogErrorContext(context.Request().Context(), MESSAGE_BINDING_ERROR)
+		return ErrBinding
+	}
+
+	if !i18n.IsSupported(dto.Language) {
+		logging.LogWarningContext(context.Request().Context(), "the language %q is not supported", dto.Language)
+		return ErrValidation.WithFields(custom_error.NewFieldError(FIELD_LANGUAGE, i18n.NewMessage(CODE_INVALID_LANGUAGE)))
+	}
+
+	user, findAuthenticatedUserErr := handler.findAuthenticatedUser(context)
+
+	if findAuthenticatedUserErr != nil {
+		return findAuthenticatedUserErr
+	}
+
+	previous := user
+	user.Language = dto.Language
+
+	if updateErr := handler.userRepository.SetLanguage(context.Request().Context(), user.Id, user.Language); updateErr != nil {
+		logging.LogErrorContext(context.Request().Context(), "could not update user, %v", updateErr)
+		return repositoryError(updateErr, ErrLanguageNotUpdated)
+	}
+
+	auditUserChange(context, previous, user)
+
+	logging.LogInfoContext(context.Request().Context(), "User %s changed the language to %s", user.Username, user.Language)
+
+	return context.NoContent(http.StatusNoContent)
+}
@@ -0,0 +1,124 @@
+package user
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/labstack/echo/v4"
+	"github.com/ncardozo92/gapef_swimming_metrics/constants"
+	"github.com/ncardozo92/gapef_swimming_metrics/custom_error"
+	"github.com/ncardozo92/gapef_swimming_metrics/i18n"
+	"github.com/ncardozo92/gapef_swimming_metrics/mail"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUpdateLanguage(t *testing.T) {
+	testCases := []struct {
+		body           string
+		expectedStatus int
+	}{
+		{`{"language": "en"}`, http.StatusNoContent},
+		{`{"language": "fr"}`, http.StatusBadRequest},
+		{`{"language": ""}`, http.StatusBadRequest},
+	}
+
+	e := newEcho()
+	token, _ := generateJWT(Entity{Id: "1", Username: "ncardozo", Role: constants.ROLE_COACH, EmailVerified: true})
+
+	for _, testCase := range testCases {
+		controller := gomock.NewController(t)
+		mockUserRepository := NewMockRepository(controller)
+		handler := NewUserHandler(mockUserRepository, mail.NewMockSender(controller), nil)
+
+		if testCase.expectedStatus == http.StatusNoContent {
+			mockUserRepository.EXPECT().FindById(gomock.Any(), "1").Return(Entity{Id: "1", Username: "ncardozo"}, nil, false)
+			mockUserRepository.EXPECT().SetLanguage(gomock.Any(), "1", i18n.LANGUAGE_EN).Return(nil)
+		}
+
+		request := httptest.NewRequest(http.MethodPut, PATH_LANGUAGE, strings.NewReader(testCase.body))
+		request.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		request.Header.Set(AUTHORIZATION_HEADER, BEARER_PREFIX+token)
+		recorder := httptest.NewRecorder()
+
+		serve(handler.UpdateLanguage, e.NewContext(request, recorder))
+		assert.Equal(t, testCase.expectedStatus, recorder.Code, testCase.body)
+
+		if testCase.expectedStatus == http.StatusBadRequest {
+			response := custom_error.DTO{}
+			json.Unmarshal(recorder.Body.Bytes(), &response)
+			assert.Equal(t, FIELD_LANGUAGE, response.Fields[0].Field)
+			assert.Equal(t, CODE_INVALID_LANGUAGE, response.Fields[0].Code)
+		}
+
+		controller.Finish()
+	}
+}
+
+func TestErrorsAreTranslated(t *testing.T) {
+	e := newEcho()
+	e.Use(i18n.Middleware)
+	e.Use(CustomJwtMiddleware)
+	e.GET(PATH_USER, func(c echo.Context) error { return ErrUserNotFound })
+
+	spanishUser, _ := generateJWT(Entity{Id: "1", Username: "ncardozo", Role: constants.ROLE_COACH, EmailVerified: true,
+		Language: i18n.LANGUAGE_ES})
+	undecidedUser, _ := generateJWT(Entity{Id: "1", Username: "ncardozo", Role: constants.ROLE_COACH, EmailVerified: true})
+
+	testCases := []struct {
+		token            string
+		acceptLanguage   string
+		expectedLanguage string
+		expectedMessage  string
+	}{
+		{undecidedUser, "", i18n.LANGUAGE_ES, MESSAGE_USER_NOT_FOUND},
+		{undecidedUser, "en-US,en;q=0.9", i18n.LANGUAGE_EN, "User not found"},
+		// the language the user chose replaces the one of the header
+		{spanishUser, "en-US,en;q=0.9", i18n.LANGUAGE_ES, MESSAGE_USER_NOT_FOUND},
+	}
+
+	for _, testCase := range testCases {
+		request := httptest.NewRequest(http.MethodGet, "/users/1", nil)
+		request.Header.Set(AUTHORIZATION_HEADER, BEARER_PREFIX+testCase.token)
+		request.Header.Set(i18n.HEADER_ACCEPT_LANGUAGE, testCase.acceptLanguage)
+		recorder := httptest.NewRecorder()
+
+		e.ServeHTTP(recorder, request)
+
+		response := custom_error.DTO{}
+		json.Unmarshal(recorder.Body.Bytes(), &response)
+		assert.Equal(t, http.StatusNotFound, recorder.Code)
+		assert.Equal(t, testCase.expectedMessage, response.Message)
+		assert.Equal(t, testCase.expectedLanguage, recorder.Header().Get(i18n.HEADER_CONTENT_LANGUAGE))
+	}
+}
+
+func TestEmailsInTheLanguageOfTheUser(t *testing.T) {
+	controller := gomock.NewController(t)
+	mockUserRepository := NewMockRepository(controller)
+	mockMailSender := mail.NewMockSender(controller)
+	handler := NewUserHandler(mockUserRepository, mockMailSender, nil)
+	defer controller.Finish()
+
+	mockUserRepository.EXPECT().FindById(gomock.Any(), "1").Return(Entity{Id: "1", Username: "swimmer",
+		Email: "swimmer@gapef.com.ar", Status: constants.STATUS_PENDING, Language: i18n.LANGUAGE_EN}, nil, false)
+	mockUserRepository.EXPECT().ApproveRegistration(gomock.Any(), "1", "Mariposa").Return(nil)
+	mockMailSender.EXPECT().Send("swimmer@gapef.com.ar", "GAPEF - Registration approved", gomock.Any()).
+		DoAndReturn(func(to, subject, body string) error {
+			assert.Equal(t, "Hi swimmer, your registration was approved in the group Mariposa. You can sign in now.", body)
+			return nil
+		})
+
+	request := httptest.NewRequest(http.MethodPost, "/users/1/approve", strings.NewReader(`{"group": "Mariposa"}`))
+	request.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	recorder := httptest.NewRecorder()
+	context := newEcho().NewContext(request, recorder)
+	context.SetParamNames("id")
+	context.SetParamValues("1")
+
+	serve(handler.Approve, context)
+	assert.Equal(t, http.StatusNoContent, recorder.Code)
+}
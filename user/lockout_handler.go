@@ -0,0 +1,33 @@
+package user
+
+import (
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+	"github.com/ncardozo92/gapef_swimming_metrics/audit"
+	"github.com/ncardozo92/gapef_swimming_metrics/logging"
+)
+
+const (
+	MESSAGE_LOCKOUT_NOT_FOUND = "No existe un bloqueo para la clave indicada"
+)
+
+// GetLockouts lists the usernames and ips that are blocked because of failed logins
+func (handler UserHandler) GetLockouts(context echo.Context) error {
+	return context.JSON(http.StatusOK, handler.loginAttempts.Lockouts())
+}
+
+// ClearLockout unblocks a username or ip, the key has the same format returned by GetLockouts
+func (handler UserHandler) ClearLockout(context echo.Context) error {
+	key := context.Param("key")
+
+	if !handler.loginAttempts.Clear(key) {
+		logging.LogWarningContext(context.Request().Context(), "lockout %s not found", key)
+		return ErrLockoutNotFound
+	}
+
+	logging.LogInfoContext(context.Request().Context(), "lockout %s cleared", key)
+	audit.SetTarget(context, AUDIT_TARGET_LOCKOUT, key)
+
+	return context.NoContent(http.StatusNoContent)
+}
@@ -0,0 +1,155 @@
+package user
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	// failures allowed before the back-off starts
+	LOGIN_FREE_ATTEMPTS = 3
+	// failures that lock the key until LOGIN_LOCKOUT_DURATION passes
+	LOGIN_MAX_ATTEMPTS     = 10
+	LOGIN_BASE_BACKOFF     = time.Second
+	LOGIN_MAX_BACKOFF      = 5 * time.Minute
+	LOGIN_LOCKOUT_DURATION = 15 * time.Minute
+	// how often the keys that stopped failing are forgotten
+	LOGIN_ATTEMPTS_SWEEP_INTERVAL = time.Minute
+
+	LOGIN_KEY_USERNAME_PREFIX = "user:"
+	LOGIN_KEY_IP_PREFIX       = "ip:"
+)
+
+type loginAttempts struct {
+	failures    int
+	lastFailure time.Time
+	blockedTill time.Time
+}
+
+// loginAttemptTracker counts the failed logins per key (username or ip) and blocks the keys that fail too often,
+// with an exponential back-off that ends in a temporary lockout
+type loginAttemptTracker struct {
+	mutex     sync.Mutex
+	attempts  map[string]*loginAttempts
+	lastSweep time.Time
+	now       func() time.Time
+}
+
+func newLoginAttemptTracker() *loginAttemptTracker {
+	return &loginAttemptTracker{attempts: map[string]*loginAttempts{}, lastSweep: time.Now(), now: time.Now}
+}
+
+// Blocked returns how long the caller must wait before trying again with any of the keys, zero if none is blocked
+func (tracker *loginAttemptTracker) Blocked(keys ...string) time.Duration {
+	tracker.mutex.Lock()
+	defer tracker.mutex.Unlock()
+
+	var wait time.Duration
+	now := tracker.now()
+
+	for _, key := range keys {
+		if attempts, tracked := tracker.attempts[key]; tracked && attempts.blockedTill.After(now) {
+			if keyWait := attempts.blockedTill.Sub(now); keyWait > wait {
+				wait = keyWait
+			}
+		}
+	}
+
+	return wait
+}
+
+// RegisterFailure counts a failed login for every key and blocks the ones that exceeded the free attempts
+func (tracker *loginAttemptTracker) RegisterFailure(keys ...string) {
+	tracker.mutex.Lock()
+	defer tracker.mutex.Unlock()
+
+	now := tracker.now()
+	tracker.sweep(now)
+
+	for _, key := range keys {
+		attempts, tracked := tracker.attempts[key]
+
+		// a key that has not failed during a whole lockout period starts again
+		if !tracked || attempts.expired(now) {
+			attempts = &loginAttempts{}
+			tracker.attempts[key] = attempts
+		}
+
+		attempts.failures++
+		attempts.lastFailure = now
+
+		if attempts.failures >= LOGIN_MAX_ATTEMPTS {
+			attempts.blockedTill = now.Add(LOGIN_LOCKOUT_DURATION)
+		} else if attempts.failures > LOGIN_FREE_ATTEMPTS {
+			attempts.blockedTill = now.Add(backoff(attempts.failures - LOGIN_FREE_ATTEMPTS))
+		}
+	}
+}
+
+// RegisterSuccess forgets the failures of the key
+func (tracker *loginAttemptTracker) RegisterSuccess(key string) {
+	tracker.Clear(key)
+}
+
+// Clear removes the key, unlocking it, and returns if it was tracked
+func (tracker *loginAttemptTracker) Clear(key string) bool {
+	tracker.mutex.Lock()
+	defer tracker.mutex.Unlock()
+
+	_, tracked := tracker.attempts[key]
+	delete(tracker.attempts, key)
+
+	return tracked
+}
+
+// Lockouts returns the keys that are currently blocked
+func (tracker *loginAttemptTracker) Lockouts() []LockoutDTO {
+	tracker.mutex.Lock()
+	defer tracker.mutex.Unlock()
+
+	now := tracker.now()
+	lockouts := []LockoutDTO{}
+
+	for key, attempts := range tracker.attempts {
+		if attempts.blockedTill.After(now) {
+			lockouts = append(lockouts, LockoutDTO{Key: key, Failures: attempts.failures, BlockedUntil: attempts.blockedTill})
+		}
+	}
+
+	sort.Slice(lockouts, func(i, j int) bool { return lockouts[i].Key < lockouts[j].Key })
+
+	return lockouts
+}
+
+// forgets the keys that have not failed during a whole lockout period, so the failures of random usernames do not
+// pile up
+func (tracker *loginAttemptTracker) sweep(now time.Time) {
+	if now.Sub(tracker.lastSweep) < LOGIN_ATTEMPTS_SWEEP_INTERVAL {
+		return
+	}
+
+	for key, attempts := range tracker.attempts {
+		if attempts.expired(now) {
+			delete(tracker.attempts, key)
+		}
+	}
+
+	tracker.lastSweep = now
+}
+
+// the lockout always ends before the last failure is that old
+func (attempts *loginAttempts) expired(now time.Time) bool {
+	return now.Sub(attempts.lastFailure) > LOGIN_LOCKOUT_DURATION
+}
+
+// the wait doubles with every failure after the free ones
+func backoff(extraFailures int) time.Duration {
+	wait := LOGIN_BASE_BACKOFF << (extraFailures - 1)
+
+	if wait > LOGIN_MAX_BACKOFF || wait <= 0 {
+		return LOGIN_MAX_BACKOFF
+	}
+
+	return wait
+}
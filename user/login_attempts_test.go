@@ -0,0 +1,102 @@
+package user
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/ncardozo92/gapef_swimming_metrics/mail"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoginAttemptTrackerBackoffAndLockout(t *testing.T) {
+	now := time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC)
+	tracker := newLoginAttemptTracker()
+	tracker.now = func() time.Time { return now }
+
+	for failure := 1; failure <= LOGIN_FREE_ATTEMPTS; failure++ {
+		tracker.RegisterFailure("user:ncardozo")
+		assert.Zero(t, tracker.Blocked("user:ncardozo"))
+	}
+
+	// the wait doubles with every extra failure
+	tracker.RegisterFailure("user:ncardozo")
+	assert.Equal(t, LOGIN_BASE_BACKOFF, tracker.Blocked("user:ncardozo"))
+
+	tracker.RegisterFailure("user:ncardozo")
+	assert.Equal(t, 2*LOGIN_BASE_BACKOFF, tracker.Blocked("user:ncardozo", "ip:127.0.0.1"))
+
+	for failure := LOGIN_FREE_ATTEMPTS + 3; failure <= LOGIN_MAX_ATTEMPTS; failure++ {
+		tracker.RegisterFailure("user:ncardozo")
+	}
+
+	assert.Equal(t, LOGIN_LOCKOUT_DURATION, tracker.Blocked("user:ncardozo"))
+	assert.Len(t, tracker.Lockouts(), 1)
+
+	// the lockout is temporary
+	now = now.Add(LOGIN_LOCKOUT_DURATION + time.Second)
+	assert.Zero(t, tracker.Blocked("user:ncardozo"))
+	assert.Empty(t, tracker.Lockouts())
+}
+
+func TestLoginAttemptTrackerForgetsExpiredKeys(t *testing.T) {
+	now := time.Now()
+	tracker := newLoginAttemptTracker()
+	tracker.now = func() time.Time { return now }
+
+	tracker.RegisterFailure("user:unknown1", "ip:10.0.0.1")
+	now = now.Add(10 * time.Minute)
+	tracker.RegisterFailure("user:unknown2", "ip:10.0.0.2")
+
+	// the first keys have not failed during a whole lockout period, the second ones still count
+	now = now.Add(LOGIN_LOCKOUT_DURATION - 5*time.Minute)
+	tracker.RegisterFailure("user:unknown3")
+
+	assert.NotContains(t, tracker.attempts, "user:unknown1")
+	assert.NotContains(t, tracker.attempts, "ip:10.0.0.1")
+	assert.Contains(t, tracker.attempts, "user:unknown2")
+	assert.Len(t, tracker.attempts, 3)
+}
+
+func TestLoginAttemptTrackerSuccessResets(t *testing.T) {
+	tracker := newLoginAttemptTracker()
+
+	for failure := 0; failure <= LOGIN_FREE_ATTEMPTS; failure++ {
+		tracker.RegisterFailure("user:ncardozo")
+	}
+
+	assert.NotZero(t, tracker.Blocked("user:ncardozo"))
+
+	tracker.RegisterSuccess("user:ncardozo")
+
+	assert.Zero(t, tracker.Blocked("user:ncardozo"))
+}
+
+func TestClearLockout(t *testing.T) {
+	controller := gomock.NewController(t)
+	handler := NewUserHandler(NewMockRepository(controller), mail.NewMockSender(controller), nil)
+	defer controller.Finish()
+
+	for failure := 0; failure < LOGIN_MAX_ATTEMPTS; failure++ {
+		handler.loginAttempts.RegisterFailure("ip:10.0.0.1")
+	}
+
+	e := newEcho()
+
+	// the first request clears the lockout, the second one does not find it
+	for _, expectedStatus := range []int{http.StatusNoContent, http.StatusNotFound} {
+		request := httptest.NewRequest(http.MethodDelete, "/lockouts/ip:10.0.0.1", strings.NewReader(""))
+		recorder := httptest.NewRecorder()
+		context := e.NewContext(request, recorder)
+		context.SetParamNames("key")
+		context.SetParamValues("ip:10.0.0.1")
+
+		serve(handler.ClearLockout, context)
+		assert.Equal(t, expectedStatus, recorder.Code)
+	}
+
+	assert.Zero(t, handler.loginAttempts.Blocked("ip:10.0.0.1"))
+}
@@ -0,0 +1,143 @@
+package user
+
+import (
+	"fmt"
+
+	"github.com/ncardozo92/gapef_swimming_metrics/custom_error"
+	"github.com/ncardozo92/gapef_swimming_metrics/i18n"
+)
+
+// the emails sent to the users, their subject and body are translated to the language of the user
+const (
+	EMAIL_VERIFICATION          = "email_verification"
+	EMAIL_PASSWORD_RESET        = "email_password_reset"
+	EMAIL_REGISTRATION_APPROVED = "email_registration_approved"
+	EMAIL_REGISTRATION_REJECTED = "email_registration_rejected"
+	EMAIL_ACCOUNT_CREATED       = "email_account_created"
+
+	EMAIL_SUBJECT_SUFFIX = "_subject"
+	EMAIL_BODY_SUFFIX    = "_body"
+)
+
+// the english texts of the errors, the spanish ones are their messages
+var errorTranslations = map[*custom_error.Error]string{
+	ErrBinding:                     "The format of the request body is not valid",
+	ErrValidation:                  "The request has invalid data",
+	ErrAuthentication:              "We could not authenticate the user",
+	ErrJwtNotPresent:               "A valid JWT must be sent",
+	ErrInvalidJwt:                  "A valid JWT must be sent",
+	ErrJwtNotCreated:               "The session could not be started",
+	ErrAccessDenied:                "You are not allowed to access the data of the athlete",
+	ErrCoachRequired:               "The user must be a coach",
+	ErrAdminRequired:               "The user must be an administrator",
+	ErrEmailUnverified:             "You must verify your email to access",
+	ErrTwoFactorEnrollmentRequired: "You must set up two-step authentication to access",
+	ErrInvalidCredentials:          "The username or the password are incorrect",
+	ErrTooManyLoginAttempts:        "Too many failed attempts, try again later",
+	ErrIncorrectPassword:           "The password is incorrect",
+	ErrUserNotFound:                "User not found",
+	ErrUserAlreadyExists:           "A user with the same username or email already exists",
+	ErrUserCreation:                "The user could not be created",
+	ErrCannotRetrieveUsers:         "The users could not be retrieved",
+	ErrCannotRetrieveUser:          "The user could not be retrieved",
+	ErrCannotSearchUsers:           "The search could not be performed",
+	ErrUserIsNotParent:             "The user is not a parent or guardian",
+	ErrUserIsNotAthlete:            "The user to link is not an athlete",
+	ErrAthleteNotLinked:            "The athlete could not be linked",
+	ErrUserPendingApproval:         "The user is pending approval",
+	ErrUserRejected:                "The registration request of the user was rejected",
+	ErrUserNotPending:              "The user is not pending approval",
+	ErrGroupRequired:               "The group of the athlete must be given",
+	ErrReasonRequired:              "The reason of the rejection must be given",
+	ErrUserReview:                  "The registration request could not be reviewed",
+	ErrInvalidVerification:         "The verification link is not valid or has expired",
+	ErrEmailNotVerified:            "The email could not be verified",
+	ErrTooManyResends:              "Too many verification links were requested, try again later",
+	ErrInvalidPassword:             "The password does not comply with the password policy",
+	ErrPasswordNotUpdated:          "The password could not be updated",
+	ErrInvalidPasswordReset:        "The password reset link is not valid or has expired",
+	ErrTooManyResets:               "Too many password reset links were requested, try again later",
+	ErrInvalidTwoFactorChallenge:   "The two-step authentication challenge is not valid or has expired",
+	ErrInvalidTwoFactorCode:        "The authentication code is not valid",
+	ErrTwoFactorLoginFailed:        "The authentication code is not valid",
+	ErrTwoFactorAlreadyEnabled:     "Two-step authentication is already enabled",
+	ErrTwoFactorNotStarted:         "The setup of two-step authentication must be started first",
+	ErrTwoFactorNotEnabled:         "Two-step authentication is not enabled",
+	ErrTwoFactorRequiredByRole:     "Two-step authentication is mandatory for the role of the user",
+	ErrTwoFactor:                   "Two-step authentication could not be set up",
+	ErrTwoFactorPolicy:             "The two-step authentication policy could not be retrieved",
+	ErrInvalidApiKey:               "The API key is not valid",
+	ErrInvalidApiKeyRequest:        "The data of the API key is not valid",
+	ErrApiKeyNotFound:              "The API key does not exist",
+	ErrCannotSaveApiKey:            "The API key could not be saved",
+	ErrCannotGetApiKeys:            "The API keys could not be retrieved",
+	ErrLockoutNotFound:             "There is no lockout for the given key",
+	ErrOidcNotConfigured:           "Signing in with an external provider is not enabled",
+	ErrInvalidOidcState:            "The sign in request is not valid or has expired",
+	ErrOidcFailed:                  "The external provider could not authenticate the user",
+	ErrOidcEmailUntrusted:          "The external provider did not verify the email of the user",
+	ErrOidcUserNotFound:            "There is no user with the email of the external account",
+	ErrImportFileRequired:          "The roster file must be sent in the file field",
+	ErrImportFileInvalid:           "The roster file must be a valid CSV or XLSX",
+	ErrImportFileTooLarge:          fmt.Sprintf("The roster file is larger than %d MB", MAX_IMPORT_FILE_SIZE>>20),
+	ErrImportFileEmpty:             "The roster file has no rows",
+	ErrImportTooManyRows:           fmt.Sprintf("The roster file has more than %d rows", MAX_IMPORT_ROWS),
+	ErrImportInvalidRows:           "The roster has invalid rows, no user was created",
+	ErrImport:                      "The roster could not be imported",
+	ErrLanguageNotUpdated:          "The language could not be updated",
+}
+
+func init() {
+	translations := map[string]i18n.Translation{
+		CODE_INVALID_EMAIL:           {Es: DETAIL_INVALID_EMAIL, En: "The email is not valid"},
+		CODE_USERNAME_REQUIRED:       {Es: DETAIL_INVALID_USERNAME, En: "The username cannot be an empty string"},
+		CODE_PASSWORD_REQUIRED:       {Es: DETAIL_INVALID_PASSWORD, En: "The password cannot be an empty string"},
+		CODE_INVALID_ROLE:            {Es: DETAIL_INVALID_ROLE, En: "The given role is not valid"},
+		CODE_INVALID_LANGUAGE:        {Es: DETAIL_INVALID_LANGUAGE, En: "The language must be es or en"},
+		CODE_INVALID_ACTIVE:          {Es: DETAIL_INVALID_ACTIVE, En: "The active filter must be true or false"},
+		CODE_SEARCH_TOO_SHORT:        {Es: DETAIL_SEARCH_TOO_SHORT, En: "The search must have at least 2 characters"},
+		CODE_INVALID_SEARCH_LIMIT:    {Es: DETAIL_INVALID_SEARCH_LIMIT, En: "The limit must be a number between 1 and 50"},
+		CODE_API_KEY_NAME_REQUIRED:   {Es: DETAIL_API_KEY_NAME_EMPTY, En: "The name of the API key must be given"},
+		CODE_API_KEY_SCOPES_REQUIRED: {Es: DETAIL_API_KEY_SCOPES_EMPTY, En: "At least one scope must be given"},
+		CODE_INVALID_SCOPE:           {Es: DETAIL_INVALID_SCOPE, En: "Invalid scope: %s"},
+		CODE_EXPIRATION_IN_PAST:      {Es: DETAIL_EXPIRATION_IN_PAST, En: "The expiration date must be in the future"},
+		CODE_IMPORT_ROW:              {Es: DETAIL_IMPORT_ROW, En: "Row %d: %s"},
+		CODE_DUPLICATED_IN_FILE:      {Es: DETAIL_DUPLICATED_IN_FILE, En: "The username or email is repeated in the file"},
+		CODE_ROLE_NOT_GRANTED:        {Es: DETAIL_ROLE_NOT_GRANTED, En: "You cannot create users with the role %s"},
+		CODE_EMAIL_VERIFIED:          {Es: MESSAGE_EMAIL_VERIFIED, En: "The email was verified"},
+
+		EMAIL_VERIFICATION + EMAIL_SUBJECT_SUFFIX: {Es: SUBJECT_EMAIL_VERIFICATION, En: "GAPEF - Verify your email"},
+		EMAIL_VERIFICATION + EMAIL_BODY_SUFFIX: {Es: BODY_EMAIL_VERIFICATION,
+			En: "Hi %s, to verify your email go to the following link: %s"},
+		EMAIL_PASSWORD_RESET + EMAIL_SUBJECT_SUFFIX: {Es: SUBJECT_PASSWORD_RESET, En: "GAPEF - Reset your password"},
+		EMAIL_PASSWORD_RESET + EMAIL_BODY_SUFFIX: {Es: BODY_PASSWORD_RESET,
+			En: "Hi %s, to reset your password go to the following link: %s"},
+		EMAIL_REGISTRATION_APPROVED + EMAIL_SUBJECT_SUFFIX: {Es: SUBJECT_REGISTRATION_APPROVED,
+			En: "GAPEF - Registration approved"},
+		EMAIL_REGISTRATION_APPROVED + EMAIL_BODY_SUFFIX: {Es: BODY_REGISTRATION_APPROVED,
+			En: "Hi %s, your registration was approved in the group %s. You can sign in now."},
+		EMAIL_REGISTRATION_REJECTED + EMAIL_SUBJECT_SUFFIX: {Es: SUBJECT_REGISTRATION_REJECTED,
+			En: "GAPEF - Registration rejected"},
+		EMAIL_REGISTRATION_REJECTED + EMAIL_BODY_SUFFIX: {Es: BODY_REGISTRATION_REJECTED,
+			En: "Hi %s, your registration was rejected for the following reason: %s"},
+		EMAIL_ACCOUNT_CREATED + EMAIL_SUBJECT_SUFFIX: {Es: SUBJECT_ACCOUNT_CREATED, En: "GAPEF - Your account was created"},
+		EMAIL_ACCOUNT_CREATED + EMAIL_BODY_SUFFIX: {Es: BODY_ACCOUNT_CREATED,
+			En: "Hi %s, your GAPEF account was created. Your username is %s . " +
+				"To verify your email go to the following link: %s and to choose your password to this other one: %s"},
+	}
+
+	for err, english := range errorTranslations {
+		translations[err.Code] = i18n.Translation{Es: err.Message, En: english}
+	}
+
+	i18n.Register(translations)
+}
+
+// the language of the emails and texts sent to the user, the default one when the user did not choose it
+func userLanguage(user Entity) string {
+	if i18n.IsSupported(user.Language) {
+		return user.Language
+	}
+
+	return i18n.DEFAULT_LANGUAGE
+}
@@ -5,9 +5,12 @@
 package user
 
 import (
+	context "context"
 	reflect "reflect"
+	time "time"
 
 	gomock "github.com/golang/mock/gomock"
+	listing "github.com/ncardozo92/gapef_swimming_metrics/listing"
 )
 
 // MockRepository is a mock of Repository interface.
@@ -33,39 +36,160 @@ func (m *MockRepository) EXPECT() *MockRepositoryMockRecorder {
 	return m.recorder
 }
 
-// Create mocks base method.
-func (m *MockRepository) Create(entity Entity) error {
+// ApproveRegistration mocks base method.
+func (m *MockRepository) ApproveRegistration(ctx context.Context, id, group string) error {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "Create", entity)
+	ret := m.ctrl.Call(m, "ApproveRegistration", ctx, id, group)
 	ret0, _ := ret[0].(error)
 	return ret0
 }
 
+// ApproveRegistration indicates an expected call of ApproveRegistration.
+func (mr *MockRepositoryMockRecorder) ApproveRegistration(ctx, id, group interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ApproveRegistration", reflect.TypeOf((*MockRepository)(nil).ApproveRegistration), ctx, id, group)
+}
+
+// Create mocks base method.
+func (m *MockRepository) Create(ctx context.Context, entity Entity) (string, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Create", ctx, entity)
+	ret0, _ := ret[0].(string)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
 // Create indicates an expected call of Create.
-func (mr *MockRepositoryMockRecorder) Create(entity interface{}) *gomock.Call {
+func (mr *MockRepositoryMockRecorder) Create(ctx, entity interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Create", reflect.TypeOf((*MockRepository)(nil).Create), entity)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Create", reflect.TypeOf((*MockRepository)(nil).Create), ctx, entity)
+}
+
+// CreateApiKey mocks base method.
+func (m *MockRepository) CreateApiKey(ctx context.Context, apiKey ApiKey) (string, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CreateApiKey", ctx, apiKey)
+	ret0, _ := ret[0].(string)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// CreateApiKey indicates an expected call of CreateApiKey.
+func (mr *MockRepositoryMockRecorder) CreateApiKey(ctx, apiKey interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateApiKey", reflect.TypeOf((*MockRepository)(nil).CreateApiKey), ctx, apiKey)
+}
+
+// CreateMany mocks base method.
+func (m *MockRepository) CreateMany(ctx context.Context, entities []Entity) ([]string, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CreateMany", ctx, entities)
+	ret0, _ := ret[0].([]string)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// CreateMany indicates an expected call of CreateMany.
+func (mr *MockRepositoryMockRecorder) CreateMany(ctx, entities interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateMany", reflect.TypeOf((*MockRepository)(nil).CreateMany), ctx, entities)
+}
+
+// DisableTwoFactor mocks base method.
+func (m *MockRepository) DisableTwoFactor(ctx context.Context, id string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DisableTwoFactor", ctx, id)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// DisableTwoFactor indicates an expected call of DisableTwoFactor.
+func (mr *MockRepositoryMockRecorder) DisableTwoFactor(ctx, id interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DisableTwoFactor", reflect.TypeOf((*MockRepository)(nil).DisableTwoFactor), ctx, id)
+}
+
+// EnableTwoFactor mocks base method.
+func (m *MockRepository) EnableTwoFactor(ctx context.Context, id string, hashedRecoveryCodes []string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "EnableTwoFactor", ctx, id, hashedRecoveryCodes)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// EnableTwoFactor indicates an expected call of EnableTwoFactor.
+func (mr *MockRepositoryMockRecorder) EnableTwoFactor(ctx, id, hashedRecoveryCodes interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "EnableTwoFactor", reflect.TypeOf((*MockRepository)(nil).EnableTwoFactor), ctx, id, hashedRecoveryCodes)
 }
 
 // Exists mocks base method.
-func (m *MockRepository) Exists(entity Entity) (bool, error) {
+func (m *MockRepository) Exists(ctx context.Context, entity Entity) (bool, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "Exists", entity)
+	ret := m.ctrl.Call(m, "Exists", ctx, entity)
 	ret0, _ := ret[0].(bool)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
 // Exists indicates an expected call of Exists.
-func (mr *MockRepositoryMockRecorder) Exists(entity interface{}) *gomock.Call {
+func (mr *MockRepositoryMockRecorder) Exists(ctx, entity interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Exists", reflect.TypeOf((*MockRepository)(nil).Exists), ctx, entity)
+}
+
+// FindApiKeyByHash mocks base method.
+func (m *MockRepository) FindApiKeyByHash(ctx context.Context, hash string) (ApiKey, error, bool) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "FindApiKeyByHash", ctx, hash)
+	ret0, _ := ret[0].(ApiKey)
+	ret1, _ := ret[1].(error)
+	ret2, _ := ret[2].(bool)
+	return ret0, ret1, ret2
+}
+
+// FindApiKeyByHash indicates an expected call of FindApiKeyByHash.
+func (mr *MockRepositoryMockRecorder) FindApiKeyByHash(ctx, hash interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Exists", reflect.TypeOf((*MockRepository)(nil).Exists), entity)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "FindApiKeyByHash", reflect.TypeOf((*MockRepository)(nil).FindApiKeyByHash), ctx, hash)
+}
+
+// FindByEmail mocks base method.
+func (m *MockRepository) FindByEmail(ctx context.Context, email string) (Entity, error, bool) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "FindByEmail", ctx, email)
+	ret0, _ := ret[0].(Entity)
+	ret1, _ := ret[1].(error)
+	ret2, _ := ret[2].(bool)
+	return ret0, ret1, ret2
+}
+
+// FindByEmail indicates an expected call of FindByEmail.
+func (mr *MockRepositoryMockRecorder) FindByEmail(ctx, email interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "FindByEmail", reflect.TypeOf((*MockRepository)(nil).FindByEmail), ctx, email)
+}
+
+// FindById mocks base method.
+func (m *MockRepository) FindById(ctx context.Context, id string) (Entity, error, bool) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "FindById", ctx, id)
+	ret0, _ := ret[0].(Entity)
+	ret1, _ := ret[1].(error)
+	ret2, _ := ret[2].(bool)
+	return ret0, ret1, ret2
+}
+
+// FindById indicates an expected call of FindById.
+func (mr *MockRepositoryMockRecorder) FindById(ctx, id interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "FindById", reflect.TypeOf((*MockRepository)(nil).FindById), ctx, id)
 }
 
 // FindByUsername mocks base method.
-func (m *MockRepository) FindByUsername(id string) (Entity, error, bool) {
+func (m *MockRepository) FindByUsername(ctx context.Context, id string) (Entity, error, bool) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "FindByUsername", id)
+	ret := m.ctrl.Call(m, "FindByUsername", ctx, id)
 	ret0, _ := ret[0].(Entity)
 	ret1, _ := ret[1].(error)
 	ret2, _ := ret[2].(bool)
@@ -73,22 +197,239 @@ func (m *MockRepository) FindByUsername(id string) (Entity, error, bool) {
 }
 
 // FindByUsername indicates an expected call of FindByUsername.
-func (mr *MockRepositoryMockRecorder) FindByUsername(id interface{}) *gomock.Call {
+func (mr *MockRepositoryMockRecorder) FindByUsername(ctx, id interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "FindByUsername", reflect.TypeOf((*MockRepository)(nil).FindByUsername), id)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "FindByUsername", reflect.TypeOf((*MockRepository)(nil).FindByUsername), ctx, id)
 }
 
-// GetUsers mocks base method.
-func (m *MockRepository) GetUsers(page, size int64) ([]Entity, error) {
+// GetApiKeys mocks base method.
+func (m *MockRepository) GetApiKeys(ctx context.Context) ([]ApiKey, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "GetUsers", page, size)
+	ret := m.ctrl.Call(m, "GetApiKeys", ctx)
+	ret0, _ := ret[0].([]ApiKey)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetApiKeys indicates an expected call of GetApiKeys.
+func (mr *MockRepositoryMockRecorder) GetApiKeys(ctx interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetApiKeys", reflect.TypeOf((*MockRepository)(nil).GetApiKeys), ctx)
+}
+
+// GetPendingUsers mocks base method.
+func (m *MockRepository) GetPendingUsers(ctx context.Context) ([]Entity, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetPendingUsers", ctx)
 	ret0, _ := ret[0].([]Entity)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
-// GetUsers indicates an expected call of GetUsers.
-func (mr *MockRepositoryMockRecorder) GetUsers(page, size interface{}) *gomock.Call {
+// GetPendingUsers indicates an expected call of GetPendingUsers.
+func (mr *MockRepositoryMockRecorder) GetPendingUsers(ctx interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetPendingUsers", reflect.TypeOf((*MockRepository)(nil).GetPendingUsers), ctx)
+}
+
+// GetTwoFactorRoles mocks base method.
+func (m *MockRepository) GetTwoFactorRoles(ctx context.Context) ([]string, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetTwoFactorRoles", ctx)
+	ret0, _ := ret[0].([]string)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetTwoFactorRoles indicates an expected call of GetTwoFactorRoles.
+func (mr *MockRepositoryMockRecorder) GetTwoFactorRoles(ctx interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetTwoFactorRoles", reflect.TypeOf((*MockRepository)(nil).GetTwoFactorRoles), ctx)
+}
+
+// LinkAthlete mocks base method.
+func (m *MockRepository) LinkAthlete(ctx context.Context, parentId, athleteId string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "LinkAthlete", ctx, parentId, athleteId)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// LinkAthlete indicates an expected call of LinkAthlete.
+func (mr *MockRepositoryMockRecorder) LinkAthlete(ctx, parentId, athleteId interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "LinkAthlete", reflect.TypeOf((*MockRepository)(nil).LinkAthlete), ctx, parentId, athleteId)
+}
+
+// ListUsers mocks base method.
+func (m *MockRepository) ListUsers(ctx context.Context, filter Filter, request listing.Request) (Page, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ListUsers", ctx, filter, request)
+	ret0, _ := ret[0].(Page)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ListUsers indicates an expected call of ListUsers.
+func (mr *MockRepositoryMockRecorder) ListUsers(ctx, filter, request interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ListUsers", reflect.TypeOf((*MockRepository)(nil).ListUsers), ctx, filter, request)
+}
+
+// RejectRegistration mocks base method.
+func (m *MockRepository) RejectRegistration(ctx context.Context, id, reason string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RejectRegistration", ctx, id, reason)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// RejectRegistration indicates an expected call of RejectRegistration.
+func (mr *MockRepositoryMockRecorder) RejectRegistration(ctx, id, reason interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RejectRegistration", reflect.TypeOf((*MockRepository)(nil).RejectRegistration), ctx, id, reason)
+}
+
+// RevokeApiKey mocks base method.
+func (m *MockRepository) RevokeApiKey(ctx context.Context, id string, revokedAt time.Time) (bool, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RevokeApiKey", ctx, id, revokedAt)
+	ret0, _ := ret[0].(bool)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// RevokeApiKey indicates an expected call of RevokeApiKey.
+func (mr *MockRepositoryMockRecorder) RevokeApiKey(ctx, id, revokedAt interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RevokeApiKey", reflect.TypeOf((*MockRepository)(nil).RevokeApiKey), ctx, id, revokedAt)
+}
+
+// SearchUsers mocks base method.
+func (m *MockRepository) SearchUsers(ctx context.Context, query, role string) ([]Entity, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SearchUsers", ctx, query, role)
+	ret0, _ := ret[0].([]Entity)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// SearchUsers indicates an expected call of SearchUsers.
+func (mr *MockRepositoryMockRecorder) SearchUsers(ctx, query, role interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SearchUsers", reflect.TypeOf((*MockRepository)(nil).SearchUsers), ctx, query, role)
+}
+
+// SetLanguage mocks base method.
+func (m *MockRepository) SetLanguage(ctx context.Context, id, language string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SetLanguage", ctx, id, language)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SetLanguage indicates an expected call of SetLanguage.
+func (mr *MockRepositoryMockRecorder) SetLanguage(ctx, id, language interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetLanguage", reflect.TypeOf((*MockRepository)(nil).SetLanguage), ctx, id, language)
+}
+
+// SetPassword mocks base method.
+func (m *MockRepository) SetPassword(ctx context.Context, id, hashedPassword string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SetPassword", ctx, id, hashedPassword)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SetPassword indicates an expected call of SetPassword.
+func (mr *MockRepositoryMockRecorder) SetPassword(ctx, id, hashedPassword interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetPassword", reflect.TypeOf((*MockRepository)(nil).SetPassword), ctx, id, hashedPassword)
+}
+
+// SetTotpSecret mocks base method.
+func (m *MockRepository) SetTotpSecret(ctx context.Context, id, secret string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SetTotpSecret", ctx, id, secret)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SetTotpSecret indicates an expected call of SetTotpSecret.
+func (mr *MockRepositoryMockRecorder) SetTotpSecret(ctx, id, secret interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetTotpSecret", reflect.TypeOf((*MockRepository)(nil).SetTotpSecret), ctx, id, secret)
+}
+
+// SetTwoFactorRoles mocks base method.
+func (m *MockRepository) SetTwoFactorRoles(ctx context.Context, roles []string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SetTwoFactorRoles", ctx, roles)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SetTwoFactorRoles indicates an expected call of SetTwoFactorRoles.
+func (mr *MockRepositoryMockRecorder) SetTwoFactorRoles(ctx, roles interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetTwoFactorRoles", reflect.TypeOf((*MockRepository)(nil).SetTwoFactorRoles), ctx, roles)
+}
+
+// TouchApiKey mocks base method.
+func (m *MockRepository) TouchApiKey(ctx context.Context, id string, usedAt time.Time) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "TouchApiKey", ctx, id, usedAt)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// TouchApiKey indicates an expected call of TouchApiKey.
+func (mr *MockRepositoryMockRecorder) TouchApiKey(ctx, id, usedAt interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "TouchApiKey", reflect.TypeOf((*MockRepository)(nil).TouchApiKey), ctx, id, usedAt)
+}
+
+// UseRecoveryCode mocks base method.
+func (m *MockRepository) UseRecoveryCode(ctx context.Context, id, hashedCode string) (bool, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UseRecoveryCode", ctx, id, hashedCode)
+	ret0, _ := ret[0].(bool)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// UseRecoveryCode indicates an expected call of UseRecoveryCode.
+func (mr *MockRepositoryMockRecorder) UseRecoveryCode(ctx, id, hashedCode interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UseRecoveryCode", reflect.TypeOf((*MockRepository)(nil).UseRecoveryCode), ctx, id, hashedCode)
+}
+
+// UseTotpStep mocks base method.
+func (m *MockRepository) UseTotpStep(ctx context.Context, id string, step int64) (bool, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UseTotpStep", ctx, id, step)
+	ret0, _ := ret[0].(bool)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// UseTotpStep indicates an expected call of UseTotpStep.
+func (mr *MockRepositoryMockRecorder) UseTotpStep(ctx, id, step interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UseTotpStep", reflect.TypeOf((*MockRepository)(nil).UseTotpStep), ctx, id, step)
+}
+
+// VerifyEmail mocks base method.
+func (m *MockRepository) VerifyEmail(ctx context.Context, id string, verifiedAt time.Time) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "VerifyEmail", ctx, id, verifiedAt)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// VerifyEmail indicates an expected call of VerifyEmail.
+func (mr *MockRepositoryMockRecorder) VerifyEmail(ctx, id, verifiedAt interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetUsers", reflect.TypeOf((*MockRepository)(nil).GetUsers), page, size)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "VerifyEmail", reflect.TypeOf((*MockRepository)(nil).VerifyEmail), ctx, id, verifiedAt)
 }
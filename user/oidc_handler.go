@@ -0,0 +1,193 @@
+package user
+
+import (
+	"context"
+	"crypto/subtle"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/labstack/echo/v4"
+	"github.com/ncardozo92/gapef_swimming_metrics/audit"
+	"github.com/ncardozo92/gapef_swimming_metrics/logging"
+	"github.com/ncardozo92/gapef_swimming_metrics/oidc"
+)
+
+const (
+	MESSAGE_OIDC_NOT_CONFIGURED  = "El inicio de sesión con un proveedor externo no está habilitado"
+	MESSAGE_INVALID_OIDC_STATE   = "La solicitud de inicio de sesión no es válida o ha expirado"
+	MESSAGE_OIDC_FAILED          = "El proveedor externo no pudo autenticar al usuario"
+	MESSAGE_OIDC_EMAIL_UNTRUSTED = "El proveedor externo no verificó el email del usuario"
+	MESSAGE_OIDC_USER_NOT_FOUND  = "No existe un usuario con el email de la cuenta externa"
+
+	OIDC_STATE_COOKIE   = "gapef_oidc_state"
+	OIDC_STATE_LIFETIME = 10 * time.Minute
+
+	JWT_FIELD_OIDC_STATE    = "state"
+	JWT_FIELD_OIDC_NONCE    = "nonce"
+	JWT_FIELD_OIDC_VERIFIER = "verifier"
+)
+
+// IdentityProvider authenticates users with an external OpenID Connect provider
+type IdentityProvider interface {
+	AuthCodeURL(state, nonce, codeChallenge string) string
+	Exchange(ctx context.Context, code, codeVerifier, nonce string) (oidc.Identity, error)
+}
+
+// OidcLogin redirects the user to the login page of the external provider. The state, nonce and PKCE verifier are
+// kept at a signed cookie until the provider redirects back to OidcCallback
+func (handler UserHandler) OidcLogin(context echo.Context) error {
+
+	if handler.identityProvider == nil {
+		return ErrOidcNotConfigured
+	}
+
+	state, stateErr := oidc.RandomString()
+	nonce, nonceErr := oidc.RandomString()
+	verifier, verifierErr := oidc.RandomString()
+
+	if stateErr != nil || nonceErr != nil || verifierErr != nil {
+		logging.LogErrorContext(context.Request().Context(), "could not generate the OIDC request values")
+		return ErrAuthentication
+	}
+
+	stateToken, tokenErr := signJWT(jwt.MapClaims{
+		JWT_FIELD_PURPOSE:       PURPOSE_OIDC_STATE,
+		JWT_FIELD_OIDC_STATE:    state,
+		JWT_FIELD_OIDC_NONCE:    nonce,
+		JWT_FIELD_OIDC_VERIFIER: verifier,
+		"iss":                   ISSUER,
+		"iat":                   time.Now().Unix(),
+		"exp":                   time.Now().Add(OIDC_STATE_LIFETIME).Unix(),
+	})
+
+	if tokenErr != nil {
+		logging.LogErrorContext(context.Request().Context(), "could not sign the OIDC state, %v", tokenErr)
+		return ErrAuthentication
+	}
+
+	context.SetCookie(newOidcStateCookie(stateToken, int(OIDC_STATE_LIFETIME.Seconds())))
+
+	return context.Redirect(http.StatusFound, handler.identityProvider.AuthCodeURL(state, nonce, oidc.CodeChallenge(verifier)))
+}
+
+// OidcCallback receives the user back from the external provider, validates the identity and logs in the user that
+// has the same verified email
+func (handler UserHandler) OidcCallback(context echo.Context) error {
+	audit.SetAction(context, AUDIT_LOGIN_OIDC)
+
+	if handler.identityProvider == nil {
+		return ErrOidcNotConfigured
+	}
+
+	if providerErr := context.QueryParam("error"); providerErr != "" {
+		logging.LogWarningContext(context.Request().Context(), "the OIDC provider answered with error %s", providerErr)
+		return ErrOidcFailed
+	}
+
+	stateClaims, stateErr := readOidcState(context)
+
+	// the state is used once
+	context.SetCookie(newOidcStateCookie("", -1))
+
+	if stateErr != nil {
+		logging.LogErrorContext(context.Request().Context(), "invalid OIDC state, %v", stateErr)
+		return ErrInvalidOidcState
+	}
+
+	nonce, _ := stateClaims[JWT_FIELD_OIDC_NONCE].(string)
+	verifier, _ := stateClaims[JWT_FIELD_OIDC_VERIFIER].(string)
+
+	identity, exchangeErr := handler.identityProvider.Exchange(context.Request().Context(), context.QueryParam("code"), verifier, nonce)
+
+	if exchangeErr != nil {
+		logging.LogErrorContext(context.Request().Context(), "could not authenticate with the OIDC provider, %v", exchangeErr)
+		return ErrOidcFailed
+	}
+
+	// only a verified email proves the external account belongs to the user
+	if !identity.EmailVerified || identity.Email == "" {
+		logging.LogWarningContext(context.Request().Context(), "OIDC identity %s has no verified email", identity.Subject)
+		return ErrOidcEmailUntrusted
+	}
+
+	user, findUserErr, userNotFound := handler.userRepository.FindByEmail(context.Request().Context(), normalizeIdentity(identity.Email))
+
+	if findUserErr != nil {
+		if userNotFound {
+			logging.LogWarningContext(context.Request().Context(), "no user for the OIDC email %s", identity.Email)
+			return ErrOidcUserNotFound
+		}
+		logging.LogErrorContext(context.Request().Context(), "could not retrieve user, %v", findUserErr)
+		return repositoryError(findUserErr, ErrAuthentication)
+	}
+
+	auditAuthenticated(context, user)
+
+	if statusErr := checkLoginStatus(context.Request().Context(), user); statusErr != nil {
+		return statusErr
+	}
+
+	// the provider already verified the email
+	if !user.EmailVerified {
+		verifiedAt := time.Now().UTC()
+		user.EmailVerified = true
+		user.EmailVerifiedAt = &verifiedAt
+
+		if updateErr := handler.userRepository.VerifyEmail(context.Request().Context(), user.Id, verifiedAt); updateErr != nil {
+			logging.LogErrorContext(context.Request().Context(), "could not mark the email as verified, %v", updateErr)
+			return repositoryError(updateErr, ErrAuthentication)
+		}
+	}
+
+	logging.LogInfoContext(context.Request().Context(), "User %s logged in with the OIDC provider", user.Username)
+
+	if user.TotpEnabled {
+		return handler.startTwoFactorChallenge(context, user)
+	}
+
+	return handler.issueLoginResponse(context, user)
+}
+
+// reads the signed state cookie and checks it matches the state returned by the provider
+func readOidcState(context echo.Context) (jwt.MapClaims, error) {
+	cookie, cookieErr := context.Cookie(OIDC_STATE_COOKIE)
+
+	if cookieErr != nil {
+		return nil, cookieErr
+	}
+
+	parsedToken, parsingErr := parseJWT(cookie.Value)
+
+	if parsingErr != nil {
+		return nil, parsingErr
+	}
+
+	claims, claimsOk := parsedToken.Claims.(jwt.MapClaims)
+
+	if !claimsOk || claims[JWT_FIELD_PURPOSE] != PURPOSE_OIDC_STATE {
+		return nil, jwt.ErrTokenInvalidClaims
+	}
+
+	state, _ := claims[JWT_FIELD_OIDC_STATE].(string)
+
+	if state == "" || subtle.ConstantTimeCompare([]byte(state), []byte(context.QueryParam("state"))) != 1 {
+		return nil, jwt.ErrTokenInvalidClaims
+	}
+
+	return claims, nil
+}
+
+// the cookie only travels to the OIDC paths, a negative max age deletes it
+func newOidcStateCookie(value string, maxAge int) *http.Cookie {
+	return &http.Cookie{
+		Name:     OIDC_STATE_COOKIE,
+		Value:    value,
+		Path:     PATH_LOGIN_OIDC,
+		MaxAge:   maxAge,
+		HttpOnly: true,
+		Secure:   strings.HasPrefix(appBaseUrl, "https://"),
+		SameSite: http.SameSiteLaxMode,
+	}
+}
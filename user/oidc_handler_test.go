@@ -0,0 +1,155 @@
+package user
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/labstack/echo/v4"
+	"github.com/ncardozo92/gapef_swimming_metrics/constants"
+	"github.com/ncardozo92/gapef_swimming_metrics/mail"
+	"github.com/ncardozo92/gapef_swimming_metrics/oidc"
+	"github.com/ncardozo92/gapef_swimming_metrics/oidc/oidctest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// starts the login at the handler and returns the state cookie and the values sent to the provider
+func startOidcLogin(t *testing.T, handler *UserHandler) (*http.Cookie, url.Values) {
+	e := newEcho()
+	request := httptest.NewRequest(http.MethodGet, PATH_LOGIN_OIDC, nil)
+	recorder := httptest.NewRecorder()
+
+	require.NoError(t, handler.OidcLogin(e.NewContext(request, recorder)))
+	require.Equal(t, http.StatusFound, recorder.Code)
+
+	location, parsingErr := url.Parse(recorder.Header().Get(echo.HeaderLocation))
+	require.NoError(t, parsingErr)
+
+	cookies := recorder.Result().Cookies()
+	require.Len(t, cookies, 1)
+
+	return cookies[0], location.Query()
+}
+
+// calls the callback the way the provider redirects the browser back
+func finishOidcLogin(handler *UserHandler, cookie *http.Cookie, code, state string) *httptest.ResponseRecorder {
+	e := newEcho()
+	query := url.Values{"code": {code}, "state": {state}}
+	request := httptest.NewRequest(http.MethodGet, PATH_LOGIN_OIDC_CALLBACK+"?"+query.Encode(), nil)
+	request.AddCookie(cookie)
+	recorder := httptest.NewRecorder()
+
+	serve(handler.OidcCallback, e.NewContext(request, recorder))
+
+	return recorder
+}
+
+func newStubIdentityProvider(t *testing.T) (*oidctest.StubProvider, IdentityProvider) {
+	stub, stubErr := oidctest.NewStubProvider()
+	require.NoError(t, stubErr)
+	t.Cleanup(stub.Close)
+
+	provider, discoveryErr := oidc.Discover(context.Background(), stub.Issuer(), oidctest.CLIENT_ID,
+		oidctest.CLIENT_SECRET, "http://localhost:8080"+PATH_LOGIN_OIDC_CALLBACK)
+	require.NoError(t, discoveryErr)
+
+	return stub, provider
+}
+
+func TestOidcLogin(t *testing.T) {
+	stub, provider := newStubIdentityProvider(t)
+
+	controller := gomock.NewController(t)
+	mockUserRepository := NewMockRepository(controller)
+	handler := NewUserHandler(mockUserRepository, mail.NewMockSender(controller), provider)
+	defer controller.Finish()
+
+	foundUser := Entity{Id: "1", Username: "ncardozo", Email: "ncardozo@gapef.com.ar", Role: constants.ROLE_ATLETHE,
+		Status: constants.STATUS_ACTIVE, EmailVerified: true}
+
+	mockUserRepository.EXPECT().FindByEmail(gomock.Any(), "ncardozo@gapef.com.ar").Return(foundUser, nil, false)
+	mockUserRepository.EXPECT().GetTwoFactorRoles(gomock.Any()).Return([]string{}, nil)
+
+	cookie, query := startOidcLogin(t, handler)
+
+	assert.True(t, cookie.HttpOnly)
+	assert.Equal(t, http.SameSiteLaxMode, cookie.SameSite)
+
+	stub.Authorize("valid-code", oidctest.Authorization{Email: "NCardozo@gapef.com.ar", EmailVerified: true,
+		Nonce: query.Get("nonce"), CodeChallenge: query.Get("code_challenge")})
+
+	recorder := finishOidcLogin(handler, cookie, "valid-code", query.Get("state"))
+
+	response := LoginDTO{}
+	json.Unmarshal(recorder.Body.Bytes(), &response)
+
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	assert.NoError(t, validateJWT(response.Token))
+}
+
+func TestOidcCallbackRejected(t *testing.T) {
+	testCases := []struct {
+		name           string
+		emailVerified  bool
+		wrongState     bool
+		userExists     bool
+		expectedStatus int
+	}{
+		{"state does not match", true, true, true, http.StatusBadRequest},
+		{"email not verified by the provider", false, false, true, http.StatusForbidden},
+		{"no user with the email", true, false, false, http.StatusForbidden},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			stub, provider := newStubIdentityProvider(t)
+
+			controller := gomock.NewController(t)
+			mockUserRepository := NewMockRepository(controller)
+			handler := NewUserHandler(mockUserRepository, mail.NewMockSender(controller), provider)
+			defer controller.Finish()
+
+			if testCase.emailVerified && !testCase.wrongState {
+				if testCase.userExists {
+					mockUserRepository.EXPECT().FindByEmail(gomock.Any(), gomock.Any()).Return(Entity{}, nil, false)
+				} else {
+					mockUserRepository.EXPECT().FindByEmail(gomock.Any(), gomock.Any()).Return(Entity{}, assert.AnError, true)
+				}
+			}
+
+			cookie, query := startOidcLogin(t, handler)
+
+			stub.Authorize("valid-code", oidctest.Authorization{Email: "ncardozo@gapef.com.ar",
+				EmailVerified: testCase.emailVerified, Nonce: query.Get("nonce"),
+				CodeChallenge: query.Get("code_challenge")})
+
+			state := query.Get("state")
+			if testCase.wrongState {
+				state = "forged-state"
+			}
+
+			recorder := finishOidcLogin(handler, cookie, "valid-code", state)
+
+			assert.Equal(t, testCase.expectedStatus, recorder.Code)
+		})
+	}
+}
+
+func TestOidcLoginNotConfigured(t *testing.T) {
+	controller := gomock.NewController(t)
+	handler := NewUserHandler(NewMockRepository(controller), mail.NewMockSender(controller), nil)
+	defer controller.Finish()
+
+	e := newEcho()
+	recorder := httptest.NewRecorder()
+	context := e.NewContext(httptest.NewRequest(http.MethodGet, PATH_LOGIN_OIDC, nil), recorder)
+
+	serve(handler.OidcLogin, context)
+
+	assert.Equal(t, http.StatusNotFound, recorder.Code)
+}
@@ -0,0 +1,256 @@
+package user
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/labstack/echo/v4"
+	"github.com/ncardozo92/gapef_swimming_metrics/logging"
+	"github.com/ncardozo92/gapef_swimming_metrics/password"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	MESSAGE_INVALID_PASSWORD       = "La contraseña no cumple con la política de contraseñas"
+	MESSAGE_PASSWORD_NOT_UPDATED   = "No se pudo actualizar la contraseña"
+	MESSAGE_INVALID_PASSWORD_RESET = "El enlace para restablecer la contraseña no es válido o ha expirado"
+	MESSAGE_TOO_MANY_RESETS        = "Se solicitaron demasiados enlaces para restablecer la contraseña, intente más tarde"
+	SUBJECT_PASSWORD_RESET         = "GAPEF - Restablecé tu contraseña"
+	BODY_PASSWORD_RESET            = "Hola %s, para restablecer tu contraseña ingresá al siguiente enlace: %s"
+	PASSWORD_RESET_LINK_LIFETIME   = 30 * time.Minute
+
+	PURPOSE_PASSWORD_RESET = "password_reset"
+	// fingerprint of the password the reset token was generated for, so the token stops working once it is used
+	JWT_FIELD_PASSWORD_FINGERPRINT = "pwd"
+)
+
+type PasswordUpdateDTO struct {
+	CurrentPassword string `json:"current_password"`
+	NewPassword     string `json:"new_password"`
+}
+
+type PasswordResetRequestDTO struct {
+	Email string `json:"email"`
+}
+
+type PasswordResetDTO struct {
+	Token       string `json:"token"`
+	NewPassword string `json:"new_password"`
+}
+
+var passwordPolicy = password.DefaultPolicy()
+
+// UsePasswordPolicy sets the policy the new passwords must follow
+func UsePasswordPolicy(policy password.Policy) {
+	passwordPolicy = policy
+}
+
+// UpdatePassword changes the password of the authenticated user, who must send the current one
+func (handler UserHandler) UpdatePassword(context echo.Context) error {
+	dto := PasswordUpdateDTO{}
+
+	if bindingErr := context.Bind(&dto); bindingErr != nil || dto.CurrentPassword == "" {
+		logging.LogErrorContext(context.Request().Context(), MESSAGE_BINDING_ERROR)
+		return ErrBinding
+	}
+
+	user, findAuthenticatedUserErr := handler.findAuthenticatedUser(context)
+
+	if findAuthenticatedUserErr != nil {
+		return findAuthenticatedUserErr
+	}
+
+	if bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(dto.CurrentPassword)) != nil {
+		logging.LogWarningContext(context.Request().Context(), "User %s sent a wrong current password", user.Username)
+		return ErrIncorrectPassword
+	}
+
+	if storeErr := handler.storePassword(context, user, dto.NewPassword); storeErr != nil {
+		return storeErr
+	}
+
+	logging.LogInfoContext(context.Request().Context(), "User %s updated the password", user.Username)
+
+	return context.NoContent(http.StatusNoContent)
+}
+
+// RequestPasswordReset sends a link to reset the password. The response is the same whether the address exists or
+// not, so the endpoint cannot be used to find out which emails have an account
+func (handler UserHandler) RequestPasswordReset(context echo.Context) error {
+	dto := PasswordResetRequestDTO{}
+
+	if bindingErr := context.Bind(&dto); bindingErr != nil || dto.Email == "" {
+		logging.LogErrorContext(context.Request().Context(), MESSAGE_BINDING_ERROR)
+		return ErrBinding
+	}
+
+	dto.Email = normalizeIdentity(dto.Email)
+
+	if allowed, retryAfter := handler.resetLimiter.Allow(dto.Email); !allowed {
+		logging.LogWarningContext(context.Request().Context(), "too many password reset links requested for %s", dto.Email)
+		context.Response().Header().Set(echo.HeaderRetryAfter, strconv.Itoa(int(retryAfter.Seconds())+1))
+		return ErrTooManyResets
+	}
+
+	user, findUserErr, userNotFound := handler.userRepository.FindByEmail(context.Request().Context(), dto.Email)
+
+	if findUserErr != nil && !userNotFound {
+		logging.LogErrorContext(context.Request().Context(), "could not retrieve user, %v", findUserErr)
+		return repositoryError(findUserErr, ErrCannotRetrieveUser)
+	}
+
+	if findUserErr == nil {
+		handler.sendPasswordResetEmail(context.Request().Context(), user)
+	}
+
+	return context.NoContent(http.StatusAccepted)
+}
+
+// ResetPassword sets a new password using the token sent by email
+func (handler UserHandler) ResetPassword(context echo.Context) error {
+	dto := PasswordResetDTO{}
+
+	if bindingErr := context.Bind(&dto); bindingErr != nil || dto.Token == "" {
+		logging.LogErrorContext(context.Request().Context(), MESSAGE_BINDING_ERROR)
+		return ErrBinding
+	}
+
+	userId, fingerprint, tokenErr := parsePasswordResetJWT(dto.Token)
+
+	if tokenErr != nil {
+		logging.LogErrorContext(context.Request().Context(), "invalid password reset token, %v", tokenErr)
+		return ErrInvalidPasswordReset
+	}
+
+	user, findUserErr, userNotFound := handler.userRepository.FindById(context.Request().Context(), userId)
+
+	if findUserErr != nil {
+		if userNotFound {
+			logging.LogErrorContext(context.Request().Context(), "User of the password reset not found")
+			return ErrInvalidPasswordReset
+		}
+		logging.LogErrorContext(context.Request().Context(), "could not retrieve user, %v", findUserErr)
+		return repositoryError(findUserErr, ErrPasswordNotUpdated)
+	}
+
+	// the token was already used, or the password changed after it was sent
+	if subtle.ConstantTimeCompare([]byte(fingerprint), []byte(passwordFingerprint(user.Password))) != 1 {
+		logging.LogWarningContext(context.Request().Context(), "password reset token of user %s was already used", user.Username)
+		return ErrInvalidPasswordReset
+	}
+
+	if storeErr := handler.storePassword(context, user, dto.NewPassword); storeErr != nil {
+		return storeErr
+	}
+
+	// whoever owns the email can log in again without waiting for the lockout
+	handler.loginAttempts.Clear(LOGIN_KEY_USERNAME_PREFIX + user.Username)
+
+	logging.LogInfoContext(context.Request().Context(), "User %s reset the password", user.Username)
+
+	return context.NoContent(http.StatusNoContent)
+}
+
+// validates the new password against the password policy and stores its hash
+func (handler UserHandler) storePassword(context echo.Context, user Entity, newPassword string) error {
+
+	if details := passwordPolicy.Validate(newPassword, user.Username, user.Email); len(details) > 0 {
+		logging.LogWarningContext(context.Request().Context(), "the new password of %s does not follow the policy, %v",
+			user.Username, details)
+		return ErrInvalidPassword.WithFields(passwordFields(details)...)
+	}
+
+	hashedPassword, hashingErr := bcrypt.GenerateFromPassword([]byte(newPassword), bcrypt.DefaultCost)
+
+	if hashingErr != nil {
+		logging.LogErrorContext(context.Request().Context(), "Error hashing the password, %v", hashingErr)
+		return ErrPasswordNotUpdated.Wrap(hashingErr)
+	}
+
+	previous := user
+	user.Password = string(hashedPassword)
+
+	if updateErr := handler.userRepository.SetPassword(context.Request().Context(), user.Id, user.Password); updateErr != nil {
+		logging.LogErrorContext(context.Request().Context(), "could not update user, %v", updateErr)
+		return repositoryError(updateErr, ErrPasswordNotUpdated)
+	}
+
+	auditUserChange(context, previous, user)
+
+	return nil
+}
+
+// sends the signed link the user must follow to reset his password
+func (handler UserHandler) sendPasswordResetEmail(ctx context.Context, user Entity) {
+	link, linkErr := passwordResetLink(user, jwtConfig.PasswordResetLifetime)
+
+	if linkErr != nil {
+		logging.LogErrorContext(ctx, "could not build the password reset link, %v", linkErr)
+		return
+	}
+
+	handler.sendEmail(ctx, user, EMAIL_PASSWORD_RESET, user.Username, link)
+}
+
+// the link opens the page of the front-end that asks for the new password and sends it with the token to
+// PATH_PASSWORD_RESET_CONFIRM, the API has no page of its own
+func passwordResetLink(user Entity, lifetime time.Duration) (string, error) {
+	token, tokenErr := signJWT(jwt.MapClaims{
+		JWT_FIELD_PURPOSE:              PURPOSE_PASSWORD_RESET,
+		JWT_FIELD_PASSWORD_FINGERPRINT: passwordFingerprint(user.Password),
+		"iss":                          ISSUER,
+		"sub":                          user.Id,
+		"iat":                          time.Now().Unix(),
+		"exp":                          time.Now().Add(lifetime).Unix(),
+	})
+
+	if tokenErr != nil {
+		return "", tokenErr
+	}
+
+	link, parsingErr := url.Parse(passwordResetPageUrl)
+
+	if parsingErr != nil {
+		return "", parsingErr
+	}
+
+	query := link.Query()
+	query.Set("token", token)
+	link.RawQuery = query.Encode()
+
+	return link.String(), nil
+}
+
+// validates a password reset token and returns the id of the user and the fingerprint of the password
+func parsePasswordResetJWT(tokenString string) (string, string, error) {
+	userId, tokenErr := parsePurposeJWT(tokenString, PURPOSE_PASSWORD_RESET)
+
+	if tokenErr != nil {
+		return "", "", tokenErr
+	}
+
+	parsedToken, _ := parseJWT(tokenString)
+	claims, _ := parsedToken.Claims.(jwt.MapClaims)
+	fingerprint, _ := claims[JWT_FIELD_PASSWORD_FINGERPRINT].(string)
+
+	if fingerprint == "" {
+		return "", "", errors.New("the password reset JWT has no password fingerprint")
+	}
+
+	return userId, fingerprint, nil
+}
+
+// a short hash of the stored password hash, it changes every time the password changes
+func passwordFingerprint(passwordHash string) string {
+	hash := sha256.Sum256([]byte(passwordHash))
+
+	return hex.EncodeToString(hash[:8])
+}
@@ -0,0 +1,144 @@
+package user
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/labstack/echo/v4"
+	"github.com/ncardozo92/gapef_swimming_metrics/constants"
+	"github.com/ncardozo92/gapef_swimming_metrics/custom_error"
+	"github.com/ncardozo92/gapef_swimming_metrics/mail"
+	"github.com/ncardozo92/gapef_swimming_metrics/password"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestUpdatePassword(t *testing.T) {
+	testCases := []struct {
+		body           string
+		expectedStatus int
+		expectedDetail string
+	}{
+		{`{"current_password":"ncardozo","new_password":"NadarMariposa2024"}`, http.StatusNoContent, ""},
+		{`{"current_password":"wrong","new_password":"NadarMariposa2024"}`, http.StatusForbidden, ""},
+		{`{"current_password":"ncardozo","new_password":"nadar"}`, http.StatusBadRequest, password.DETAIL_MISSING_UPPER},
+		{`{"current_password":"ncardozo","new_password":"Ncardozo2024"}`, http.StatusBadRequest, password.DETAIL_CONTAINS_USERNAME},
+	}
+
+	e := newEcho()
+	token, _ := generateJWT(Entity{Id: "1", Username: "ncardozo", Role: constants.ROLE_COACH, EmailVerified: true})
+
+	for _, testCase := range testCases {
+		controller := gomock.NewController(t)
+		mockUserRepository := NewMockRepository(controller)
+		handler := NewUserHandler(mockUserRepository, mail.NewMockSender(controller), nil)
+
+		foundUser := Entity{Id: "1", Username: "ncardozo", Email: "nc@gapef.com.ar", Password: testPasswordHash,
+			Role: constants.ROLE_COACH, EmailVerified: true}
+
+		mockUserRepository.EXPECT().FindById(gomock.Any(), "1").Return(foundUser, nil, false)
+
+		if testCase.expectedStatus == http.StatusNoContent {
+			mockUserRepository.EXPECT().SetPassword(gomock.Any(), "1", gomock.Any()).DoAndReturn(func(_ context.Context, id, hashedPassword string) error {
+				assert.NoError(t, bcrypt.CompareHashAndPassword([]byte(hashedPassword), []byte("NadarMariposa2024")))
+				return nil
+			})
+		}
+
+		request := httptest.NewRequest(http.MethodPut, PATH_PASSWORD, strings.NewReader(testCase.body))
+		request.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		request.Header.Set(AUTHORIZATION_HEADER, BEARER_PREFIX+token)
+		recorder := httptest.NewRecorder()
+
+		serve(handler.UpdatePassword, e.NewContext(request, recorder))
+
+		assert.Equal(t, testCase.expectedStatus, recorder.Code, testCase.body)
+
+		if testCase.expectedDetail != "" {
+			response := custom_error.DTO{}
+			json.Unmarshal(recorder.Body.Bytes(), &response)
+			assert.Contains(t, response.Details, testCase.expectedDetail)
+		}
+
+		controller.Finish()
+	}
+}
+
+func TestPasswordReset(t *testing.T) {
+	controller := gomock.NewController(t)
+	mockUserRepository := NewMockRepository(controller)
+	mockMailSender := mail.NewMockSender(controller)
+	handler := NewUserHandler(mockUserRepository, mockMailSender, nil)
+	defer controller.Finish()
+
+	passwordResetPageUrl = "https://metricas.gapef.com.ar/reset-password"
+	defer func() { passwordResetPageUrl = "" }()
+
+	storedUser := Entity{Id: "1", Username: "ncardozo", Email: "nc@gapef.com.ar", Password: testPasswordHash,
+		Role: constants.ROLE_COACH, EmailVerified: true}
+
+	var resetLink string
+	mockUserRepository.EXPECT().FindByEmail(gomock.Any(), "nc@gapef.com.ar").Return(storedUser, nil, false)
+	mockMailSender.EXPECT().Send("nc@gapef.com.ar", SUBJECT_PASSWORD_RESET, gomock.Any()).DoAndReturn(
+		func(to, subject, body string) error {
+			resetLink = regexp.MustCompile(`https?://\S+`).FindString(body)
+			return nil
+		})
+
+	e := newEcho()
+	request := httptest.NewRequest(http.MethodPost, PATH_PASSWORD_RESET, strings.NewReader(`{"email":"nc@gapef.com.ar"}`))
+	request.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	recorder := httptest.NewRecorder()
+
+	serve(handler.RequestPasswordReset, e.NewContext(request, recorder))
+	assert.Equal(t, http.StatusAccepted, recorder.Code)
+
+	parsedLink, _ := url.Parse(resetLink)
+	resetToken := parsedLink.Query().Get("token")
+
+	// the link opens the page of the front-end, not a route of the API
+	assert.Equal(t, "https://metricas.gapef.com.ar/reset-password", parsedLink.Scheme+"://"+parsedLink.Host+parsedLink.Path)
+
+	// the first reset changes the password, so the same link cannot be used again
+	mockUserRepository.EXPECT().FindById(gomock.Any(), "1").DoAndReturn(func(_ context.Context, id string) (Entity, error, bool) {
+		return storedUser, nil, false
+	}).Times(2)
+	mockUserRepository.EXPECT().SetPassword(gomock.Any(), "1", gomock.Any()).DoAndReturn(func(_ context.Context, id, hashedPassword string) error {
+		storedUser.Password = hashedPassword
+		return nil
+	})
+
+	for _, expectedStatus := range []int{http.StatusNoContent, http.StatusBadRequest} {
+		body, _ := json.Marshal(PasswordResetDTO{Token: resetToken, NewPassword: "NadarMariposa2024"})
+		request := httptest.NewRequest(http.MethodPost, PATH_PASSWORD_RESET_CONFIRM, strings.NewReader(string(body)))
+		request.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		recorder := httptest.NewRecorder()
+
+		serve(handler.ResetPassword, e.NewContext(request, recorder))
+		assert.Equal(t, expectedStatus, recorder.Code)
+	}
+}
+
+func TestPasswordResetUnknownEmail(t *testing.T) {
+	controller := gomock.NewController(t)
+	mockUserRepository := NewMockRepository(controller)
+	handler := NewUserHandler(mockUserRepository, mail.NewMockSender(controller), nil)
+	defer controller.Finish()
+
+	mockUserRepository.EXPECT().FindByEmail(gomock.Any(), "nobody@gapef.com.ar").Return(Entity{}, assert.AnError, true)
+
+	e := newEcho()
+	request := httptest.NewRequest(http.MethodPost, PATH_PASSWORD_RESET, strings.NewReader(`{"email":"nobody@gapef.com.ar"}`))
+	request.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	recorder := httptest.NewRecorder()
+
+	serve(handler.RequestPasswordReset, e.NewContext(request, recorder))
+	assert.Equal(t, http.StatusAccepted, recorder.Code)
+}
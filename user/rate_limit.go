@@ -0,0 +1,34 @@
+package user
+
+import (
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	RATE_LIMIT_KEY_USER    = "user:"
+	RATE_LIMIT_KEY_API_KEY = "api_key:"
+	RATE_LIMIT_KEY_IP      = "ip:"
+)
+
+// RateLimitKey identifies the client of a request for the rate limits, the users and API keys by the id of their
+// credentials and the anonymous clients by their ip
+func RateLimitKey(c echo.Context) string {
+	claims, claimsErr := getRequestClaims(c)
+
+	if claimsErr != nil {
+		return RateLimitIpKey(c)
+	}
+
+	id, _ := claims[JWT_FIELD_ID].(string)
+
+	if claims[JWT_FIELD_API_KEY] == true {
+		return RATE_LIMIT_KEY_API_KEY + id
+	}
+
+	return RATE_LIMIT_KEY_USER + id
+}
+
+// RateLimitIpKey identifies the client of a request by its ip, for the limits checked before the authentication
+func RateLimitIpKey(c echo.Context) string {
+	return RATE_LIMIT_KEY_IP + c.RealIP()
+}
@@ -0,0 +1,37 @@
+package user
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRateLimitKey(t *testing.T) {
+	testCases := []struct {
+		name     string
+		claims   jwt.MapClaims
+		expected string
+	}{
+		{name: "user", claims: jwt.MapClaims{JWT_FIELD_ID: "1"}, expected: "user:1"},
+		{name: "API key", claims: jwt.MapClaims{JWT_FIELD_ID: "2", JWT_FIELD_API_KEY: true}, expected: "api_key:2"},
+		{name: "without credentials", expected: "ip:203.0.113.7"},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			request := httptest.NewRequest(http.MethodPost, PATH_LOGIN, nil)
+			request.RemoteAddr = "203.0.113.7:5000"
+			context := echo.New().NewContext(request, httptest.NewRecorder())
+
+			if testCase.claims != nil {
+				context.Set(CONTEXT_CLAIMS, testCase.claims)
+			}
+
+			assert.Equal(t, testCase.expected, RateLimitKey(context))
+		})
+	}
+}
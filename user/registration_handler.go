@@ -0,0 +1,173 @@
+package user
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+	"github.com/ncardozo92/gapef_swimming_metrics/constants"
+	"github.com/ncardozo92/gapef_swimming_metrics/i18n"
+	"github.com/ncardozo92/gapef_swimming_metrics/logging"
+)
+
+const (
+	MESSAGE_USER_PENDING_APPROVAL = "El usuario está pendiente de aprobación"
+	MESSAGE_USER_REJECTED         = "La solicitud de registro del usuario fue rechazada"
+	MESSAGE_USER_NOT_PENDING      = "El usuario no está pendiente de aprobación"
+	MESSAGE_GROUP_REQUIRED        = "Debe indicarse el grupo del atleta"
+	MESSAGE_REASON_REQUIRED       = "Debe indicarse el motivo del rechazo"
+	MESSAGE_USER_REVIEW_ERROR     = "No se pudo revisar la solicitud de registro"
+	SUBJECT_REGISTRATION_APPROVED = "GAPEF - Registro aprobado"
+	SUBJECT_REGISTRATION_REJECTED = "GAPEF - Registro rechazado"
+	BODY_REGISTRATION_APPROVED    = "Hola %s, tu registro fue aprobado en el grupo %s. Ya podés iniciar sesión."
+	BODY_REGISTRATION_REJECTED    = "Hola %s, tu registro fue rechazado por el siguiente motivo: %s"
+)
+
+// SignUp registers an athlete that will be able to log in after verifying the email and being approved by a coach
+func (handler UserHandler) SignUp(context echo.Context) error {
+
+	dto := DTO{}
+
+	if bindingErr := context.Bind(&dto); bindingErr != nil {
+		logging.LogErrorContext(context.Request().Context(), MESSAGE_BINDING_ERROR)
+		return ErrBinding
+	}
+
+	// only athletes can register themselves
+	dto.Role = constants.ROLE_ATLETHE
+	dto.Status = constants.STATUS_PENDING
+	dto.Group = ""
+
+	// the emails are sent in the language the athlete registered with, unless another one is chosen
+	if dto.Language == "" {
+		dto.Language = i18n.FromContext(context.Request().Context())
+	}
+
+	entity, storeNewUserErr := handler.storeNewUser(context, dto)
+
+	if storeNewUserErr != nil {
+		return storeNewUserErr
+	}
+
+	auditUserChange(context, Entity{}, entity)
+	handler.sendVerificationEmail(context.Request().Context(), entity)
+
+	return context.NoContent(http.StatusCreated)
+}
+
+// GetPendingUsers returns the approval queue, the registered athletes that already verified their email
+func (handler UserHandler) GetPendingUsers(context echo.Context) error {
+
+	usersDTOs := []DTO{}
+
+	users, getUsersErr := handler.userRepository.GetPendingUsers(context.Request().Context())
+
+	if getUsersErr != nil {
+		logging.LogErrorContext(context.Request().Context(), "could not retrieve pending users, %v", getUsersErr)
+		return repositoryError(getUsersErr, ErrCannotRetrieveUsers)
+	}
+
+	for _, user := range users {
+		usersDTOs = append(usersDTOs, toDTO(user))
+	}
+
+	return context.JSON(http.StatusOK, usersDTOs)
+}
+
+// Approve activates a pending athlete into a training group
+func (handler UserHandler) Approve(context echo.Context) error {
+
+	dto := ApprovalDTO{}
+
+	if bindingErr := context.Bind(&dto); bindingErr != nil || dto.Group == "" {
+		logging.LogErrorContext(context.Request().Context(), "approval without group")
+		return ErrGroupRequired
+	}
+
+	user, findPendingUserErr := handler.findPendingUser(context, context.Param("id"))
+
+	if findPendingUserErr != nil {
+		return findPendingUserErr
+	}
+
+	previous := user
+	user.Status = constants.STATUS_ACTIVE
+	user.Group = dto.Group
+
+	if updateErr := handler.userRepository.ApproveRegistration(context.Request().Context(), user.Id, user.Group); updateErr != nil {
+		logging.LogErrorContext(context.Request().Context(), "could not approve user, %v", updateErr)
+		return repositoryError(updateErr, ErrUserReview)
+	}
+
+	auditUserChange(context, previous, user)
+
+	handler.sendEmail(context.Request().Context(), user, EMAIL_REGISTRATION_APPROVED, user.Username, user.Group)
+
+	return context.NoContent(http.StatusNoContent)
+}
+
+// Reject refuses the registration of a pending athlete, the reason is emailed back to him
+func (handler UserHandler) Reject(context echo.Context) error {
+
+	dto := RejectionDTO{}
+
+	if bindingErr := context.Bind(&dto); bindingErr != nil || dto.Reason == "" {
+		logging.LogErrorContext(context.Request().Context(), "rejection without reason")
+		return ErrReasonRequired
+	}
+
+	user, findPendingUserErr := handler.findPendingUser(context, context.Param("id"))
+
+	if findPendingUserErr != nil {
+		return findPendingUserErr
+	}
+
+	previous := user
+	user.Status = constants.STATUS_REJECTED
+	user.RejectionReason = dto.Reason
+
+	if updateErr := handler.userRepository.RejectRegistration(context.Request().Context(), user.Id, user.RejectionReason); updateErr != nil {
+		logging.LogErrorContext(context.Request().Context(), "could not reject user, %v", updateErr)
+		return repositoryError(updateErr, ErrUserReview)
+	}
+
+	auditUserChange(context, previous, user)
+
+	handler.sendEmail(context.Request().Context(), user, EMAIL_REGISTRATION_REJECTED, user.Username, user.RejectionReason)
+
+	return context.NoContent(http.StatusNoContent)
+}
+
+// finds a user waiting for approval, when it cannot be found it returns the error to answer
+func (handler UserHandler) findPendingUser(context echo.Context, id string) (Entity, error) {
+
+	user, findUserErr, userNotFound := handler.userRepository.FindById(context.Request().Context(), id)
+
+	if findUserErr != nil {
+		if userNotFound {
+			logging.LogErrorContext(context.Request().Context(), "User not found")
+			return user, ErrUserNotFound
+		}
+		logging.LogErrorContext(context.Request().Context(), "could not retrieve user, %v", findUserErr)
+		return user, repositoryError(findUserErr, ErrUserReview)
+	}
+
+	if user.Status != constants.STATUS_PENDING {
+		logging.LogWarningContext(context.Request().Context(), "User %s is not pending of approval", user.Id)
+		return user, ErrUserNotPending
+	}
+
+	return user, nil
+}
+
+// sends an email in the language of the user, the args fill the verbs of the body. A failure is only logged because
+// it must not undo the operation that triggered it
+func (handler UserHandler) sendEmail(ctx context.Context, user Entity, email string, args ...any) {
+	language := userLanguage(user)
+	subject := i18n.NewMessage(email + EMAIL_SUBJECT_SUFFIX).Text(language)
+	body := i18n.NewMessage(email+EMAIL_BODY_SUFFIX, args...).Text(language)
+
+	if sendErr := handler.mailSender.Send(user.Email, subject, body); sendErr != nil {
+		logging.LogErrorContext(ctx, "could not send email to %s, %v", user.Email, sendErr)
+	}
+}
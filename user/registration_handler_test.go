@@ -0,0 +1,124 @@
+package user
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/ncardozo92/gapef_swimming_metrics/constants"
+	"github.com/ncardozo92/gapef_swimming_metrics/mail"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSignUpSuccess(t *testing.T) {
+	controller := gomock.NewController(t)
+	mockUserRepository := NewMockRepository(controller)
+	mockMailSender := mail.NewMockSender(controller)
+	handler := NewUserHandler(mockUserRepository, mockMailSender, nil)
+	defer controller.Finish()
+
+	e := newEcho()
+
+	// the role sent is ignored, a self registered user is always a pending athlete
+	requestBody := `{"email": "swimmer@gapef.com.ar", "username": "swimmer", "password": "anitaLAVAlaTina2024", "role": "ADMIN"}`
+
+	mockUserRepository.EXPECT().Exists(gomock.Any(), gomock.Any()).Return(false, nil)
+	mockUserRepository.EXPECT().Create(gomock.Any(), gomock.Any()).DoAndReturn(func(_ context.Context, entity Entity) (string, error) {
+		assert.Equal(t, constants.ROLE_ATLETHE, entity.Role)
+		assert.Equal(t, constants.STATUS_PENDING, entity.Status)
+		assert.False(t, entity.EmailVerified)
+		return "1", nil
+	})
+	mockMailSender.EXPECT().Send("swimmer@gapef.com.ar", SUBJECT_EMAIL_VERIFICATION, gomock.Any()).Return(nil)
+
+	request := httptest.NewRequest(http.MethodPost, "/signup", strings.NewReader(requestBody))
+	request.Header.Set("Content-Type", "application/json")
+
+	recorder := httptest.NewRecorder()
+	context := e.NewContext(request, recorder)
+
+	serve(handler.SignUp, context)
+	assert.Equal(t, http.StatusCreated, recorder.Code)
+}
+
+func TestApproveSuccess(t *testing.T) {
+	controller := gomock.NewController(t)
+	mockUserRepository := NewMockRepository(controller)
+	mockMailSender := mail.NewMockSender(controller)
+	handler := NewUserHandler(mockUserRepository, mockMailSender, nil)
+	defer controller.Finish()
+
+	e := newEcho()
+
+	pendingUser := Entity{Id: "1", Email: "swimmer@gapef.com.ar", Status: constants.STATUS_PENDING, EmailVerified: true}
+
+	mockUserRepository.EXPECT().FindById(gomock.Any(), "1").Return(pendingUser, nil, false)
+	mockUserRepository.EXPECT().ApproveRegistration(gomock.Any(), "1", "Juveniles").Return(nil)
+	mockMailSender.EXPECT().Send("swimmer@gapef.com.ar", SUBJECT_REGISTRATION_APPROVED, gomock.Any()).Return(nil)
+
+	request := httptest.NewRequest(http.MethodPost, "/users/1/approve", strings.NewReader(`{"group": "Juveniles"}`))
+	request.Header.Set("Content-Type", "application/json")
+
+	recorder := httptest.NewRecorder()
+	context := e.NewContext(request, recorder)
+	context.SetParamNames("id")
+	context.SetParamValues("1")
+
+	serve(handler.Approve, context)
+	assert.Equal(t, http.StatusNoContent, recorder.Code)
+}
+
+func TestApproveNotPendingUserFails(t *testing.T) {
+	controller := gomock.NewController(t)
+	mockUserRepository := NewMockRepository(controller)
+	handler := NewUserHandler(mockUserRepository, mail.NewMockSender(controller), nil)
+	defer controller.Finish()
+
+	e := newEcho()
+
+	mockUserRepository.EXPECT().FindById(gomock.Any(), "1").Return(Entity{Id: "1", Status: constants.STATUS_ACTIVE}, nil, false)
+	mockUserRepository.EXPECT().ApproveRegistration(gomock.Any(), gomock.Any(), gomock.Any()).Times(0)
+
+	request := httptest.NewRequest(http.MethodPost, "/users/1/approve", strings.NewReader(`{"group": "Juveniles"}`))
+	request.Header.Set("Content-Type", "application/json")
+
+	recorder := httptest.NewRecorder()
+	context := e.NewContext(request, recorder)
+	context.SetParamNames("id")
+	context.SetParamValues("1")
+
+	serve(handler.Approve, context)
+	assert.Equal(t, http.StatusConflict, recorder.Code)
+}
+
+func TestRejectSendsReason(t *testing.T) {
+	controller := gomock.NewController(t)
+	mockUserRepository := NewMockRepository(controller)
+	mockMailSender := mail.NewMockSender(controller)
+	handler := NewUserHandler(mockUserRepository, mockMailSender, nil)
+	defer controller.Finish()
+
+	e := newEcho()
+
+	mockUserRepository.EXPECT().FindById(gomock.Any(), "1").Return(Entity{Id: "1", Email: "swimmer@gapef.com.ar", Status: constants.STATUS_PENDING}, nil, false)
+	mockUserRepository.EXPECT().RejectRegistration(gomock.Any(), "1", gomock.Any()).Return(nil)
+	mockMailSender.EXPECT().Send("swimmer@gapef.com.ar", SUBJECT_REGISTRATION_REJECTED, gomock.Any()).
+		DoAndReturn(func(to, subject, body string) error {
+			assert.Contains(t, body, "no es socio del club")
+			return nil
+		})
+
+	request := httptest.NewRequest(http.MethodPost, "/users/1/reject", strings.NewReader(`{"reason": "no es socio del club"}`))
+	request.Header.Set("Content-Type", "application/json")
+
+	recorder := httptest.NewRecorder()
+	context := e.NewContext(request, recorder)
+	context.SetParamNames("id")
+	context.SetParamValues("1")
+
+	serve(handler.Reject, context)
+	assert.Equal(t, http.StatusNoContent, recorder.Code)
+}
@@ -2,22 +2,68 @@ package user
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"time"
 
+	"github.com/ncardozo92/gapef_swimming_metrics/constants"
+	"github.com/ncardozo92/gapef_swimming_metrics/listing"
 	"github.com/ncardozo92/gapef_swimming_metrics/persistence"
+	"github.com/ncardozo92/gapef_swimming_metrics/search"
 	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
 const (
-	USER_COLLECTION string = "users"
+	USER_COLLECTION     string = "users"
+	SETTINGS_COLLECTION string = "settings"
+	API_KEY_COLLECTION  string = "api_keys"
+	// id of the settings document with the two factor policy
+	TWO_FACTOR_POLICY_ID string = "two_factor_policy"
+	// the search ranks at most this amount of users, the ones that share more trigrams with the query
+	SEARCH_CANDIDATES int    = 200
+	USER_TEXT_INDEX   string = "users_text_search"
+	// name of the operations of this repository at the metrics and traces
+	REPOSITORY_NAME string = "users"
+	// names of the migrations of the stored users
+	MIGRATION_EMAIL_VERIFIED      string = "users_email_verified"
+	MIGRATION_NORMALIZED_IDENTITY string = "users_normalized_identity"
+	MIGRATION_SEARCH_GRAMS        string = "users_search_grams"
 )
 
+// Page is a page of a users listing
+type Page = listing.Page[Entity]
+
 type Repository interface {
-	FindByUsername(id string) (Entity, error, bool)
-	GetUsers(page, size int64) ([]Entity, error)
-	Create(entity Entity) error
-	Exists(entity Entity) (bool, error)
+	FindByUsername(ctx context.Context, id string) (Entity, error, bool)
+	FindById(ctx context.Context, id string) (Entity, error, bool)
+	FindByEmail(ctx context.Context, email string) (Entity, error, bool)
+	ListUsers(ctx context.Context, filter Filter, request listing.Request) (Page, error)
+	Create(ctx context.Context, entity Entity) (string, error)
+	CreateMany(ctx context.Context, entities []Entity) ([]string, error)
+	Exists(ctx context.Context, entity Entity) (bool, error)
+	LinkAthlete(ctx context.Context, parentId, athleteId string) error
+	VerifyEmail(ctx context.Context, id string, verifiedAt time.Time) error
+	SetPassword(ctx context.Context, id, hashedPassword string) error
+	ApproveRegistration(ctx context.Context, id, group string) error
+	RejectRegistration(ctx context.Context, id, reason string) error
+	SetLanguage(ctx context.Context, id, language string) error
+	SetTotpSecret(ctx context.Context, id, secret string) error
+	EnableTwoFactor(ctx context.Context, id string, hashedRecoveryCodes []string) error
+	DisableTwoFactor(ctx context.Context, id string) error
+	UseRecoveryCode(ctx context.Context, id, hashedCode string) (bool, error)
+	UseTotpStep(ctx context.Context, id string, step int64) (bool, error)
+	GetPendingUsers(ctx context.Context) ([]Entity, error)
+	GetTwoFactorRoles(ctx context.Context) ([]string, error)
+	SetTwoFactorRoles(ctx context.Context, roles []string) error
+	CreateApiKey(ctx context.Context, apiKey ApiKey) (string, error)
+	GetApiKeys(ctx context.Context) ([]ApiKey, error)
+	FindApiKeyByHash(ctx context.Context, hash string) (ApiKey, error, bool)
+	RevokeApiKey(ctx context.Context, id string, revokedAt time.Time) (bool, error)
+	TouchApiKey(ctx context.Context, id string, usedAt time.Time) error
+	SearchUsers(ctx context.Context, query, role string) ([]Entity, error)
 }
 
 type UserRepository struct {
@@ -29,9 +75,12 @@ func NewUserRepository() *UserRepository {
 	return &UserRepository{Database: persistence.GetDatabase()}
 }
 
-func (repository UserRepository) FindByUsername(username string) (Entity, error, bool) {
+func (repository UserRepository) FindByUsername(ctx context.Context, username string) (_ Entity, err error, _ bool) {
+	ctx, done := persistence.StartOperation(ctx, REPOSITORY_NAME, "FindByUsername")
+	defer func() { done(err) }()
+
 	user := Entity{}
-	mongoErr := repository.Database.Collection(USER_COLLECTION).FindOne(context.TODO(), bson.D{{Key: "username", Value: username}}).Decode(&user)
+	mongoErr := repository.Database.Collection(USER_COLLECTION).FindOne(ctx, bson.D{{Key: "username", Value: normalizeIdentity(username)}}).Decode(&user)
 
 	if mongoErr != nil {
 		var notFound bool
@@ -46,62 +95,663 @@ func (repository UserRepository) FindByUsername(username string) (Entity, error,
 	return user, nil, false
 }
 
-// gets all the users in the collections in pages
-func (repository UserRepository) GetUsers(page, size int64) ([]Entity, error) {
-	actualContext := context.TODO()
-	usersList := []Entity{}
-	findingOptions := options.Find().SetLimit(size).SetSkip((page * size) + 1)
+// finds a user by his email, the last returned value indicates if the user was not found
+func (repository UserRepository) FindByEmail(ctx context.Context, email string) (_ Entity, err error, _ bool) {
+	ctx, done := persistence.StartOperation(ctx, REPOSITORY_NAME, "FindByEmail")
+	defer func() { done(err) }()
 
-	usersCursor, findUsersErr := repository.Database.Collection(USER_COLLECTION).Find(actualContext, bson.D{}, findingOptions)
+	user := Entity{}
+	mongoErr := repository.Database.Collection(USER_COLLECTION).FindOne(ctx, bson.D{{Key: "email", Value: normalizeIdentity(email)}}).Decode(&user)
 
-	if findUsersErr != nil {
-		return nil, findUsersErr
+	if mongoErr != nil {
+		return user, mongoErr, mongoErr == mongo.ErrNoDocuments
 	}
 
-	for usersCursor.Next(actualContext) {
-		user := Entity{}
+	return user, nil, false
+}
 
-		if cursorErr := usersCursor.Decode(&user); cursorErr != nil {
-			return nil, cursorErr
-		}
+// finds a user by his id, the last returned value indicates if the user was not found
+func (repository UserRepository) FindById(ctx context.Context, id string) (_ Entity, err error, _ bool) {
+	ctx, done := persistence.StartOperation(ctx, REPOSITORY_NAME, "FindById")
+	defer func() { done(err) }()
+
+	user := Entity{}
 
-		usersList = append(usersList, user)
+	objectId, idErr := primitive.ObjectIDFromHex(id)
+
+	if idErr != nil {
+		return user, mongo.ErrNoDocuments, true
 	}
 
-	return usersList, nil
+	mongoErr := repository.Database.Collection(USER_COLLECTION).FindOne(ctx, bson.D{{Key: "_id", Value: objectId}}).Decode(&user)
+
+	if mongoErr != nil {
+		return user, mongoErr, mongoErr == mongo.ErrNoDocuments
+	}
+
+	return user, nil, false
 }
 
-// inserts a new user at the collection
-func (repository UserRepository) Create(entity Entity) error {
+// gets a page of the users that match the filter
+func (repository UserRepository) ListUsers(ctx context.Context, filter Filter, request listing.Request) (_ Page, err error) {
+	ctx, done := persistence.StartOperation(ctx, REPOSITORY_NAME, "ListUsers")
+	defer func() { done(err) }()
+
+	collection := repository.Database.Collection(USER_COLLECTION)
+	query := filter.query()
+
+	total, countErr := collection.CountDocuments(ctx, query)
+
+	if countErr != nil {
+		return Page{}, countErr
+	}
+
+	pageQuery := bson.D{{Key: "$and", Value: bson.A{query, request.Filter()}}}
+
+	usersCursor, findUsersErr := collection.Find(ctx, pageQuery, request.FindOptions())
 
-	_, insertErr := repository.Database.Collection(USER_COLLECTION).InsertOne(context.TODO(), entity)
+	if findUsersErr != nil {
+		return Page{}, findUsersErr
+	}
+
+	usersList := []Entity{}
+
+	if cursorErr := usersCursor.All(ctx, &usersList); cursorErr != nil {
+		return Page{}, cursorErr
+	}
+
+	return listing.NewPage(usersList, total, request, func(user Entity) (any, string) {
+		return user.sortValue(request.SortField), user.Id
+	})
+}
+
+// inserts a new user at the collection and returns its id
+func (repository UserRepository) Create(ctx context.Context, entity Entity) (_ string, err error) {
+	ctx, done := persistence.StartOperation(ctx, REPOSITORY_NAME, "Create")
+	defer func() { done(err) }()
+
+	entity = normalizeEntity(entity)
+
+	result, insertErr := repository.Database.Collection(USER_COLLECTION).InsertOne(ctx, entity)
 
 	if insertErr != nil {
-		return insertErr
-	} else {
-		return nil
+		return "", persistence.CheckDuplicateKey(insertErr)
+	}
+
+	if objectId, isObjectId := result.InsertedID.(primitive.ObjectID); isObjectId {
+		return objectId.Hex(), nil
 	}
+
+	return fmt.Sprint(result.InsertedID), nil
 }
 
-// checks if a user already has username or password
-func (repository UserRepository) Exists(entity Entity) (bool, error) {
+// inserts the users in a single ordered batch and returns their ids in the same order. When the batch fails the users
+// inserted before the failure are deleted, so the batch is stored whole or not at all
+func (repository UserRepository) CreateMany(ctx context.Context, entities []Entity) (_ []string, err error) {
+	ctx, done := persistence.StartOperation(ctx, REPOSITORY_NAME, "CreateMany")
+	defer func() { done(err) }()
+
+	collection := repository.Database.Collection(USER_COLLECTION)
+
+	// the ids are generated before the insert, so the inserted users are known whatever the failure is
+	objectIds := []primitive.ObjectID{}
+	documents := []any{}
+	for _, entity := range entities {
+		objectId := primitive.NewObjectID()
+		objectIds = append(objectIds, objectId)
+		documents = append(documents, newEntity{Id: objectId, Entity: normalizeEntity(entity)})
+	}
 
-	goContext := context.TODO()
+	if _, insertErr := collection.InsertMany(ctx, documents); insertErr != nil {
+		// the deletion has its own timeout, the one of the insert could be expired
+		deleteContext, cancel := persistence.WithTimeout(context.WithoutCancel(ctx))
+		defer cancel()
+
+		filter := bson.D{{Key: "_id", Value: bson.D{{Key: "$in", Value: objectIds}}}}
+
+		if _, deleteErr := collection.DeleteMany(deleteContext, filter); deleteErr != nil {
+			return nil, errors.Join(persistence.CheckDuplicateKey(insertErr),
+				fmt.Errorf("cannot delete the users inserted before the failure, %w", deleteErr))
+		}
+
+		return nil, persistence.CheckDuplicateKey(insertErr)
+	}
+
+	ids := []string{}
+	for _, objectId := range objectIds {
+		ids = append(ids, objectId.Hex())
+	}
+
+	return ids, nil
+}
+
+// checks if a user already has the username or email
+func (repository UserRepository) Exists(ctx context.Context, entity Entity) (_ bool, err error) {
+	ctx, done := persistence.StartOperation(ctx, REPOSITORY_NAME, "Exists")
+	defer func() { done(err) }()
 
 	filter := bson.D{
 		{Key: "$or",
 			Value: bson.A{
-				bson.D{{Key: "username", Value: bson.D{{Key: "$eq", Value: entity.Username}}}},
-				bson.D{{Key: "email", Value: bson.D{{Key: "$eq", Value: entity.Email}}}},
+				bson.D{{Key: "username", Value: bson.D{{Key: "$eq", Value: normalizeIdentity(entity.Username)}}}},
+				bson.D{{Key: "email", Value: bson.D{{Key: "$eq", Value: normalizeIdentity(entity.Email)}}}},
+			},
+		},
+	}
+
+	// one match is enough to know it exists
+	count, countErr := repository.Database.Collection(USER_COLLECTION).CountDocuments(ctx, filter, options.Count().SetLimit(1))
+
+	if countErr != nil {
+		return false, countErr
+	}
+
+	return count > 0, nil
+}
+
+// links an athlete to a parent user, linking the same athlete twice has no effect
+func (repository UserRepository) LinkAthlete(ctx context.Context, parentId, athleteId string) (err error) {
+	ctx, done := persistence.StartOperation(ctx, REPOSITORY_NAME, "LinkAthlete")
+	defer func() { done(err) }()
+
+	objectId, idErr := primitive.ObjectIDFromHex(parentId)
+
+	if idErr != nil {
+		return idErr
+	}
+
+	update := bson.D{{Key: "$addToSet", Value: bson.D{{Key: "athletes", Value: athleteId}}}}
+
+	_, updateErr := repository.Database.Collection(USER_COLLECTION).UpdateByID(ctx, objectId, update)
+
+	return updateErr
+}
+
+// marks the email of a user as verified
+func (repository UserRepository) VerifyEmail(ctx context.Context, id string, verifiedAt time.Time) (err error) {
+	ctx, done := persistence.StartOperation(ctx, REPOSITORY_NAME, "VerifyEmail")
+	defer func() { done(err) }()
+
+	return repository.updateUser(ctx, id, bson.D{{Key: "$set", Value: bson.D{
+		{Key: "email_verified", Value: true},
+		{Key: "email_verified_at", Value: verifiedAt},
+	}}})
+}
+
+// stores the hash of the new password of a user
+func (repository UserRepository) SetPassword(ctx context.Context, id, hashedPassword string) (err error) {
+	ctx, done := persistence.StartOperation(ctx, REPOSITORY_NAME, "SetPassword")
+	defer func() { done(err) }()
+
+	return repository.updateUser(ctx, id, bson.D{{Key: "$set", Value: bson.D{{Key: "password", Value: hashedPassword}}}})
+}
+
+// activates a pending user at the group assigned by the coach
+func (repository UserRepository) ApproveRegistration(ctx context.Context, id, group string) (err error) {
+	ctx, done := persistence.StartOperation(ctx, REPOSITORY_NAME, "ApproveRegistration")
+	defer func() { done(err) }()
+
+	return repository.updateUser(ctx, id, bson.D{{Key: "$set", Value: bson.D{
+		{Key: "status", Value: constants.STATUS_ACTIVE},
+		{Key: "group", Value: group},
+	}}})
+}
+
+// rejects a pending user, storing the reason given by the coach
+func (repository UserRepository) RejectRegistration(ctx context.Context, id, reason string) (err error) {
+	ctx, done := persistence.StartOperation(ctx, REPOSITORY_NAME, "RejectRegistration")
+	defer func() { done(err) }()
+
+	return repository.updateUser(ctx, id, bson.D{{Key: "$set", Value: bson.D{
+		{Key: "status", Value: constants.STATUS_REJECTED},
+		{Key: "rejection_reason", Value: reason},
+	}}})
+}
+
+// stores the language a user prefers
+func (repository UserRepository) SetLanguage(ctx context.Context, id, language string) (err error) {
+	ctx, done := persistence.StartOperation(ctx, REPOSITORY_NAME, "SetLanguage")
+	defer func() { done(err) }()
+
+	return repository.updateUser(ctx, id, bson.D{{Key: "$set", Value: bson.D{{Key: "language", Value: language}}}})
+}
+
+// stores the secret of a two factor enrolment that is not confirmed yet
+func (repository UserRepository) SetTotpSecret(ctx context.Context, id, secret string) (err error) {
+	ctx, done := persistence.StartOperation(ctx, REPOSITORY_NAME, "SetTotpSecret")
+	defer func() { done(err) }()
+
+	return repository.updateUser(ctx, id, bson.D{{Key: "$set", Value: bson.D{{Key: "totp_secret", Value: secret}}}})
+}
+
+// enables the second factor of a user with the hashes of his recovery codes
+func (repository UserRepository) EnableTwoFactor(ctx context.Context, id string, hashedRecoveryCodes []string) (err error) {
+	ctx, done := persistence.StartOperation(ctx, REPOSITORY_NAME, "EnableTwoFactor")
+	defer func() { done(err) }()
+
+	return repository.updateUser(ctx, id, bson.D{{Key: "$set", Value: bson.D{
+		{Key: "totp_enabled", Value: true},
+		{Key: "recovery_codes", Value: hashedRecoveryCodes},
+	}}})
+}
+
+// disables the second factor of a user and removes his secret and recovery codes
+func (repository UserRepository) DisableTwoFactor(ctx context.Context, id string) (err error) {
+	ctx, done := persistence.StartOperation(ctx, REPOSITORY_NAME, "DisableTwoFactor")
+	defer func() { done(err) }()
+
+	return repository.updateUser(ctx, id, bson.D{
+		{Key: "$set", Value: bson.D{{Key: "totp_enabled", Value: false}}},
+		{Key: "$unset", Value: bson.D{{Key: "totp_secret", Value: ""}, {Key: "recovery_codes", Value: ""}}},
+	})
+}
+
+// removes a recovery code of a user, returns false when the user does not have it, so two concurrent logins cannot
+// use the same code
+func (repository UserRepository) UseRecoveryCode(ctx context.Context, id, hashedCode string) (_ bool, err error) {
+	ctx, done := persistence.StartOperation(ctx, REPOSITORY_NAME, "UseRecoveryCode")
+	defer func() { done(err) }()
+
+	objectId, idErr := primitive.ObjectIDFromHex(id)
+
+	if idErr != nil {
+		return false, idErr
+	}
+
+	filter := bson.D{{Key: "_id", Value: objectId}, {Key: "recovery_codes", Value: hashedCode}}
+	update := bson.D{{Key: "$pull", Value: bson.D{{Key: "recovery_codes", Value: hashedCode}}}}
+
+	result, updateErr := repository.Database.Collection(USER_COLLECTION).UpdateOne(ctx, filter, update)
+
+	if updateErr != nil {
+		return false, updateErr
+	}
+
+	return result.ModifiedCount > 0, nil
+}
+
+// stores the time step of an accepted code, returns false when a code of that step or a later one was already
+// accepted, so two concurrent requests cannot use the same code
+func (repository UserRepository) UseTotpStep(ctx context.Context, id string, step int64) (_ bool, err error) {
+	ctx, done := persistence.StartOperation(ctx, REPOSITORY_NAME, "UseTotpStep")
+	defer func() { done(err) }()
+
+	objectId, idErr := primitive.ObjectIDFromHex(id)
+
+	if idErr != nil {
+		return false, idErr
+	}
+
+	// $not also matches the users that never used a code
+	filter := bson.D{
+		{Key: "_id", Value: objectId},
+		{Key: "totp_last_step", Value: bson.D{{Key: "$not", Value: bson.D{{Key: "$gte", Value: step}}}}},
+	}
+	update := bson.D{{Key: "$set", Value: bson.D{{Key: "totp_last_step", Value: step}}}}
+
+	result, updateErr := repository.Database.Collection(USER_COLLECTION).UpdateOne(ctx, filter, update)
+
+	if updateErr != nil {
+		return false, updateErr
+	}
+
+	return result.ModifiedCount > 0, nil
+}
+
+// applies an update to a user, only the fields named at the update are written, so concurrent updates of other
+// fields are not undone
+func (repository UserRepository) updateUser(ctx context.Context, id string, update bson.D) error {
+	objectId, idErr := primitive.ObjectIDFromHex(id)
+
+	if idErr != nil {
+		return idErr
+	}
+
+	_, updateErr := repository.Database.Collection(USER_COLLECTION).UpdateByID(ctx, objectId, update)
+
+	return updateErr
+}
+
+// gets the users that verified their email and are waiting for a coach approval
+func (repository UserRepository) GetPendingUsers(ctx context.Context) (_ []Entity, err error) {
+	ctx, done := persistence.StartOperation(ctx, REPOSITORY_NAME, "GetPendingUsers")
+	defer func() { done(err) }()
+
+	usersList := []Entity{}
+
+	filter := bson.D{
+		{Key: "status", Value: constants.STATUS_PENDING},
+		{Key: "email_verified", Value: true},
+	}
+
+	usersCursor, findUsersErr := repository.Database.Collection(USER_COLLECTION).Find(ctx, filter)
+
+	if findUsersErr != nil {
+		return nil, findUsersErr
+	}
+
+	if cursorErr := usersCursor.All(ctx, &usersList); cursorErr != nil {
+		return nil, cursorErr
+	}
+
+	return usersList, nil
+}
+
+// gets the roles that must use two factor authentication
+func (repository UserRepository) GetTwoFactorRoles(ctx context.Context) (_ []string, err error) {
+	ctx, done := persistence.StartOperation(ctx, REPOSITORY_NAME, "GetTwoFactorRoles")
+	defer func() { done(err) }()
+
+	policy := struct {
+		Roles []string `bson:"roles"`
+	}{}
+
+	findErr := repository.Database.Collection(SETTINGS_COLLECTION).FindOne(ctx, bson.D{{Key: "_id", Value: TWO_FACTOR_POLICY_ID}}).Decode(&policy)
+
+	// without a stored policy no role is required to use it
+	if findErr == mongo.ErrNoDocuments {
+		return []string{}, nil
+	}
+
+	return policy.Roles, findErr
+}
+
+// stores the roles that must use two factor authentication
+func (repository UserRepository) SetTwoFactorRoles(ctx context.Context, roles []string) (err error) {
+	ctx, done := persistence.StartOperation(ctx, REPOSITORY_NAME, "SetTwoFactorRoles")
+	defer func() { done(err) }()
+
+	update := bson.D{{Key: "$set", Value: bson.D{{Key: "roles", Value: roles}}}}
+
+	_, updateErr := repository.Database.Collection(SETTINGS_COLLECTION).UpdateByID(ctx, TWO_FACTOR_POLICY_ID, update, options.Update().SetUpsert(true))
+
+	return updateErr
+}
+
+// inserts a new API key and returns its id
+func (repository UserRepository) CreateApiKey(ctx context.Context, apiKey ApiKey) (_ string, err error) {
+	ctx, done := persistence.StartOperation(ctx, REPOSITORY_NAME, "CreateApiKey")
+	defer func() { done(err) }()
+
+	result, insertErr := repository.Database.Collection(API_KEY_COLLECTION).InsertOne(ctx, apiKey)
+
+	if insertErr != nil {
+		return "", insertErr
+	}
+
+	if objectId, isObjectId := result.InsertedID.(primitive.ObjectID); isObjectId {
+		return objectId.Hex(), nil
+	}
+
+	return fmt.Sprint(result.InsertedID), nil
+}
+
+// gets all the API keys, including the revoked and expired ones
+func (repository UserRepository) GetApiKeys(ctx context.Context) (_ []ApiKey, err error) {
+	ctx, done := persistence.StartOperation(ctx, REPOSITORY_NAME, "GetApiKeys")
+	defer func() { done(err) }()
+
+	apiKeys := []ApiKey{}
+
+	apiKeysCursor, findErr := repository.Database.Collection(API_KEY_COLLECTION).Find(ctx, bson.D{})
+
+	if findErr != nil {
+		return nil, findErr
+	}
+
+	if cursorErr := apiKeysCursor.All(ctx, &apiKeys); cursorErr != nil {
+		return nil, cursorErr
+	}
+
+	return apiKeys, nil
+}
+
+// finds an API key by the hash of its secret, the last returned value indicates if the key was not found
+func (repository UserRepository) FindApiKeyByHash(ctx context.Context, hash string) (_ ApiKey, err error, _ bool) {
+	ctx, done := persistence.StartOperation(ctx, REPOSITORY_NAME, "FindApiKeyByHash")
+	defer func() { done(err) }()
+
+	apiKey := ApiKey{}
+	mongoErr := repository.Database.Collection(API_KEY_COLLECTION).FindOne(ctx, bson.D{{Key: "hash", Value: hash}}).Decode(&apiKey)
+
+	if mongoErr != nil {
+		return apiKey, mongoErr, mongoErr == mongo.ErrNoDocuments
+	}
+
+	return apiKey, nil, false
+}
+
+// marks an API key as revoked, returns false when there is no key with the id
+func (repository UserRepository) RevokeApiKey(ctx context.Context, id string, revokedAt time.Time) (_ bool, err error) {
+	ctx, done := persistence.StartOperation(ctx, REPOSITORY_NAME, "RevokeApiKey")
+	defer func() { done(err) }()
+
+	objectId, idErr := primitive.ObjectIDFromHex(id)
+
+	if idErr != nil {
+		return false, nil
+	}
+
+	update := bson.D{{Key: "$set", Value: bson.D{{Key: "revoked_at", Value: revokedAt}}}}
+
+	result, updateErr := repository.Database.Collection(API_KEY_COLLECTION).UpdateByID(ctx, objectId, update)
+
+	if updateErr != nil {
+		return false, updateErr
+	}
+
+	return result.MatchedCount > 0, nil
+}
+
+// stores when an API key was last used
+func (repository UserRepository) TouchApiKey(ctx context.Context, id string, usedAt time.Time) (err error) {
+	ctx, done := persistence.StartOperation(ctx, REPOSITORY_NAME, "TouchApiKey")
+	defer func() { done(err) }()
+
+	objectId, idErr := primitive.ObjectIDFromHex(id)
+
+	if idErr != nil {
+		return idErr
+	}
+
+	update := bson.D{{Key: "$set", Value: bson.D{{Key: "last_used_at", Value: usedAt}}}}
+
+	_, updateErr := repository.Database.Collection(API_KEY_COLLECTION).UpdateByID(ctx, objectId, update)
+
+	return updateErr
+}
+
+// finds the users whose names match the query by words, ignoring accents, or share trigrams with it. The users
+// are not ranked, only the ones sharing more trigrams are preferred when there are too many
+func (repository UserRepository) SearchUsers(ctx context.Context, query, role string) (_ []Entity, err error) {
+	ctx, done := persistence.StartOperation(ctx, REPOSITORY_NAME, "SearchUsers")
+	defer func() { done(err) }()
+
+	queryGrams := search.Grams(query)
+
+	match := bson.D{{Key: "$or", Value: bson.A{
+		bson.D{{Key: "$text", Value: bson.D{{Key: "$search", Value: query}}}},
+		bson.D{{Key: "search_grams", Value: bson.D{{Key: "$in", Value: queryGrams}}}},
+	}}}
+
+	if role != "" {
+		match = append(match, bson.E{Key: "role", Value: role})
+	}
+
+	sharedGrams := bson.D{{Key: "$size", Value: bson.D{{Key: "$setIntersection", Value: bson.A{
+		bson.D{{Key: "$ifNull", Value: bson.A{"$search_grams", bson.A{}}}},
+		queryGrams,
+	}}}}}
+
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: match}},
+		{{Key: "$addFields", Value: bson.D{{Key: "shared_grams", Value: sharedGrams}}}},
+		{{Key: "$sort", Value: bson.D{{Key: "shared_grams", Value: -1}}}},
+		{{Key: "$limit", Value: SEARCH_CANDIDATES}},
+	}
+
+	usersCursor, aggregateErr := repository.Database.Collection(USER_COLLECTION).Aggregate(ctx, pipeline)
+
+	if aggregateErr != nil {
+		return nil, aggregateErr
+	}
+
+	usersList := []Entity{}
+
+	if cursorErr := usersCursor.All(ctx, &usersList); cursorErr != nil {
+		return nil, cursorErr
+	}
+
+	return usersList, nil
+}
+
+// EnsureSearchIndexes creates the indexes of the user search and stores, once, the trigrams of the users created
+// before the search existed. The text index has no language, so the names are not stemmed, and ignores the accents
+func (repository UserRepository) EnsureSearchIndexes() error {
+	collection := repository.Database.Collection(USER_COLLECTION)
+
+	_, indexErr := collection.Indexes().CreateMany(context.TODO(), []mongo.IndexModel{
+		{
+			Keys: bson.D{
+				{Key: "first_name", Value: "text"},
+				{Key: "last_name", Value: "text"},
+				{Key: "username", Value: "text"},
 			},
+			Options: options.Index().SetName(USER_TEXT_INDEX).SetDefaultLanguage("none").
+				SetWeights(bson.D{{Key: "first_name", Value: 3}, {Key: "last_name", Value: 3}, {Key: "username", Value: 1}}),
 		},
+		{Keys: bson.D{{Key: "search_grams", Value: 1}}},
+	})
+
+	if indexErr != nil {
+		return indexErr
+	}
+
+	return persistence.Migrate(repository.Database, MIGRATION_SEARCH_GRAMS, repository.storeSearchGrams)
+}
+
+// the users created after the search store their trigrams when they are saved
+func (repository UserRepository) storeSearchGrams(ctx context.Context) error {
+	collection := repository.Database.Collection(USER_COLLECTION)
+
+	usersCursor, findErr := collection.Find(ctx, bson.D{{Key: "search_grams", Value: bson.D{{Key: "$exists", Value: false}}}})
+
+	if findErr != nil {
+		return findErr
+	}
+
+	defer usersCursor.Close(ctx)
+
+	for usersCursor.Next(ctx) {
+		user := Entity{}
+
+		if decodeErr := usersCursor.Decode(&user); decodeErr != nil {
+			return decodeErr
+		}
+
+		objectId, idErr := primitive.ObjectIDFromHex(user.Id)
+
+		if idErr != nil {
+			return idErr
+		}
+
+		update := bson.D{{Key: "$set", Value: bson.D{{Key: "search_grams", Value: searchGrams(user)}}}}
+
+		if _, updateErr := collection.UpdateByID(ctx, objectId, update); updateErr != nil {
+			return updateErr
+		}
+	}
+
+	return usersCursor.Err()
+}
+
+// EnsureUniqueIndexes normalises, once, the usernames and emails stored before they were and makes both fields
+// unique, so two concurrent creations cannot store the same user twice
+func (repository UserRepository) EnsureUniqueIndexes() error {
+	migrationErr := persistence.Migrate(repository.Database, MIGRATION_NORMALIZED_IDENTITY, repository.normalizeStoredIdentities)
+
+	if migrationErr != nil {
+		return migrationErr
 	}
 
-	result, findingErr := repository.Database.Collection(USER_COLLECTION).Find(goContext, filter)
+	return persistence.EnsureUniqueIndexes(repository.Database.Collection(USER_COLLECTION), "username", "email")
+}
 
-	if findingErr != nil {
-		return false, findingErr
+// EnsureApiKeyIndexes makes the hash of the API keys unique and indexed, as every request with an API key looks it up
+func (repository UserRepository) EnsureApiKeyIndexes() error {
+	return persistence.EnsureUniqueIndexes(repository.Database.Collection(API_KEY_COLLECTION), "hash")
+}
+
+// the identities are normalised with normalizeIdentity, like the new ones, as the $toLower of mongo only lowers the
+// ASCII letters and would store MUÑOZ as muÑoz
+func (repository UserRepository) normalizeStoredIdentities(ctx context.Context) error {
+	collection := repository.Database.Collection(USER_COLLECTION)
+	projection := options.Find().SetProjection(bson.D{{Key: "username", Value: 1}, {Key: "email", Value: 1}})
+
+	usersCursor, findErr := collection.Find(ctx, bson.D{}, projection)
+
+	if findErr != nil {
+		return findErr
 	}
 
-	return result.Next(goContext), nil
+	for usersCursor.Next(ctx) {
+		user := Entity{}
+
+		if decodeErr := usersCursor.Decode(&user); decodeErr != nil {
+			return decodeErr
+		}
+
+		username, email := normalizeIdentity(user.Username), normalizeIdentity(user.Email)
+
+		if username == user.Username && email == user.Email {
+			continue
+		}
+
+		objectId, idErr := primitive.ObjectIDFromHex(user.Id)
+
+		if idErr != nil {
+			return idErr
+		}
+
+		update := bson.D{{Key: "$set", Value: bson.D{{Key: "username", Value: username}, {Key: "email", Value: email}}}}
+
+		if _, updateErr := collection.UpdateByID(ctx, objectId, update); updateErr != nil {
+			return updateErr
+		}
+	}
+
+	return usersCursor.Err()
+}
+
+// a user to insert with an id chosen by the repository, the id of the entity is empty so it is not written
+type newEntity struct {
+	Id     primitive.ObjectID `bson:"_id"`
+	Entity `bson:",inline"`
+}
+
+// MigrateEmailVerification marks as verified the users created before the email verification existed. They have no
+// email_verified field and would get the restricted tokens of the users that did not verify their email
+func (repository UserRepository) MigrateEmailVerification() error {
+	return persistence.Migrate(repository.Database, MIGRATION_EMAIL_VERIFIED, func(ctx context.Context) error {
+		filter := bson.D{{Key: "email_verified", Value: bson.D{{Key: "$exists", Value: false}}}}
+		update := bson.D{{Key: "$set", Value: bson.D{{Key: "email_verified", Value: true}}}}
+
+		_, updateErr := repository.Database.Collection(USER_COLLECTION).UpdateMany(ctx, filter, update)
+
+		return updateErr
+	})
+}
+
+// prepares a user to be stored, with the identity in lower case and the search trigrams
+func normalizeEntity(entity Entity) Entity {
+	entity.Username = normalizeIdentity(entity.Username)
+	entity.Email = normalizeIdentity(entity.Email)
+	entity.SearchGrams = searchGrams(entity)
+
+	return entity
+}
+
+// the trigrams of the fields the users are searched by
+func searchGrams(entity Entity) []string {
+	return search.Grams(entity.FirstName, entity.LastName, entity.Username)
 }
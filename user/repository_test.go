@@ -0,0 +1,314 @@
+package user
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/ncardozo92/gapef_swimming_metrics/constants"
+	"github.com/ncardozo92/gapef_swimming_metrics/persistence"
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+// runs the test with a repository of a mocked deployment, which records the commands sent to it
+func withMockedRepository(t *testing.T, name string, test func(mt *mtest.T, repository UserRepository)) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+
+	mt.Run(name, func(mt *mtest.T) {
+		test(mt, UserRepository{Database: mt.DB})
+	})
+}
+
+// the filter and the update of the last update command sent
+func sentUpdate(mt *mtest.T) (bson.Raw, bson.Raw) {
+	statement := mt.GetStartedEvent().Command.Lookup("updates").Array().Index(0).Value().Document()
+
+	return statement.Lookup("q").Document(), statement.Lookup("u").Document()
+}
+
+func marshal(document bson.D) bson.Raw {
+	raw, _ := bson.Marshal(document)
+	return raw
+}
+
+func TestUpdatesOnlyWriteTheirFields(t *testing.T) {
+	id := primitive.NewObjectID()
+	verifiedAt := time.Now().UTC().Truncate(time.Millisecond)
+
+	testCases := []struct {
+		name           string
+		update         func(repository UserRepository) error
+		expectedUpdate bson.D
+	}{
+		{"verify email", func(repository UserRepository) error {
+			return repository.VerifyEmail(context.TODO(), id.Hex(), verifiedAt)
+		}, bson.D{{Key: "$set", Value: bson.D{{Key: "email_verified", Value: true}, {Key: "email_verified_at", Value: verifiedAt}}}}},
+		{"password", func(repository UserRepository) error {
+			return repository.SetPassword(context.TODO(), id.Hex(), "hash")
+		}, bson.D{{Key: "$set", Value: bson.D{{Key: "password", Value: "hash"}}}}},
+		{"approval", func(repository UserRepository) error {
+			return repository.ApproveRegistration(context.TODO(), id.Hex(), "Juveniles")
+		}, bson.D{{Key: "$set", Value: bson.D{{Key: "status", Value: constants.STATUS_ACTIVE}, {Key: "group", Value: "Juveniles"}}}}},
+		{"rejection", func(repository UserRepository) error {
+			return repository.RejectRegistration(context.TODO(), id.Hex(), "no es socio")
+		}, bson.D{{Key: "$set", Value: bson.D{{Key: "status", Value: constants.STATUS_REJECTED}, {Key: "rejection_reason", Value: "no es socio"}}}}},
+		{"language", func(repository UserRepository) error {
+			return repository.SetLanguage(context.TODO(), id.Hex(), "en")
+		}, bson.D{{Key: "$set", Value: bson.D{{Key: "language", Value: "en"}}}}},
+		{"totp secret", func(repository UserRepository) error {
+			return repository.SetTotpSecret(context.TODO(), id.Hex(), "SECRET")
+		}, bson.D{{Key: "$set", Value: bson.D{{Key: "totp_secret", Value: "SECRET"}}}}},
+		{"two factor enabled", func(repository UserRepository) error {
+			return repository.EnableTwoFactor(context.TODO(), id.Hex(), []string{"a", "b"})
+		}, bson.D{{Key: "$set", Value: bson.D{{Key: "totp_enabled", Value: true}, {Key: "recovery_codes", Value: bson.A{"a", "b"}}}}}},
+	}
+
+	for _, testCase := range testCases {
+		withMockedRepository(t, testCase.name, func(mt *mtest.T, repository UserRepository) {
+			mt.AddMockResponses(mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 1}, bson.E{Key: "nModified", Value: 1}))
+
+			if assert.NoError(t, testCase.update(repository)) {
+				filter, update := sentUpdate(mt)
+
+				assert.Equal(t, marshal(bson.D{{Key: "_id", Value: id}}), filter)
+				assert.Equal(t, marshal(testCase.expectedUpdate), update)
+			}
+		})
+	}
+}
+
+func TestDisableTwoFactorRemovesTheSecretAndRecoveryCodes(t *testing.T) {
+	id := primitive.NewObjectID()
+
+	withMockedRepository(t, "disable", func(mt *mtest.T, repository UserRepository) {
+		mt.AddMockResponses(mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 1}, bson.E{Key: "nModified", Value: 1}))
+
+		if assert.NoError(t, repository.DisableTwoFactor(context.TODO(), id.Hex())) {
+			_, update := sentUpdate(mt)
+
+			// the fields are removed, setting them empty would be skipped by omitempty
+			assert.Equal(t, marshal(bson.D{
+				{Key: "$set", Value: bson.D{{Key: "totp_enabled", Value: false}}},
+				{Key: "$unset", Value: bson.D{{Key: "totp_secret", Value: ""}, {Key: "recovery_codes", Value: ""}}},
+			}), update)
+		}
+	})
+}
+
+func TestUseRecoveryCode(t *testing.T) {
+	id := primitive.NewObjectID()
+
+	testCases := []struct {
+		name         string
+		modified     int
+		expectedUsed bool
+	}{
+		{"stored code", 1, true},
+		// a code used by a concurrent login no longer matches the filter
+		{"used code", 0, false},
+	}
+
+	for _, testCase := range testCases {
+		withMockedRepository(t, testCase.name, func(mt *mtest.T, repository UserRepository) {
+			mt.AddMockResponses(mtest.CreateSuccessResponse(bson.E{Key: "n", Value: testCase.modified},
+				bson.E{Key: "nModified", Value: testCase.modified}))
+
+			used, useErr := repository.UseRecoveryCode(context.TODO(), id.Hex(), "hash")
+
+			if assert.NoError(t, useErr) {
+				filter, update := sentUpdate(mt)
+
+				assert.Equal(t, testCase.expectedUsed, used)
+				assert.Equal(t, marshal(bson.D{{Key: "_id", Value: id}, {Key: "recovery_codes", Value: "hash"}}), filter)
+				assert.Equal(t, marshal(bson.D{{Key: "$pull", Value: bson.D{{Key: "recovery_codes", Value: "hash"}}}}), update)
+			}
+		})
+	}
+}
+
+func TestUseTotpStep(t *testing.T) {
+	id := primitive.NewObjectID()
+
+	testCases := []struct {
+		name         string
+		modified     int
+		expectedUsed bool
+	}{
+		{"new step", 1, true},
+		// a step accepted by a concurrent request no longer matches the filter
+		{"used step", 0, false},
+	}
+
+	for _, testCase := range testCases {
+		withMockedRepository(t, testCase.name, func(mt *mtest.T, repository UserRepository) {
+			mt.AddMockResponses(mtest.CreateSuccessResponse(bson.E{Key: "n", Value: testCase.modified},
+				bson.E{Key: "nModified", Value: testCase.modified}))
+
+			used, useErr := repository.UseTotpStep(context.TODO(), id.Hex(), 42)
+
+			if assert.NoError(t, useErr) {
+				filter, update := sentUpdate(mt)
+
+				assert.Equal(t, testCase.expectedUsed, used)
+				assert.Equal(t, marshal(bson.D{{Key: "_id", Value: id}, {Key: "totp_last_step", Value: bson.D{
+					{Key: "$not", Value: bson.D{{Key: "$gte", Value: int64(42)}}}}}}), filter)
+				assert.Equal(t, marshal(bson.D{{Key: "$set", Value: bson.D{{Key: "totp_last_step", Value: int64(42)}}}}), update)
+			}
+		})
+	}
+}
+
+func TestCreateManyDeletesTheInsertedUsersWhenItFails(t *testing.T) {
+	withMockedRepository(t, "create many", func(mt *mtest.T, repository UserRepository) {
+		// the second user repeats an existing username, the first one was inserted
+		mt.AddMockResponses(
+			mtest.CreateWriteErrorsResponse(mtest.WriteError{Index: 1, Code: 11000, Message: "duplicate key"}),
+			mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 1}))
+
+		ids, createErr := repository.CreateMany(context.TODO(), []Entity{{Username: "ana"}, {Username: "juan"}, {Username: "sol"}})
+
+		assert.ErrorIs(t, createErr, persistence.ErrDuplicateKey)
+		assert.Nil(t, ids)
+
+		insert := mt.GetStartedEvent()
+		deletion := mt.GetStartedEvent()
+
+		if assert.Equal(t, "insert", insert.CommandName) && assert.Equal(t, "delete", deletion.CommandName) {
+			insertedIds := bson.A{}
+			documents, _ := insert.Command.Lookup("documents").Array().Values()
+			for _, document := range documents {
+				insertedIds = append(insertedIds, document.Document().Lookup("_id").ObjectID())
+			}
+
+			statement := deletion.Command.Lookup("deletes").Array().Index(0).Value().Document()
+
+			assert.Len(t, insertedIds, 3)
+			assert.Equal(t, marshal(bson.D{{Key: "_id", Value: bson.D{{Key: "$in", Value: insertedIds}}}}),
+				statement.Lookup("q").Document())
+		}
+	})
+}
+
+func TestMigrateEmailVerificationOnlyChangesTheUsersWithoutTheField(t *testing.T) {
+	withMockedRepository(t, "email verification", func(mt *mtest.T, repository UserRepository) {
+		mt.AddMockResponses(
+			mtest.CreateCursorResponse(0, "test."+persistence.MIGRATIONS_COLLECTION, mtest.FirstBatch),
+			mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 2}, bson.E{Key: "nModified", Value: 2}),
+			mtest.CreateSuccessResponse())
+
+		if assert.NoError(t, repository.MigrateEmailVerification()) {
+			mt.GetStartedEvent()
+			filter, update := sentUpdate(mt)
+
+			assert.Equal(t, marshal(bson.D{{Key: "email_verified", Value: bson.D{{Key: "$exists", Value: false}}}}), filter)
+			assert.Equal(t, marshal(bson.D{{Key: "$set", Value: bson.D{{Key: "email_verified", Value: true}}}}), update)
+		}
+	})
+}
+
+func TestEnsureUniqueIndexesNormalizesTheStoredIdentities(t *testing.T) {
+	normalizedId, storedId := primitive.NewObjectID(), primitive.NewObjectID()
+
+	withMockedRepository(t, "unique indexes", func(mt *mtest.T, repository UserRepository) {
+		mt.AddMockResponses(
+			mtest.CreateCursorResponse(0, "test."+persistence.MIGRATIONS_COLLECTION, mtest.FirstBatch),
+			mtest.CreateCursorResponse(0, "test."+USER_COLLECTION, mtest.FirstBatch,
+				bson.D{{Key: "_id", Value: normalizedId}, {Key: "username", Value: "ana"}, {Key: "email", Value: "ana@gapef.com.ar"}},
+				bson.D{{Key: "_id", Value: storedId}, {Key: "username", Value: "MUÑOZ"}, {Key: "email", Value: " Munoz@GAPEF.com.ar"}}),
+			mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 1}, bson.E{Key: "nModified", Value: 1}),
+			mtest.CreateSuccessResponse(),
+			mtest.CreateSuccessResponse())
+
+		if assert.NoError(t, repository.EnsureUniqueIndexes()) {
+			mt.GetStartedEvent()
+			mt.GetStartedEvent()
+			filter, update := sentUpdate(mt)
+
+			// only the user that was not normalised is updated, the non ASCII letters are lowered too
+			assert.Equal(t, marshal(bson.D{{Key: "_id", Value: storedId}}), filter)
+			assert.Equal(t, marshal(bson.D{{Key: "$set", Value: bson.D{
+				{Key: "username", Value: "muñoz"},
+				{Key: "email", Value: "munoz@gapef.com.ar"},
+			}}}), update)
+			assert.Equal(t, "insert", mt.GetStartedEvent().CommandName)
+			assert.Equal(t, "createIndexes", mt.GetStartedEvent().CommandName)
+		}
+	})
+}
+
+func TestExists(t *testing.T) {
+	testCases := map[string]int32{"exists": 1, "does not exist": 0}
+
+	for name, count := range testCases {
+		withMockedRepository(t, name, func(mt *mtest.T, repository UserRepository) {
+			mt.AddMockResponses(mtest.CreateCursorResponse(0, "test."+USER_COLLECTION, mtest.FirstBatch,
+				bson.D{{Key: "n", Value: count}}))
+
+			exists, existsErr := repository.Exists(context.Background(), Entity{Username: "Ana", Email: "ana@gapef.com.ar"})
+
+			if assert.NoError(t, existsErr) {
+				assert.Equal(t, count > 0, exists)
+
+				// the documents are counted, no cursor is left open
+				command := mt.GetStartedEvent().Command
+				assert.Equal(t, USER_COLLECTION, command.Lookup("aggregate").StringValue())
+				assert.Contains(t, command.Lookup("pipeline").String(), `"$limit": {"$numberLong":"1"}`)
+			}
+		})
+	}
+}
+
+func TestEnsureSearchIndexesStoresTheGramsOnce(t *testing.T) {
+	userId := primitive.NewObjectID()
+
+	withMockedRepository(t, "search grams", func(mt *mtest.T, repository UserRepository) {
+		mt.AddMockResponses(
+			mtest.CreateSuccessResponse(),
+			mtest.CreateCursorResponse(0, "test."+persistence.MIGRATIONS_COLLECTION, mtest.FirstBatch),
+			mtest.CreateCursorResponse(0, "test."+USER_COLLECTION, mtest.FirstBatch,
+				bson.D{{Key: "_id", Value: userId}, {Key: "username", Value: "ana"}, {Key: "first_name", Value: "Ana"}}),
+			mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 1}, bson.E{Key: "nModified", Value: 1}),
+			mtest.CreateSuccessResponse())
+
+		if assert.NoError(t, repository.EnsureSearchIndexes()) {
+			assert.Equal(t, "createIndexes", mt.GetStartedEvent().CommandName)
+			mt.GetStartedEvent()
+			mt.GetStartedEvent()
+			filter, _ := sentUpdate(mt)
+
+			assert.Equal(t, marshal(bson.D{{Key: "_id", Value: userId}}), filter)
+			assert.Equal(t, "insert", mt.GetStartedEvent().CommandName)
+		}
+	})
+
+	withMockedRepository(t, "search grams already stored", func(mt *mtest.T, repository UserRepository) {
+		mt.AddMockResponses(
+			mtest.CreateSuccessResponse(),
+			mtest.CreateCursorResponse(0, "test."+persistence.MIGRATIONS_COLLECTION, mtest.FirstBatch,
+				bson.D{{Key: "_id", Value: MIGRATION_SEARCH_GRAMS}}))
+
+		if assert.NoError(t, repository.EnsureSearchIndexes()) {
+			mt.GetStartedEvent()
+			mt.GetStartedEvent()
+			assert.Nil(t, mt.GetStartedEvent())
+		}
+	})
+}
+
+func TestEnsureApiKeyIndexes(t *testing.T) {
+	withMockedRepository(t, "api key indexes", func(mt *mtest.T, repository UserRepository) {
+		mt.AddMockResponses(mtest.CreateSuccessResponse())
+
+		if assert.NoError(t, repository.EnsureApiKeyIndexes()) {
+			command := mt.GetStartedEvent().Command
+			index := command.Lookup("indexes").Array().Index(0).Value().Document()
+
+			assert.Equal(t, API_KEY_COLLECTION, command.Lookup("createIndexes").StringValue())
+			assert.Equal(t, marshal(bson.D{{Key: "hash", Value: int32(1)}}), index.Lookup("key").Document())
+			assert.True(t, index.Lookup("unique").Boolean())
+		}
+	})
+}
@@ -0,0 +1,102 @@
+package user
+
+import (
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+	"github.com/ncardozo92/gapef_swimming_metrics/i18n"
+	"github.com/ncardozo92/gapef_swimming_metrics/logging"
+	"github.com/ncardozo92/gapef_swimming_metrics/search"
+)
+
+const (
+	DEFAULT_SEARCH_LIMIT = 10
+	MAX_SEARCH_LIMIT     = 50
+	// shorter queries match almost every name
+	MIN_SEARCH_LENGTH = 2
+	// users that match worse than this are not returned
+	MIN_SEARCH_SCORE = 0.4
+
+	DETAIL_SEARCH_TOO_SHORT     = "La búsqueda debe tener al menos 2 caracteres"
+	DETAIL_INVALID_SEARCH_LIMIT = "El límite debe ser un número entre 1 y 50"
+	MESSAGE_CANNOT_SEARCH_USERS = "No se pudo realizar la búsqueda"
+)
+
+// SearchUsers looks users up by partial or misspelled names, ignoring accents, and returns the best matches first
+func (handler UserHandler) SearchUsers(context echo.Context) error {
+	query := strings.TrimSpace(context.QueryParam("q"))
+	role := context.QueryParam("role")
+	limit := DEFAULT_SEARCH_LIMIT
+	details := []i18n.Message{}
+
+	if len([]rune(search.Normalize(query))) < MIN_SEARCH_LENGTH {
+		details = append(details, i18n.NewMessage(CODE_SEARCH_TOO_SHORT))
+	}
+
+	if role != "" && !isValidRole(role) {
+		details = append(details, i18n.NewMessage(CODE_INVALID_ROLE))
+	}
+
+	if rawLimit := context.QueryParam("limit"); rawLimit != "" {
+		parsedLimit, parsingErr := strconv.Atoi(rawLimit)
+
+		if parsingErr != nil || parsedLimit < 1 || parsedLimit > MAX_SEARCH_LIMIT {
+			details = append(details, i18n.NewMessage(CODE_INVALID_SEARCH_LIMIT))
+		} else {
+			limit = parsedLimit
+		}
+	}
+
+	if len(details) > 0 {
+		logging.LogErrorContext(context.Request().Context(), "invalid users search, %v", details)
+		return ErrValidation.WithDetails(details...)
+	}
+
+	candidates, searchErr := handler.userRepository.SearchUsers(context.Request().Context(), query, role)
+
+	if searchErr != nil {
+		logging.LogErrorContext(context.Request().Context(), "could not search users, %v", searchErr)
+		return repositoryError(searchErr, ErrCannotSearchUsers)
+	}
+
+	return context.JSON(http.StatusOK, rankSearchResults(query, candidates, limit))
+}
+
+// scores the candidates against the query and keeps the best ones
+func rankSearchResults(query string, candidates []Entity, limit int) []SearchResultDTO {
+	results := []SearchResultDTO{}
+
+	for _, candidate := range candidates {
+		score := search.Score(query, candidate.FirstName, candidate.LastName, candidate.Username)
+
+		if score < MIN_SEARCH_SCORE {
+			continue
+		}
+
+		results = append(results, SearchResultDTO{
+			Id:       candidate.Id,
+			Username: candidate.Username,
+			Name:     strings.TrimSpace(candidate.FirstName + " " + candidate.LastName),
+			Role:     candidate.Role,
+			Group:    candidate.Group,
+			Score:    math.Round(score*100) / 100,
+		})
+	}
+
+	sort.SliceStable(results, func(i, j int) bool {
+		if results[i].Score != results[j].Score {
+			return results[i].Score > results[j].Score
+		}
+		return search.Normalize(results[i].Name) < search.Normalize(results[j].Name)
+	})
+
+	if len(results) > limit {
+		results = results[:limit]
+	}
+
+	return results
+}
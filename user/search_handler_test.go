@@ -0,0 +1,82 @@
+package user
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/ncardozo92/gapef_swimming_metrics/constants"
+	"github.com/ncardozo92/gapef_swimming_metrics/mail"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSearchUsers(t *testing.T) {
+	controller := gomock.NewController(t)
+	mockUserRepository := NewMockRepository(controller)
+	handler := NewUserHandler(mockUserRepository, mail.NewMockSender(controller), nil)
+	defer controller.Finish()
+
+	candidates := []Entity{
+		{Id: "1", Username: "mgomez", FirstName: "Martín", LastName: "Gómez", Role: constants.ROLE_ATLETHE, Group: "A"},
+		{Id: "2", Username: "lgomes", FirstName: "Lucía", LastName: "Gomes", Role: constants.ROLE_ATLETHE},
+		{Id: "3", Username: "jrodriguez", FirstName: "Juan", LastName: "Rodríguez", Role: constants.ROLE_ATLETHE},
+	}
+
+	mockUserRepository.EXPECT().SearchUsers(gomock.Any(), "gomez", constants.ROLE_ATLETHE).Return(candidates, nil)
+
+	e := newEcho()
+	request := httptest.NewRequest(http.MethodGet, PATH_USERS_SEARCH+"?q=gomez&role="+constants.ROLE_ATLETHE, nil)
+	recorder := httptest.NewRecorder()
+
+	serve(handler.SearchUsers, e.NewContext(request, recorder))
+
+	results := []SearchResultDTO{}
+	json.Unmarshal(recorder.Body.Bytes(), &results)
+
+	assert.Equal(t, http.StatusOK, recorder.Code)
+
+	// the misspelled name goes after the exact one and the unrelated name is not returned
+	if assert.Len(t, results, 2) {
+		assert.Equal(t, SearchResultDTO{Id: "1", Username: "mgomez", Name: "Martín Gómez",
+			Role: constants.ROLE_ATLETHE, Group: "A", Score: 1}, results[0])
+		assert.Equal(t, "2", results[1].Id)
+		assert.Less(t, results[1].Score, results[0].Score)
+	}
+}
+
+func TestSearchUsersInvalidParams(t *testing.T) {
+	testCases := []string{"q=a", "q=%C3%A1%20", "q=gomez&limit=0", "q=gomez&limit=100", "q=gomez&role=KING"}
+
+	e := newEcho()
+
+	for _, testCase := range testCases {
+		controller := gomock.NewController(t)
+		handler := NewUserHandler(NewMockRepository(controller), mail.NewMockSender(controller), nil)
+
+		request := httptest.NewRequest(http.MethodGet, PATH_USERS_SEARCH+"?"+testCase, nil)
+		recorder := httptest.NewRecorder()
+
+		serve(handler.SearchUsers, e.NewContext(request, recorder))
+
+		assert.Equal(t, http.StatusBadRequest, recorder.Code, testCase)
+
+		controller.Finish()
+	}
+}
+
+func TestRankSearchResultsLimit(t *testing.T) {
+	candidates := []Entity{
+		{Id: "1", FirstName: "Ana", LastName: "Pérez"},
+		{Id: "2", FirstName: "Ana", LastName: "Álvarez"},
+		{Id: "3", FirstName: "Anabel", LastName: "Sosa"},
+	}
+
+	results := rankSearchResults("ana", candidates, 2)
+
+	// same score, sorted by name without accents
+	if assert.Len(t, results, 2) {
+		assert.Equal(t, []string{"Ana Álvarez", "Ana Pérez"}, []string{results[0].Name, results[1].Name})
+	}
+}
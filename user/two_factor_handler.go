@@ -0,0 +1,513 @@
+package user
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/labstack/echo/v4"
+	"github.com/ncardozo92/gapef_swimming_metrics/audit"
+	"github.com/ncardozo92/gapef_swimming_metrics/constants"
+	"github.com/ncardozo92/gapef_swimming_metrics/custom_error"
+	"github.com/ncardozo92/gapef_swimming_metrics/i18n"
+	"github.com/ncardozo92/gapef_swimming_metrics/logging"
+	"github.com/ncardozo92/gapef_swimming_metrics/totp"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+const (
+	MESSAGE_INVALID_2FA_CHALLENGE = "El desafío de autenticación en dos pasos no es válido o ha expirado"
+	MESSAGE_INVALID_2FA_CODE      = "El código de autenticación no es válido"
+	MESSAGE_2FA_ALREADY_ENABLED   = "La autenticación en dos pasos ya está habilitada"
+	MESSAGE_2FA_NOT_STARTED       = "Primero debe iniciarse la configuración de la autenticación en dos pasos"
+	MESSAGE_2FA_NOT_ENABLED       = "La autenticación en dos pasos no está habilitada"
+	MESSAGE_2FA_REQUIRED_BY_ROLE  = "La autenticación en dos pasos es obligatoria para el rol del usuario"
+	MESSAGE_2FA_ERROR             = "No se pudo configurar la autenticación en dos pasos"
+	MESSAGE_2FA_POLICY_ERROR      = "No se pudo recuperar la política de autenticación en dos pasos"
+
+	TWO_FACTOR_CHALLENGE_LIFETIME = 5 * time.Minute
+	RECOVERY_CODES_AMOUNT         = 10
+	RECOVERY_CODE_BYTES           = 5
+
+	// fingerprint of the second factor state of the user at the challenge, it changes when a code is accepted, so the
+	// challenge is used once
+	JWT_FIELD_TWO_FACTOR_FINGERPRINT = "tfa"
+)
+
+// LoginTwoFactor finishes the login of a user with two factor authentication, exchanging the challenge token and a
+// code of the authenticator app, or a recovery code, for the JWT
+func (handler UserHandler) LoginTwoFactor(context echo.Context) error {
+
+	audit.SetAction(context, AUDIT_LOGIN_2FA)
+
+	dto := TwoFactorLoginDTO{}
+
+	if bindingErr := context.Bind(&dto); bindingErr != nil || dto.ChallengeToken == "" || dto.Code == "" {
+		logging.LogErrorContext(context.Request().Context(), MESSAGE_BINDING_ERROR)
+		return ErrBinding
+	}
+
+	userId, fingerprint, challengeErr := parseTwoFactorChallenge(dto.ChallengeToken)
+
+	if challengeErr != nil {
+		logging.LogErrorContext(context.Request().Context(), "invalid two factor challenge, %v", challengeErr)
+		return ErrInvalidTwoFactorChallenge
+	}
+
+	user, findUserErr, _ := handler.userRepository.FindById(context.Request().Context(), userId)
+
+	if findUserErr != nil || !user.TotpEnabled {
+		logging.LogErrorContext(context.Request().Context(), "user of the two factor challenge cannot log in, %v", findUserErr)
+		return ErrInvalidTwoFactorChallenge
+	}
+
+	// a code was accepted since the challenge was issued, so it was already used
+	if subtle.ConstantTimeCompare([]byte(fingerprint), []byte(twoFactorFingerprint(user))) != 1 {
+		logging.LogWarningContext(context.Request().Context(), "two factor challenge of %s used again", user.Username)
+		return ErrInvalidTwoFactorChallenge
+	}
+
+	auditAuthenticated(context, user)
+
+	if blockedErr := handler.checkTwoFactorAttempts(context, user); blockedErr != nil {
+		return blockedErr
+	}
+
+	totpCodeUsed, totpErr := handler.useTotpCode(context, &user, dto.Code)
+
+	if totpErr != nil {
+		logging.LogErrorContext(context.Request().Context(), "could not use the two factor code, %v", totpErr)
+		return repositoryError(totpErr, ErrAuthentication)
+	}
+
+	if !totpCodeUsed {
+		recoveryCodeUsed, recoveryErr := handler.useRecoveryCode(context, &user, dto.Code)
+
+		if recoveryErr != nil {
+			logging.LogErrorContext(context.Request().Context(), "could not use recovery code, %v", recoveryErr)
+			return repositoryError(recoveryErr, ErrAuthentication)
+		}
+
+		if !recoveryCodeUsed {
+			logging.LogErrorContext(context.Request().Context(), "invalid two factor code for %s", user.Username)
+			handler.loginAttempts.RegisterFailure(twoFactorAttemptKeys(context, user)...)
+			return ErrTwoFactorLoginFailed
+		}
+
+		logging.LogWarningContext(context.Request().Context(), "User %s logged in with a recovery code, %d left",
+			user.Username, len(user.RecoveryCodes))
+	}
+
+	handler.loginAttempts.RegisterSuccess(LOGIN_KEY_USERNAME_PREFIX + user.Username)
+
+	return handler.issueLoginResponse(context, user)
+}
+
+// EnrollTwoFactor generates the secret of the authenticator app for the authenticated user, it is not enabled until
+// ConfirmTwoFactor receives a valid code
+func (handler UserHandler) EnrollTwoFactor(context echo.Context) error {
+
+	user, findAuthenticatedUserErr := handler.findAuthenticatedUser(context)
+
+	if findAuthenticatedUserErr != nil {
+		return findAuthenticatedUserErr
+	}
+
+	if user.TotpEnabled {
+		logging.LogWarningContext(context.Request().Context(), "User %s already has two factor authentication", user.Username)
+		return ErrTwoFactorAlreadyEnabled
+	}
+
+	secret, secretErr := totp.GenerateSecret()
+
+	if secretErr != nil {
+		logging.LogErrorContext(context.Request().Context(), "could not generate totp secret, %v", secretErr)
+		return ErrTwoFactor
+	}
+
+	previous := user
+	user.TotpSecret = secret
+
+	if updateErr := handler.userRepository.SetTotpSecret(context.Request().Context(), user.Id, secret); updateErr != nil {
+		logging.LogErrorContext(context.Request().Context(), "could not store totp secret, %v", updateErr)
+		return repositoryError(updateErr, ErrTwoFactor)
+	}
+
+	auditUserChange(context, previous, user)
+
+	return context.JSON(http.StatusOK, TwoFactorEnrollmentDTO{
+		Secret:          secret,
+		ProvisioningURI: totp.ProvisioningURI(ISSUER, user.Username, secret),
+	})
+}
+
+// ConfirmTwoFactor enables the second factor after checking a code of the authenticator app and returns the
+// recovery codes, which are shown only this time
+func (handler UserHandler) ConfirmTwoFactor(context echo.Context) error {
+
+	dto := TwoFactorCodeDTO{}
+
+	if bindingErr := context.Bind(&dto); bindingErr != nil || dto.Code == "" {
+		logging.LogErrorContext(context.Request().Context(), MESSAGE_BINDING_ERROR)
+		return ErrBinding
+	}
+
+	user, findAuthenticatedUserErr := handler.findAuthenticatedUser(context)
+
+	if findAuthenticatedUserErr != nil {
+		return findAuthenticatedUserErr
+	}
+
+	if user.TotpEnabled {
+		logging.LogWarningContext(context.Request().Context(), "User %s already has two factor authentication", user.Username)
+		return ErrTwoFactorAlreadyEnabled
+	}
+
+	if user.TotpSecret == "" {
+		logging.LogWarningContext(context.Request().Context(), "User %s has not started the two factor enrolment", user.Username)
+		return ErrTwoFactorNotStarted
+	}
+
+	if codeErr := handler.checkTwoFactorCode(context, &user, dto.Code); codeErr != nil {
+		return codeErr
+	}
+
+	recoveryCodes, hashedRecoveryCodes, recoveryErr := generateRecoveryCodes()
+
+	if recoveryErr != nil {
+		logging.LogErrorContext(context.Request().Context(), "could not generate recovery codes, %v", recoveryErr)
+		return ErrTwoFactor
+	}
+
+	previous := user
+	user.TotpEnabled = true
+	user.RecoveryCodes = hashedRecoveryCodes
+
+	if updateErr := handler.userRepository.EnableTwoFactor(context.Request().Context(), user.Id, hashedRecoveryCodes); updateErr != nil {
+		logging.LogErrorContext(context.Request().Context(), "could not enable two factor authentication, %v", updateErr)
+		return repositoryError(updateErr, ErrTwoFactor)
+	}
+
+	logging.LogInfoContext(context.Request().Context(), "User %s enabled two factor authentication", user.Username)
+	auditUserChange(context, previous, user)
+
+	return context.JSON(http.StatusOK, RecoveryCodesDTO{RecoveryCodes: recoveryCodes})
+}
+
+// DisableTwoFactor removes the second factor of the authenticated user, unless his role requires it
+func (handler UserHandler) DisableTwoFactor(context echo.Context) error {
+
+	dto := TwoFactorCodeDTO{}
+
+	if bindingErr := context.Bind(&dto); bindingErr != nil || dto.Code == "" {
+		logging.LogErrorContext(context.Request().Context(), MESSAGE_BINDING_ERROR)
+		return ErrBinding
+	}
+
+	user, findAuthenticatedUserErr := handler.findAuthenticatedUser(context)
+
+	if findAuthenticatedUserErr != nil {
+		return findAuthenticatedUserErr
+	}
+
+	if !user.TotpEnabled {
+		return ErrTwoFactorNotEnabled
+	}
+
+	requiredRoles, policyErr := handler.userRepository.GetTwoFactorRoles(context.Request().Context())
+
+	if policyErr != nil {
+		logging.LogErrorContext(context.Request().Context(), "could not read the two factor policy, %v", policyErr)
+		return repositoryError(policyErr, ErrTwoFactorPolicy)
+	}
+
+	if slices.Contains(requiredRoles, user.Role) {
+		logging.LogWarningContext(context.Request().Context(), "User %s cannot disable two factor authentication", user.Username)
+		return ErrTwoFactorRequiredByRole
+	}
+
+	if codeErr := handler.checkTwoFactorCode(context, &user, dto.Code); codeErr != nil {
+		return codeErr
+	}
+
+	previous := user
+	user.TotpEnabled = false
+	user.TotpSecret = ""
+	user.RecoveryCodes = nil
+
+	if updateErr := handler.userRepository.DisableTwoFactor(context.Request().Context(), user.Id); updateErr != nil {
+		logging.LogErrorContext(context.Request().Context(), "could not disable two factor authentication, %v", updateErr)
+		return repositoryError(updateErr, ErrTwoFactor)
+	}
+
+	logging.LogInfoContext(context.Request().Context(), "User %s disabled two factor authentication", user.Username)
+	auditUserChange(context, previous, user)
+
+	return context.NoContent(http.StatusNoContent)
+}
+
+// GetTwoFactorPolicy returns the roles that must use two factor authentication
+func (handler UserHandler) GetTwoFactorPolicy(context echo.Context) error {
+
+	roles, policyErr := handler.userRepository.GetTwoFactorRoles(context.Request().Context())
+
+	if policyErr != nil {
+		logging.LogErrorContext(context.Request().Context(), "could not read the two factor policy, %v", policyErr)
+		return repositoryError(policyErr, ErrTwoFactorPolicy)
+	}
+
+	return context.JSON(http.StatusOK, TwoFactorPolicyDTO{Roles: roles})
+}
+
+// SetTwoFactorPolicy changes the roles that must use two factor authentication, users of those roles without a second
+// factor will only be able to enrol one on their next login
+func (handler UserHandler) SetTwoFactorPolicy(context echo.Context) error {
+
+	dto := TwoFactorPolicyDTO{}
+
+	if bindingErr := context.Bind(&dto); bindingErr != nil || dto.Roles == nil {
+		logging.LogErrorContext(context.Request().Context(), MESSAGE_BINDING_ERROR)
+		return ErrBinding
+	}
+
+	for _, role := range dto.Roles {
+		if !isValidRole(role) {
+			logging.LogErrorContext(context.Request().Context(), "invalid role %s for the two factor policy", role)
+			return ErrValidation.WithFields(
+				custom_error.NewFieldError(FIELD_ROLES, i18n.NewMessage(CODE_INVALID_ROLE)))
+		}
+	}
+
+	if updateErr := handler.userRepository.SetTwoFactorRoles(context.Request().Context(), dto.Roles); updateErr != nil {
+		logging.LogErrorContext(context.Request().Context(), "could not store the two factor policy, %v", updateErr)
+		return repositoryError(updateErr, ErrTwoFactorPolicy)
+	}
+
+	logging.LogInfoContext(context.Request().Context(), "two factor authentication required for roles %v", dto.Roles)
+	audit.SetTarget(context, AUDIT_TARGET_SETTINGS, "two_factor_roles")
+	audit.SetChanges(context, nil, bson.M{"two_factor_roles": dto.Roles})
+
+	return context.JSON(http.StatusOK, dto)
+}
+
+// answers the login of a user with two factor authentication with a short lived challenge token
+func (handler UserHandler) startTwoFactorChallenge(context echo.Context, user Entity) error {
+
+	challengeToken, challengeErr := generateTwoFactorChallenge(user)
+
+	if challengeErr != nil {
+		logging.LogErrorContext(context.Request().Context(), "Cannot generate two factor challenge %v", challengeErr)
+		return ErrJwtNotCreated
+	}
+
+	return context.JSON(http.StatusOK, LoginDTO{EmailVerified: user.EmailVerified, TwoFactorRequired: true, ChallengeToken: challengeToken})
+}
+
+// the challenge can be exchanged for the JWT once, it stops being valid when any code of the user is accepted
+func generateTwoFactorChallenge(user Entity) (string, error) {
+	return signJWT(jwt.MapClaims{
+		JWT_FIELD_PURPOSE:                PURPOSE_2FA_CHALLENGE,
+		JWT_FIELD_TWO_FACTOR_FINGERPRINT: twoFactorFingerprint(user),
+		"iss":                            ISSUER,
+		"sub":                            user.Id,
+		"iat":                            time.Now().Unix(),
+		"exp":                            time.Now().Add(TWO_FACTOR_CHALLENGE_LIFETIME).Unix(),
+	})
+}
+
+// validates a two factor challenge and returns the id of the user and the fingerprint of his second factor
+func parseTwoFactorChallenge(tokenString string) (string, string, error) {
+	userId, tokenErr := parsePurposeJWT(tokenString, PURPOSE_2FA_CHALLENGE)
+
+	if tokenErr != nil {
+		return "", "", tokenErr
+	}
+
+	parsedToken, _ := parseJWT(tokenString)
+	claims, _ := parsedToken.Claims.(jwt.MapClaims)
+	fingerprint, _ := claims[JWT_FIELD_TWO_FACTOR_FINGERPRINT].(string)
+
+	if fingerprint == "" {
+		return "", "", errors.New("the two factor challenge has no fingerprint")
+	}
+
+	return userId, fingerprint, nil
+}
+
+// a short hash of the last time step and the recovery codes of the user, it changes every time a code is accepted
+func twoFactorFingerprint(user Entity) string {
+	hash := sha256.Sum256([]byte(fmt.Sprintf("%d:%s", user.TotpLastStep, strings.Join(user.RecoveryCodes, ","))))
+
+	return hex.EncodeToString(hash[:8])
+}
+
+// the wrong codes count as failed logins of the user and of the client, so the codes cannot be guessed
+func twoFactorAttemptKeys(context echo.Context, user Entity) []string {
+	return []string{LOGIN_KEY_USERNAME_PREFIX + user.Username, LOGIN_KEY_IP_PREFIX + context.RealIP()}
+}
+
+// returns the error answered when the user or the client failed too many codes
+func (handler UserHandler) checkTwoFactorAttempts(context echo.Context, user Entity) error {
+	wait := handler.loginAttempts.Blocked(twoFactorAttemptKeys(context, user)...)
+
+	if wait == 0 {
+		return nil
+	}
+
+	logging.LogWarningContext(context.Request().Context(), "two factor code blocked for %s from %s", user.Username,
+		context.RealIP())
+	context.Response().Header().Set(echo.HeaderRetryAfter, strconv.Itoa(int(wait.Seconds())+1))
+
+	return ErrTooManyLoginAttempts
+}
+
+// checks a code of the authenticator app sent by an authenticated user, counting the wrong ones like the login does
+func (handler UserHandler) checkTwoFactorCode(context echo.Context, user *Entity, code string) error {
+	if blockedErr := handler.checkTwoFactorAttempts(context, *user); blockedErr != nil {
+		return blockedErr
+	}
+
+	used, useErr := handler.useTotpCode(context, user, code)
+
+	if useErr != nil {
+		logging.LogErrorContext(context.Request().Context(), "could not use the two factor code, %v", useErr)
+		return repositoryError(useErr, ErrTwoFactor)
+	}
+
+	if !used {
+		logging.LogErrorContext(context.Request().Context(), "invalid two factor code for %s", user.Username)
+		handler.loginAttempts.RegisterFailure(twoFactorAttemptKeys(context, *user)...)
+		return ErrInvalidTwoFactorCode
+	}
+
+	handler.loginAttempts.RegisterSuccess(LOGIN_KEY_USERNAME_PREFIX + user.Username)
+
+	return nil
+}
+
+// consumes a code of the authenticator app, returning if it was used. A code of a time step that was already
+// accepted is refused, so a code cannot be replayed inside its validity window
+func (handler UserHandler) useTotpCode(context echo.Context, user *Entity, code string) (bool, error) {
+	step, valid := totp.Match(user.TotpSecret, code, time.Now())
+
+	if !valid || step <= user.TotpLastStep {
+		return false, nil
+	}
+
+	// the step is stored only if no other request stored it or a later one first
+	used, useErr := handler.userRepository.UseTotpStep(context.Request().Context(), user.Id, step)
+
+	if used {
+		user.TotpLastStep = step
+	}
+
+	return used, useErr
+}
+
+// checks if the user role requires a second factor the user has not enrolled yet
+func (handler UserHandler) mustEnrollTwoFactor(context echo.Context, user Entity) (bool, error) {
+	if user.TotpEnabled {
+		return false, nil
+	}
+
+	requiredRoles, policyErr := handler.userRepository.GetTwoFactorRoles(context.Request().Context())
+
+	if policyErr != nil {
+		return false, policyErr
+	}
+
+	return slices.Contains(requiredRoles, user.Role), nil
+}
+
+// finds the user of the JWT sent at the request, when it cannot be found it returns the status and body of the
+// error response
+func (handler UserHandler) findAuthenticatedUser(context echo.Context) (Entity, error) {
+
+	claims, claimsErr := getRequestClaims(context)
+
+	if claimsErr != nil {
+		logging.LogErrorContext(context.Request().Context(), "Could not read JWT claims, %v", claimsErr)
+		return Entity{}, ErrJwtNotPresent
+	}
+
+	userId, _ := claims[JWT_FIELD_ID].(string)
+
+	user, findUserErr, userNotFound := handler.userRepository.FindById(context.Request().Context(), userId)
+
+	if findUserErr != nil {
+		if userNotFound {
+			logging.LogErrorContext(context.Request().Context(), "User of the JWT not found")
+			return user, ErrUserNotFound
+		}
+		logging.LogErrorContext(context.Request().Context(), "could not retrieve user, %v", findUserErr)
+		return user, repositoryError(findUserErr, ErrCannotRetrieveUser)
+	}
+
+	return user, nil
+}
+
+// consumes the recovery code when it belongs to the user, returning if it was used
+func (handler UserHandler) useRecoveryCode(context echo.Context, user *Entity, code string) (bool, error) {
+	hashedCode := hashRecoveryCode(code)
+
+	for index, storedCode := range user.RecoveryCodes {
+		if subtle.ConstantTimeCompare([]byte(storedCode), []byte(hashedCode)) == 1 {
+			// the code is removed only if it is still stored, a concurrent login could have used it
+			used, useErr := handler.userRepository.UseRecoveryCode(context.Request().Context(), user.Id, hashedCode)
+
+			if used {
+				user.RecoveryCodes = slices.Delete(user.RecoveryCodes, index, index+1)
+			}
+
+			return used, useErr
+		}
+	}
+
+	return false, nil
+}
+
+// generates the recovery codes, returning them and the hashes to store
+func generateRecoveryCodes() ([]string, []string, error) {
+	codes := []string{}
+	hashedCodes := []string{}
+
+	for len(codes) < RECOVERY_CODES_AMOUNT {
+		randomBytes := make([]byte, RECOVERY_CODE_BYTES)
+
+		if _, randomErr := rand.Read(randomBytes); randomErr != nil {
+			return nil, nil, randomErr
+		}
+
+		encoded := strings.ToUpper(hex.EncodeToString(randomBytes))
+		code := fmt.Sprintf("%s-%s", encoded[:5], encoded[5:])
+
+		codes = append(codes, code)
+		hashedCodes = append(hashedCodes, hashRecoveryCode(code))
+	}
+
+	return codes, hashedCodes, nil
+}
+
+// recovery codes are random, so a fast hash is enough to store them. The code is normalized so the user can type it
+// without the dash or in lower case
+func hashRecoveryCode(code string) string {
+	normalizedCode := strings.ToUpper(strings.ReplaceAll(strings.TrimSpace(code), "-", ""))
+	hash := sha256.Sum256([]byte(normalizedCode))
+
+	return hex.EncodeToString(hash[:])
+}
+
+// checks that the role is one of the known roles
+func isValidRole(role string) bool {
+	return role == constants.ROLE_ADMIN || role == constants.ROLE_ATLETHE || role == constants.ROLE_COACH ||
+		role == constants.ROLE_PARENT
+}
@@ -0,0 +1,338 @@
+package user
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/labstack/echo/v4"
+	"github.com/ncardozo92/gapef_swimming_metrics/constants"
+	"github.com/ncardozo92/gapef_swimming_metrics/custom_error"
+	"github.com/ncardozo92/gapef_swimming_metrics/mail"
+	"github.com/ncardozo92/gapef_swimming_metrics/totp"
+	"github.com/stretchr/testify/assert"
+)
+
+// password of the hash is "ncardozo"
+const testPasswordHash = "$2a$12$8HKZFQTtifYRXmiguKAO2OPp3IxtsnZPEV7f7MnQdl5uzCJwsttci"
+
+func TestLoginWithTwoFactorReturnsChallenge(t *testing.T) {
+	controller := gomock.NewController(t)
+	mockUserRepository := NewMockRepository(controller)
+	handler := NewUserHandler(mockUserRepository, mail.NewMockSender(controller), nil)
+	defer controller.Finish()
+
+	foundUser := Entity{Id: "1", Username: "ncardozo", Password: testPasswordHash, Role: constants.ROLE_COACH,
+		EmailVerified: true, TotpEnabled: true, TotpSecret: "JBSWY3DPEHPK3PXP"}
+
+	mockUserRepository.EXPECT().FindByUsername(gomock.Any(), "ncardozo").Return(foundUser, nil, false)
+
+	e := newEcho()
+	request := httptest.NewRequest(http.MethodPost, "/login", strings.NewReader(requestBody))
+	request.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	recorder := httptest.NewRecorder()
+	context := e.NewContext(request, recorder)
+
+	serve(handler.Login, context)
+
+	response := LoginDTO{}
+	json.Unmarshal(recorder.Body.Bytes(), &response)
+
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	assert.True(t, response.TwoFactorRequired)
+	assert.Empty(t, response.Token)
+
+	// the challenge cannot be used as an authentication token
+	assert.Error(t, validateJWT(response.ChallengeToken))
+}
+
+func TestLoginTwoFactor(t *testing.T) {
+	secret, _ := totp.GenerateSecret()
+	validCode, _ := totp.Code(secret, time.Now())
+	recoveryCodes, hashedRecoveryCodes, _ := generateRecoveryCodes()
+	challengeToken, _ := generateTwoFactorChallenge(Entity{Id: "1", RecoveryCodes: hashedRecoveryCodes})
+
+	testCases := []struct {
+		code           string
+		expectedStatus int
+	}{
+		{validCode, http.StatusOK},
+		{strings.ToLower(recoveryCodes[0]), http.StatusOK},
+		{"000000", http.StatusUnauthorized},
+	}
+
+	e := newEcho()
+
+	for _, testCase := range testCases {
+		controller := gomock.NewController(t)
+		mockUserRepository := NewMockRepository(controller)
+		handler := NewUserHandler(mockUserRepository, mail.NewMockSender(controller), nil)
+
+		foundUser := Entity{Id: "1", Username: "ncardozo", Role: constants.ROLE_COACH, EmailVerified: true,
+			TotpEnabled: true, TotpSecret: secret, RecoveryCodes: append([]string{}, hashedRecoveryCodes...)}
+
+		mockUserRepository.EXPECT().FindById(gomock.Any(), "1").Return(foundUser, nil, false)
+		mockUserRepository.EXPECT().GetTwoFactorRoles(gomock.Any()).Return([]string{constants.ROLE_COACH}, nil).AnyTimes()
+
+		// a used recovery code is removed and the step of a used code is stored
+		mockUserRepository.EXPECT().UseRecoveryCode(gomock.Any(), "1", hashRecoveryCode(recoveryCodes[0])).Return(true, nil).MaxTimes(1)
+		mockUserRepository.EXPECT().UseTotpStep(gomock.Any(), "1", totp.Step(time.Now())).Return(true, nil).MaxTimes(1)
+
+		requestBody, _ := json.Marshal(TwoFactorLoginDTO{ChallengeToken: challengeToken, Code: testCase.code})
+		request := httptest.NewRequest(http.MethodPost, "/login/2fa", strings.NewReader(string(requestBody)))
+		request.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		recorder := httptest.NewRecorder()
+		context := e.NewContext(request, recorder)
+
+		serve(handler.LoginTwoFactor, context)
+		assert.Equal(t, testCase.expectedStatus, recorder.Code, testCase.code)
+
+		if testCase.expectedStatus == http.StatusOK {
+			response := LoginDTO{}
+			json.Unmarshal(recorder.Body.Bytes(), &response)
+			assert.NoError(t, validateJWT(response.Token))
+		}
+
+		controller.Finish()
+	}
+}
+
+func TestRecoveryCodeUsedByAnotherLoginFails(t *testing.T) {
+	controller := gomock.NewController(t)
+	mockUserRepository := NewMockRepository(controller)
+	handler := NewUserHandler(mockUserRepository, mail.NewMockSender(controller), nil)
+	defer controller.Finish()
+
+	secret, _ := totp.GenerateSecret()
+	recoveryCodes, hashedRecoveryCodes, _ := generateRecoveryCodes()
+	challengeToken, _ := generateTwoFactorChallenge(Entity{Id: "1", RecoveryCodes: hashedRecoveryCodes})
+
+	mockUserRepository.EXPECT().FindById(gomock.Any(), "1").Return(Entity{Id: "1", Username: "ncardozo", EmailVerified: true,
+		TotpEnabled: true, TotpSecret: secret, RecoveryCodes: hashedRecoveryCodes}, nil, false)
+	// the code was still at the read user, but it is no longer stored
+	mockUserRepository.EXPECT().UseRecoveryCode(gomock.Any(), "1", hashRecoveryCode(recoveryCodes[0])).Return(false, nil)
+
+	e := newEcho()
+	requestBody, _ := json.Marshal(TwoFactorLoginDTO{ChallengeToken: challengeToken, Code: recoveryCodes[0]})
+	request := httptest.NewRequest(http.MethodPost, "/login/2fa", strings.NewReader(string(requestBody)))
+	request.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	recorder := httptest.NewRecorder()
+
+	serve(handler.LoginTwoFactor, e.NewContext(request, recorder))
+	assert.Equal(t, http.StatusUnauthorized, recorder.Code)
+}
+
+// sends the code with the challenge to the two factor login
+func loginTwoFactor(handler *UserHandler, challengeToken, code string) *httptest.ResponseRecorder {
+	requestBody, _ := json.Marshal(TwoFactorLoginDTO{ChallengeToken: challengeToken, Code: code})
+	request := httptest.NewRequest(http.MethodPost, "/login/2fa", strings.NewReader(string(requestBody)))
+	request.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	recorder := httptest.NewRecorder()
+
+	serve(handler.LoginTwoFactor, newEcho().NewContext(request, recorder))
+
+	return recorder
+}
+
+func TestTwoFactorCodeCannotBeReplayed(t *testing.T) {
+	controller := gomock.NewController(t)
+	mockUserRepository := NewMockRepository(controller)
+	handler := NewUserHandler(mockUserRepository, mail.NewMockSender(controller), nil)
+	defer controller.Finish()
+
+	secret, _ := totp.GenerateSecret()
+	validCode, _ := totp.Code(secret, time.Now())
+	step := totp.Step(time.Now())
+
+	// the code of the step was already accepted
+	usedUser := Entity{Id: "1", Username: "ncardozo", TotpEnabled: true, TotpSecret: secret, TotpLastStep: step}
+	challengeToken, _ := generateTwoFactorChallenge(usedUser)
+
+	mockUserRepository.EXPECT().FindById(gomock.Any(), "1").Return(usedUser, nil, false)
+	mockUserRepository.EXPECT().UseTotpStep(gomock.Any(), gomock.Any(), gomock.Any()).Times(0)
+
+	assert.Equal(t, http.StatusUnauthorized, loginTwoFactor(handler, challengeToken, validCode).Code)
+
+	// a concurrent login stored the step first
+	user := Entity{Id: "1", Username: "ncardozo", TotpEnabled: true, TotpSecret: secret}
+	challengeToken, _ = generateTwoFactorChallenge(user)
+
+	mockUserRepository.EXPECT().FindById(gomock.Any(), "1").Return(user, nil, false)
+	mockUserRepository.EXPECT().UseTotpStep(gomock.Any(), "1", step).Return(false, nil)
+
+	assert.Equal(t, http.StatusUnauthorized, loginTwoFactor(handler, challengeToken, validCode).Code)
+}
+
+func TestTwoFactorChallengeIsSingleUse(t *testing.T) {
+	controller := gomock.NewController(t)
+	mockUserRepository := NewMockRepository(controller)
+	handler := NewUserHandler(mockUserRepository, mail.NewMockSender(controller), nil)
+	defer controller.Finish()
+
+	secret, _ := totp.GenerateSecret()
+	user := Entity{Id: "1", Username: "ncardozo", TotpEnabled: true, TotpSecret: secret}
+	challengeToken, _ := generateTwoFactorChallenge(user)
+
+	// the challenge was exchanged with a code of an earlier step
+	user.TotpLastStep = totp.Step(time.Now()) - 1
+	mockUserRepository.EXPECT().FindById(gomock.Any(), "1").Return(user, nil, false)
+	mockUserRepository.EXPECT().UseTotpStep(gomock.Any(), gomock.Any(), gomock.Any()).Times(0)
+
+	validCode, _ := totp.Code(secret, time.Now())
+	recorder := loginTwoFactor(handler, challengeToken, validCode)
+
+	response := custom_error.DTO{}
+	json.Unmarshal(recorder.Body.Bytes(), &response)
+	assert.Equal(t, ErrInvalidTwoFactorChallenge.Code, response.Code)
+}
+
+// a stolen session cannot guess the code that disables the second factor
+func TestDisableTwoFactorWrongCodesAreLimited(t *testing.T) {
+	controller := gomock.NewController(t)
+	mockUserRepository := NewMockRepository(controller)
+	handler := NewUserHandler(mockUserRepository, mail.NewMockSender(controller), nil)
+	defer controller.Finish()
+
+	secret, _ := totp.GenerateSecret()
+	user := Entity{Id: "1", Username: "ncardozo", Role: constants.ROLE_COACH, EmailVerified: true, TotpEnabled: true,
+		TotpSecret: secret}
+	token, _ := generateJWT(user)
+
+	mockUserRepository.EXPECT().FindById(gomock.Any(), "1").Return(user, nil, false).AnyTimes()
+	mockUserRepository.EXPECT().GetTwoFactorRoles(gomock.Any()).Return([]string{}, nil).AnyTimes()
+	mockUserRepository.EXPECT().DisableTwoFactor(gomock.Any(), gomock.Any()).Times(0)
+
+	e := newEcho()
+	statuses := []int{}
+
+	for attempt := 0; attempt <= LOGIN_FREE_ATTEMPTS+1; attempt++ {
+		request := httptest.NewRequest(http.MethodDelete, PATH_2FA, strings.NewReader(`{"code": "000000"}`))
+		request.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		request.Header.Set(AUTHORIZATION_HEADER, BEARER_PREFIX+token)
+		recorder := httptest.NewRecorder()
+
+		serve(handler.DisableTwoFactor, e.NewContext(request, recorder))
+		statuses = append(statuses, recorder.Code)
+	}
+
+	assert.Equal(t, ErrInvalidTwoFactorCode.Status, statuses[0])
+	assert.Equal(t, http.StatusTooManyRequests, statuses[len(statuses)-1])
+}
+
+func TestLoginRequiresEnrollmentByPolicy(t *testing.T) {
+	controller := gomock.NewController(t)
+	mockUserRepository := NewMockRepository(controller)
+	handler := NewUserHandler(mockUserRepository, mail.NewMockSender(controller), nil)
+	defer controller.Finish()
+
+	foundUser := Entity{Id: "1", Username: "ncardozo", Password: testPasswordHash, Role: constants.ROLE_ADMIN, EmailVerified: true}
+
+	mockUserRepository.EXPECT().FindByUsername(gomock.Any(), "ncardozo").Return(foundUser, nil, false)
+	mockUserRepository.EXPECT().GetTwoFactorRoles(gomock.Any()).Return([]string{constants.ROLE_ADMIN}, nil)
+
+	e := newEcho()
+	e.Use(CustomJwtMiddleware)
+	e.GET(PATH_USERS, func(c echo.Context) error { return c.NoContent(http.StatusOK) })
+	e.POST(PATH_2FA, func(c echo.Context) error { return c.NoContent(http.StatusOK) })
+
+	request := httptest.NewRequest(http.MethodPost, "/login", strings.NewReader(requestBody))
+	request.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	recorder := httptest.NewRecorder()
+
+	serve(handler.Login, e.NewContext(request, recorder))
+
+	response := LoginDTO{}
+	json.Unmarshal(recorder.Body.Bytes(), &response)
+	assert.True(t, response.TwoFactorEnrollmentRequired)
+
+	// the token only allows enrolling the second factor
+	pathsStatuses := map[string]int{
+		http.MethodGet + " " + PATH_USERS: http.StatusForbidden,
+		http.MethodPost + " " + PATH_2FA:  http.StatusOK,
+	}
+
+	for methodAndPath, expectedStatus := range pathsStatuses {
+		methodPath := strings.Split(methodAndPath, " ")
+		request := httptest.NewRequest(methodPath[0], methodPath[1], strings.NewReader(""))
+		request.Header.Set(AUTHORIZATION_HEADER, BEARER_PREFIX+response.Token)
+		recorder := httptest.NewRecorder()
+
+		e.ServeHTTP(recorder, request)
+
+		assert.Equal(t, expectedStatus, recorder.Code, methodAndPath)
+	}
+}
+
+func TestEnrollAndConfirmTwoFactor(t *testing.T) {
+	controller := gomock.NewController(t)
+	mockUserRepository := NewMockRepository(controller)
+	handler := NewUserHandler(mockUserRepository, mail.NewMockSender(controller), nil)
+	defer controller.Finish()
+
+	user := Entity{Id: "1", Username: "ncardozo", Role: constants.ROLE_COACH, EmailVerified: true}
+	token, _ := generateJWT(user)
+
+	e := newEcho()
+
+	// enrolment stores the secret without enabling it
+	mockUserRepository.EXPECT().FindById(gomock.Any(), "1").Return(user, nil, false)
+	mockUserRepository.EXPECT().SetTotpSecret(gomock.Any(), "1", gomock.Any()).DoAndReturn(func(_ context.Context, id, secret string) error {
+		user.TotpSecret = secret
+		return nil
+	})
+
+	request := httptest.NewRequest(http.MethodPost, "/users/me/2fa", strings.NewReader(""))
+	request.Header.Set(AUTHORIZATION_HEADER, BEARER_PREFIX+token)
+	recorder := httptest.NewRecorder()
+
+	serve(handler.EnrollTwoFactor, e.NewContext(request, recorder))
+	assert.Equal(t, http.StatusOK, recorder.Code)
+
+	enrollment := TwoFactorEnrollmentDTO{}
+	json.Unmarshal(recorder.Body.Bytes(), &enrollment)
+	assert.Equal(t, user.TotpSecret, enrollment.Secret)
+	assert.Contains(t, enrollment.ProvisioningURI, "otpauth://totp/")
+
+	// the confirmation enables it and returns the recovery codes
+	mockUserRepository.EXPECT().FindById(gomock.Any(), "1").DoAndReturn(func(_ context.Context, id string) (Entity, error, bool) { return user, nil, false })
+	mockUserRepository.EXPECT().UseTotpStep(gomock.Any(), "1", totp.Step(time.Now())).Return(true, nil)
+	mockUserRepository.EXPECT().EnableTwoFactor(gomock.Any(), "1", gomock.Any()).DoAndReturn(func(_ context.Context, id string, hashedRecoveryCodes []string) error {
+		assert.Len(t, hashedRecoveryCodes, RECOVERY_CODES_AMOUNT)
+		return nil
+	})
+
+	code, _ := totp.Code(enrollment.Secret, time.Now())
+	request = httptest.NewRequest(http.MethodPost, "/users/me/2fa/confirm", strings.NewReader(`{"code": "`+code+`"}`))
+	request.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	request.Header.Set(AUTHORIZATION_HEADER, BEARER_PREFIX+token)
+	recorder = httptest.NewRecorder()
+
+	serve(handler.ConfirmTwoFactor, e.NewContext(request, recorder))
+	assert.Equal(t, http.StatusOK, recorder.Code)
+
+	recoveryCodes := RecoveryCodesDTO{}
+	json.Unmarshal(recorder.Body.Bytes(), &recoveryCodes)
+	assert.Len(t, recoveryCodes.RecoveryCodes, RECOVERY_CODES_AMOUNT)
+}
+
+func TestSetTwoFactorPolicyInvalidRoleFails(t *testing.T) {
+	controller := gomock.NewController(t)
+	mockUserRepository := NewMockRepository(controller)
+	handler := NewUserHandler(mockUserRepository, mail.NewMockSender(controller), nil)
+	defer controller.Finish()
+
+	mockUserRepository.EXPECT().SetTwoFactorRoles(gomock.Any(), gomock.Any()).Times(0)
+
+	e := newEcho()
+	request := httptest.NewRequest(http.MethodPut, "/security/2fa-policy", strings.NewReader(`{"roles": ["COACH", "TRAINER"]}`))
+	request.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	recorder := httptest.NewRecorder()
+
+	serve(handler.SetTwoFactorPolicy, e.NewContext(request, recorder))
+	assert.Equal(t, http.StatusBadRequest, recorder.Code)
+}
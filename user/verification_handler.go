@@ -0,0 +1,213 @@
+package user
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/ncardozo92/gapef_swimming_metrics/audit"
+	"github.com/ncardozo92/gapef_swimming_metrics/i18n"
+	"github.com/ncardozo92/gapef_swimming_metrics/logging"
+)
+
+const (
+	MESSAGE_INVALID_VERIFICATION     = "El enlace de verificación no es válido o ha expirado"
+	MESSAGE_EMAIL_VERIFIED           = "El email fue verificado"
+	MESSAGE_EMAIL_NOT_VERIFIED       = "No se pudo verificar el email"
+	MESSAGE_TOO_MANY_RESENDS         = "Se solicitaron demasiados enlaces de verificación, intente más tarde"
+	SUBJECT_EMAIL_VERIFICATION       = "GAPEF - Verificá tu email"
+	BODY_EMAIL_VERIFICATION          = "Hola %s, para verificar tu email ingresá al siguiente enlace: %s"
+	EMAIL_VERIFICATION_LINK_LIFETIME = 24 * time.Hour
+
+	// an address can request a new verification link RESEND_MAX_PER_WINDOW times every RESEND_WINDOW,
+	// with at least RESEND_MIN_INTERVAL between two requests
+	RESEND_WINDOW         = time.Hour
+	RESEND_MAX_PER_WINDOW = 3
+	RESEND_MIN_INTERVAL   = time.Minute
+	// the limiters forget the addresses without recent requests, checking them at most this often
+	EMAIL_LIMITER_SWEEP_INTERVAL = time.Minute
+)
+
+type ResendVerificationDTO struct {
+	Email string `json:"email"`
+}
+
+// VerifyEmail marks the email of the user as verified using the token sent by email
+func (handler UserHandler) VerifyEmail(context echo.Context) error {
+
+	audit.SetAction(context, AUDIT_VERIFY_EMAIL)
+
+	userId, tokenErr := parsePurposeJWT(context.QueryParam("token"), PURPOSE_EMAIL_VERIFICATION)
+
+	if tokenErr != nil {
+		logging.LogErrorContext(context.Request().Context(), "invalid verification token, %v", tokenErr)
+		return ErrInvalidVerification
+	}
+
+	user, findUserErr, userNotFound := handler.userRepository.FindById(context.Request().Context(), userId)
+
+	if findUserErr != nil {
+		if userNotFound {
+			logging.LogErrorContext(context.Request().Context(), "User to verify not found")
+			return ErrInvalidVerification
+		}
+		logging.LogErrorContext(context.Request().Context(), "could not retrieve user, %v", findUserErr)
+		return repositoryError(findUserErr, ErrEmailNotVerified)
+	}
+
+	// following the link twice keeps the first verification date
+	if !user.EmailVerified {
+		previous := user
+		verifiedAt := time.Now().UTC()
+		user.EmailVerified = true
+		user.EmailVerifiedAt = &verifiedAt
+
+		if updateErr := handler.userRepository.VerifyEmail(context.Request().Context(), user.Id, verifiedAt); updateErr != nil {
+			logging.LogErrorContext(context.Request().Context(), "could not update user, %v", updateErr)
+			return repositoryError(updateErr, ErrEmailNotVerified)
+		}
+
+		auditAuthenticated(context, user)
+		auditUserChange(context, previous, user)
+	}
+
+	language := i18n.FromContext(context.Request().Context())
+
+	return context.String(http.StatusOK, i18n.NewMessage(CODE_EMAIL_VERIFIED).Text(language))
+}
+
+// ResendVerification sends a new verification link. The response is the same whether the address exists or not,
+// so the endpoint cannot be used to find out which emails have an account
+func (handler UserHandler) ResendVerification(context echo.Context) error {
+
+	dto := ResendVerificationDTO{}
+
+	if bindingErr := context.Bind(&dto); bindingErr != nil || dto.Email == "" {
+		logging.LogErrorContext(context.Request().Context(), MESSAGE_BINDING_ERROR)
+		return ErrBinding
+	}
+
+	dto.Email = normalizeIdentity(dto.Email)
+
+	if allowed, retryAfter := handler.resendLimiter.Allow(dto.Email); !allowed {
+		logging.LogWarningContext(context.Request().Context(), "too many verification links requested for %s", dto.Email)
+		context.Response().Header().Set(echo.HeaderRetryAfter, strconv.Itoa(int(retryAfter.Seconds())+1))
+		return ErrTooManyResends
+	}
+
+	user, findUserErr, userNotFound := handler.userRepository.FindByEmail(context.Request().Context(), dto.Email)
+
+	if findUserErr != nil && !userNotFound {
+		logging.LogErrorContext(context.Request().Context(), "could not retrieve user, %v", findUserErr)
+		return repositoryError(findUserErr, ErrEmailNotVerified)
+	}
+
+	if findUserErr == nil && !user.EmailVerified {
+		handler.sendVerificationEmail(context.Request().Context(), user)
+	}
+
+	return context.NoContent(http.StatusAccepted)
+}
+
+// sends the signed link the user must follow to verify his email
+func (handler UserHandler) sendVerificationEmail(ctx context.Context, user Entity) {
+
+	link, linkErr := verificationLink(user)
+
+	if linkErr != nil {
+		logging.LogErrorContext(ctx, "could not generate verification token, %v", linkErr)
+		return
+	}
+
+	handler.sendEmail(ctx, user, EMAIL_VERIFICATION, user.Username, link)
+}
+
+// the signed link that verifies the email of the user
+func verificationLink(user Entity) (string, error) {
+
+	token, tokenErr := generatePurposeJWT(user.Id, PURPOSE_EMAIL_VERIFICATION, jwtConfig.EmailVerificationLifetime)
+
+	if tokenErr != nil {
+		return "", tokenErr
+	}
+
+	return fmt.Sprintf("%s%s?token=%s", appBaseUrl, PATH_VERIFY_EMAIL, url.QueryEscape(token)), nil
+}
+
+// emailRateLimiter limits how many times an action can be requested for the same email address
+type emailRateLimiter struct {
+	mutex       sync.Mutex
+	window      time.Duration
+	maxRequests int
+	minInterval time.Duration
+	requests    map[string][]time.Time
+	lastSweep   time.Time
+	now         func() time.Time
+}
+
+func newEmailRateLimiter(window time.Duration, maxRequests int, minInterval time.Duration) *emailRateLimiter {
+	return &emailRateLimiter{
+		window:      window,
+		maxRequests: maxRequests,
+		minInterval: minInterval,
+		requests:    map[string][]time.Time{},
+		lastSweep:   time.Now(),
+		now:         time.Now,
+	}
+}
+
+// Allow registers a request for the address when it is allowed, otherwise it returns how long the caller must wait
+func (limiter *emailRateLimiter) Allow(email string) (bool, time.Duration) {
+	limiter.mutex.Lock()
+	defer limiter.mutex.Unlock()
+
+	now := limiter.now()
+	limiter.sweep(now)
+
+	key := strings.ToLower(strings.TrimSpace(email))
+
+	// only the requests inside the window are kept
+	recentRequests := []time.Time{}
+	for _, requestTime := range limiter.requests[key] {
+		if now.Sub(requestTime) < limiter.window {
+			recentRequests = append(recentRequests, requestTime)
+		}
+	}
+
+	if len(recentRequests) > 0 {
+		if sinceLast := now.Sub(recentRequests[len(recentRequests)-1]); sinceLast < limiter.minInterval {
+			limiter.requests[key] = recentRequests
+			return false, limiter.minInterval - sinceLast
+		}
+	}
+
+	if len(recentRequests) >= limiter.maxRequests {
+		limiter.requests[key] = recentRequests
+		return false, limiter.window - now.Sub(recentRequests[0])
+	}
+
+	limiter.requests[key] = append(recentRequests, now)
+
+	return true, 0
+}
+
+// forgets the addresses whose requests are all outside the window
+func (limiter *emailRateLimiter) sweep(now time.Time) {
+	if now.Sub(limiter.lastSweep) < EMAIL_LIMITER_SWEEP_INTERVAL {
+		return
+	}
+
+	for key, requestTimes := range limiter.requests {
+		if now.Sub(requestTimes[len(requestTimes)-1]) >= limiter.window {
+			delete(limiter.requests, key)
+		}
+	}
+
+	limiter.lastSweep = now
+}
@@ -0,0 +1,171 @@
+package user
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/labstack/echo/v4"
+	"github.com/ncardozo92/gapef_swimming_metrics/constants"
+	"github.com/ncardozo92/gapef_swimming_metrics/mail"
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+func TestVerifyEmailSuccess(t *testing.T) {
+	controller := gomock.NewController(t)
+	mockUserRepository := NewMockRepository(controller)
+	handler := NewUserHandler(mockUserRepository, mail.NewMockSender(controller), nil)
+	defer controller.Finish()
+
+	e := newEcho()
+
+	token, _ := generatePurposeJWT("1", PURPOSE_EMAIL_VERIFICATION, time.Minute)
+
+	mockUserRepository.EXPECT().FindById(gomock.Any(), "1").Return(Entity{Id: "1", Status: constants.STATUS_PENDING}, nil, false)
+	mockUserRepository.EXPECT().VerifyEmail(gomock.Any(), "1", gomock.Any()).Return(nil)
+
+	request := httptest.NewRequest(http.MethodGet, "/verify-email?token="+token, strings.NewReader(""))
+	recorder := httptest.NewRecorder()
+	context := e.NewContext(request, recorder)
+
+	serve(handler.VerifyEmail, context)
+	assert.Equal(t, http.StatusOK, recorder.Code)
+}
+
+func TestVerifyEmailInvalidTokenFails(t *testing.T) {
+	controller := gomock.NewController(t)
+	mockUserRepository := NewMockRepository(controller)
+	handler := NewUserHandler(mockUserRepository, mail.NewMockSender(controller), nil)
+	defer controller.Finish()
+
+	e := newEcho()
+
+	// an authentication token cannot be used as verification token
+	authenticationToken, _ := generateJWT(Entity{Id: "1", Username: "swimmer", Role: constants.ROLE_ATLETHE})
+	expiredToken, _ := generatePurposeJWT("1", PURPOSE_EMAIL_VERIFICATION, -time.Minute)
+
+	mockUserRepository.EXPECT().FindById(gomock.Any(), gomock.Any()).Times(0)
+
+	for _, token := range []string{"", authenticationToken, expiredToken} {
+		request := httptest.NewRequest(http.MethodGet, "/verify-email?token="+token, strings.NewReader(""))
+		recorder := httptest.NewRecorder()
+		context := e.NewContext(request, recorder)
+
+		serve(handler.VerifyEmail, context)
+		assert.Equal(t, http.StatusBadRequest, recorder.Code)
+	}
+}
+
+func TestResendVerificationIsRateLimited(t *testing.T) {
+	controller := gomock.NewController(t)
+	mockUserRepository := NewMockRepository(controller)
+	mockMailSender := mail.NewMockSender(controller)
+	handler := NewUserHandler(mockUserRepository, mockMailSender, nil)
+	defer controller.Finish()
+
+	e := newEcho()
+
+	mockUserRepository.EXPECT().FindByEmail(gomock.Any(), "swimmer@gapef.com.ar").Return(Entity{Id: "1", Email: "swimmer@gapef.com.ar"}, nil, false).Times(1)
+	mockMailSender.EXPECT().Send("swimmer@gapef.com.ar", SUBJECT_EMAIL_VERIFICATION, gomock.Any()).Return(nil).Times(1)
+
+	expectedStatuses := []int{http.StatusAccepted, http.StatusTooManyRequests}
+
+	for _, expectedStatus := range expectedStatuses {
+		request := httptest.NewRequest(http.MethodPost, "/verify-email/resend", strings.NewReader(`{"email": "swimmer@gapef.com.ar"}`))
+		request.Header.Set("Content-Type", "application/json")
+
+		recorder := httptest.NewRecorder()
+		context := e.NewContext(request, recorder)
+
+		serve(handler.ResendVerification, context)
+		assert.Equal(t, expectedStatus, recorder.Code)
+	}
+}
+
+func TestResendVerificationUnknownEmail(t *testing.T) {
+	controller := gomock.NewController(t)
+	mockUserRepository := NewMockRepository(controller)
+	mockMailSender := mail.NewMockSender(controller)
+	handler := NewUserHandler(mockUserRepository, mockMailSender, nil)
+	defer controller.Finish()
+
+	e := newEcho()
+
+	mockUserRepository.EXPECT().FindByEmail(gomock.Any(), "nobody@gapef.com.ar").Return(Entity{}, mongo.ErrNoDocuments, true)
+	mockMailSender.EXPECT().Send(gomock.Any(), gomock.Any(), gomock.Any()).Times(0)
+
+	request := httptest.NewRequest(http.MethodPost, "/verify-email/resend", strings.NewReader(`{"email": "nobody@gapef.com.ar"}`))
+	request.Header.Set("Content-Type", "application/json")
+
+	recorder := httptest.NewRecorder()
+	context := e.NewContext(request, recorder)
+
+	// the response does not reveal that the email has no account
+	serve(handler.ResendVerification, context)
+	assert.Equal(t, http.StatusAccepted, recorder.Code)
+}
+
+func TestEmailRateLimiter(t *testing.T) {
+	limiter := newEmailRateLimiter(time.Hour, 2, 0)
+
+	allowed, _ := limiter.Allow("swimmer@gapef.com.ar")
+	assert.True(t, allowed)
+
+	// addresses are compared ignoring case
+	allowed, _ = limiter.Allow("Swimmer@gapef.com.ar")
+	assert.True(t, allowed)
+
+	allowed, retryAfter := limiter.Allow("swimmer@gapef.com.ar")
+	assert.False(t, allowed)
+	assert.Greater(t, retryAfter, time.Duration(0))
+
+	allowed, _ = limiter.Allow("other@gapef.com.ar")
+	assert.True(t, allowed)
+}
+
+func TestEmailRateLimiterForgetsExpiredAddresses(t *testing.T) {
+	now := time.Now()
+	limiter := newEmailRateLimiter(time.Hour, 2, 0)
+	limiter.now = func() time.Time { return now }
+
+	limiter.Allow("swimmer@gapef.com.ar")
+	now = now.Add(30 * time.Minute)
+	limiter.Allow("other@gapef.com.ar")
+
+	// the first address has no requests inside the window, the second one still has
+	now = now.Add(45 * time.Minute)
+	limiter.Allow("coach@gapef.com.ar")
+
+	assert.NotContains(t, limiter.requests, "swimmer@gapef.com.ar")
+	assert.Contains(t, limiter.requests, "other@gapef.com.ar")
+	assert.Len(t, limiter.requests, 2)
+}
+
+func TestUnverifiedTokenOnlyAccessesOwnProfile(t *testing.T) {
+	e := newEcho()
+	e.Use(CustomJwtMiddleware)
+	e.GET(PATH_USER, func(c echo.Context) error { return c.NoContent(http.StatusOK) })
+	e.GET(PATH_USERS, func(c echo.Context) error { return c.NoContent(http.StatusOK) })
+
+	token, _ := generateJWT(Entity{Id: "1", Username: "swimmer", Role: constants.ROLE_ATLETHE})
+
+	testCases := map[string]int{
+		"/users/1": http.StatusOK,
+		"/users/2": http.StatusForbidden,
+		"/users":   http.StatusForbidden,
+	}
+
+	for path, expectedStatus := range testCases {
+		request := httptest.NewRequest(http.MethodGet, path, strings.NewReader(""))
+		request.Header.Set(AUTHORIZATION_HEADER, BEARER_PREFIX+token)
+
+		recorder := httptest.NewRecorder()
+		e.ServeHTTP(recorder, request)
+
+		assert.Equal(t, expectedStatus, recorder.Code, path)
+	}
+}